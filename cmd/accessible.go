@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// accessible is set when the TUI should suit a screen reader: no colors,
+// borders or animations, and the field being edited is said in words
+var accessible bool
+
+// applyAccessible turns the styles plain. A screen reader can't see colors
+// and reads the lines of a box out as a row of symbols, so we leave them out.
+func applyAccessible() {
+
+	accessible = true
+	accentColor, mutedColor, focusColor, borderColor = lipgloss.NoColor{}, lipgloss.NoColor{}, lipgloss.NoColor{}, lipgloss.NoColor{}
+	bodyBordered = false
+
+	inputStyle = lipgloss.NewStyle()
+	continueStyle = lipgloss.NewStyle()
+	focusStyle = lipgloss.NewStyle()
+	errorStyle = lipgloss.NewStyle()
+	spellStyle = lipgloss.NewStyle()
+}
+
+// plainDelegate renders the items of a list without the bar next to the
+// selected one, which is marked with a > instead
+func plainDelegate() list.DefaultDelegate {
+
+	d := list.NewDefaultDelegate()
+	d.Styles.NormalTitle = lipgloss.NewStyle().PaddingLeft(2)
+	d.Styles.NormalDesc = lipgloss.NewStyle().PaddingLeft(2)
+	d.Styles.SelectedTitle = lipgloss.NewStyle().SetString(">")
+	d.Styles.SelectedDesc = lipgloss.NewStyle().PaddingLeft(2)
+	d.Styles.DimmedTitle = lipgloss.NewStyle().PaddingLeft(2)
+	d.Styles.DimmedDesc = lipgloss.NewStyle().PaddingLeft(2)
+	d.Styles.FilterMatch = lipgloss.NewStyle()
+
+	return d
+}
+
+// announcement says in words which field is being edited and what's wrong
+// with the form, on a line of its own at the bottom of the screen. It only
+// changes when they do, so a screen reader doesn't repeat it as you type.
+func (m model) announcement() string {
+
+	if !accessible {
+		return ""
+	}
+
+	name := func(field int) string {
+		return strings.TrimRight(tr(fieldLabels[field]), ": ")
+	}
+
+	line := trf("Editing %s, field %d of %d.", name(m.focused), m.focused+1, body+1)
+	for field := to; field < body; field++ {
+		if err := m.fieldErr(field); err != nil {
+			line += " " + trf("Error in %s: %s.", name(field), err)
+		}
+	}
+	if m.err != nil {
+		line += " " + trf("Error: %s", m.err)
+	}
+
+	return "\n" + line
+}
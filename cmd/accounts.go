@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// accountInfo is an account as go-mailer accounts -json prints it
+type accountInfo struct {
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Identities []string `json:"identities,omitempty"`
+	Backend    string   `json:"backend"`
+	SendsWith  string   `json:"sends_with"`
+	Default    bool     `json:"default"`
+}
+
+// accountsCommand lists the accounts in the config, the first one being
+// the one used when no -account is given
+//
+//	go-mailer accounts [-json]
+func accountsCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("accounts", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the accounts as JSON, one per line")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: go-mailer accounts [-json]")
+	}
+
+	for i, a := range cfg.Accounts {
+		info := accountInfo{Name: a.Name, Address: a.Address, Backend: a.BackendName(), SendsWith: sendsWith(a), Default: i == 0}
+		for _, id := range a.Identities {
+			info.Identities = append(info.Identities, id.Address)
+		}
+
+		if *asJSON {
+			if err := printJSON(info); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line := fmt.Sprintf("%s\t%s", info.Name, info.Address)
+		if len(info.Identities) > 0 {
+			line += " (also " + strings.Join(info.Identities, ", ") + ")"
+		}
+		line += fmt.Sprintf(", reads with %s and sends with %s", info.Backend, info.SendsWith)
+		if info.Default {
+			line += ", the default"
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+// sendsWith names the transport newTransport picks for the account, without setting it up
+func sendsWith(a config.Account) string {
+
+	switch {
+	case a.BackendName() == config.BackendJMAP:
+		return "jmap"
+	case a.Gmail.Enabled():
+		return "gmail"
+	case a.Graph.Enabled():
+		return "graph"
+	case a.SMTP.Enabled():
+		return "smtp"
+	}
+	return "nothing"
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/htmltext"
+)
+
+// htmlStart matches the start of a body written in HTML, e.g. pasted from
+// a browser or filled in from a template
+var htmlStart = regexp.MustCompile(`(?i)^\s*<(!doctype\s+html|html|head|body|div|p|table|h[1-6]|ul|ol|blockquote|span|a|b|strong|em|br|img)\b`)
+
+// isHTML reports whether the body is HTML rather than text
+func isHTML(body string) bool {
+	return htmlStart.MatchString(body) && strings.HasSuffix(strings.TrimSpace(body), ">")
+}
+
+// alternativeBody returns the two versions of an HTML body: the HTML with
+// the signature added, and a plain text version made from it. Mail that is
+// only HTML is more likely to be taken for spam, and not everyone reads HTML.
+func alternativeBody(body, signature, signatureHTML string) (text, htmlText string) {
+
+	text = htmltext.Render(body, htmltext.Plain)
+	if signature != "" {
+		text = appendSignature(text, signature)
+	}
+
+	// a signature only written as text is shown the way it is written
+	if signatureHTML == "" && signature != "" {
+		signatureHTML = strings.ReplaceAll(html.EscapeString(signature), "\n", "<br>\n")
+	}
+	if signatureHTML == "" {
+		return text, body
+	}
+
+	sig := "<div>-- <br>\n" + signatureHTML + "\n</div>\n"
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return text, body[:i] + sig + body[i:]
+	}
+	return text, strings.TrimRight(body, "\n") + "\n" + sig
+}
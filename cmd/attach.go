@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aidk/go-mailer/pkg/email"
+
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// attachModel browses the files on disk to pick one to attach
+type attachModel struct {
+	picker filepicker.Model
+	err    error
+}
+
+// newAttach returns a file picker starting in the directory go-mailer was started from
+func newAttach() attachModel {
+
+	fp := filepicker.New()
+	if dir, err := os.Getwd(); err == nil {
+		fp.CurrentDirectory = dir
+	}
+	fp.AutoHeight = false
+	fp.Height = defaultEditorHeight * 2
+
+	// esc goes back to the message, so it can't go up a directory as well
+	fp.KeyMap.Back = key.NewBinding(key.WithKeys("h", "backspace", "left"), key.WithHelp("h", "back"))
+
+	fp.Styles.Cursor = lipgloss.NewStyle().Foreground(accentColor)
+	fp.Styles.Selected = lipgloss.NewStyle().Foreground(accentColor).Bold(true)
+	fp.Styles.Directory = lipgloss.NewStyle().Foreground(focusColor)
+	fp.Styles.Permission = continueStyle
+	fp.Styles.FileSize = continueStyle.Copy().Width(7).Align(lipgloss.Right)
+	fp.Styles.EmptyDirectory = continueStyle.Copy().PaddingLeft(2).SetString("There are no files here.")
+
+	return attachModel{picker: fp}
+}
+
+// open shows the files of the directory we were last in, it may have changed since
+func (a *attachModel) open() tea.Cmd {
+	a.err = nil
+	return a.picker.Init()
+}
+
+// resize gives the list of files the rows the title and the help leave free
+func (a *attachModel) resize(height int) {
+	a.picker.Height = max(height-6, minEditorHeight)
+}
+
+// updateAttach handles messages while a file to attach is being picked
+func (m model) updateAttach(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	a := &m.attach
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+
+		// we'll handle esc to go back to the message without attaching anything
+		case msg.Type == tea.KeyEsc:
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle . to show the hidden files, or hide them again
+		case msg.String() == ".":
+			a.picker.ShowHidden = !a.picker.ShowHidden
+			return m, a.picker.Init()
+
+		// we'll handle ctrl+c to quit the program
+		case key.Matches(msg, m.keys.quit):
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	a.picker, cmd = a.picker.Update(msg)
+
+	// we'll attach the file once one has been picked, and go back to the message
+	if ok, path := a.picker.DidSelectFile(msg); ok {
+		file, err := readAttachment(path)
+		if err != nil {
+			a.err = err
+			return m, cmd
+		}
+		m.attachments = append(m.attachments, file)
+		m.status = fmt.Sprintf("Attached %s (%s)", file.Filename, email.FormatSize(len(file.Data)))
+
+		// we'll warn straight away when the attachments make the message too big to be delivered
+		total := 0
+		for _, f := range m.attachments {
+			total += len(f.Data)
+		}
+		if total > m.cfg.MaxSize() {
+			m.status += fmt.Sprintf(", the attachments come to %s, more than the limit of %s", email.FormatSize(total), email.FormatSize(m.cfg.MaxSize()))
+		}
+		m.screen = composeScreen
+	}
+
+	return m, cmd
+}
+
+// viewAttach renders the files of the directory we're in
+func (m model) viewAttach() string {
+
+	a := m.attach
+
+	view := fmt.Sprintf("\n  %s %s\n\n%s\n  %s\n",
+		focusStyle.Render("Attach a file from"),
+		inputStyle.Render(a.picker.CurrentDirectory),
+		a.picker.View(),
+		continueStyle.Render("(↑/↓ to move, → to open a folder, ← to go up, enter to attach, . for hidden files, esc to go back)"))
+
+	if a.err != nil {
+		view += "  " + errorStyle.Render(a.err.Error()) + "\n"
+	}
+
+	return view
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/audit"
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// auditCommand lists the attempts at sending mail in the audit log, after
+// checking that none of them were changed
+//
+//	go-mailer audit [-account name] [-to address] [-since 2024-03-01] [-json] [-verify]
+func auditCommand(args []string) error {
+
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	account := fs.String("account", "", "only list what this account sent")
+	to := fs.String("to", "", "only list messages to this address")
+	since := fs.String("since", "", "only list attempts from this day on, e.g. 2024-03-01")
+	asJSON := fs.Bool("json", false, "print the entries as JSON, one per line")
+	verify := fs.Bool("verify", false, "only check the log, and print the hash of its last entry")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: go-mailer audit [-account name] [-to address] [-since 2024-03-01] [-json] [-verify]")
+	}
+
+	var from time.Time
+	if *since != "" {
+		var err error
+		if from, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+			return fmt.Errorf("-since should be a day like 2024-03-01")
+		}
+	}
+
+	path, err := config.AuditPath()
+	if err != nil {
+		return err
+	}
+	entries, err := audit.Read(path)
+	if err != nil {
+		return err
+	}
+	broken := audit.Verify(entries)
+
+	if *verify {
+		if broken != nil {
+			return fmt.Errorf("the audit log has been tampered with: %w", broken)
+		}
+		last := "none"
+		if len(entries) > 0 {
+			last = entries[len(entries)-1].Hash
+		}
+		fmt.Printf("%d entries, none of them changed, the last one's hash is %s\n", len(entries), last)
+		return nil
+	}
+
+	for _, e := range entries {
+		if (*account != "" && e.Account != *account) || e.Time.Before(from) || (*to != "" && !sentTo(e, *to)) {
+			continue
+		}
+
+		if *asJSON {
+			if err := printJSON(e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line := fmt.Sprintf("%s  %-9s %s via %s, %s to %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Result, e.Account, e.Transport, e.From, strings.Join(e.To, ", "))
+		if e.MessageID != "" {
+			line += " " + e.MessageID
+		}
+		if e.Error != "" {
+			line += ": " + e.Error
+		}
+		fmt.Println(line)
+	}
+
+	// what was listed is still worth seeing, but nobody should rely on it
+	if broken != nil {
+		return fmt.Errorf("the audit log has been tampered with: %w", broken)
+	}
+
+	return nil
+}
+
+// sentTo reports whether the entry went to the address
+func sentTo(e audit.Entry, addr string) bool {
+	for _, rcpt := range e.To {
+		if strings.EqualFold(rcpt, addr) {
+			return true
+		}
+	}
+	return false
+}
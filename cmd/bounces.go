@@ -0,0 +1,154 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/dsn"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/store"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bouncesMsg is sent once the inbox has been searched for bounces
+type bouncesMsg struct {
+	found int // how many recipients the new bounces were about
+}
+
+// bounceSubjects are what the subjects of bounces usually start with or
+// contain, for servers that don't send them from a mailer daemon
+var bounceSubjects = []string{
+	"undeliverable",
+	"undelivered mail",
+	"delivery status notification",
+	"delivery failure",
+	"failure notice",
+	"returned mail",
+	"mail delivery failed",
+}
+
+// mightBounce reports whether the envelope looks like a bounce, so only those
+// messages are fetched to find out
+func mightBounce(e mailbox.Envelope) bool {
+
+	from := strings.ToLower(e.From)
+	if strings.Contains(from, "mailer-daemon") || strings.Contains(from, "postmaster") {
+		return true
+	}
+
+	subject := strings.ToLower(e.Subject)
+	for _, s := range bounceSubjects {
+		if strings.Contains(subject, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// findBounces fetches the messages in the inbox that look like bounces in
+// the background, and keeps what the delivery status notifications among
+// them say about the messages we sent. Messages looked at before are skipped.
+func (i inboxModel) findBounces(envelopes []mailbox.Envelope) tea.Cmd {
+
+	var candidates []mailbox.Envelope
+	for _, e := range envelopes {
+		// ids are only unique within a folder
+		if id := i.folder + "/" + e.ID; !i.checked[id] && mightBounce(e) {
+			i.checked[id] = true
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	account, folder := *i.account, i.folder
+	return func() tea.Msg {
+		found, err := saveBounces(account, folder, candidates)
+		if err != nil {
+			slog.Error("Could not look for bounces", "err", err)
+		}
+		return bouncesMsg{found: found}
+	}
+}
+
+// saveBounces fetches the candidates and saves the bounces in the reports
+// among them to the account's store, returning how many it saved
+func saveBounces(account config.Account, folder string, candidates []mailbox.Envelope) (int, error) {
+
+	dir, err := account.StoreDir()
+	if err != nil {
+		return 0, err
+	}
+	s, err := store.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	known, err := s.Bounces()
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(known))
+	for _, b := range known {
+		seen[b.ReportID] = true
+	}
+
+	var bounces []store.Bounce
+	for _, e := range candidates {
+		// a report without a Message-ID of its own goes by its id in the mailbox
+		reportID := e.MessageID
+		if reportID == "" {
+			reportID = e.ID
+		}
+		if seen[reportID] {
+			continue
+		}
+
+		raw, err := fetchMessage(account, folder, e.ID)
+		if err != nil {
+			// one message we can't fetch shouldn't stop us looking at the others
+			slog.Error("Could not fetch a possible bounce", "id", e.ID, "err", err)
+			continue
+		}
+
+		report, ok := dsn.Parse(raw)
+		if !ok || report.OriginalID == "" {
+			continue
+		}
+
+		received := e.Date
+		if received.IsZero() {
+			received = time.Now()
+		}
+		for _, r := range report.Recipients {
+			if !r.Failed() {
+				continue
+			}
+			bounces = append(bounces, store.Bounce{
+				ReportID:   reportID,
+				OriginalID: report.OriginalID,
+				Recipient:  r.Address,
+				Status:     r.Status,
+				Diagnostic: r.Diagnostic,
+				Received:   received,
+			})
+		}
+	}
+
+	if len(bounces) == 0 {
+		return 0, nil
+	}
+	return len(bounces), s.SaveBounces(bounces)
+}
+
+// bouncesByMessage groups bounces by the Message-ID of the message that bounced
+func bouncesByMessage(bounces []store.Bounce) map[string][]store.Bounce {
+	byID := make(map[string][]store.Bounce)
+	for _, b := range bounces {
+		byID[b.OriginalID] = append(byID[b.OriginalID], b)
+	}
+	return byID
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aidk/go-mailer/internal/paths"
+	"github.com/aidk/go-mailer/pkg/testutil"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// capture is the server every message goes to with --capture, nil otherwise
+var capture *testutil.Server
+
+// startCapture starts the server that takes the messages instead of the
+// accounts' servers, it keeps them in captured in the data directory
+func startCapture() error {
+
+	dir, err := paths.Data()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "captured")
+
+	s, err := testutil.NewServer()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveTo(dir); err != nil {
+		s.Close()
+		return err
+	}
+
+	capture = s
+	fmt.Fprintf(os.Stderr, "Capturing messages in %s, nothing is sent\n", dir)
+	return nil
+}
+
+// stopCapture stops the capture server, if there is one
+func stopCapture() {
+	if capture != nil {
+		capture.Close()
+	}
+}
+
+// captureTransport hands messages to the capture server. It is SMTP like
+// any other, apart from its name, which is what ends up in the sent history.
+type captureTransport struct {
+	transport.SMTP
+}
+
+func (t captureTransport) Name() string {
+	return "capture"
+}
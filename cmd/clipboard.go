@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// the sequences that turn bracketed paste on and off. The terminal then
+// wraps what is pasted into it in ESC [ 200 ~ and ESC [ 201 ~, so a pasted
+// line break isn't taken for enter.
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+)
+
+// pastedMsg is sent when what is on the clipboard has been read
+type pastedMsg struct {
+	text string
+	err  error
+}
+
+// copiedMsg is sent when the field has been put on the clipboard
+type copiedMsg struct {
+	field    int
+	terminal bool // no tool was found, so the terminal was asked to copy it
+	err      error
+}
+
+// pasteMark reports whether the message starts or ends a bracketed paste.
+// Bubble Tea doesn't know these sequences yet and passes them on as unknown
+// ones, which print as ?CSI[50 48 48 126]? and ?CSI[50 48 49 126]?.
+func pasteMark(msg tea.Msg) (start, ok bool) {
+
+	s, isStringer := msg.(fmt.Stringer)
+	if !isStringer {
+		return false, false
+	}
+	switch s.String() {
+	case "?CSI[50 48 48 126]?":
+		return true, true
+	case "?CSI[50 48 49 126]?":
+		return false, true
+	}
+	return false, false
+}
+
+// updatePasting collects the keys of a bracketed paste, and once it ends
+// puts what was pasted into the field being edited
+func (m model) updatePasting(msg tea.Msg) (tea.Model, tea.Cmd, bool) {
+
+	if start, ok := pasteMark(msg); ok {
+		if start {
+			m.pasting, m.pasted = m.screen == composeScreen, ""
+			return m, nil, m.pasting
+		}
+		if !m.pasting {
+			return m, nil, false
+		}
+		m.pasting = false
+		m.paste(m.pasted)
+		return m, nil, true
+	}
+
+	key, ok := msg.(tea.KeyMsg)
+	if !ok || !m.pasting {
+		return m, nil, false
+	}
+
+	switch key.Type {
+	case tea.KeyRunes:
+		m.pasted += string(key.Runes)
+	case tea.KeySpace:
+		m.pasted += " "
+	case tea.KeyEnter, tea.KeyCtrlJ:
+		m.pasted += "\n"
+	case tea.KeyTab:
+		m.pasted += "\t"
+	}
+	return m, nil, true
+}
+
+// pasteClipboard reads the clipboard in the background, to paste it into the field being edited
+func pasteClipboard() tea.Msg {
+	text, err := clipboard.Read()
+	return pastedMsg{text: text, err: err}
+}
+
+// copyField puts what is in the field being edited on the clipboard. With
+// no tool to do it we ask the terminal, which works over ssh too.
+func (m model) copyField() tea.Cmd {
+
+	field := m.focused
+	text := m.editor.Value()
+	if field != body {
+		text = m.inputs[field].Value()
+	}
+	if text == "" {
+		return func() tea.Msg { return copiedMsg{field: field, err: errors.New("there's nothing to copy")} }
+	}
+
+	return func() tea.Msg {
+		err := clipboard.Write(text)
+		if errors.Is(err, clipboard.ErrUnavailable) {
+			fmt.Fprint(os.Stdout, clipboard.OSC52(text))
+			return copiedMsg{field: field, terminal: true}
+		}
+		return copiedMsg{field: field, err: err}
+	}
+}
+
+// paste puts the text into the field being edited, where the cursor is. The
+// body keeps its lines, the recipients pasted one per line are separated by
+// commas and the other fields take it as one line.
+func (m *model) paste(text string) {
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if text == "" {
+		return
+	}
+
+	if m.focused == body {
+		m.editor.InsertString(text)
+		return
+	}
+
+	var parts []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	sep := " "
+	if m.focused == to {
+		sep = ", "
+	}
+	text = strings.ReplaceAll(strings.Join(parts, sep), "\t", " ")
+
+	input := &m.inputs[m.focused]
+	value := []rune(input.Value())
+	pos := input.Position()
+	input.SetValue(string(value[:pos]) + text + string(value[pos:]))
+	input.SetCursor(pos + len([]rune(text)))
+}
+
+// status says what was copied, or why it wasn't
+func (msg copiedMsg) status() string {
+
+	name := []string{to: "recipients", from: "sender", subject: "subject", sendAt: "send time", body: "body"}[msg.field]
+	switch {
+	case msg.err != nil:
+		return "Could not copy the " + name + ": " + msg.err.Error()
+	case msg.terminal:
+		return "Asked the terminal to copy the " + name
+	}
+	return "Copied the " + name
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/mbox"
+	"github.com/aidk/go-mailer/internal/store"
+)
+
+// command is one of the things go-mailer does instead of starting the TUI
+type command struct {
+	name    string
+	summary string
+	run     func(cfg *config.Config, args []string) error
+
+	// flags and words are what the shell completions offer after it, words
+	// being what can come first after the command, e.g. contacts' import
+	flags []string
+	words []string
+}
+
+// commands lists the commands in the order help shows them. compose and
+// help are run by main and runCommand themselves.
+var commands = []command{
+	{name: "compose", summary: "write a message in the TUI, the same as no command, starting from a message file if one is given"},
+	{name: "send", summary: "send a message without the TUI", run: sendCommand,
+		flags: []string{"account", "to", "from", "reply-to", "subject", "body-file", "attach", "json", "dry-run", "no-signature", "read-receipt", "delivery-report"}},
+	{name: "merge", summary: "send a template to everyone in a CSV file", run: mergeCommand,
+		flags: []string{"account", "template", "rate", "column", "json", "no-signature", "unsubscribe-mailto", "unsubscribe-url"}},
+	{name: "queue", summary: "list, send, retry or cancel the messages in the outbox", run: queueCommand,
+		flags: []string{"account", "json"}, words: []string{"list", "flush", "retry", "cancel"}},
+	{name: "contacts", summary: "import vCards into the address book or list it", run: func(_ *config.Config, args []string) error { return contactsCommand(args) },
+		words: []string{"import", "list"}},
+	{name: "accounts", summary: "list the accounts in the config", run: accountsCommand,
+		flags: []string{"json"}},
+	{name: "serve", summary: "take messages to send over HTTP", run: serveCommand,
+		flags: []string{"listen", "token-file", "insecure"}},
+	{name: "export", summary: "write a local folder to an mbox file", run: exportCommand,
+		flags: []string{"account", "folder"}},
+	{name: "import", summary: "fill a local folder from an mbox file", run: importCommand,
+		flags: []string{"account", "folder"}},
+	{name: "audit", summary: "list the audit log or check it", run: func(_ *config.Config, args []string) error { return auditCommand(args) },
+		flags: []string{"account", "to", "since", "json", "verify"}},
+	{name: "gmail-auth", summary: "let go-mailer send through the Gmail API", run: gmailAuthCommand,
+		flags: []string{"account"}},
+	{name: "graph-auth", summary: "let go-mailer send through Microsoft Graph", run: graphAuthCommand,
+		flags: []string{"account"}},
+	{name: "completion", summary: "print the bash, zsh or fish completions", run: func(_ *config.Config, args []string) error { return completionCommand(args) },
+		words: []string{"bash", "zsh", "fish"}},
+	{name: "help", summary: "list the commands"},
+}
+
+// findCommand returns the command with the given name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// runCommand runs one of the non interactive commands instead of the TUI
+func runCommand(cfg *config.Config, name string, args []string) error {
+
+	if name == "help" || name == "-help" || name == "--help" || name == "-h" {
+		printHelp()
+		return nil
+	}
+
+	c, ok := findCommand(name)
+	if !ok || c.run == nil {
+		return fmt.Errorf("unknown command %q, go-mailer help lists them", name)
+	}
+	return c.run(cfg, args)
+}
+
+// printHelp lists the commands, each command's -h tells about its flags
+func printHelp() {
+
+	fmt.Println("usage: go-mailer [--capture] [--verbose] [--accessible] [--lang code] [command] [flags]")
+	fmt.Println()
+	fmt.Println("Without a command go-mailer starts the TUI. The commands are:")
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	w.Flush()
+}
+
+// openStore opens the local store of the named account
+func openStore(cfg *config.Config, name string) (*store.Store, error) {
+
+	account, err := cfg.Account(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := account.StoreDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Open(dir)
+}
+
+// exportCommand writes every message in a local folder to an mbox file
+//
+//	go-mailer export [-account name] [-folder Sent] file.mbox
+func exportCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	account := fs.String("account", "", "account to export from, defaults to the first one")
+	folder := fs.String("folder", store.Sent, "folder to export, e.g. Sent or Drafts")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: go-mailer export [-account name] [-folder Sent] file.mbox")
+	}
+
+	s, err := openStore(cfg, *account)
+	if err != nil {
+		return err
+	}
+	dir := s.Folder(store.FolderName(*folder))
+
+	keys, err := dir.Keys()
+	if err != nil {
+		return err
+	}
+
+	// we append so exporting into an existing mbox doesn't destroy it
+	f, err := os.OpenFile(fs.Arg(0), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := mbox.NewWriter(f)
+
+	// keys are newest first, but mbox files are conventionally oldest first
+	for i := len(keys) - 1; i >= 0; i-- {
+		raw, err := dir.Get(keys[i])
+		if err != nil {
+			return err
+		}
+
+		sender, date := separatorInfo(raw)
+		if err := w.WriteMessage(sender, date, raw); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d messages to %s\n", len(keys), fs.Arg(0))
+	return f.Close()
+}
+
+// separatorInfo returns the sender address and date used in a message's mbox From line
+func separatorInfo(raw []byte) (string, time.Time) {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", time.Now()
+	}
+
+	date, err := msg.Header.Date()
+	if err != nil {
+		date = time.Now()
+	}
+
+	// the return path is the real envelope sender, if we have it
+	for _, h := range []string{"Return-Path", "From"} {
+		if addr, err := mail.ParseAddress(msg.Header.Get(h)); err == nil {
+			return addr.Address, date
+		}
+	}
+
+	return "", date
+}
+
+// importCommand copies every message in an mbox file into a local folder
+//
+//	go-mailer import [-account name] [-folder INBOX] file.mbox
+func importCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	account := fs.String("account", "", "account to import into, defaults to the first one")
+	folder := fs.String("folder", store.Inbox, "folder to import into")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: go-mailer import [-account name] [-folder INBOX] file.mbox")
+	}
+
+	s, err := openStore(cfg, *account)
+	if err != nil {
+		return err
+	}
+
+	dir := s.Folder(store.FolderName(*folder))
+	if err := dir.Init(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := mbox.NewReader(f)
+	count := 0
+	for {
+		raw, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read message %d: %w", count+1, err)
+		}
+
+		// imported mail has already been read somewhere else
+		if _, err := dir.Deliver(raw, string(store.FlagSeen)); err != nil {
+			return err
+		}
+		count++
+	}
+
+	fmt.Printf("Imported %d messages into %s\n", count, dir)
+	return nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aidk/go-mailer/internal/carddav"
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/contacts"
+	"github.com/aidk/go-mailer/internal/ldap"
+	"github.com/aidk/go-mailer/internal/store"
+)
+
+// As an address is typed in the To field we suggest people to send to, from
+// those we've sent mail to before and the address book straight away, and
+// from the account's CardDAV server or LDAP directory once the typing
+// pauses, so we don't ask on every key.
+
+// how many letters have to be typed before we suggest anyone, how many
+// suggestions we show and how long the typing has to pause for before we
+// ask the directories
+const (
+	minQuery      = 2
+	maxSuggested  = 5
+	lookupDelay   = 300 * time.Millisecond
+	lookupTimeout = 5 * time.Second
+)
+
+// suggestion is an address which could be put in the To field
+type suggestion struct {
+	name string
+	addr string
+}
+
+// completeModel keeps track of the suggestions for the address being typed
+type completeModel struct {
+	account     *config.Account
+	book        *contacts.Book
+	recent      []store.Recipient // who we've sent mail to, the most often and recently first
+	query       string            // the address being typed
+	dismissed   string            // the query the user closed the suggestions for with esc
+	suggestions []suggestion
+	selected    int
+	looking     bool // whether the directories are being asked
+	err         error
+
+	// what the directories answered for each query, so going back over
+	// what you typed doesn't ask them again
+	remote map[string][]contacts.Contact
+}
+
+// lookupTickMsg is sent once the typing has paused, if the query is still the same we ask the directories
+type lookupTickMsg struct {
+	query string
+}
+
+// lookupMsg carries what the directories found for a query
+type lookupMsg struct {
+	query   string
+	results []contacts.Contact
+	err     error
+}
+
+// newComplete loads the address book, without one we only have the directories to go on
+func newComplete(account *config.Account) completeModel {
+
+	c := completeModel{account: account, remote: make(map[string][]contacts.Contact)}
+
+	path, err := config.ContactsPath()
+	if err == nil {
+		c.book, err = contacts.Open(path)
+	}
+	if err != nil {
+		slog.Error("Could not open the address book", "err", err)
+	}
+
+	return c
+}
+
+// loadRecent reads who we've sent mail to, it is read again for every
+// address typed so what was sent a moment ago is in it
+func (c *completeModel) loadRecent() {
+
+	if c.account == nil {
+		return
+	}
+	dir, err := c.account.StoreDir()
+	if err != nil {
+		return
+	}
+	s, err := store.Open(dir)
+	if err == nil {
+		c.recent, err = s.Recipients()
+	}
+	if err != nil {
+		slog.Error("Could not read the recipients", "err", err)
+	}
+}
+
+// local returns the recipients and the contacts in the address book that
+// match the query, the recipients first. The address book has the names
+// of the recipients we only know the address of.
+func (c completeModel) local(query string) []contacts.Contact {
+
+	var found []contacts.Contact
+	if len(c.recent) > 0 {
+		recent := &contacts.Book{}
+		for _, r := range c.recent {
+			recent.Contacts = append(recent.Contacts, contacts.Contact{Name: r.Name, Emails: []string{r.Address}})
+		}
+		found = recent.Search(query)
+	}
+	if c.book == nil {
+		return found
+	}
+
+	for i, r := range found {
+		if r.Name != "" {
+			continue
+		}
+		for _, b := range c.book.Search(r.Emails[0]) {
+			if b.Name != "" && hasAddress(b, r.Emails[0]) {
+				found[i].Name = b.Name
+				break
+			}
+		}
+	}
+	return append(found, c.book.Search(query)...)
+}
+
+// hasAddress reports whether the contact has the address
+func hasAddress(c contacts.Contact, addr string) bool {
+	for _, e := range c.Emails {
+		if strings.EqualFold(e, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sentTo returns how many messages went to the address, and when the last one did
+func (c completeModel) sentTo(addr string) (store.Recipient, bool) {
+	for _, r := range c.recent {
+		if strings.EqualFold(r.Address, addr) {
+			return r, true
+		}
+	}
+	return store.Recipient{}, false
+}
+
+// showing reports whether there are suggestions on the screen
+func (c completeModel) showing() bool {
+	return len(c.suggestions) > 0 && c.query != c.dismissed
+}
+
+// lastAddress splits the To field into the addresses already entered and the one being typed
+func lastAddress(value string) (done, typing string) {
+
+	i := strings.LastIndex(value, ",")
+	if i < 0 {
+		return "", strings.TrimSpace(value)
+	}
+
+	return value[:i+1], strings.TrimSpace(value[i+1:])
+}
+
+// trimAddressList drops the comma left at the end of the To field after picking a suggestion
+func trimAddressList(value string) string {
+	return strings.TrimRight(strings.TrimSpace(value), ", ")
+}
+
+// suggest works out what to suggest for what is in the To field now, the
+// command it returns waits for the typing to pause before asking the directories
+func (m *model) suggest() tea.Cmd {
+
+	// we only suggest while the end of the To field is being typed
+	input := m.inputs[to]
+	query := ""
+	if m.focused == to && input.Position() == len([]rune(input.Value())) {
+		_, query = lastAddress(input.Value())
+	}
+	if len([]rune(query)) < minQuery {
+		query = ""
+	}
+
+	c := &m.complete
+	if query == c.query {
+		return nil
+	}
+	if c.query == "" && query != "" {
+		c.loadRecent()
+	}
+	c.query, c.selected, c.err = query, 0, nil
+	if query == "" {
+		c.suggestions, c.looking = nil, false
+		return nil
+	}
+
+	remote, cached := c.remote[strings.ToLower(query)]
+	c.suggestions = m.suggestions(append(c.local(query), remote...))
+
+	c.looking = !cached && hasDirectory(m.account)
+	if !c.looking {
+		return nil
+	}
+
+	return tea.Tick(lookupDelay, func(time.Time) tea.Msg {
+		return lookupTickMsg{query: query}
+	})
+}
+
+// suggestions turns the contacts found into addresses to suggest, leaving
+// out any already in the To field and any found twice
+func (m *model) suggestions(found []contacts.Contact) []suggestion {
+
+	seen := make(map[string]bool)
+	done, _ := lastAddress(m.inputs[to].Value())
+	if addrs, err := parseAddressList(trimAddressList(done)); err == nil {
+		for _, a := range addrs {
+			seen[strings.ToLower(a.Address)] = true
+		}
+	}
+
+	var out []suggestion
+	for _, c := range found {
+		for _, addr := range c.Emails {
+			if seen[strings.ToLower(addr)] {
+				continue
+			}
+			seen[strings.ToLower(addr)] = true
+			out = append(out, suggestion{name: c.Name, addr: addr})
+			if len(out) == maxSuggested {
+				return out
+			}
+		}
+	}
+
+	return out
+}
+
+// hasDirectory reports whether the account has a CardDAV server or LDAP directory to ask
+func hasDirectory(account *config.Account) bool {
+	return account != nil && (account.CardDAV.Enabled() || account.LDAP.Enabled())
+}
+
+// lookup asks the account's directories for the query in the background
+func lookup(account *config.Account, query string) tea.Cmd {
+	return func() tea.Msg {
+
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		// one directory being down shouldn't hide what the other found
+		var (
+			results []contacts.Contact
+			errs    []string
+		)
+		if account.CardDAV.Enabled() {
+			found, err := carddav.Search(ctx, account.CardDAV, query)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			results = append(results, found...)
+		}
+		if account.LDAP.Enabled() {
+			found, err := ldap.Search(ctx, account.LDAP, query)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			results = append(results, found...)
+		}
+
+		msg := lookupMsg{query: query, results: results}
+		if len(errs) > 0 {
+			msg.err = errors.New(strings.Join(errs, "; "))
+		}
+		return msg
+	}
+}
+
+// updateLookup handles the typing pausing and the directories answering
+func (m model) updateLookup(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	c := &m.complete
+	switch msg := msg.(type) {
+
+	case lookupTickMsg:
+		// the user kept typing, so the query is out of date
+		if msg.query != c.query {
+			return m, nil
+		}
+		return m, lookup(m.account, msg.query)
+
+	case lookupMsg:
+		if msg.err != nil {
+			slog.Error("Could not search the directory", "err", msg.err)
+		} else {
+			c.remote[strings.ToLower(msg.query)] = msg.results
+		}
+		if msg.query != c.query {
+			return m, nil
+		}
+
+		// the recipients' and the address book's matches stay at the top, the directories' go below them
+		c.suggestions = m.suggestions(append(c.local(msg.query), msg.results...))
+		c.looking, c.err = false, msg.err
+	}
+
+	return m, nil
+}
+
+// updateSuggestions handles the keys for picking a suggestion, it reports
+// whether the key was one of them
+func (m *model) updateSuggestions(msg tea.KeyMsg) bool {
+
+	c := &m.complete
+	if m.focused != to || !c.showing() {
+		return false
+	}
+
+	switch msg.Type {
+	case tea.KeyUp:
+		c.selected = (c.selected - 1 + len(c.suggestions)) % len(c.suggestions)
+	case tea.KeyDown:
+		c.selected = (c.selected + 1) % len(c.suggestions)
+	case tea.KeyEsc:
+		c.dismissed = c.query
+	case tea.KeyTab:
+		// the address being typed is swapped for the one picked, with a
+		// comma after it so the next one can be typed straight away
+		done, _ := lastAddress(m.inputs[to].Value())
+		if done != "" {
+			done += " "
+		}
+		s := c.suggestions[c.selected]
+		m.inputs[to].SetValue(done + formatAddress(s.name, s.addr) + ", ")
+		m.inputs[to].CursorEnd()
+		m.suggest()
+	default:
+		return false
+	}
+
+	return true
+}
+
+// times writes a count the way it is said, once, twice or 3 times
+func times(n int) string {
+	switch n {
+	case 1:
+		return "once"
+	case 2:
+		return "twice"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// formatAddress writes an address the way it is typed, quoting the name if it needs to be
+func formatAddress(name, addr string) string {
+
+	if name == "" {
+		return addr
+	}
+	if strings.ContainsAny(name, `()<>[]:;@\,."`) {
+		name = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+
+	return name + " <" + addr + ">"
+}
+
+// suggestionList renders the suggestions below the To field
+func (m model) suggestionList() string {
+
+	c := m.complete
+	if m.focused != to || c.query == "" || c.query == c.dismissed {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, s := range c.suggestions {
+		line := formatAddress(s.name, s.addr)
+		if r, ok := c.sentTo(s.addr); ok {
+			line += fmt.Sprintf(" · sent %s, last %s", times(r.Count), r.Last.Format("2 Jan 2006"))
+		}
+		if i == c.selected {
+			b.WriteString("\n\t" + inputStyle.Render("› "+line))
+		} else {
+			b.WriteString("\n\t" + continueStyle.Render("  "+line))
+		}
+	}
+
+	switch {
+	case c.looking:
+		b.WriteString("\n\t" + continueStyle.Render("  searching the directory..."))
+	case c.err != nil && len(c.suggestions) == 0:
+		b.WriteString("\n\t" + continueStyle.Render("  could not search the directory"))
+	case len(c.suggestions) > 0:
+		b.WriteString("\n\t" + continueStyle.Render("  (up and down to choose, tab to pick, esc to close)"))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/contacts"
+)
+
+// The shell completions only hand the words being typed to go-mailer
+// __complete, which prints what could come next one per line, so the
+// account names and the addresses in the address book are always current.
+
+const bashCompletion = `# bash completion for go-mailer, e.g. in ~/.bashrc:
+#   source <(go-mailer completion bash)
+_go_mailer() {
+	local IFS=$'\n'
+	COMPREPLY=($(go-mailer __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _go_mailer go-mailer
+`
+
+const zshCompletion = `# zsh completion for go-mailer, e.g. in ~/.zshrc after compinit:
+#   source <(go-mailer completion zsh)
+_go_mailer() {
+	local -a candidates
+	candidates=("${(@f)$(go-mailer __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -- $candidates
+	else
+		_files
+	fi
+}
+compdef _go_mailer go-mailer
+`
+
+const fishCompletion = `# fish completion for go-mailer, e.g.:
+#   go-mailer completion fish > ~/.config/fish/completions/go-mailer.fish
+function __go_mailer_complete
+	go-mailer __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c go-mailer -a '(__go_mailer_complete)'
+`
+
+// completionCommand prints the completions for the shell
+//
+//	go-mailer completion bash|zsh|fish
+func completionCommand(args []string) error {
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: go-mailer completion bash|zsh|fish")
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return fmt.Errorf("no completions for %q, only for bash, zsh and fish", args[0])
+	}
+	return nil
+}
+
+// completeCommand prints what could come next on a command line, for the
+// completions. args are the words after go-mailer, the last being the one
+// being typed. It runs before anything is set up, so it doesn't ask for the
+// passphrase or write to the log, and says nothing when the config is wrong.
+func completeCommand(args []string) {
+
+	var cfg *config.Config
+	if path, err := config.DefaultPath(); err == nil {
+		cfg, _ = config.Load(path)
+	}
+
+	for _, c := range completions(cfg, args) {
+		fmt.Fprintln(os.Stdout, c)
+	}
+}
+
+// completions returns what could take the place of the last of the words
+func completions(cfg *config.Config, words []string) []string {
+
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	typing := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	// the flags that go before the command
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		// --lang takes the next word, unless it comes after an =
+		if words[0] == "--lang" || words[0] == "-lang" {
+			words = words[1:]
+		}
+		if len(words) > 0 {
+			words = words[1:]
+		}
+	}
+
+	if len(words) == 0 {
+		if strings.HasPrefix(typing, "-") {
+			return matching(typing, []string{"--capture", "--verbose", "--accessible", "--lang"})
+		}
+		var names []string
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+		return matching(typing, names)
+	}
+
+	c, ok := findCommand(words[0])
+	if !ok {
+		return nil
+	}
+	args := words[1:]
+
+	// bash makes a word of its own of the = in -to=ann
+	if len(args) > 1 && args[len(args)-1] == "=" {
+		args = args[:len(args)-1]
+	}
+
+	// the value of a flag, which can come after it or an =
+	flag, value := "", typing
+	if len(args) > 0 && strings.HasPrefix(args[len(args)-1], "-") && !strings.Contains(args[len(args)-1], "=") {
+		flag = flagName(args[len(args)-1])
+	}
+	if name, v, ok := strings.Cut(typing, "="); ok && strings.HasPrefix(typing, "-") {
+		flag, value = flagName(name), v
+	}
+	switch flag {
+	case "account":
+		return prefixed(typing, value, matching(value, accountNames(cfg)))
+	case "to", "reply-to":
+		return prefixed(typing, value, matching(value, contactAddresses()))
+	case "from":
+		return prefixed(typing, value, matching(value, accountAddresses(cfg)))
+	}
+
+	if strings.HasPrefix(typing, "-") {
+		var flags []string
+		for _, f := range c.flags {
+			flags = append(flags, "-"+f)
+		}
+		return matching(typing, flags)
+	}
+
+	// the word after the command, the flags before it aside
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			return nil
+		}
+	}
+	if c.name == "help" {
+		return nil
+	}
+	return matching(typing, c.words)
+}
+
+// flagName returns the name of a flag however it is written, e.g. account for --account=work
+func flagName(arg string) string {
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return name
+}
+
+// matching returns the candidates that start with what is being typed
+func matching(typing string, candidates []string) []string {
+
+	var found []string
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), strings.ToLower(typing)) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// prefixed puts back what came before the value being typed, e.g. the
+// -to= of -to=ann, since the shell replaces the whole word
+func prefixed(typing, value string, candidates []string) []string {
+
+	before := strings.TrimSuffix(typing, value)
+	for i := range candidates {
+		candidates[i] = before + candidates[i]
+	}
+	return candidates
+}
+
+// accountNames returns the names of the accounts in the config
+func accountNames(cfg *config.Config) []string {
+
+	if cfg == nil {
+		return nil
+	}
+	var names []string
+	for _, a := range cfg.Accounts {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+// accountAddresses returns the addresses the accounts send as
+func accountAddresses(cfg *config.Config) []string {
+
+	if cfg == nil {
+		return nil
+	}
+	var addrs []string
+	for _, a := range cfg.Accounts {
+		addrs = append(addrs, a.Address)
+		for _, id := range a.Identities {
+			addrs = append(addrs, id.Address)
+		}
+	}
+	return addrs
+}
+
+// contactAddresses returns every address in the address book
+func contactAddresses() []string {
+
+	path, err := config.ContactsPath()
+	if err != nil {
+		return nil
+	}
+	book, err := contacts.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	var addrs []string
+	for _, c := range book.Contacts {
+		addrs = append(addrs, c.Emails...)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
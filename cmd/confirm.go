@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/links"
+	"github.com/aidk/go-mailer/internal/spamcheck"
+	"github.com/aidk/go-mailer/pkg/email"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// confirmModel sums up the message before it is sent, it's too easy to
+// send one that is only half written with a single key
+type confirmModel struct {
+	to          []string
+	subject     string
+	sendAt      string // when it is scheduled for, empty when it goes now
+	attachments int
+	size        int // the size of the message as it is sent, in bytes
+	tooBig      bool
+
+	check   int               // counts the times the summary was opened, to match the spam score with the message
+	scoring bool              // whether the spam score is on its way
+	spam    *spamcheck.Report // the spam score, if the message was scored
+	spamErr error
+
+	links     []links.Link // the links in the message, to make sure they're the right ones
+	linksSeen bool         // whether we said some of the links look wrong
+}
+
+// openConfirm sums up the message in the form and asks whether to send it
+func (m model) openConfirm() (tea.Model, tea.Cmd) {
+
+	msg, err := m.newMessage()
+	if m.err = err; m.err != nil {
+		return m, nil
+	}
+
+	// the attachments grow by a third when they're encoded, so we measure
+	// the message the way it will be sent
+	raw, err := msg.bytes()
+	if m.err = err; m.err != nil {
+		return m, nil
+	}
+
+	c := confirmModel{
+		subject:     msg.subject,
+		attachments: len(msg.files),
+		size:        len(raw),
+		tooBig:      len(raw) > m.cfg.MaxSize(),
+		check:       m.confirm.check + 1,
+		links:       messageLinks(msg),
+	}
+	for _, a := range msg.to {
+		c.to = append(c.to, formatAddress(a.Name, a.Address))
+	}
+	for _, name := range []string{"Cc", "Bcc"} {
+		for _, a := range msg.copied(name) {
+			c.to = append(c.to, formatAddress(a.Name, a.Address)+" ("+strings.ToLower(name)+")")
+		}
+	}
+	if !msg.sendAt.IsZero() {
+		c.sendAt = msg.sendAt.Format("Mon 02 Jan 15:04")
+	}
+
+	var cmd tea.Cmd
+	if how := m.cfg.SpamChecks(); how != config.SpamOff {
+		c.scoring = true
+		cmd = scoreSpam(how, c.check, raw)
+	}
+
+	m.confirm = c
+	m.screen = confirmScreen
+	return m, cmd
+}
+
+// updateConfirm handles messages while we ask whether to send the message
+func (m model) updateConfirm(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+
+		// we'll handle y to send it, nothing else does so a stray key can't
+		case msg.String() == "y":
+			// links that look wrong take another y, once we've pointed them out
+			if m.confirm.doubtfulLinks() > 0 && !m.confirm.linksSeen {
+				m.confirm.linksSeen = true
+				return m, nil
+			}
+			m.screen = composeScreen
+			return m.sendNow()
+
+		// we'll handle n and esc to go back to the message
+		case msg.String() == "n" || msg.Type == tea.KeyEsc:
+			m.screen = composeScreen
+
+		// we'll handle ctrl+c to quit, the message is kept as a draft
+		case key.Matches(msg, m.keys.quit):
+			return m.quit()
+		}
+	}
+
+	return m, nil
+}
+
+// viewConfirm renders the summary of the message in a box in the middle of the screen
+func (m model) viewConfirm() string {
+
+	c := m.confirm
+
+	subject := c.subject
+	if subject == "" {
+		subject = tr("(no subject)")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", focusStyle.Render(tr("Send this message?")))
+	fmt.Fprintf(&b, "%s %s\n", inputStyle.Render(tr("To:")), strings.Join(c.to, ",\n    "))
+	fmt.Fprintf(&b, "%s %s\n", inputStyle.Render(tr("Subject:")), subject)
+	if c.sendAt != "" {
+		fmt.Fprintf(&b, "%s %s\n", inputStyle.Render(tr("Send at:")), c.sendAt)
+	}
+	fmt.Fprintf(&b, "%s %d\n", inputStyle.Render(tr("Attachments:")), c.attachments)
+	fmt.Fprintf(&b, "%s %s\n", inputStyle.Render(tr("Size:")), email.FormatSize(c.size))
+	if c.tooBig {
+		fmt.Fprintf(&b, "%s\n", errorStyle.Render(fmt.Sprintf("⚠ That's more than %s, it may be too big to be delivered", email.FormatSize(m.cfg.MaxSize()))))
+	}
+	for _, line := range m.domainLines() {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	for _, line := range m.reach.reachWarnings() {
+		fmt.Fprintf(&b, "%s\n", errorStyle.Render(line))
+	}
+	for _, line := range c.spamLines() {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	for _, line := range c.linkLines() {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	b.WriteString("\n")
+	b.WriteString(continueStyle.Render(trf("(y to send, n or esc to go back, %s %s)", keyHelp(m.keys.quit), m.keys.quit.Help().Desc)))
+
+	return m.modal(b.String())
+}
+
+// modal renders a box in the middle of the screen, for questions that have
+// to be answered before going on
+func (m model) modal(content string) string {
+
+	// a screen reader reads a box out line by line, border and all
+	if accessible {
+		return "\n" + content + "\n"
+	}
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(accentColor).
+		Padding(1, 2).
+		Render(content)
+
+	// until the terminal tells us how big it is we can't put it in the middle
+	if m.width == 0 || m.height == 0 {
+		return "\n" + lipgloss.NewStyle().MarginLeft(tabWidth).Render(box) + "\n"
+	}
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/contacts"
+	"github.com/aidk/go-mailer/internal/vcard"
+)
+
+// contactsCommand manages the address book
+//
+//	go-mailer contacts import file.vcf...
+//	go-mailer contacts list
+func contactsCommand(args []string) error {
+
+	usage := fmt.Errorf("usage: go-mailer contacts import file.vcf... or go-mailer contacts list")
+	if len(args) == 0 {
+		return usage
+	}
+
+	path, err := config.ContactsPath()
+	if err != nil {
+		return err
+	}
+	book, err := contacts.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open the address book: %w", err)
+	}
+
+	switch args[0] {
+	case "import":
+		if len(args) < 2 {
+			return usage
+		}
+		return importContacts(book, args[1:])
+
+	case "list":
+		for _, c := range book.Contacts {
+			line := c.Name
+			if c.Organization != "" {
+				line += " (" + c.Organization + ")"
+			}
+			fmt.Printf("%s\t%s\n", line, strings.Join(c.Emails, ", "))
+		}
+		return nil
+	}
+
+	return usage
+}
+
+// importContacts adds the cards in the vCard files to the address book
+func importContacts(book *contacts.Book, files []string) error {
+
+	added, updated, skipped := 0, 0, 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		cards, err := vcard.Parse(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", file, err)
+		}
+
+		for _, card := range cards {
+			c := contacts.Contact{Name: card.Name, Organization: card.Organization}
+			for _, addr := range card.Emails {
+				if a, err := mail.ParseAddress(addr); err == nil {
+					c.Emails = append(c.Emails, a.Address)
+				}
+			}
+
+			// without an address there is nothing to send mail to
+			if len(c.Emails) == 0 {
+				skipped++
+				continue
+			}
+
+			if book.Add(c) {
+				added++
+			} else {
+				updated++
+			}
+		}
+	}
+
+	if err := book.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d contacts and updated %d", added, updated)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d without an email address", skipped)
+	}
+	fmt.Println()
+	return nil
+}
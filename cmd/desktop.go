@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/aidk/go-mailer/internal/desktop"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// focusState is whether the terminal go-mailer is in is the window in front
+type focusState int
+
+const (
+	focusUnknown focusState = iota // the terminal hasn't said, it may not report its focus
+	focusIn
+	focusOut
+)
+
+// the sequences that turn the terminal's focus reports on and off, it then
+// sends ESC [ I when its window gets the focus and ESC [ O when it loses it
+const (
+	focusReportsOn  = "\x1b[?1004h"
+	focusReportsOff = "\x1b[?1004l"
+)
+
+// focusReport reports whether the message is a focus report, and which.
+// Bubble Tea doesn't know these reports yet and passes them on as unknown
+// sequences, which print as ?CSI[73]? for ESC [ I and ?CSI[79]? for ESC [ O.
+func focusReport(msg tea.Msg) (focusState, bool) {
+
+	s, ok := msg.(fmt.Stringer)
+	if !ok {
+		return focusUnknown, false
+	}
+	switch s.String() {
+	case "?CSI[73]?":
+		return focusIn, true
+	case "?CSI[79]?":
+		return focusOut, true
+	}
+	return focusUnknown, false
+}
+
+// notifyDesktop shows a desktop notification in the background, when notifications
+// are on and go-mailer isn't the window in front. Terminals that don't
+// report their focus get every notification.
+func (m model) notifyDesktop(title, body string) tea.Cmd {
+
+	if !m.cfg.Notify || m.focus == focusIn {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if err := desktop.Notify(title, body); err != nil {
+			slog.Error("Could not show a notification", "err", err)
+		}
+		return nil
+	}
+}
+
+// plural returns "1 message" or "2 messages"
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
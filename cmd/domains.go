@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/domains"
+)
+
+// domainWarning is a recipient whose domain looks wrong, either a typo of
+// a common one or a provider of throwaway addresses
+type domainWarning struct {
+	addr       string
+	domain     string
+	suggestion string // the domain it was most likely meant to be, if it's a typo
+}
+
+// domainWarnings checks the domains of the addresses in the To field
+func (m model) domainWarnings() []domainWarning {
+
+	addrs, err := parseAddressList(trimAddressList(m.inputs[to].Value()))
+	if err != nil {
+		return nil
+	}
+
+	var warnings []domainWarning
+	for _, a := range addrs {
+		domain := strings.ToLower(domainOf(a.Address))
+		if suggestion, ok := domains.Suggest(domain); ok {
+			warnings = append(warnings, domainWarning{addr: a.Address, domain: domain, suggestion: suggestion})
+		} else if domains.Disposable(domain) {
+			warnings = append(warnings, domainWarning{addr: a.Address, domain: domain})
+		}
+	}
+
+	return warnings
+}
+
+// domainLines renders a line for each recipient whose domain looks wrong
+func (m model) domainLines() []string {
+
+	var lines []string
+	for _, w := range m.domainWarnings() {
+		if w.suggestion != "" {
+			lines = append(lines, errorStyle.Render("⚠ "+w.addr+": did you mean "+w.suggestion+"? ("+keyHelp(m.keys.fix)+" to fix it)"))
+		} else {
+			lines = append(lines, errorStyle.Render("⚠ "+w.addr+" is a throwaway address, it may already have stopped working"))
+		}
+	}
+
+	return lines
+}
+
+// domainStatus renders the recipients whose domains look wrong, shown below
+// the form once the To field has been left, so half typed domains aren't warned about
+func (m model) domainStatus() string {
+
+	if m.focused == to {
+		return ""
+	}
+
+	return strings.Join(m.domainLines(), "\n")
+}
+
+// fixDomains swaps the mistyped domains in the To field for the ones they
+// were most likely meant to be
+func (m *model) fixDomains() {
+
+	value := m.inputs[to].Value()
+	var fixed []string
+	for _, w := range m.domainWarnings() {
+		if w.suggestion == "" {
+			continue
+		}
+		value = replaceDomain(value, w.domain, w.suggestion)
+		fixed = append(fixed, w.suggestion)
+	}
+	if len(fixed) == 0 {
+		return
+	}
+
+	m.inputs[to].SetValue(value)
+	m.checkKeys()
+	m.status = "Changed the domain to " + strings.Join(fixed, ", ")
+}
+
+// replaceDomain replaces the domain of every address at old in the value,
+// whatever its case, leaving domains that only start with it alone
+func replaceDomain(value, old, new string) string {
+
+	var b strings.Builder
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// a few letters change length with their case, we then match the case as it is
+		lower = value
+	}
+	for {
+		i := strings.Index(lower, "@"+old)
+		if i < 0 {
+			break
+		}
+		end := i + 1 + len(old)
+		b.WriteString(value[:i+1])
+		if end == len(value) || strings.ContainsRune(">, \t", rune(value[end])) {
+			b.WriteString(new)
+		} else {
+			b.WriteString(value[i+1 : end])
+		}
+		value, lower = value[end:], lower[end:]
+	}
+	b.WriteString(value)
+
+	return b.String()
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// autosaveInterval is how often we save the compose form as a draft
+const autosaveInterval = 5 * time.Second
+
+// sendAtHeader keeps the send at field of a draft, it is never sent
+const sendAtHeader = "X-Go-Mailer-Send-At"
+
+// autosaveMsg is sent every autosaveInterval to save the current draft
+type autosaveMsg struct{}
+
+// autosaveTick waits for the next autosave
+func autosaveTick() tea.Cmd {
+	return tea.Tick(autosaveInterval, func(time.Time) tea.Msg {
+		return autosaveMsg{}
+	})
+}
+
+// draft is the saved state of the compose form. Drafts are kept as
+// messages in the account's Drafts maildir, with the fields stored exactly
+// as typed so half written addresses survive too.
+type draft struct {
+	key     string
+	to      string
+	from    string
+	subject string
+	body    string
+	sendAt  string
+	files   []email.Attachment
+	thread  threadHeaders
+	headers []header
+	pgp     pgpMode
+	date    time.Time
+
+	receipts receiptMode
+	priority priority
+
+	noSignature bool // whether the account's signature was switched off for this message
+}
+
+// empty reports whether there is nothing in the draft worth keeping
+func (d draft) empty() bool {
+	return strings.TrimSpace(d.to+d.from+d.subject+d.body+d.sendAt) == "" && len(d.files) == 0
+}
+
+// same reports whether two drafts have the same content
+func (d draft) same(o draft) bool {
+	if len(d.files) != len(o.files) || len(d.headers) != len(o.headers) {
+		return false
+	}
+	for i := range d.headers {
+		if d.headers[i] != o.headers[i] {
+			return false
+		}
+	}
+	for i := range d.files {
+		if d.files[i].Filename != o.files[i].Filename {
+			return false
+		}
+	}
+	return d.to == o.to && d.from == o.from && d.subject == o.subject && d.body == o.body && d.sendAt == o.sendAt &&
+		d.thread.inReplyTo == o.thread.inReplyTo && d.pgp == o.pgp && d.noSignature == o.noSignature &&
+		d.receipts == o.receipts && d.priority == o.priority
+}
+
+// bytes renders the draft as a message
+func (d draft) bytes() []byte {
+
+	var b bytes.Buffer
+
+	email.WriteHeader(&b, "To", d.to)
+	email.WriteHeader(&b, "From", d.from)
+	email.WriteHeader(&b, "Subject", d.subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if d.sendAt != "" {
+		fmt.Fprintf(&b, "%s: %s\r\n", sendAtHeader, d.sendAt)
+	}
+	if d.pgp != 0 {
+		fmt.Fprintf(&b, "%s: %s\r\n", pgpHeader, d.pgp)
+	}
+	if d.noSignature {
+		fmt.Fprintf(&b, "%s: %s\r\n", signatureHeader, signatureOff)
+	}
+	if d.receipts != 0 {
+		fmt.Fprintf(&b, "%s: %s\r\n", receiptsHeader, d.receipts)
+	}
+	for _, h := range append(d.priority.headers(), d.thread.headers()...) {
+		email.WriteHeader(&b, h.Name, h.Value)
+	}
+	for _, h := range d.headers {
+		email.WriteHeader(&b, h.name, h.value)
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	// drafts keep the text as it was typed, it is only wrapped when it is sent
+	email.Message{Text: d.body, Attachments: d.files}.WriteBody(&b, false)
+
+	return b.Bytes()
+}
+
+// parseDraft reads a draft back out of a stored message
+func parseDraft(key string, raw []byte) (draft, error) {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return draft{}, err
+	}
+
+	c, err := parseBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return draft{}, err
+	}
+
+	d := draft{
+		key:     key,
+		to:      decodedHeader(msg.Header, "To"),
+		from:    decodedHeader(msg.Header, "From"),
+		subject: decodeText(msg.Header.Get("Subject")),
+		body:    strings.TrimRight(strings.ReplaceAll(c.text, "\r\n", "\n"), "\n"),
+		sendAt:  msg.Header.Get(sendAtHeader),
+		files:   c.files,
+		pgp:     c.pgp | parsePGPMode(msg.Header.Get(pgpHeader)),
+		thread:  readThreadHeaders(msg.Header),
+		headers: extraHeaders(msg.Header),
+
+		noSignature: msg.Header.Get(signatureHeader) == signatureOff,
+		receipts:    parseReceiptMode(msg.Header.Get(receiptsHeader)),
+		priority:    readPriority(msg.Header),
+	}
+	d.date, _ = msg.Header.Date()
+
+	return d, nil
+}
+
+// draftFolder returns the maildir drafts are kept in. Without an account
+// we still want drafts, so they go into the store of an unnamed account.
+func draftFolder(account *config.Account) (store.Maildir, error) {
+
+	if account == nil {
+		account = &config.Account{}
+	}
+
+	dir, err := account.StoreDir()
+	if err != nil {
+		return "", err
+	}
+
+	s, err := store.Open(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Folder(store.Drafts), nil
+}
+
+// loadDrafts returns every saved draft, newest first
+func loadDrafts(folder store.Maildir) ([]draft, error) {
+
+	keys, err := folder.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var drafts []draft
+	for _, key := range keys {
+		raw, err := folder.Get(key)
+		if err != nil {
+			continue
+		}
+		if d, err := parseDraft(key, raw); err == nil {
+			drafts = append(drafts, d)
+		}
+	}
+
+	return drafts, nil
+}
+
+// currentDraft returns the compose form as a draft
+func (m model) currentDraft() draft {
+	return draft{
+		key:     m.draftKey,
+		to:      trimAddressList(m.inputs[to].Value()),
+		from:    m.inputs[from].Value(),
+		subject: m.inputs[subject].Value(),
+		body:    m.editor.Value(),
+		sendAt:  m.inputs[sendAt].Value(),
+		files:   m.attachments,
+		thread:  m.thread,
+		headers: m.headers,
+		pgp:     m.pgp,
+
+		noSignature: !m.signature && m.sender().Signature.Enabled(),
+		receipts:    m.receipts,
+		priority:    m.priority,
+	}
+}
+
+// saveDraft writes the compose form to the drafts folder if it has changed
+// since the last save, replacing the previous copy of the draft
+func (m *model) saveDraft() error {
+
+	d := m.currentDraft()
+	if d.same(m.saved) {
+		return nil
+	}
+
+	// we couldn't open the drafts folder at startup and already said so
+	if m.drafts == "" {
+		return nil
+	}
+
+	// a form that has been cleared doesn't need a draft anymore
+	if d.empty() {
+		err := m.discardDraft()
+		m.saved = d
+		return err
+	}
+
+	key, err := m.drafts.DeliverSealed(d.bytes(), string(store.FlagDraft)+string(store.FlagSeen))
+	if err != nil {
+		return err
+	}
+
+	if m.draftKey != "" {
+		m.drafts.Remove(m.draftKey)
+	}
+
+	m.draftKey = key
+	m.saved = d
+	return nil
+}
+
+// discardDraft removes the saved copy of the compose form, e.g. once it has been sent
+func (m *model) discardDraft() error {
+
+	if m.draftKey == "" {
+		return nil
+	}
+
+	err := m.drafts.Remove(m.draftKey)
+	m.draftKey = ""
+	return err
+}
+
+// resumeDraft fills the compose form from a saved draft
+func (m *model) resumeDraft(d draft) {
+	m.inputs[to].SetValue(d.to)
+	m.inputs[from].SetValue(d.from)
+	m.inputs[subject].SetValue(d.subject)
+	m.editor.SetValue(m.resumeSignature(d.body, d.noSignature))
+	m.inputs[sendAt].SetValue(d.sendAt)
+	m.attachments = d.files
+	m.thread = d.thread
+	m.headers = d.headers
+	m.pgp = d.pgp
+	m.receipts = d.receipts
+	m.priority = d.priority
+	m.checkKeys()
+	m.draftKey = d.key
+	m.saved = d
+}
+
+// draftItem lets us show a draft in a bubbles list
+type draftItem struct {
+	draft
+}
+
+func (d draftItem) Title() string {
+	if d.subject == "" {
+		return "(no subject)"
+	}
+	return d.subject
+}
+
+func (d draftItem) Description() string {
+	return fmt.Sprintf("to %s - %s", d.to, d.date.Format("02 Jan 15:04"))
+}
+
+func (d draftItem) FilterValue() string {
+	return d.to + " " + d.subject
+}
+
+// draftsModel is the picker shown on startup when there are saved drafts
+type draftsModel struct {
+	list list.Model
+}
+
+// newDraftPicker returns a picker listing the given drafts
+func newDraftPicker(drafts []draft) draftsModel {
+
+	items := make([]list.Item, len(drafts))
+	for i, d := range drafts {
+		items[i] = draftItem{d}
+	}
+
+	l := list.New(items, themedDelegate(), 50, 20)
+	l.Title = "Resume a draft? (enter to resume, n for a new message, d to delete)"
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+
+	return draftsModel{list: l}
+}
+
+// selected returns the highlighted draft
+func (d draftsModel) selected() (draft, bool) {
+	item, ok := d.list.SelectedItem().(draftItem)
+	return item.draft, ok
+}
+
+func (d draftsModel) Update(msg tea.Msg) (draftsModel, tea.Cmd) {
+
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		d.list.SetSize(msg.Width, msg.Height-2)
+		return d, nil
+	}
+
+	var cmd tea.Cmd
+	d.list, cmd = d.list.Update(msg)
+	return d, cmd
+}
+
+func (d draftsModel) View() string {
+	return d.list.View()
+}
+
+// updateDrafts handles messages while the draft picker is showing
+func (m model) updateDrafts(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.picker.list.FilterState() != list.Filtering {
+		switch msg.String() {
+
+		// we'll handle enter to carry on with the selected draft
+		case "enter":
+			if d, ok := m.picker.selected(); ok {
+				m.resumeDraft(d)
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle n and esc to start a new message instead
+		case "n", "esc":
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle d to throw the selected draft away
+		case "d":
+			if d, ok := m.picker.selected(); ok {
+				m.drafts.Remove(d.key)
+				m.picker.list.RemoveItem(m.picker.list.Index())
+			}
+			if len(m.picker.list.Items()) == 0 {
+				m.screen = composeScreen
+			}
+			return m, nil
+		}
+
+		// a draft hasn't been picked yet, so there is nothing in the form to save
+		if key.Matches(msg, m.keys.quit) {
+			return m.quitWhenFlushed()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.picker, cmd = m.picker.Update(msg)
+	return m, cmd
+}
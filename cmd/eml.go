@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+)
+
+// openEML loads an .eml file into the compose form, so it can be changed and
+// sent. A bounce is replaced by the message that bounced, which is usually
+// the one that needs fixing.
+func (m *model) openEML(path string) error {
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if original, ok := bounced(raw); ok {
+		raw = original
+	}
+
+	if err := m.reopenSent(raw); err != nil {
+		return fmt.Errorf("could not open %s: %w", path, err)
+	}
+
+	m.screen = composeScreen
+	return nil
+}
+
+// bounced returns the original message returned inside a bounce, which is a
+// multipart/report as RFC 3462 describes
+func bounced(raw []byte) ([]byte, bool) {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, false
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, false
+	}
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextRawPart()
+		if err != nil {
+			return nil, false
+		}
+
+		// some servers only send the headers back, they're no use for sending it again
+		if t, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); t != "message/rfc822" {
+			continue
+		}
+
+		original, err := io.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		return original, true
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/emoji"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// emojiRows is how many of the matches the picker shows at once
+const emojiRows = 8
+
+// shorthand is a colon typed at the start of a word and the first two letters
+// of an emoji's name, like :sm for :smile:. A colon after a word or a number,
+// like in "Re:" or 10:30, doesn't start one.
+var shorthand = regexp.MustCompile(`(?:^|\s):([a-z0-9_+-]{2})$`)
+
+// shortcode is the whole name of an emoji between colons, like :smile:
+var shortcode = regexp.MustCompile(`(?:^|\s):([a-z0-9_+-]+):$`)
+
+// emojiModel is the picker that inserts an emoji or a symbol into the subject or the body
+type emojiModel struct {
+	search  textinput.Model
+	matches []emoji.Emoji
+	cursor  int // the match that enter inserts
+	typed   int // how many runes of a shorthand were typed into the field, the emoji replaces them
+}
+
+// newEmoji returns the picker, it is opened with open
+func newEmoji() emojiModel {
+
+	search := textinput.New()
+	search.Placeholder = "smile, heart, arrow..."
+	search.Prompt = ":"
+	search.Width = 30
+
+	return emojiModel{search: search}
+}
+
+// open starts the picker searching for the query
+func (e *emojiModel) open(query string, typed int) tea.Cmd {
+	e.search.SetValue(query)
+	e.search.CursorEnd()
+	e.typed = typed
+	e.filter()
+	return e.search.Focus()
+}
+
+// filter finds the emoji matching what has been typed into the search
+func (e *emojiModel) filter() {
+	e.matches = emoji.Search(e.search.Value())
+	e.cursor = 0
+}
+
+// pickEmoji opens the picker for the field being edited. Addresses and the
+// send time can't hold an emoji, so it only opens in the subject and the body.
+func (m *model) pickEmoji(query string, typed int) tea.Cmd {
+
+	if m.focused != subject && m.focused != body {
+		m.status = "Emoji go in the subject or the body"
+		return nil
+	}
+
+	m.screen = emojiScreen
+	return m.emojiPicker.open(query, typed)
+}
+
+// emojiShorthand reports whether a shorthand has just been typed into the
+// subject or the body, and the letters of it. A whole shortcode, typed
+// too quickly for the picker to open, turns into its emoji right away.
+func (m *model) emojiShorthand(msg tea.Msg) (string, bool) {
+
+	key, ok := msg.(tea.KeyMsg)
+	if !ok || key.Type != tea.KeyRunes || (m.focused != subject && m.focused != body) {
+		return "", false
+	}
+
+	text, cursor := m.fieldText(m.focused)
+	before := string([]rune(text)[:cursor])
+
+	if match := shortcode.FindStringSubmatch(before); match != nil {
+		if e, ok := emoji.Named(match[1]); ok {
+			m.emojiPicker.typed = len([]rune(match[1])) + 2
+			m.insertEmoji(e.Char)
+		}
+		return "", false
+	}
+
+	match := shorthand.FindStringSubmatch(before)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// insertEmoji puts the text at the cursor of the field, in place of the shorthand that was typed
+func (m *model) insertEmoji(text string) {
+
+	value, cursor := m.fieldText(m.focused)
+	runes := []rune(value)
+	start := max(0, cursor-m.emojiPicker.typed)
+
+	value = string(runes[:start]) + text + string(runes[cursor:])
+	m.setFieldText(m.focused, value, start+len([]rune(text)))
+}
+
+// updateEmoji handles messages while the emoji picker is showing
+func (m model) updateEmoji(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	e := &m.emojiPicker
+
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		var cmd tea.Cmd
+		e.search, cmd = e.search.Update(msg)
+		return m, cmd
+	}
+
+	// we'll handle a colon to finish the name the way it is written out, like
+	// :smile:. Keys typed quickly can come in together, so it may end them.
+	if key.Type == tea.KeyRunes && strings.HasSuffix(string(key.Runes), ":") {
+		name := e.search.Value() + strings.TrimSuffix(string(key.Runes), ":")
+		if choice, ok := emoji.Named(name); ok {
+			m.insertEmoji(choice.Char)
+			m.screen = composeScreen
+		}
+		return m, nil
+	}
+
+	switch key.String() {
+
+	// we'll handle enter to insert the emoji
+	case "enter":
+		if len(e.matches) == 0 {
+			return m, nil
+		}
+		m.insertEmoji(e.matches[e.cursor].Char)
+		m.screen = composeScreen
+		return m, nil
+
+	// we'll handle esc to go back, what was typed of a shorthand stays in the field
+	case "esc":
+		if e.typed > 0 {
+			m.insertEmoji(":" + e.search.Value())
+		}
+		m.screen = composeScreen
+		return m, nil
+
+	case "up", "ctrl+p", "shift+tab":
+		if e.cursor > 0 {
+			e.cursor--
+		}
+		return m, nil
+
+	case "down", "ctrl+n", "tab":
+		if e.cursor < len(e.matches)-1 {
+			e.cursor++
+		}
+		return m, nil
+	}
+
+	before := e.search.Value()
+	var cmd tea.Cmd
+	e.search, cmd = e.search.Update(msg)
+	if e.search.Value() != before {
+		e.filter()
+	}
+	return m, cmd
+}
+
+// viewEmoji renders the picker over the middle of the screen
+func (m model) viewEmoji() string {
+
+	e := m.emojiPicker
+
+	var b strings.Builder
+	b.WriteString(inputStyle.Render("Pick an emoji (enter to insert, esc to go back)") + "\n\n")
+	b.WriteString(e.search.View() + "\n\n")
+
+	if len(e.matches) == 0 {
+		b.WriteString(continueStyle.Render("Nothing is called that"))
+		return m.modal(b.String())
+	}
+
+	// the window of matches scrolls to keep the cursor in it
+	first := max(0, e.cursor-emojiRows+1)
+	last := min(len(e.matches), first+emojiRows)
+	for i := first; i < last; i++ {
+		em := e.matches[i]
+
+		// an emoji takes two columns and a symbol one, the names line up after them
+		pad := strings.Repeat(" ", max(1, 3-lipgloss.Width(em.Char)))
+		line := fmt.Sprintf("%s%s:%s:", em.Char, pad, em.Name)
+		if i == e.cursor {
+			b.WriteString(focusStyle.Render("> "+line) + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	b.WriteString(continueStyle.Render(fmt.Sprintf("%d of %d", e.cursor+1, len(e.matches))))
+
+	return m.modal(b.String())
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/imapclient"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// flagMsg is sent once a flag of a message has been set or cleared
+	flagMsg struct {
+		folder string
+		id     string
+		flag   string
+		on     bool
+		err    error
+	}
+
+	// movedMsg is sent once a message has been moved into another folder
+	movedMsg struct {
+		folder string
+		id     string
+		to     string
+		err    error
+	}
+
+	// expungedMsg is sent once the messages marked as deleted have been removed
+	expungedMsg struct {
+		folder string
+		err    error
+	}
+
+	// foldersMsg is sent with the account's folders, after they were listed or changed
+	foldersMsg struct {
+		folders []string
+		status  string // what was changed, if anything was
+		err     error
+	}
+)
+
+// localFlags maps the mailbox flags to the maildir ones, for accounts whose
+// mail is kept in the local store
+var localFlags = map[string]rune{
+	mailbox.FlagSeen:    store.FlagSeen,
+	mailbox.FlagFlagged: store.FlagFlagged,
+	mailbox.FlagDeleted: store.FlagTrashed,
+}
+
+// defaultFolder is the folder the inbox starts in
+func defaultFolder(account *config.Account) string {
+
+	if account == nil {
+		return store.Inbox
+	}
+
+	switch account.BackendName() {
+	case config.BackendJMAP:
+		return "Inbox"
+	case config.BackendPOP3:
+		return store.Inbox
+	default:
+		return account.IMAP.MailboxName()
+	}
+}
+
+// changeMailbox runs the change on the account's mailbox. Changes go to the
+// server for IMAP, and to the local store, where its mail is kept, for POP3.
+func changeMailbox(account config.Account, remote func(*imapclient.Client) error, local func(*store.Store) error) error {
+
+	switch account.BackendName() {
+
+	case config.BackendJMAP:
+		return fmt.Errorf("folders and flags can't be changed on a JMAP account yet")
+
+	case config.BackendPOP3:
+		dir, err := account.StoreDir()
+		if err != nil {
+			return err
+		}
+		s, err := store.Open(dir)
+		if err != nil {
+			return err
+		}
+		return local(s)
+
+	default:
+		c, err := imapclient.Dial(account.IMAP)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return remote(c)
+	}
+}
+
+// setFlag sets or clears a flag of the message in the background
+func setFlag(account config.Account, folder, id, flag string, on bool) tea.Cmd {
+
+	return func() tea.Msg {
+		err := changeMailbox(account,
+			func(c *imapclient.Client) error {
+				return c.SetFlag(folder, id, flag, on)
+			},
+			func(s *store.Store) error {
+				d := s.Folder(folder)
+				flags, err := d.Flags(id)
+				if err != nil {
+					return err
+				}
+				f := string(localFlags[flag])
+				flags = strings.ReplaceAll(flags, f, "")
+				if on {
+					flags += f
+				}
+				return d.SetFlags(id, flags)
+			})
+		return flagMsg{folder: folder, id: id, flag: flag, on: on, err: err}
+	}
+}
+
+// moveMessage moves the message into another folder in the background
+func moveMessage(account config.Account, folder, id, to string) tea.Cmd {
+
+	return func() tea.Msg {
+		err := changeMailbox(account,
+			func(c *imapclient.Client) error {
+				return c.Move(folder, id, to)
+			},
+			func(s *store.Store) error {
+				return s.Folder(folder).MoveTo(id, s.Folder(to))
+			})
+		return movedMsg{folder: folder, id: id, to: to, err: err}
+	}
+}
+
+// expungeFolder removes the messages marked as deleted in the background
+func expungeFolder(account config.Account, folder string) tea.Cmd {
+
+	return func() tea.Msg {
+		err := changeMailbox(account,
+			func(c *imapclient.Client) error {
+				return c.Expunge(folder)
+			},
+			func(s *store.Store) error {
+				return s.Folder(folder).Expunge()
+			})
+		return expungedMsg{folder: folder, err: err}
+	}
+}
+
+// listFolders lists the account's folders in the background, after making
+// the change, if there is one. status says what the change did.
+func listFolders(account config.Account, status string, remote func(*imapclient.Client) error, local func(*store.Store) error) tea.Cmd {
+
+	return func() tea.Msg {
+		var folders []string
+		err := changeMailbox(account,
+			func(c *imapclient.Client) error {
+				if remote != nil {
+					if err := remote(c); err != nil {
+						return err
+					}
+				}
+				var err error
+				folders, err = c.Folders()
+				return err
+			},
+			func(s *store.Store) error {
+				if local != nil {
+					if err := local(s); err != nil {
+						return err
+					}
+				}
+				var err error
+				folders, err = s.Folders()
+				return err
+			})
+		return foldersMsg{folders: folders, status: status, err: err}
+	}
+}
+
+// folderItem lets us show a folder in a bubbles list
+type folderItem struct {
+	name    string
+	current bool // whether the inbox is showing it
+}
+
+func (f folderItem) Title() string {
+	if f.current {
+		return "● " + f.name
+	}
+	return f.name
+}
+
+func (f folderItem) Description() string {
+	if f.current {
+		return "open in the inbox"
+	}
+	return ""
+}
+
+func (f folderItem) FilterValue() string {
+	return f.name
+}
+
+// foldersModel lists the account's folders, to open one in the inbox or to
+// move a message into one
+type foldersModel struct {
+	list   list.Model
+	input  textinput.Model // the name of a new folder
+	moving string          // the id of the message being moved, empty when we're just looking
+	status string
+	err    error
+
+	creating bool   // whether we're asking for the name of a new folder
+	deleting string // the folder we're asking to delete, until it is confirmed
+}
+
+// newFolders returns an empty folder list
+func newFolders() foldersModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+	l.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "new folder")),
+			key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "delete folder")),
+		}
+	}
+
+	input := textinput.New()
+	input.Prompt = "New folder: "
+	input.CharLimit = 0
+	input.Width = 50
+
+	return foldersModel{list: l, input: input}
+}
+
+// openFolders shows the folders, moving is the id of the message to move
+// into the one that is picked, or empty to open it in the inbox instead
+func (m model) openFolders(moving string) (tea.Model, tea.Cmd) {
+
+	f := &m.folders
+	f.moving, f.status, f.err = moving, "", nil
+	f.creating, f.deleting = false, ""
+	f.list.Title = "Folders (enter to open, esc to go back)"
+	if moving != "" {
+		f.list.Title = "Move to (enter to move the message here, esc to go back)"
+	}
+
+	m.screen = foldersScreen
+	if !m.inbox.enabled() {
+		f.err = fmt.Errorf("no mail account configured")
+		return m, nil
+	}
+	f.status = "loading..."
+	return m, listFolders(*m.inbox.account, "", nil, nil)
+}
+
+// show puts the folders in the list, marking the one the inbox is showing
+func (f *foldersModel) show(folders []string, current string) {
+
+	items := make([]list.Item, len(folders))
+	for i, name := range folders {
+		items[i] = folderItem{name: name, current: name == current}
+	}
+	f.list.SetItems(items)
+}
+
+// resize fits the folder list in the terminal
+func (f *foldersModel) resize(width, height int) {
+	f.list.SetSize(width, height-3)
+	f.input.Width = max(width-len(f.input.Prompt)-2, 10)
+}
+
+// updateFolders handles messages while the folders are showing
+func (m model) updateFolders(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	f := &m.folders
+
+	if msg, ok := msg.(tea.KeyMsg); ok && f.creating {
+		switch msg.Type {
+
+		// we'll handle enter to create the folder
+		case tea.KeyEnter:
+			name := strings.TrimSpace(f.input.Value())
+			f.creating = false
+			f.input.Blur()
+			if name == "" {
+				return m, nil
+			}
+			f.status = "creating " + name + "..."
+			return m, listFolders(*m.inbox.account, "Created "+name,
+				func(c *imapclient.Client) error { return c.CreateFolder(name) },
+				func(s *store.Store) error { return s.CreateFolder(name) })
+
+		// we'll handle esc to stop creating a folder
+		case tea.KeyEsc:
+			f.creating = false
+			f.input.Blur()
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		f.input, cmd = f.input.Update(msg)
+		return m, cmd
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && f.deleting != "" {
+		// deleting a folder deletes its mail, so it takes a y to go ahead
+		name := f.deleting
+		f.deleting = ""
+		if msg.String() != "y" {
+			f.status = ""
+			return m, nil
+		}
+		f.status = "deleting " + name + "..."
+		return m, listFolders(*m.inbox.account, "Deleted "+name,
+			func(c *imapclient.Client) error { return c.DeleteFolder(name) },
+			func(s *store.Store) error { return s.DeleteFolder(name) })
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && f.list.FilterState() != list.Filtering {
+		item, selected := f.list.SelectedItem().(folderItem)
+
+		switch msg.String() {
+
+		// we'll handle esc to go back to the inbox
+		case "esc":
+			m.screen = inboxScreen
+			return m, nil
+
+		// we'll handle enter to move the message into the folder, or open it
+		case "enter":
+			if !selected {
+				return m, nil
+			}
+			m.screen = inboxScreen
+			if f.moving != "" {
+				m.inbox.list.Title = m.inbox.title("moving to " + item.name + "...")
+				return m, moveMessage(*m.inbox.account, m.inbox.folder, f.moving, item.name)
+			}
+			return m, m.inbox.open(item.name)
+
+		// we'll handle n to create a folder
+		case "n":
+			if m.inbox.enabled() {
+				f.creating, f.status = true, ""
+				f.input.SetValue("")
+				return m, f.input.Focus()
+			}
+			return m, nil
+
+		// we'll handle D to delete the highlighted folder, once it is confirmed
+		case "D":
+			if selected {
+				f.deleting = item.name
+				f.status = fmt.Sprintf("Delete %s and every message in it? (y to delete)", item.name)
+			}
+			return m, nil
+		}
+
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	f.list, cmd = f.list.Update(msg)
+	return m, cmd
+}
+
+// viewFolders renders the folder list
+func (m model) viewFolders() string {
+
+	f := m.folders
+
+	status := continueStyle.Render(f.status)
+	switch {
+	case f.creating:
+		status = f.input.View() + " " + continueStyle.Render("(enter to create, esc to cancel)")
+	case f.err != nil:
+		status = errorStyle.Render("✗ " + f.err.Error())
+	}
+
+	return fmt.Sprintf("%s\n%s", f.list.View(), status)
+}
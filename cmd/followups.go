@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// defaultFollowUpDays is how long we wait for a reply unless told otherwise
+const defaultFollowUpDays = 3
+
+// repliesMsg is sent once the inbox has been looked through for replies to
+// the messages we're waiting on
+type repliesMsg struct {
+	found int // how many of the messages got their reply
+}
+
+// findReplies drops the reminders of the sent messages the envelopes reply
+// to in the background. A reply names the message in its In-Reply-To, and
+// the messages before in the conversation in its References.
+func (i inboxModel) findReplies(envelopes []mailbox.Envelope) tea.Cmd {
+
+	var ids []string
+	for _, e := range envelopes {
+		if e.InReplyTo != "" {
+			ids = append(ids, e.InReplyTo)
+		}
+		ids = append(ids, e.References...)
+	}
+	if len(ids) == 0 || i.account == nil {
+		return nil
+	}
+
+	account := *i.account
+	return func() tea.Msg {
+		dir, err := account.StoreDir()
+		if err != nil {
+			slog.Error("Could not look for replies", "err", err)
+			return repliesMsg{}
+		}
+		s, err := store.Open(dir)
+		if err != nil {
+			slog.Error("Could not look for replies", "err", err)
+			return repliesMsg{}
+		}
+		found, err := s.RemoveFollowUps(ids...)
+		if err != nil {
+			slog.Error("Could not look for replies", "err", err)
+		}
+		return repliesMsg{found: found}
+	}
+}
+
+// followUpItem lets us show a reminder in a bubbles list
+type followUpItem struct {
+	store.FollowUp
+}
+
+func (f followUpItem) Title() string {
+	subject := f.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	title := fmt.Sprintf("%s to %s", subject, strings.Join(f.To, ", "))
+	if f.Overdue(time.Now()) {
+		// the ones to follow up on now stand out
+		title = "⏰ " + title
+	}
+	return title
+}
+
+func (f followUpItem) Description() string {
+	if f.Overdue(time.Now()) {
+		return fmt.Sprintf("no reply yet, follow up since %s", f.Due.Format("Mon 02 Jan 15:04"))
+	}
+	return fmt.Sprintf("waiting for a reply until %s", f.Due.Format("Mon 02 Jan 15:04"))
+}
+
+func (f followUpItem) FilterValue() string {
+	return f.Subject + " " + strings.Join(f.To, " ")
+}
+
+// followUpsModel lists the sent messages we're waiting for a reply to
+type followUpsModel struct {
+	list      list.Model
+	store     *store.Store
+	followUps []store.FollowUp
+	status    string
+}
+
+// newFollowUps returns the reminders of the given account
+func newFollowUps(account *config.Account) followUpsModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Title = "Follow-ups (enter to read, a to follow up, d when it's done, esc to go back)"
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+
+	f := followUpsModel{list: l}
+
+	if account != nil {
+		dir, err := account.StoreDir()
+		if err == nil {
+			f.store, err = store.Open(dir)
+		}
+		if err != nil {
+			slog.Error("Could not open the follow-ups", "err", err)
+		}
+	}
+
+	f.refresh()
+	return f
+}
+
+// refresh reloads the reminders from the store
+func (f *followUpsModel) refresh() {
+
+	if f.store == nil {
+		return
+	}
+
+	followUps, err := f.store.FollowUps()
+	if err != nil {
+		slog.Error("Could not read the follow-ups", "err", err)
+		return
+	}
+	f.followUps = followUps
+
+	items := make([]list.Item, len(followUps))
+	for i, fu := range followUps {
+		items[i] = followUpItem{fu}
+	}
+	f.list.SetItems(items)
+}
+
+// due returns how many of the reminders are due
+func (f followUpsModel) due() int {
+
+	n, now := 0, time.Now()
+	for _, fu := range f.followUps {
+		if fu.Overdue(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// waiting returns the reminder of the sent message, if it has one
+func (f followUpsModel) waiting(messageID string) (store.FollowUp, bool) {
+
+	for _, fu := range f.followUps {
+		if messageID != "" && mailbox.NormalizeID(fu.MessageID) == mailbox.NormalizeID(messageID) {
+			return fu, true
+		}
+	}
+	return store.FollowUp{}, false
+}
+
+// remind sets a reminder for the sent message, to follow up on it if no
+// reply arrives within the days. No days takes the reminder away.
+func (f *followUpsModel) remind(rec store.SentRecord, days int) error {
+
+	if f.store == nil {
+		return fmt.Errorf("reminders need an account to keep them in")
+	}
+	if rec.MessageID == "" {
+		return fmt.Errorf("the message has no Message-ID, so its replies can't be told apart")
+	}
+
+	var err error
+	if days <= 0 {
+		_, err = f.store.RemoveFollowUps(rec.MessageID)
+	} else {
+		err = f.store.SetFollowUp(store.FollowUp{
+			MessageID: rec.MessageID,
+			Key:       rec.Key,
+			To:        rec.To,
+			Subject:   rec.Subject,
+			Due:       rec.Sent.AddDate(0, 0, days),
+		})
+	}
+	f.refresh()
+	return err
+}
+
+// openFollowUps shows the messages waiting for a reply
+func (m model) openFollowUps() (tea.Model, tea.Cmd) {
+	m.followUps.refresh()
+	m.followUps.status = ""
+	m.screen = followUpsScreen
+	return m, nil
+}
+
+// resize fits the reminders in the terminal
+func (f *followUpsModel) resize(width, height int) {
+	f.list.SetSize(width, height-3)
+}
+
+// selected returns the highlighted reminder and the message it is about
+func (f followUpsModel) selected() (store.FollowUp, []byte, error) {
+
+	item, ok := f.list.SelectedItem().(followUpItem)
+	if !ok {
+		return store.FollowUp{}, nil, fmt.Errorf("no message selected")
+	}
+
+	raw, err := f.store.Folder(store.Sent).Get(item.Key)
+	return item.FollowUp, raw, err
+}
+
+// updateFollowUps handles messages while the follow-ups are showing
+func (m model) updateFollowUps(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	f := &m.followUps
+
+	if msg, ok := msg.(tea.KeyMsg); ok && f.list.FilterState() != list.Filtering {
+		switch msg.String() {
+
+		// we'll handle enter to read the message we sent
+		case "enter":
+			fu, raw, err := f.selected()
+			if err == nil {
+				err = m.openReader(raw, followUpsScreen, store.Sent, fu.Key)
+			}
+			if err != nil {
+				f.status = "Could not open message: " + err.Error()
+			}
+			return m, nil
+
+		// we'll handle a to write the follow up, the reminder stays until a reply arrives
+		case "a":
+			_, raw, err := f.selected()
+			if err == nil {
+				err = m.startReply(raw, replyKeys["a"])
+			}
+			if err != nil {
+				f.status = "Could not open message: " + err.Error()
+				return m, nil
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle d to drop the reminder, when there's nothing more to wait for
+		case "d":
+			fu, _, err := f.selected()
+			if err == nil {
+				_, err = f.store.RemoveFollowUps(fu.MessageID)
+				f.refresh()
+			}
+			if err != nil {
+				f.status = "Could not drop the reminder: " + err.Error()
+			} else {
+				f.status = fmt.Sprintf("No longer waiting for a reply to %q", fu.Subject)
+			}
+			return m, nil
+
+		// we'll handle esc to go back to the compose view, unless the list is using it
+		case "esc":
+			if f.list.FilterState() == list.Unfiltered {
+				m.screen = composeScreen
+				return m, nil
+			}
+		}
+
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	f.list, cmd = f.list.Update(msg)
+	return m, cmd
+}
+
+// viewFollowUps renders the reminders
+func (m model) viewFollowUps() string {
+	return fmt.Sprintf("%s\n%s", m.followUps.list.View(), continueStyle.Render(m.followUps.status))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/gmail"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+var (
+	gmailMu      sync.Mutex
+	gmailClients = make(map[string]*gmail.Client) // by refresh token, so the access token is reused between messages
+)
+
+// gmailFor returns the client for the Gmail settings
+func gmailFor(cfg config.Gmail) *gmail.Client {
+
+	gmailMu.Lock()
+	defer gmailMu.Unlock()
+
+	c, ok := gmailClients[cfg.RefreshToken]
+	if !ok {
+		c = gmail.New(cfg)
+		gmailClients[cfg.RefreshToken] = c
+	}
+
+	return c
+}
+
+// gmailTransport sends mail with the Gmail API
+type gmailTransport struct {
+	client *gmail.Client
+}
+
+func (t gmailTransport) Name() string {
+	return "gmail"
+}
+
+func (t gmailTransport) Send(from string, to []string, msg []byte) (string, error) {
+
+	// like jmap, the Gmail API can't ask for delivery reports
+	msg, _ = email.TakeDeliveryReport(msg)
+
+	id, err := t.client.Send(to, msg)
+	if err != nil {
+		return "", err
+	}
+
+	return "gmail " + id, nil
+}
+
+// gmailAuthCommand grants go-mailer access to send as the account through
+// the Gmail API, and prints the refresh token to put in its settings
+//
+//	go-mailer gmail-auth [-account name]
+func gmailAuthCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("gmail-auth", flag.ExitOnError)
+	accountName := fs.String("account", "", "account to grant access for, defaults to the first one")
+	fs.Parse(args)
+
+	account, err := cfg.Account(*accountName)
+	if err != nil {
+		return err
+	}
+	if !account.Gmail.Enabled() {
+		return fmt.Errorf("account %q has no gmail settings, it needs a client_id and client_secret", account.Name)
+	}
+
+	token, err := gmail.Authorize(account.Gmail, func(url string) {
+		fmt.Fprintf(os.Stderr, "Grant go-mailer access in your browser, if it doesn't open go to\n\n%s\n\n", url)
+		openWithSystem(url)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Access granted, put this in the [accounts.gmail] settings of %q:\n\n", account.Name)
+	fmt.Printf("refresh_token = %q\n", token)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/graph"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+var (
+	graphMu      sync.Mutex
+	graphClients = make(map[string]*graph.Client) // by account, so the access token is reused between messages
+)
+
+// graphFor returns the Microsoft Graph client of the account
+func graphFor(account *config.Account) (*graph.Client, error) {
+
+	path, err := account.GraphTokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	graphMu.Lock()
+	defer graphMu.Unlock()
+
+	c, ok := graphClients[path]
+	if !ok {
+		c = graph.New(account.Graph, path)
+		graphClients[path] = c
+	}
+
+	return c, nil
+}
+
+// graphTransport sends mail with Microsoft Graph
+type graphTransport struct {
+	client *graph.Client
+}
+
+func (t graphTransport) Name() string {
+	return "graph"
+}
+
+func (t graphTransport) Send(from string, to []string, msg []byte) (string, error) {
+
+	// like jmap, Graph can't ask for delivery reports
+	msg, _ = email.TakeDeliveryReport(msg)
+
+	if err := t.client.Send(from, to, msg); err != nil {
+		return "", err
+	}
+
+	// sendMail only says it has taken the message, it doesn't give it an id
+	return "accepted", nil
+}
+
+// graphAuthCommand signs the account's user in to Microsoft Graph, so
+// go-mailer can send as them
+//
+//	go-mailer graph-auth [-account name]
+func graphAuthCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("graph-auth", flag.ExitOnError)
+	accountName := fs.String("account", "", "account to sign in for, defaults to the first one")
+	fs.Parse(args)
+
+	account, err := cfg.Account(*accountName)
+	if err != nil {
+		return err
+	}
+	if !account.Graph.Enabled() {
+		return fmt.Errorf("account %q has no graph settings, it needs a client_id", account.Name)
+	}
+
+	c, err := graphFor(account)
+	if err != nil {
+		return err
+	}
+	err = c.SignIn(func(message string) {
+		fmt.Fprintln(os.Stderr, message)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Signed in, %q sends through Microsoft Graph now\n", account.Name)
+	return nil
+}
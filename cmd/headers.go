@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/aidk/go-mailer/pkg/email"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// header is an extra header added to the outgoing message by hand, such as Reply-To
+type header struct {
+	name  string
+	value string
+}
+
+// reservedHeaders are written from the compose form, so they can't be added by hand
+var reservedHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-Id", "In-Reply-To", "References",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding", sendAtHeader, pgpHeader,
+	signatureHeader, receiptsHeader, "Disposition-Notification-To", "X-Priority", "Importance",
+}
+
+// traceHeaders are added by servers on the way, they don't belong in a message we send again
+var traceHeaders = []string{
+	"Received", "Return-Path", "Delivered-To", "Dkim-Signature", "Authentication-Results",
+	"Arc-Seal", "Arc-Message-Signature", "Arc-Authentication-Results",
+}
+
+// reserved reports whether the header is one of the reservedHeaders
+func reserved(name string) bool {
+	for _, r := range reservedHeaders {
+		if strings.EqualFold(name, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrace reports whether the header is one of the traceHeaders
+func isTrace(name string) bool {
+	for _, t := range traceHeaders {
+		if strings.EqualFold(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHeader checks a header before it is added, see email.ValidateHeader.
+// The headers written from the compose form can't be added by hand.
+func validateHeader(name, value string) error {
+
+	if err := email.ValidateHeader(name, value); err != nil {
+		return err
+	}
+	if reserved(name) {
+		return fmt.Errorf("%s is set from the compose form", name)
+	}
+	// their addresses get the message too, so we have to be able to read them
+	if strings.EqualFold(name, "Cc") || strings.EqualFold(name, "Bcc") {
+		if _, err := mail.ParseAddressList(value); err != nil {
+			return fmt.Errorf("%s should be a list of addresses, like ann@example.com, Bob <bob@example.com>", name)
+		}
+	}
+
+	return nil
+}
+
+// decodeText undoes encodeText, text that isn't encoded comes back as it is
+func decodeText(text string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(text); err == nil {
+		return decoded
+	}
+	return text
+}
+
+// extraHeaders returns the headers of a message that aren't written from the
+// compose form, so they come back when a saved message is opened again
+func extraHeaders(h mail.Header) []header {
+
+	var headers []header
+	for name, values := range h {
+		if reserved(name) || isTrace(name) {
+			continue
+		}
+		for _, v := range values {
+			headers = append(headers, header{name: name, value: decodeText(v)})
+		}
+	}
+
+	// maps have no order, so we sort them to keep drafts from changing on every save
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].name < headers[j].name })
+	return headers
+}
+
+// the two inputs of the headers panel
+const (
+	headerName = iota
+	headerValue
+)
+
+// headersModel is the advanced headers panel, where extra headers are added to the message
+type headersModel struct {
+	inputs   []textinput.Model
+	focused  int
+	selected int // the added header the cursor is on
+	err      error
+}
+
+// newHeaders returns an empty headers panel
+func newHeaders() headersModel {
+
+	inputs := make([]textinput.Model, 2)
+
+	inputs[headerName] = textinput.New()
+	inputs[headerName].Placeholder = "e.g. Reply-To, Organization, X-Mailer..."
+	inputs[headerName].Width = defaultFieldWidth
+	inputs[headerName].Prompt = ""
+
+	inputs[headerValue] = textinput.New()
+	inputs[headerValue].Placeholder = "Value..."
+	inputs[headerValue].Width = defaultFieldWidth
+	inputs[headerValue].Prompt = ""
+
+	return headersModel{inputs: inputs}
+}
+
+// resize makes the inputs as wide as the terminal has room for
+func (h *headersModel) resize(width int) {
+	for i := range h.inputs {
+		h.inputs[i].Width = fieldWidth(width)
+	}
+}
+
+// open resets the panel, ready to add a header
+func (h *headersModel) open() {
+	h.inputs[headerName].SetValue("")
+	h.inputs[headerValue].SetValue("")
+	h.inputs[headerValue].Blur()
+	h.inputs[headerName].Focus()
+	h.focused = headerName
+	h.err = nil
+}
+
+// updateHeaders handles messages while the headers panel is showing
+func (m model) updateHeaders(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	h := &m.headersPanel
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+
+		// we'll handle tab to move between the name and the value
+		case tea.KeyTab, tea.KeyShiftTab:
+			h.inputs[h.focused].Blur()
+			h.focused = 1 - h.focused
+			h.inputs[h.focused].Focus()
+			return m, nil
+
+		// we'll handle enter to add the header, or to move on to the value
+		case tea.KeyEnter:
+			if h.focused == headerName {
+				h.inputs[headerName].Blur()
+				h.focused = headerValue
+				h.inputs[headerValue].Focus()
+				return m, nil
+			}
+
+			name := strings.TrimSpace(h.inputs[headerName].Value())
+			value := strings.TrimSpace(h.inputs[headerValue].Value())
+			if h.err = validateHeader(name, value); h.err != nil {
+				return m, nil
+			}
+			m.headers = append(m.headers, header{name: name, value: value})
+			h.selected = len(m.headers) - 1
+			h.open()
+			return m, nil
+
+		// we'll handle up and down to pick one of the added headers
+		case tea.KeyUp:
+			if h.selected > 0 {
+				h.selected--
+			}
+			return m, nil
+		case tea.KeyDown:
+			if h.selected < len(m.headers)-1 {
+				h.selected++
+			}
+			return m, nil
+
+		// we'll handle ctrl+d to remove the picked header
+		case tea.KeyCtrlD:
+			if h.selected < len(m.headers) {
+				m.headers = append(m.headers[:h.selected:h.selected], m.headers[h.selected+1:]...)
+				if h.selected > 0 && h.selected >= len(m.headers) {
+					h.selected--
+				}
+			}
+			return m, nil
+
+		// we'll handle esc to go back to the compose view
+		case tea.KeyEsc:
+			m.screen = composeScreen
+			return m, nil
+		}
+
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	h.inputs[h.focused], cmd = h.inputs[h.focused].Update(msg)
+	return m, cmd
+}
+
+// viewHeaders renders the headers panel
+func (m model) viewHeaders() string {
+
+	h := m.headersPanel
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\t%s\n\t%s\n\n\t%s\n\t%s\n\n",
+		inputStyle.Copy().Width(h.inputs[headerName].Width).Render("Header:"),
+		h.inputs[headerName].View(),
+		inputStyle.Copy().Width(h.inputs[headerValue].Width).Render("Value:"),
+		h.inputs[headerValue].View(),
+	)
+
+	if len(m.headers) == 0 {
+		b.WriteString("\t" + continueStyle.Render("No extra headers yet.") + "\n")
+	}
+	for i, hd := range m.headers {
+		cursor := "  "
+		if i == h.selected {
+			cursor = lipgloss.NewStyle().Foreground(accentColor).Render("> ")
+		}
+		fmt.Fprintf(&b, "\t%s%s: %s\n", cursor, hd.name, hd.value)
+	}
+
+	b.WriteString("\n\t" + continueStyle.Render("(enter to add, ↑/↓ and ctrl + d to remove, esc to go back)") + "\n")
+
+	if h.err != nil {
+		b.WriteString("\t" + h.err.Error() + "\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// the keys for picking a suggestion in the To field, they can't be changed
+// so they aren't in the key map, but the help lists them while there are suggestions
+var (
+	pickSuggestion    = key.NewBinding(key.WithKeys("up", "down"), key.WithHelp("↑/↓", "to pick"))
+	acceptSuggestion  = key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "to use it"))
+	dismissSuggestion = key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "to hide them"))
+)
+
+// newHelp returns the help shown below the form, in the colors of the theme
+func newHelp() help.Model {
+
+	h := help.New()
+	h.Styles.ShortKey = lipgloss.NewStyle().Foreground(accentColor)
+	h.Styles.ShortDesc = continueStyle
+	h.Styles.ShortSeparator = continueStyle
+	h.Styles.Ellipsis = continueStyle
+	h.Styles.FullKey = lipgloss.NewStyle().Foreground(accentColor)
+	h.Styles.FullDesc = continueStyle
+	h.Styles.FullSeparator = continueStyle
+
+	// a screen reader reads the dot between the keys out as "bullet"
+	if accessible {
+		h.ShortSeparator = ", "
+	}
+
+	return h
+}
+
+// shortHelp returns the keys for the help line, the ones that do something
+// right now. A narrow terminal cuts the line short, so the keys that matter
+// most come first.
+func (m model) shortHelp() []key.Binding {
+
+	if m.focused == to && m.complete.showing() {
+		return []key.Binding{pickSuggestion, acceptSuggestion, dismissSuggestion, m.keys.help}
+	}
+
+	bindings := []key.Binding{m.keys.send}
+	if m.undo.ID != "" {
+		bindings = append(bindings, m.keys.undo)
+	}
+
+	return append(bindings, m.keys.quit, m.keys.help, m.keys.inbox, m.keys.sent)
+}
+
+// fullHelp returns every key of the compose view, for the help opened with the help key
+func (m model) fullHelp() [][]key.Binding {
+
+	k := m.keys
+	return [][]key.Binding{
+		{k.next, k.prev, k.send, k.undo},
+		{k.pgp, k.pgpKeys, k.identity, k.signature, k.headers, k.attach, k.invite, k.receipts, k.priority, k.templates, k.preview, k.spell, k.fix, k.emoji, k.paste, k.copy},
+		{k.inbox, k.outbox, k.sent, k.followUps, k.search, k.help, k.quit},
+	}
+}
+
+// toggleHelp opens or closes the help with every key, the body makes room for it
+func (m *model) toggleHelp() {
+	m.help.ShowAll = !m.help.ShowAll
+	m.fitEditor()
+}
+
+// helpView renders the help below the form
+func (m model) helpView() string {
+
+	view := m.help.ShortHelpView(m.shortHelp())
+	if m.help.ShowAll {
+		view = m.fullHelpView()
+	}
+
+	// the form is indented with a tab, so every line of the help needs one too
+	return strings.ReplaceAll(view, "\n", "\n\t")
+}
+
+// fullHelpView renders every key in columns. The help bubble leaves out the
+// columns that don't fit, so in a narrow terminal we put them below each other instead.
+func (m model) fullHelpView() string {
+
+	h := m.help
+	h.Width = 0
+
+	var rows []string
+	var row [][]key.Binding
+	for _, group := range m.fullHelp() {
+		wider := append(row, group)
+		if len(row) > 0 && m.help.Width > 0 && lipgloss.Width(h.FullHelpView(wider)) > m.help.Width {
+			rows = append(rows, h.FullHelpView(row))
+			wider = [][]key.Binding{group}
+		}
+		row = wider
+	}
+	rows = append(rows, h.FullHelpView(row))
+
+	return strings.Join(rows, "\n\n")
+}
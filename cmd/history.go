@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sentItem lets us show a sent history record in a bubbles list
+type sentItem struct {
+	store.SentRecord
+	bounces []store.Bounce // the recipients it couldn't be delivered to, if any
+	waiting bool           // whether we're waiting for a reply to it
+}
+
+func (s sentItem) Title() string {
+	subject := s.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	title := fmt.Sprintf("%s to %s", subject, strings.Join(s.To, ", "))
+	if len(s.bounces) > 0 {
+		// bounced messages get a marker so they stand out
+		title = "✗ " + title
+	}
+	if s.waiting {
+		title = "⏳ " + title
+	}
+	return title
+}
+
+func (s sentItem) Description() string {
+
+	if len(s.bounces) == 0 {
+		return fmt.Sprintf("sent %s via %s: %s", s.Sent.Format("Mon 02 Jan 15:04"), s.Transport, s.Result)
+	}
+
+	// there's only room for one line, so the first bounce says why
+	b := s.bounces[0]
+	reason := b.Diagnostic
+	if reason == "" {
+		reason = b.Status
+	}
+	desc := fmt.Sprintf("bounced %s for %s: %s", b.Received.Format("Mon 02 Jan 15:04"), b.Recipient, reason)
+	if len(s.bounces) > 1 {
+		desc += fmt.Sprintf(" (and %d more)", len(s.bounces)-1)
+	}
+	return desc
+}
+
+func (s sentItem) FilterValue() string {
+	return s.Subject + " " + s.From + " " + strings.Join(s.To, " ")
+}
+
+// historyModel lists the messages sent from the account
+type historyModel struct {
+	list  list.Model
+	store *store.Store
+
+	remind    textinput.Model // the days to wait for a reply
+	reminding bool            // whether we're asking how long to wait
+	status    string
+}
+
+// newHistory returns the sent history of the given account
+func newHistory(account *config.Account) historyModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Title = "Sent (/ to search, enter to read, e to re-open, r to resend, a/A to reply, f to forward, w to await a reply)"
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+
+	remind := textinput.New()
+	remind.Prompt = "Remind me if there's no reply within how many days? "
+	remind.CharLimit = 4
+	remind.Width = 5
+
+	h := historyModel{list: l, remind: remind}
+
+	if account != nil {
+		dir, err := account.StoreDir()
+		if err == nil {
+			h.store, err = store.Open(dir)
+		}
+		if err != nil {
+			slog.Error("Could not open sent history", "err", err)
+		}
+	}
+
+	return h
+}
+
+// refresh reloads the list from the sent history
+func (h *historyModel) refresh() {
+
+	if h.store == nil {
+		return
+	}
+
+	records, err := h.store.History()
+	if err != nil {
+		slog.Error("Could not read sent history", "err", err)
+		return
+	}
+
+	// a history we can match bounces with is still worth showing without them
+	bounces, err := h.store.Bounces()
+	if err != nil {
+		slog.Error("Could not read bounces", "err", err)
+	}
+	byID := bouncesByMessage(bounces)
+
+	// the same goes for the reminders
+	followUps, err := h.store.FollowUps()
+	if err != nil {
+		slog.Error("Could not read the follow-ups", "err", err)
+	}
+	waiting := make(map[string]bool, len(followUps))
+	for _, f := range followUps {
+		waiting[mailbox.NormalizeID(f.MessageID)] = true
+	}
+
+	items := make([]list.Item, len(records))
+	for i, rec := range records {
+		item := sentItem{SentRecord: rec}
+		if rec.MessageID != "" {
+			item.bounces = byID[rec.MessageID]
+			item.waiting = waiting[mailbox.NormalizeID(rec.MessageID)]
+		}
+		items[i] = item
+	}
+	h.list.SetItems(items)
+}
+
+// selected returns the highlighted record and the message it describes
+func (h historyModel) selected() (store.SentRecord, []byte, error) {
+
+	item, ok := h.list.SelectedItem().(sentItem)
+	if !ok {
+		return store.SentRecord{}, nil, fmt.Errorf("no message selected")
+	}
+
+	raw, err := h.store.Folder(store.Sent).Get(item.Key)
+	return item.SentRecord, raw, err
+}
+
+func (h historyModel) Update(msg tea.Msg) (historyModel, tea.Cmd) {
+
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		h.list.SetSize(msg.Width, msg.Height-3)
+		return h, nil
+	}
+
+	var cmd tea.Cmd
+	h.list, cmd = h.list.Update(msg)
+	return h, cmd
+}
+
+func (h historyModel) View() string {
+
+	status := continueStyle.Render(h.status)
+	if h.reminding {
+		status = h.remind.View() + " " + continueStyle.Render("(enter to set, 0 to take the reminder away, esc to cancel)")
+	}
+	return fmt.Sprintf("%s\n%s", h.list.View(), status)
+}
+
+// updateHistory handles messages while the sent history is showing
+func (m model) updateHistory(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	h := &m.history
+
+	if msg, ok := msg.(tea.KeyMsg); ok && h.reminding {
+		switch msg.Type {
+
+		// we'll handle enter to set the reminder
+		case tea.KeyEnter:
+			h.reminding = false
+			h.remind.Blur()
+			days, err := strconv.Atoi(strings.TrimSpace(h.remind.Value()))
+			if err != nil || days < 0 {
+				h.status = "The days to wait should be a number, like 3"
+				return m, nil
+			}
+			rec, _, err := h.selected()
+			if err == nil {
+				err = m.followUps.remind(rec, days)
+			}
+			switch {
+			case err != nil:
+				h.status = "Could not set the reminder: " + err.Error()
+			case days == 0:
+				h.status = "No longer waiting for a reply"
+			default:
+				h.status = fmt.Sprintf("You'll be reminded on %s if there's no reply", rec.Sent.AddDate(0, 0, days).Format("Mon 02 Jan"))
+			}
+			h.refresh()
+			return m, nil
+
+		// we'll handle esc to leave the reminder as it was
+		case tea.KeyEsc:
+			h.reminding = false
+			h.remind.Blur()
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		h.remind, cmd = h.remind.Update(msg)
+		return m, cmd
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.history.list.FilterState() != list.Filtering {
+		switch msg.String() {
+
+		// we'll handle enter to read the selected message
+		case "enter":
+			rec, raw, err := m.history.selected()
+			if err == nil {
+				err = m.openReader(raw, sentScreen, store.Sent, rec.Key)
+			}
+			if err != nil {
+				m.status = "Could not open message: " + err.Error()
+				m.screen = composeScreen
+			}
+			return m, nil
+
+		// we'll handle e to copy the selected message into the form, so it can be changed and sent again
+		case "e":
+			_, raw, err := m.history.selected()
+			if err == nil {
+				err = m.reopenSent(raw)
+			}
+			if err != nil {
+				m.status = "Could not re-open message: " + err.Error()
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle r to send the selected message again exactly as it was
+		case "r":
+			rec, raw, err := m.history.selected()
+			if err == nil && m.outbox == nil {
+				err = fmt.Errorf("resending needs an account to queue the message in")
+			}
+			if err == nil {
+				_, err = m.outbox.Enqueue(rec.From, rec.To, rec.Subject, raw)
+			}
+			if err != nil {
+				m.status = "Could not resend message: " + err.Error()
+				m.screen = composeScreen
+				return m, nil
+			}
+			m.queue.refresh(m.outbox)
+			m.status = "Resending " + sentItem{SentRecord: rec}.Title()
+			m.screen = composeScreen
+			cmd := m.flush()
+			return m, cmd
+
+		// we'll handle a, A and f to follow up on, or forward, the selected message
+		case "a", "A", "f":
+			_, raw, err := m.history.selected()
+			if err == nil {
+				err = m.startReply(raw, replyKeys[msg.String()])
+			}
+			if err != nil {
+				m.status = "Could not open message: " + err.Error()
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle w to be reminded of the selected message if nobody replies to it
+		case "w":
+			item, ok := h.list.SelectedItem().(sentItem)
+			if !ok {
+				return m, nil
+			}
+			days := strconv.Itoa(defaultFollowUpDays)
+			if fu, ok := m.followUps.waiting(item.MessageID); ok {
+				// the reminder that is set is what we start from
+				days = strconv.Itoa(max(int(fu.Due.Sub(item.Sent).Hours()/24), 1))
+			}
+			h.reminding, h.status = true, ""
+			h.remind.SetValue(days)
+			h.remind.CursorEnd()
+			return m, h.remind.Focus()
+
+		// we'll handle esc to go back to the compose view, unless the list is using it
+		case "esc":
+			if m.history.list.FilterState() == list.Unfiltered {
+				m.screen = composeScreen
+				return m, nil
+			}
+		}
+
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.history, cmd = m.history.Update(msg)
+	return m, cmd
+}
+
+// reopenSent loads a sent message into the compose form as a new message
+func (m *model) reopenSent(raw []byte) error {
+
+	d, err := parseDraft("", raw)
+	if err != nil {
+		return err
+	}
+
+	// whatever was in the form is kept as a draft rather than thrown away
+	if err := m.saveDraft(); err != nil {
+		return err
+	}
+
+	m.resetForm()
+	m.resumeDraft(d)
+	m.draftKey, m.saved = "", draft{}
+	return nil
+}
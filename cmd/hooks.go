@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// postHooks tracks the post-send hooks still running, so they aren't cut off when the program exits
+var postHooks sync.WaitGroup
+
+// hookRun is what a hook is told about the message, in GO_MAILER_ variables
+type hookRun struct {
+	account   *config.Account
+	transport string
+	from      string
+	to        []string
+	subject   string
+
+	// only for the post-send hooks, how sending went
+	result string
+	reply  string
+	err    error
+}
+
+// env returns the variables the hook gets on top of go-mailer's own
+func (r hookRun) env(stage string, raw []byte) []string {
+
+	env := append(os.Environ(),
+		"GO_MAILER_HOOK="+stage,
+		"GO_MAILER_ACCOUNT="+r.account.Name,
+		"GO_MAILER_TRANSPORT="+r.transport,
+		"GO_MAILER_FROM="+r.from,
+		"GO_MAILER_TO="+strings.Join(r.to, ","),
+		"GO_MAILER_SUBJECT="+r.subject,
+		"GO_MAILER_MESSAGE_ID="+messageID(raw),
+	)
+	if r.result != "" {
+		env = append(env, "GO_MAILER_RESULT="+r.result, "GO_MAILER_REPLY="+r.reply)
+	}
+	if r.err != nil {
+		env = append(env, "GO_MAILER_ERROR="+r.err.Error())
+	}
+	return env
+}
+
+// preSend runs the account's pre-send hooks one after the other, each
+// given the message the one before it left. A hook that fails stops the
+// message, with what it printed on stderr as the reason.
+func preSend(r hookRun, raw []byte) ([]byte, error) {
+
+	for _, hook := range r.account.Hooks.PreSend {
+		out, err := runHook(r.account.Hooks, hook, r.env("pre_send", raw), raw)
+		if err != nil {
+			return nil, &transport.RefusedError{By: "the pre-send hook " + hook, Reason: err.Error()}
+		}
+
+		// printing nothing leaves the message as it is
+		if len(bytes.TrimSpace(out)) == 0 {
+			continue
+		}
+		if _, err := mail.ReadMessage(bytes.NewReader(out)); err != nil {
+			return nil, &transport.RefusedError{By: "the pre-send hook " + hook, Reason: "what it printed isn't a message: " + err.Error()}
+		}
+		// a script is likely to write plain \n line endings
+		raw = bytes.ReplaceAll(bytes.ReplaceAll(out, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+		slog.Info("A pre-send hook rewrote the message", "account", r.account.Name, "hook", hook)
+	}
+
+	return raw, nil
+}
+
+// postSend runs the account's post-send hooks in the background, what
+// goes wrong with them goes in the log since the message has gone its way
+func postSend(r hookRun, raw []byte) {
+
+	if len(r.account.Hooks.PostSend) == 0 {
+		return
+	}
+
+	r.result = statusSent
+	if r.err != nil {
+		r.result = "failed"
+	}
+	env := r.env("post_send", raw)
+
+	postHooks.Add(1)
+	go func() {
+		defer postHooks.Done()
+		for _, hook := range r.account.Hooks.PostSend {
+			if _, err := runHook(r.account.Hooks, hook, env, raw); err != nil {
+				slog.Error("The post-send hook failed", "account", r.account.Name, "hook", hook, "id", messageID(raw), "err", err)
+			}
+		}
+	}()
+}
+
+// waitHooks waits for the post-send hooks still running, before the program exits
+func waitHooks() {
+	postHooks.Wait()
+}
+
+// runHook runs a hook with the message on stdin and returns what it printed
+func runHook(hooks config.Hooks, hook string, env []string, raw []byte) ([]byte, error) {
+
+	path, err := config.ExpandHome(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hooks.TimeLimit())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(raw)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// a script's own children can keep its output open after it is stopped
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("it took longer than %s", hooks.TimeLimit())
+	case err != nil:
+		// what it said is the best reason, the exit status is the next best
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/i18n"
+)
+
+// catalog translates what the TUI says, it is nil for English
+var catalog *i18n.Catalog
+
+// tr translates s into the user's language
+func tr(s string) string {
+	return catalog.T(s)
+}
+
+// trf translates the format into the user's language and fills it in
+func trf(format string, args ...any) string {
+	return fmt.Sprintf(catalog.T(format), args...)
+}
+
+// setLanguage picks the language of the TUI: the one --lang asks for, else
+// the one in the config, else the one of the environment. Our own locale
+// files are kept next to the config, in locales.
+func setLanguage(cfg *config.Config, configPath, lang string) error {
+
+	dir := filepath.Join(filepath.Dir(configPath), "locales")
+
+	if lang == "" {
+		lang = cfg.Language
+	}
+	if lang != "" {
+		c, err := i18n.Load(dir, lang)
+		if err != nil {
+			return err
+		}
+		catalog = c
+		return nil
+	}
+
+	// a language we have no translation for is fine when the environment
+	// asks for it, English is what the TUI says without one
+	catalog, _ = i18n.Load(dir, i18n.FromEnv())
+	return nil
+}
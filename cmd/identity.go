@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/mail"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// sender returns the identity of the account the message in the form is
+// from, the account's own when the From field isn't one of its identities
+func (m model) sender() config.Identity {
+
+	if m.account == nil {
+		return config.Identity{}
+	}
+
+	id, _ := m.account.Sender(m.inputs[from].Value())
+	return id
+}
+
+// nextSender fills the From field in with the identity after the one it
+// holds, an address that isn't one of them starts again at the first
+func (m *model) nextSender() {
+
+	if m.account == nil {
+		return
+	}
+
+	senders := m.account.Senders()
+	next := 0
+	if id, ok := m.account.Sender(m.inputs[from].Value()); ok {
+		for i, s := range senders {
+			if s.Address == id.Address {
+				next = (i + 1) % len(senders)
+			}
+		}
+	}
+
+	m.inputs[from].SetValue(senders[next].From())
+	m.checkKeys()
+}
+
+// replyIdentity picks the identity a reply goes out from, the one the message
+// was sent to. If it wasn't sent to any of them we answer as the account.
+func replyIdentity(account *config.Account, h mail.Header) config.Identity {
+
+	for _, name := range []string{"Delivered-To", "To", "Cc"} {
+		list, err := h.AddressList(name)
+		if err != nil {
+			continue
+		}
+		for _, a := range list {
+			if id, ok := account.Sender(a.Address); ok {
+				return id
+			}
+		}
+	}
+
+	id, _ := account.Sender("")
+	return id
+}
+
+// senderStatus says who the message is from, when the account has more than one identity to pick from
+func (m model) senderStatus() string {
+
+	if m.account == nil || len(m.account.Identities) == 0 {
+		return ""
+	}
+
+	return "👤 from " + m.sender().From() + " (" + keyHelp(m.keys.identity) + " for another identity)"
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/termimage"
+	"github.com/aidk/go-mailer/pkg/email"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// imagesShownMsg is sent once the images have been looked at and the reader is back
+type imagesShownMsg struct {
+	err error
+}
+
+// imageProtocol returns how the terminal shows images, as the config asks for
+func imageProtocol(cfg *config.Config) termimage.Protocol {
+	switch cfg.ImagePreview() {
+	case config.ImagesKitty:
+		return termimage.Kitty
+	case config.ImagesSixel:
+		return termimage.Sixel
+	case config.ImagesOff:
+		return termimage.None
+	}
+	return termimage.Detect()
+}
+
+// isImage reports whether the attachment is an image we can show, inline
+// images are attachments too, without a name of their own
+func isImage(f email.Attachment) bool {
+	switch http.DetectContentType(f.Data) {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// imageSize describes the size of an image attachment, or is empty if it can't be read
+func imageSize(f email.Attachment) string {
+	if !isImage(f) {
+		return ""
+	}
+	img, err := termimage.Decode(f.Data)
+	if err != nil {
+		return ""
+	}
+	b := img.Bounds()
+	return fmt.Sprintf("%d×%d image", b.Dx(), b.Dy())
+}
+
+// imagesCommand draws the images while the program is paused, one screen
+// each. Bubble Tea redraws its screen line by line, which would cut through
+// an image, so the images get the terminal to themselves for a while.
+type imagesCommand struct {
+	files    []email.Attachment
+	protocol termimage.Protocol
+	width    int
+	height   int
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (c *imagesCommand) SetStdin(r io.Reader)  { c.stdin = r }
+func (c *imagesCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *imagesCommand) SetStderr(io.Writer)   {}
+
+// Run shows the images until enter has been pressed after the last one, or q after any
+func (c *imagesCommand) Run() error {
+
+	in := bufio.NewReader(c.stdin)
+	defer termimage.Clear(c.stdout, c.protocol)
+
+	for i, f := range c.files {
+		img, err := termimage.Decode(f.Data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Filename, err)
+		}
+
+		// the top line names the image and the bottom one says what to press
+		termimage.Clear(c.stdout, c.protocol)
+		fmt.Fprintf(c.stdout, "\x1b[2J\x1b[H%s (%d of %d)\r\n", f.Filename, i+1, len(c.files))
+		if err := termimage.Write(c.stdout, img, c.protocol, c.width, c.height-3); err != nil {
+			return err
+		}
+
+		next := "enter to go back"
+		if i < len(c.files)-1 {
+			next = "enter for the next image, q and enter to go back"
+		}
+		fmt.Fprintf(c.stdout, "\x1b[%d;1H%s", c.height, next)
+
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		if strings.TrimSpace(line) == "q" {
+			return nil
+		}
+	}
+	return nil
+}
+
+// showImages shows the message's images
+func (r *readerModel) showImages() tea.Cmd {
+
+	var images []email.Attachment
+	for _, f := range r.files {
+		if isImage(f) {
+			images = append(images, f)
+		}
+	}
+
+	c := &imagesCommand{files: images, protocol: r.protocol, width: r.width, height: r.height}
+	return tea.Exec(c, func(err error) tea.Msg {
+		return imagesShownMsg{err: err}
+	})
+}
+
+// images reports whether the message has images to show, and the terminal can show them
+func (r *readerModel) images() bool {
+	if r.protocol == termimage.None {
+		return false
+	}
+	for _, f := range r.files {
+		if isImage(f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/imapclient"
+	"github.com/aidk/go-mailer/internal/jmap"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/pop3"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// inboxLimit is how many of the newest messages we show in the inbox
+const inboxLimit = 50
+
+// inboxKeys are the keys shown in the title of the message list, ? shows the rest
+const inboxKeys = "enter to read, a to reply, A to reply all, f to forward, r to refresh, ? for more"
+
+type (
+	// newMailMsg is sent by the IDLE watcher when new messages arrive
+	newMailMsg struct {
+		count int
+	}
+
+	// envelopesMsg is sent when the inbox has finished loading
+	envelopesMsg struct {
+		folder    string
+		envelopes []mailbox.Envelope
+		err       error
+	}
+)
+
+// envelopeItem lets us show an envelope in a bubbles list. The inbox is
+// grouped by conversation, the first message of a thread says how many
+// messages it has and the replies below it are indented.
+type envelopeItem struct {
+	mailbox.Envelope
+	reply   bool // whether it follows an earlier message of the same thread
+	replies int  // how many messages follow it in the thread
+}
+
+func (e envelopeItem) Title() string {
+
+	title := e.Subject
+	if e.Flagged {
+		title = "⚑ " + title
+	}
+	if !e.Seen {
+		// unread messages get a marker so they stand out
+		title = "● " + title
+	}
+	if e.Deleted {
+		// they're still there until the folder is expunged
+		title = "✗ " + title
+	}
+	if e.replies > 0 {
+		title += fmt.Sprintf(" (%d)", e.replies+1)
+	}
+	if e.reply {
+		title = "  ↳ " + title
+	}
+
+	return title
+}
+
+func (e envelopeItem) Description() string {
+	return fmt.Sprintf("%s - %s", e.From, e.Date.Format("02 Jan 15:04"))
+}
+
+func (e envelopeItem) FilterValue() string {
+	return e.From + " " + e.Subject
+}
+
+// inboxModel is the message list for the account's mailbox
+type inboxModel struct {
+	list    list.Model
+	account *config.Account
+	err     error
+
+	folder    string // the folder that is showing
+	envelopes []mailbox.Envelope
+
+	// checked holds the ids of the messages already looked at for bounces
+	checked map[string]bool
+}
+
+// newInbox returns an empty inbox for the given account
+func newInbox(account *config.Account) inboxModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Styles = themedListStyles()
+	l.AdditionalFullHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "read/unread")),
+			key.NewBinding(key.WithKeys("*"), key.WithHelp("*", "flag")),
+			key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete/undelete")),
+			key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "expunge deleted")),
+			key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "move to folder")),
+			key.NewBinding(key.WithKeys("F"), key.WithHelp("F", "folders")),
+		}
+	}
+
+	// we handle esc ourselves to go back to the compose view
+	l.DisableQuitKeybindings()
+
+	i := inboxModel{
+		list:    l,
+		account: account,
+		folder:  defaultFolder(account),
+		checked: make(map[string]bool),
+	}
+	i.list.Title = i.title("")
+	return i
+}
+
+// title is shown above the message list, with what is going on or else the keys
+func (i inboxModel) title(status string) string {
+	if status == "" {
+		status = inboxKeys
+	}
+	return fmt.Sprintf("%s (%s)", i.folder, status)
+}
+
+// enabled reports whether the account has a mailbox we can show
+func (i inboxModel) enabled() bool {
+
+	if i.account == nil {
+		return false
+	}
+
+	switch i.account.BackendName() {
+	case config.BackendJMAP:
+		return i.account.JMAP.Enabled()
+	case config.BackendPOP3:
+		return i.account.POP3.Enabled()
+	default:
+		return i.account.IMAP.Enabled()
+	}
+}
+
+// filtering reports whether the user is typing into the list's filter
+func (i inboxModel) filtering() bool {
+	return i.list.FilterState() == list.Filtering
+}
+
+// load fetches the newest envelopes in the background
+func (i inboxModel) load() tea.Cmd {
+
+	if !i.enabled() {
+		return nil
+	}
+
+	account, folder := *i.account, i.folder
+	return func() tea.Msg {
+		envelopes, err := fetchEnvelopes(account, folder)
+		return envelopesMsg{folder: folder, envelopes: envelopes, err: err}
+	}
+}
+
+// open shows another folder in the inbox
+func (i *inboxModel) open(folder string) tea.Cmd {
+	i.folder, i.envelopes, i.err = folder, nil, nil
+	i.list.Title = i.title("loading...")
+	return tea.Batch(i.list.SetItems(nil), i.load())
+}
+
+// fetchEnvelopes returns the newest envelopes in the folder using the account's backend
+func fetchEnvelopes(account config.Account, folder string) ([]mailbox.Envelope, error) {
+
+	switch account.BackendName() {
+
+	case config.BackendJMAP:
+		c, err := jmap.Dial(account.JMAP)
+		if err != nil {
+			return nil, err
+		}
+		return c.Envelopes(inboxLimit)
+
+	case config.BackendPOP3:
+		// POP3 has no folders to browse, so we download new mail into
+		// the local store and show what's in there
+		dir, err := account.StoreDir()
+		if err != nil {
+			return nil, err
+		}
+		s, err := store.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pop3.Fetch(account.POP3, s); err != nil {
+			return nil, err
+		}
+		return s.Folder(folder).Envelopes(inboxLimit)
+
+	default:
+		c, err := imapclient.Dial(account.IMAP)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return c.Envelopes(folder, inboxLimit)
+	}
+}
+
+// fetchOriginal fetches the whole of the selected message in the background,
+// so it can be replied to or forwarded
+func (i *inboxModel) fetchOriginal(mode replyMode) tea.Cmd {
+
+	item, ok := i.list.SelectedItem().(envelopeItem)
+	if !ok {
+		return nil
+	}
+
+	i.list.Title = i.title("opening message...")
+	account, folder := *i.account, i.folder
+	return func() tea.Msg {
+		raw, err := fetchMessage(account, folder, item.ID)
+		return originalMsg{raw: raw, mode: mode, err: err}
+	}
+}
+
+// fetchToRead fetches the whole of the selected message in the background, to read it
+func (i *inboxModel) fetchToRead() tea.Cmd {
+
+	item, ok := i.list.SelectedItem().(envelopeItem)
+	if !ok {
+		return nil
+	}
+
+	i.list.Title = i.title("opening message...")
+	account, folder := *i.account, i.folder
+	return func() tea.Msg {
+		raw, err := fetchMessage(account, folder, item.ID)
+		return readMsg{raw: raw, err: err}
+	}
+}
+
+// fetchMessage returns the raw message in the folder with the given id using the account's backend
+func fetchMessage(account config.Account, folder, id string) ([]byte, error) {
+
+	switch account.BackendName() {
+
+	case config.BackendJMAP:
+		c, err := jmap.Dial(account.JMAP)
+		if err != nil {
+			return nil, err
+		}
+		return c.Message(id)
+
+	case config.BackendPOP3:
+		// the inbox shows the local store, so the message is already here
+		dir, err := account.StoreDir()
+		if err != nil {
+			return nil, err
+		}
+		s, err := store.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		return s.Folder(folder).Get(id)
+
+	default:
+		c, err := imapclient.Dial(account.IMAP)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return c.Message(folder, id)
+	}
+}
+
+func (i inboxModel) Update(msg tea.Msg) (inboxModel, tea.Cmd) {
+
+	switch msg := msg.(type) {
+
+	case tea.WindowSizeMsg:
+		i.list.SetSize(msg.Width, msg.Height-2)
+		return i, nil
+
+	case envelopesMsg:
+		// a folder we have since left may still have been loading
+		if msg.folder != i.folder {
+			return i, nil
+		}
+		i.list.Title = i.title("")
+		i.err = msg.err
+		if msg.err != nil {
+			return i, nil
+		}
+		i.envelopes = msg.envelopes
+		return i, tea.Batch(i.show(), i.findBounces(msg.envelopes), i.findReplies(msg.envelopes))
+
+	// the changes the mailbox made are made to the list too, rather than loading it again
+	case flagMsg:
+		if msg.err != nil {
+			i.list.Title = i.title("could not change the flag: " + msg.err.Error())
+			return i, nil
+		}
+		i.list.Title = i.title("")
+		if msg.folder != i.folder {
+			return i, nil
+		}
+		for n, e := range i.envelopes {
+			if e.ID != msg.id {
+				continue
+			}
+			switch msg.flag {
+			case mailbox.FlagSeen:
+				i.envelopes[n].Seen = msg.on
+			case mailbox.FlagFlagged:
+				i.envelopes[n].Flagged = msg.on
+			case mailbox.FlagDeleted:
+				i.envelopes[n].Deleted = msg.on
+			}
+		}
+		return i, i.show()
+
+	case movedMsg:
+		if msg.err != nil {
+			i.list.Title = i.title("could not move the message: " + msg.err.Error())
+			return i, nil
+		}
+		i.list.Title = i.title("moved to " + msg.to)
+		if msg.folder != i.folder {
+			return i, nil
+		}
+		return i, i.drop(func(e mailbox.Envelope) bool { return e.ID == msg.id })
+
+	case expungedMsg:
+		if msg.err != nil {
+			i.list.Title = i.title("could not expunge: " + msg.err.Error())
+			return i, nil
+		}
+		i.list.Title = i.title("")
+		if msg.folder != i.folder {
+			return i, nil
+		}
+		return i, i.drop(func(e mailbox.Envelope) bool { return e.Deleted })
+
+	case tea.KeyMsg:
+		// while filtering every key belongs to the filter input
+		if i.filtering() {
+			break
+		}
+
+		switch msg.String() {
+		case "r":
+			i.list.Title = i.title("refreshing...")
+			return i, i.load()
+
+		// we'll handle u, * and d to mark the selected message as read, flagged or deleted, or not
+		case "u", "*", "d":
+			item, ok := i.list.SelectedItem().(envelopeItem)
+			if !ok {
+				return i, nil
+			}
+			flag, on := mailbox.FlagSeen, !item.Seen
+			switch msg.String() {
+			case "*":
+				flag, on = mailbox.FlagFlagged, !item.Flagged
+			case "d":
+				flag, on = mailbox.FlagDeleted, !item.Deleted
+			}
+			i.list.Title = i.title("changing flags...")
+			return i, setFlag(*i.account, i.folder, item.ID, flag, on)
+
+		// we'll handle x to remove the messages marked as deleted for good
+		case "x":
+			i.list.Title = i.title("expunging...")
+			return i, expungeFolder(*i.account, i.folder)
+		}
+	}
+
+	var cmd tea.Cmd
+	i.list, cmd = i.list.Update(msg)
+	return i, cmd
+}
+
+// show puts the envelopes in the list, grouped by conversation
+func (i *inboxModel) show() tea.Cmd {
+
+	var items []list.Item
+	for _, thread := range mailbox.Threads(i.envelopes) {
+		for n, e := range thread {
+			item := envelopeItem{Envelope: e, reply: n > 0}
+			if n == 0 {
+				item.replies = len(thread) - 1
+			}
+			items = append(items, item)
+		}
+	}
+	return i.list.SetItems(items)
+}
+
+// drop takes the envelopes that are no longer in the folder out of the list
+func (i *inboxModel) drop(gone func(mailbox.Envelope) bool) tea.Cmd {
+
+	kept := i.envelopes[:0]
+	for _, e := range i.envelopes {
+		if !gone(e) {
+			kept = append(kept, e)
+		}
+	}
+	i.envelopes = kept
+	return i.show()
+}
+
+// View renders the inbox list
+func (i inboxModel) View() string {
+
+	if !i.enabled() {
+		return "\n\tNo mail account configured.\n\n\t" + continueStyle.Render("(esc to go back)") + "\n"
+	}
+
+	if i.err != nil {
+		return "\n\t" + i.err.Error() + "\n\n\t" + continueStyle.Render("(r to retry or esc to go back)") + "\n"
+	}
+
+	return i.list.View()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+var (
+	// markdownImage matches an image written the Markdown way in the body, e.g. ![logo](~/logo.png)
+	markdownImage = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+	// imgSource matches the src of an img tag in the HTML
+	imgSource = regexp.MustCompile(`(<img\b[^>]*?\bsrc\s*=\s*)("[^"]*"|'[^']*')`)
+
+	// urlScheme matches the start of a URL, an image with one isn't a file on disk
+	urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+)
+
+// hasImages reports whether the body shows any images
+func hasImages(body string) bool {
+	return markdownImage.MatchString(body)
+}
+
+// textImages replaces the images in the plain text version of the body with
+// what they show, the images themselves are only in the HTML version
+func textImages(body string) string {
+
+	return markdownImage.ReplaceAllStringFunc(body, func(s string) string {
+		m := markdownImage.FindStringSubmatch(s)
+		alt := m[1]
+		if alt == "" {
+			alt = filepath.Base(m[2])
+		}
+		return "[image: " + alt + "]"
+	})
+}
+
+// htmlLine escapes a line of the body for the HTML version, turning its images into img tags
+func htmlLine(line string) string {
+
+	var b strings.Builder
+	last := 0
+	for _, m := range markdownImage.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(html.EscapeString(line[last:m[0]]))
+		alt, src := line[m[2]:m[3]], line[m[4]:m[5]]
+		fmt.Fprintf(&b, `<img src="%s" alt="%s">`, html.EscapeString(src), html.EscapeString(alt))
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(line[last:]))
+
+	return b.String()
+}
+
+// embedImages finds the images in the HTML that are files on disk, and
+// points them at related parts that carry the files along instead. The
+// message's id keeps their Content-IDs from clashing with other messages'.
+func embedImages(htmlText, id string) (string, []email.Image, error) {
+
+	var (
+		images []email.Image
+		cids   = make(map[string]string) // an image shown twice is only sent once
+		err    error
+	)
+
+	htmlText = imgSource.ReplaceAllStringFunc(htmlText, func(s string) string {
+		m := imgSource.FindStringSubmatch(s)
+		src := html.UnescapeString(m[2][1 : len(m[2])-1])
+		if err != nil || src == "" || urlScheme.MatchString(src) {
+			return s
+		}
+
+		cid, ok := cids[src]
+		if !ok {
+			var image email.Image
+			if image, err = readImage(src); err != nil {
+				return s
+			}
+			image.CID = fmt.Sprintf("image%d.%s", len(images)+1, strings.Trim(id, "<>"))
+			images = append(images, image)
+			cids[src] = image.CID
+			cid = image.CID
+		}
+
+		return m[1] + `"cid:` + cid + `"`
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return htmlText, images, nil
+}
+
+// readImage reads an image to show inline, its path can start with ~
+func readImage(src string) (email.Image, error) {
+
+	path, err := config.ExpandHome(src)
+	if err != nil {
+		return email.Image{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return email.Image{}, fmt.Errorf("could not read image: %w", err)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	if !strings.HasPrefix(contentType, "image/") {
+		return email.Image{}, fmt.Errorf("%s is not an image", src)
+	}
+
+	return email.Image{Attachment: email.Attachment{Filename: filepath.Base(path), ContentType: contentType, Data: data}}, nil
+}
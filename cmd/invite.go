@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aidk/go-mailer/internal/ical"
+)
+
+// the inputs of the invite panel
+const (
+	inviteSummary = iota
+	inviteStart
+	inviteDuration
+	inviteLocation
+)
+
+// inviteLabels are the names of the invite panel's inputs
+var inviteLabels = []string{inviteSummary: "What:", inviteStart: "When:", inviteDuration: "How long:", inviteLocation: "Where:"}
+
+// meeting is what the message invites its recipients to. Who is invited is
+// worked out from the To and Cc addresses when the message is sent, so
+// they can still be changed after the invite is made.
+type meeting struct {
+	uid      string
+	summary  string
+	location string
+	start    time.Time
+	end      time.Time
+}
+
+// inviteModel is the panel where the meeting the message invites to is filled in
+type inviteModel struct {
+	inputs  []textinput.Model
+	focused int
+	err     error
+}
+
+// newInvite returns an empty invite panel
+func newInvite() inviteModel {
+
+	placeholders := []string{
+		inviteSummary:  "e.g. Planning meeting, the subject if it's left empty...",
+		inviteStart:    "e.g. 14:00, tomorrow 09:30, 2006-01-02 15:04...",
+		inviteDuration: "e.g. 30m, 1h, 1h30m...",
+		inviteLocation: "e.g. Room 4, or a link to the call...",
+	}
+
+	inputs := make([]textinput.Model, len(placeholders))
+	for i, p := range placeholders {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = p
+		inputs[i].Width = defaultFieldWidth
+		inputs[i].Prompt = ""
+	}
+
+	return inviteModel{inputs: inputs}
+}
+
+// resize makes the inputs as wide as the terminal has room for
+func (v *inviteModel) resize(width int) {
+	for i := range v.inputs {
+		v.inputs[i].Width = fieldWidth(width)
+	}
+}
+
+// open fills the panel in from the meeting the message already invites to, if there is one
+func (v *inviteModel) open(mt *meeting) {
+
+	for i := range v.inputs {
+		v.inputs[i].SetValue("")
+		v.inputs[i].Blur()
+	}
+	v.inputs[inviteDuration].SetValue("1h")
+	if mt != nil {
+		v.inputs[inviteSummary].SetValue(mt.summary)
+		v.inputs[inviteStart].SetValue(mt.start.Format("2006-01-02 15:04"))
+		// a duration is written like 1h0m0s, we leave off the zeroes at the end
+		length := strings.TrimSuffix(mt.end.Sub(mt.start).String(), "0s")
+		if strings.HasSuffix(length, "h0m") {
+			length = strings.TrimSuffix(length, "0m")
+		}
+		v.inputs[inviteDuration].SetValue(length)
+		v.inputs[inviteLocation].SetValue(mt.location)
+	}
+
+	v.focused = inviteSummary
+	v.inputs[v.focused].Focus()
+	v.err = nil
+}
+
+// meeting reads the meeting out of the panel, it keeps the uid of the one
+// it replaces so sending it again moves the meeting instead of adding another
+func (v inviteModel) meeting(old *meeting, subj string) (*meeting, error) {
+
+	summary := strings.TrimSpace(v.inputs[inviteSummary].Value())
+	if summary == "" {
+		summary = strings.TrimSpace(subj)
+	}
+	if summary == "" {
+		return nil, fmt.Errorf("what is the meeting about?")
+	}
+
+	when := strings.TrimSpace(v.inputs[inviteStart].Value())
+	if when == "" {
+		return nil, fmt.Errorf("when is the meeting?")
+	}
+	start, err := parseSendAt(when, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid time, try 14:00, tomorrow 09:30 or 2006-01-02 15:04")
+	}
+
+	length, err := time.ParseDuration(strings.TrimSpace(v.inputs[inviteDuration].Value()))
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("invalid length, try 30m, 1h or 1h30m")
+	}
+
+	mt := &meeting{
+		summary:  summary,
+		location: strings.TrimSpace(v.inputs[inviteLocation].Value()),
+		start:    start,
+		end:      start.Add(length),
+	}
+	if old != nil {
+		mt.uid = old.uid
+	} else {
+		b := make([]byte, 16)
+		rand.Read(b)
+		mt.uid = hex.EncodeToString(b) + "@go-mailer"
+	}
+
+	return mt, nil
+}
+
+// event turns the meeting into the calendar event sent with the message,
+// everyone it goes to or is copied on is invited
+func (mt meeting) event(msg message) ical.Event {
+
+	e := ical.Event{
+		UID:         mt.uid,
+		Summary:     mt.summary,
+		Description: strings.TrimSpace(msg.body),
+		Location:    mt.location,
+		Start:       mt.start,
+		End:         mt.end,
+		Organizer:   ical.Person{Name: msg.from.Name, Address: msg.from.Address},
+		Stamp:       time.Now(),
+	}
+
+	// the attendees are the recipients everyone can see, those in Bcc get
+	// the invitation without being listed, like the message itself
+	attendees := append(append([]*mail.Address(nil), msg.to...), msg.copied("Cc")...)
+	seen := make(map[string]bool)
+	for _, a := range attendees {
+		if seen[strings.ToLower(a.Address)] {
+			continue
+		}
+		seen[strings.ToLower(a.Address)] = true
+		e.Attendees = append(e.Attendees, ical.Person{Name: a.Name, Address: a.Address})
+	}
+
+	return e
+}
+
+// when writes when the meeting is, the way the form shows it
+func (mt meeting) when() string {
+	return mt.start.Format("Mon 02 Jan 15:04") + " – " + mt.end.Format("15:04")
+}
+
+// updateInvite handles messages while the invite panel is showing
+func (m model) updateInvite(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	v := &m.invitePanel
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+
+		// we'll handle tab and shift+tab to move between the inputs
+		case tea.KeyTab, tea.KeyShiftTab:
+			v.inputs[v.focused].Blur()
+			n := len(v.inputs)
+			if msg.Type == tea.KeyTab {
+				v.focused = (v.focused + 1) % n
+			} else {
+				v.focused = (v.focused - 1 + n) % n
+			}
+			v.inputs[v.focused].Focus()
+			return m, nil
+
+		// we'll handle enter to put the invite in the message
+		case tea.KeyEnter:
+			mt, err := v.meeting(m.meeting, m.inputs[subject].Value())
+			if v.err = err; v.err != nil {
+				return m, nil
+			}
+			m.meeting = mt
+			if strings.TrimSpace(m.inputs[subject].Value()) == "" {
+				m.inputs[subject].SetValue("Invitation: " + mt.summary)
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle ctrl+d to take the invite out of the message
+		case tea.KeyCtrlD:
+			m.meeting = nil
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle esc to go back to the compose view, leaving the invite as it was
+		case tea.KeyEsc:
+			m.screen = composeScreen
+			return m, nil
+		}
+
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	v.inputs[v.focused], cmd = v.inputs[v.focused].Update(msg)
+	return m, cmd
+}
+
+// viewInvite renders the invite panel
+func (m model) viewInvite() string {
+
+	v := m.invitePanel
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\t%s\n\n", focusStyle.Render("Invite the recipients to a meeting"))
+	for i, name := range inviteLabels {
+		fmt.Fprintf(&b, "\t%s\n\t%s\n\n", inputStyle.Copy().Width(v.inputs[i].Width).Render(name), v.inputs[i].View())
+	}
+
+	help := "(tab to move, enter to add the invite, esc to go back"
+	if m.meeting != nil {
+		help += ", ctrl+d to remove the invite"
+	}
+	b.WriteString("\t" + continueStyle.Render(help+")") + "\n")
+
+	if v.err != nil {
+		b.WriteString("\t" + errorStyle.Render(v.err.Error()) + "\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// keyMap holds the keys of the compose view, each action can be bound to
+// other keys in the [keys] section of the config
+type keyMap struct {
+	send      key.Binding
+	next      key.Binding
+	prev      key.Binding
+	quit      key.Binding
+	undo      key.Binding
+	inbox     key.Binding
+	outbox    key.Binding
+	sent      key.Binding
+	followUps key.Binding
+	search    key.Binding
+	pgp       key.Binding
+	signature key.Binding
+	headers   key.Binding
+	attach    key.Binding
+	invite    key.Binding
+	receipts  key.Binding
+	priority  key.Binding
+	identity  key.Binding
+	pgpKeys   key.Binding
+	templates key.Binding
+	preview   key.Binding
+	spell     key.Binding
+	fix       key.Binding
+	copy      key.Binding
+	emoji     key.Binding
+	paste     key.Binding
+	help      key.Binding
+}
+
+// keyAction is an action in the config, with the keys it has unless they're changed
+type keyAction struct {
+	name    string
+	keys    []string
+	help    string
+	binding func(*keyMap) *key.Binding
+}
+
+// keyActions are the actions which can be bound to other keys, in the order the help line shows them
+var keyActions = []keyAction{
+	{"quit", []string{"ctrl+c"}, "to quit", func(k *keyMap) *key.Binding { return &k.quit }},
+	{"inbox", []string{"ctrl+o"}, "for inbox", func(k *keyMap) *key.Binding { return &k.inbox }},
+	{"sent", []string{"ctrl+t"}, "for sent", func(k *keyMap) *key.Binding { return &k.sent }},
+	{"followups", []string{"alt+w"}, "for follow-ups", func(k *keyMap) *key.Binding { return &k.followUps }},
+	{"search", []string{"alt+/"}, "to search", func(k *keyMap) *key.Binding { return &k.search }},
+	{"send", []string{"ctrl+s"}, "to send", func(k *keyMap) *key.Binding { return &k.send }},
+	{"next", []string{"tab", "enter", "ctrl+n"}, "for the next field", func(k *keyMap) *key.Binding { return &k.next }},
+	{"prev", []string{"shift+tab"}, "for the previous field", func(k *keyMap) *key.Binding { return &k.prev }},
+	{"undo", []string{"ctrl+z"}, "to undo", func(k *keyMap) *key.Binding { return &k.undo }},
+	{"outbox", []string{"ctrl+q"}, "for the outbox", func(k *keyMap) *key.Binding { return &k.outbox }},
+	{"pgp", []string{"ctrl+g"}, "to sign or encrypt", func(k *keyMap) *key.Binding { return &k.pgp }},
+	{"pgpkeys", []string{"alt+k"}, "to review the keys found", func(k *keyMap) *key.Binding { return &k.pgpKeys }},
+	{"identity", []string{"alt+a"}, "to send as another identity", func(k *keyMap) *key.Binding { return &k.identity }},
+	{"signature", []string{"ctrl+y"}, "for the signature", func(k *keyMap) *key.Binding { return &k.signature }},
+	{"headers", []string{"ctrl+x"}, "for extra headers", func(k *keyMap) *key.Binding { return &k.headers }},
+	{"attach", []string{"ctrl+a"}, "to attach a file", func(k *keyMap) *key.Binding { return &k.attach }},
+	{"invite", []string{"alt+i"}, "to invite to a meeting", func(k *keyMap) *key.Binding { return &k.invite }},
+	{"receipts", []string{"alt+r"}, "for receipts", func(k *keyMap) *key.Binding { return &k.receipts }},
+	{"priority", []string{"alt+p"}, "for the priority", func(k *keyMap) *key.Binding { return &k.priority }},
+	{"templates", []string{"ctrl+l"}, "for templates", func(k *keyMap) *key.Binding { return &k.templates }},
+	{"preview", []string{"ctrl+r"}, "to preview", func(k *keyMap) *key.Binding { return &k.preview }},
+	{"spell", []string{"alt+s"}, "to correct the spelling", func(k *keyMap) *key.Binding { return &k.spell }},
+	{"fix", []string{"alt+t"}, "to fix a mistyped domain", func(k *keyMap) *key.Binding { return &k.fix }},
+	{"emoji", []string{"ctrl+j"}, "for emoji", func(k *keyMap) *key.Binding { return &k.emoji }},
+	{"paste", []string{"ctrl+v"}, "to paste", func(k *keyMap) *key.Binding { return &k.paste }},
+	{"copy", []string{"alt+y"}, "to copy the field", func(k *keyMap) *key.Binding { return &k.copy }},
+	{"help", []string{"f1", "alt+h"}, "for all the keys", func(k *keyMap) *key.Binding { return &k.help }},
+}
+
+// newKeyMap builds the key map from the defaults and the keys changed in the config
+func newKeyMap(changed map[string]config.Keys) (keyMap, error) {
+
+	var k keyMap
+
+	known := make(map[string]bool)
+	for _, a := range keyActions {
+		known[a.name] = true
+	}
+	for name := range changed {
+		if !known[name] {
+			return k, fmt.Errorf("keys: there is no action called %q, the actions are %s", name, actionNames())
+		}
+	}
+
+	// a key bound in the config is taken from the action it does by default,
+	// so a config from before an action was added keeps working
+	claimed := make(map[string]bool)
+	for _, keys := range changed {
+		for _, name := range keys {
+			claimed[name] = true
+		}
+	}
+
+	// a key can only do one thing, so we check none is bound twice
+	boundTo := make(map[string]string)
+	for _, a := range keyActions {
+		keys, ok := changed[a.name]
+		if !ok {
+			keys = nil
+			for _, name := range a.keys {
+				if !claimed[name] {
+					keys = append(keys, name)
+				}
+			}
+			if len(keys) == 0 {
+				// every key of the action was given to another one
+				*a.binding(&k) = key.NewBinding(key.WithDisabled())
+				continue
+			}
+		}
+		if len(keys) == 0 {
+			return k, fmt.Errorf("keys: %s needs at least one key", a.name)
+		}
+
+		for _, name := range keys {
+			if err := checkKey(name); err != nil {
+				return k, fmt.Errorf("keys: %s: %w", a.name, err)
+			}
+			if other, ok := boundTo[name]; ok {
+				return k, fmt.Errorf("keys: %s is bound to both %s and %s", name, other, a.name)
+			}
+			boundTo[name] = a.name
+		}
+
+		*a.binding(&k) = key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyName(keys[0]), tr(a.help)))
+	}
+
+	return k, nil
+}
+
+// checkKey makes sure a key can be bound. A letter on its own can't, it
+// would no longer type the letter in the form.
+func checkKey(name string) error {
+
+	if name == "" {
+		return fmt.Errorf("a key can't be empty")
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return fmt.Errorf("%q is needed for typing, use it with ctrl+ or alt+", name)
+	}
+
+	return nil
+}
+
+// actionNames lists the actions which can be bound, for error messages
+func actionNames() string {
+
+	var names []string
+	for _, a := range keyActions {
+		names = append(names, a.name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// keyName writes a key the way the help line does, ctrl+s as ctrl + s
+func keyName(name string) string {
+	return strings.ReplaceAll(name, "+", " + ")
+}
+
+// keyHelp returns the first key of an action as the help line writes it
+func keyHelp(b key.Binding) string {
+	return b.Help().Key
+}
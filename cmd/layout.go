@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/charmbracelet/lipgloss"
+)
+
+// the sizes the form is laid out with, it follows the terminal between the smallest and the largest
+const (
+	defaultFieldWidth = 50 // until the terminal tells us how big it is
+	minFieldWidth     = 20
+	maxFieldWidth     = 100 // wider than this a line is hard to read
+
+	defaultEditorHeight = 6
+	minEditorHeight     = 3
+
+	// sideBySideWidth is how wide the terminal has to be for the preview to
+	// show the headers next to the body instead of above it
+	sideBySideWidth = 120
+)
+
+// fieldWidth returns how wide the fields can be in a terminal this wide,
+// leaving room for the tab they're indented with and the cursor at the end
+func fieldWidth(terminalWidth int) int {
+	return min(max(terminalWidth-tabWidth-2, minFieldWidth), maxFieldWidth)
+}
+
+// resize lays the compose form out again for a terminal of the given size
+func (m *model) resize(width, height int) {
+
+	m.width, m.height = width, height
+
+	w := fieldWidth(width)
+	for i := range m.inputs {
+		m.inputs[i].Width = w
+	}
+	m.editor.SetWidth(w)
+	m.help.Width = width - tabWidth
+	m.fitEditor()
+}
+
+// fitEditor gives the body the rows the rest of the form leaves free, so
+// the whole form fits in a small terminal and a tall one has room to write
+func (m *model) fitEditor() {
+
+	if m.height == 0 {
+		return
+	}
+
+	// we keep a line free for the messages that come and go below the form
+	m.editor.SetHeight(minEditorHeight)
+	free := m.height - lipgloss.Height(m.viewForm()) - 1
+	m.editor.SetHeight(max(minEditorHeight+free, minEditorHeight))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aidk/go-mailer/internal/links"
+)
+
+// maxLinks is how many of the links the summary lists
+const maxLinks = 10
+
+// messageLinks returns the links in the message, those in its text and in
+// the HTML of the signature, each once
+func messageLinks(msg message) []links.Link {
+
+	found := links.Find(msg.body + "\n" + msg.signature)
+	found = append(found, links.Anchors(msg.signatureHTML)...)
+
+	var unique []links.Link
+	seen := make(map[links.Link]bool)
+	for _, l := range found {
+		if !seen[l] {
+			seen[l] = true
+			unique = append(unique, l)
+		}
+	}
+	return unique
+}
+
+// doubtful reports whether the link looks wrong, and why
+func doubtful(l links.Link) (string, bool) {
+	switch {
+	case l.Mismatched():
+		return "it goes to another site than it says", true
+	case l.Internal():
+		return "it only works inside your network", true
+	}
+	return "", false
+}
+
+// doubtfulLinks returns how many of the links look wrong
+func (c confirmModel) doubtfulLinks() int {
+	n := 0
+	for _, l := range c.links {
+		if _, ok := doubtful(l); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// linkLines lists the links for the summary, the ones that look wrong first
+// and with what's wrong with them
+func (c confirmModel) linkLines() []string {
+
+	if len(c.links) == 0 {
+		return nil
+	}
+
+	var bad, good []string
+	for _, l := range c.links {
+		line := l.URL
+		if l.Text != "" && l.Text != l.URL {
+			line = fmt.Sprintf("%s → %s", l.Text, l.URL)
+		}
+		if why, ok := doubtful(l); ok {
+			bad = append(bad, errorStyle.Render(fmt.Sprintf("  ⚠ %s, %s", line, why)))
+		} else {
+			good = append(good, "  "+line)
+		}
+	}
+
+	lines := append([]string{inputStyle.Render("Links:")}, append(bad, good...)...)
+	if len(lines) > maxLinks+1 {
+		lines = append(lines[:maxLinks+1], continueStyle.Render(fmt.Sprintf("  and %d more", len(lines)-maxLinks-1)))
+	}
+	if len(bad) > 0 && c.linksSeen {
+		lines = append(lines, errorStyle.Render("Some links look wrong, y again sends the message anyway"))
+	}
+	return lines
+}
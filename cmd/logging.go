@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// where the log goes, see setupLogging
+var (
+	logFile     *os.File // nil until the log is set up
+	logToStderr bool
+	logVerbose  bool          // --verbose was given, log_level doesn't matter then
+	logLevel    slog.LevelVar // what is logged, it follows log_level when the config is reloaded
+)
+
+// setupLogging sends the log to go-mailer.log in the data directory, where it
+// doesn't get in the way of the TUI, and to stderr as well when toStderr is
+// set. verbose logs everything, the dialogue with the SMTP servers included,
+// whatever log_level says.
+func setupLogging(cfg *config.Config, verbose, toStderr bool) error {
+
+	path, err := config.LogPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open the log: %w", err)
+	}
+
+	logVerbose = verbose
+	setLogLevel(cfg)
+
+	var w io.Writer = f
+	if toStderr {
+		w = io.MultiWriter(f, os.Stderr)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: &logLevel})))
+	logFile, logToStderr = f, toStderr
+
+	return nil
+}
+
+// setLogLevel logs as much as the config asks for, or everything with --verbose
+func setLogLevel(cfg *config.Config) {
+	if logVerbose {
+		logLevel.Set(slog.LevelDebug)
+		return
+	}
+	logLevel.Set(cfg.Level())
+}
+
+// smtpLog returns the logger the dialogue with an account's SMTP server goes
+// to, nil when the log leaves out debug messages, so it isn't traced for nothing
+func smtpLog(account *config.Account) *slog.Logger {
+
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return nil
+	}
+
+	return slog.Default().With("account", account.Name)
+}
+
+// fatal prints the error and exits, it goes in the log too
+func fatal(err any) {
+
+	// stderr has the error anyway
+	if logFile != nil && !logToStderr {
+		slog.Error(fmt.Sprint(err))
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
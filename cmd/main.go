@@ -1,10 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net/mail"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/imapclient"
+	"github.com/aidk/go-mailer/internal/outbox"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -12,20 +25,253 @@ import (
 
 func main() {
 
-	p := tea.NewProgram(initialModel())
-	if _, err := p.Run(); err != nil {
-		log.Fatal(err)
+	// the shell completions ask what could come next on the command line
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		completeCommand(os.Args[2:])
+		return
+	}
+
+	path, err := config.DefaultPath()
+	if err != nil {
+		fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fatal(err)
+	}
+
+	// --capture hands every message to a server of our own instead of
+	// sending it, for trying things out without a real server, --verbose
+	// logs the dialogue with the servers, --lang picks the language and
+	// --accessible suits the TUI to a screen reader
+	args := os.Args[1:]
+	var capturing, verbose bool
+	var lang string
+flags:
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--capture" || args[0] == "-capture":
+			capturing = true
+		case args[0] == "--verbose" || args[0] == "-verbose":
+			verbose = true
+		case args[0] == "--accessible" || args[0] == "-accessible":
+			cfg.Accessible = true
+		case (args[0] == "--lang" || args[0] == "-lang") && len(args) > 1:
+			lang = args[1]
+			args = args[1:]
+		case strings.HasPrefix(args[0], "--lang=") || strings.HasPrefix(args[0], "-lang="):
+			_, lang, _ = strings.Cut(args[0], "=")
+		default:
+			break flags
+		}
+		args = args[1:]
+	}
+
+	// help and the completions only print, they need neither the log nor the passphrase
+	if len(args) > 0 && (args[0] == "help" || args[0] == "completion") {
+		if err := runCommand(cfg, args[0], args[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// serve runs as a service, whose log is expected on stderr as well
+	if err := setupLogging(cfg, verbose, len(args) > 0 && args[0] == "serve"); err != nil {
+		fatal(err)
+	}
+	if cfg.Encrypt {
+		if err := unlockVault(); err != nil {
+			fatal(err)
+		}
+	}
+	if capturing {
+		if err := startCapture(); err != nil {
+			fatal(err)
+		}
+	}
+
+	// anything after the program name is a command to run instead of the TUI,
+	// except for compose, which starts it, with a message in the form if one
+	// is given. open is what compose was called before.
+	if len(args) > 0 && args[0] == "open" {
+		args[0] = "compose"
+	}
+	if len(args) > 0 && args[0] != "compose" {
+		err := runCommand(cfg, args[0], args[1:])
+		waitWebhooks()
+		waitHooks()
+		closePools()
+		stopCapture()
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// only the TUI is translated, the commands and serve are read by scripts
+	if err := setLanguage(cfg, path, lang); err != nil {
+		fatal(err)
+	}
+
+	// the config has already been checked, so the theme is one we know
+	theme, _ := cfg.Theme.Colors()
+	applyTheme(theme)
+	if cfg.Accessible {
+		applyAccessible()
+	}
+
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		fatal(err)
+	}
+
+	m := initialModel(cfg, keys)
+	if len(args) > 2 {
+		fatal("usage: go-mailer compose [message.eml]")
+	}
+	if len(args) == 2 {
+		if err := m.openEML(args[1]); err != nil {
+			fatal(err)
+		}
+	}
+
+	account := cfg.DefaultAccount()
+	// the mouse needs the whole screen, so we know which line was clicked.
+	// A screen reader reads the terminal as it scrolls, so it doesn't get it.
+	var options []tea.ProgramOption
+	if cfg.Mouse && !cfg.Accessible {
+		options = append(options, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	}
+	p := tea.NewProgram(m, options...)
+
+	// the terminal tells us when it goes into the background, so we only
+	// notify about what the user can't already see
+	if cfg.Notify {
+		fmt.Fprint(os.Stdout, focusReportsOn)
+		defer fmt.Fprint(os.Stdout, focusReportsOff)
+	}
+
+	// the terminal marks what is pasted into it, so its lines go into the body
+	// instead of each moving on to the next field
+	fmt.Fprint(os.Stdout, bracketedPasteOn)
+	defer fmt.Fprint(os.Stdout, bracketedPasteOff)
+
+	// changes to the config are picked up without a restart
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchConfig(ctx, path, func(msg configMsg) {
+		p.Send(msg)
+	})
+
+	// we keep an IDLE connection open in the background so the inbox
+	// refreshes itself whenever new mail arrives
+	if account != nil && account.BackendName() == config.BackendIMAP && account.IMAP.Enabled() {
+		go imapclient.Watch(ctx, account.IMAP, func(count uint32) {
+			p.Send(newMailMsg{count: int(count)})
+		})
+	}
+
+	_, err = p.Run()
+	waitWebhooks()
+	waitHooks()
+	closePools()
+	stopCapture()
+	if err != nil {
+		fatal(err)
 	}
 }
 
 // Model is the main Model for the program
-// it contains a slice of text inputs, the index of the currently focused input,
+// it contains a slice of text inputs, the body editor, the index of the
+// currently focused field, the screen being shown and the inbox
 type model struct {
-	inputs  []textinput.Model
-	focused int
-	err     error
+	inputs      []textinput.Model
+	editor      textarea.Model
+	keys        keyMap
+	help        help.Model         // the keys listed below the form
+	attachments []email.Attachment // files carried along with the message, e.g. when forwarding
+	thread      threadHeaders      // ties the message to the one it replies to
+	headers     []header           // extra headers added in the headers panel
+	meeting     *meeting           // the meeting the message invites to, if it does
+	pgp         pgpMode            // whether the message will be signed and encrypted
+	pgpMissing  []string           // recipients we have no encryption key for
+	pgpKeys     pgpKeysModel       // the keys looked up for them
+	receipts    receiptMode        // the read receipt and delivery report the message asks for
+	priority    priority           // how important the message says it is
+	signature   bool               // false when the signature was switched off for this message
+	focused     int
+	checked     [body]bool // the fields that have been left, their errors show as they are typed
+	err         error      // what went wrong sending, the fields show their own errors
+	width       int        // the size of the terminal, the form follows it
+	height      int
+
+	cfg     *config.Config
+	account *config.Account
+	screen  screen
+	inbox   inboxModel
+	newMail int        // number of messages that arrived since the inbox was last opened
+	focus   focusState // whether the terminal is the window in front, for the notifications
+	pasting bool       // whether the terminal is in the middle of a bracketed paste
+	pasted  string     // what has been pasted so far
+
+	drafts   store.Maildir // where drafts are saved
+	draftKey string        // the key of the saved copy of the form, if there is one
+	saved    draft         // what the form looked like when it was last saved
+	picker   draftsModel
+
+	outbox   *outbox.Outbox // where messages that couldn't be sent wait to be retried
+	queue    queueModel
+	flushing bool         // whether the outbox is being flushed in the background
+	quitting bool         // whether we quit as soon as the flush has finished
+	status   string       // a message for the user, shown below the form
+	undo     outbox.Entry // the message waiting out its undo window, if there is one
+
+	history      historyModel   // every message sent from the account
+	followUps    followUpsModel // the sent messages waiting for a reply
+	headersPanel headersModel
+	templates    templatesModel
+	previewPanel previewModel
+	complete     completeModel // suggestions for the address being typed in the To field
+	reach        reachModel    // the recipients that may not be able to receive mail
+	spell        spellModel    // the dictionary and the misspelled word being corrected
+	vim          vimModel      // the mode we're in when the compose view is modal
+	emojiPicker  emojiModel    // the emoji and symbols to put in the subject or the body
+	sending      sendingModel  // the message being sent, and how it went
+	confirm      confirmModel  // the summary of the message shown before it is sent
+	quitFrom     screen        // the screen to go back to when quitting is cancelled
+	attach       attachModel   // the files to pick an attachment from
+	invitePanel  inviteModel
+	search       searchModel  // finding messages in the sent mail and the drafts
+	reader       readerModel  // the message being read
+	folders      foldersModel // the folders, to open one in the inbox or move a message into
 }
 
+// screen is the view currently shown to the user
+type screen int
+
+const (
+	composeScreen screen = iota
+	inboxScreen
+	draftsScreen
+	queueScreen
+	sentScreen
+	headersScreen
+	templatesScreen
+	previewScreen
+	sendingScreen
+	confirmScreen
+	quitScreen
+	attachScreen
+	inviteScreen
+	searchScreen
+	readerScreen
+	foldersScreen
+	followUpsScreen
+	emojiScreen
+	pgpKeysScreen
+)
+
 type (
 	errMsg error
 )
@@ -36,88 +282,416 @@ const (
 	to = iota // iota is a special golang constant that starts at 0 and increments by 1 for each const it's used in
 	from
 	subject
-	body
-)
+	sendAt
 
-const (
-	hotPink  = lipgloss.Color("#FF0687") // a nice hot pink
-	darkGrey = lipgloss.Color("#767676") // a dark grey
-)
-
-// we'll use these styles to render the inputs and the continue prompt
-var (
-	inputStyle    = lipgloss.NewStyle().Foreground(hotPink)
-	continueStyle = lipgloss.NewStyle().Foreground(darkGrey)
+	// body comes last as it isn't one of the inputs, it is the multi-line editor
+	body
 )
 
-// validateAddress validates the email address
-func (m model) validateAddress() error {
-
-	var err error
-
-	c := m.inputs[m.focused]
-	if _, err = mail.ParseAddress(c.Value()); err != nil {
-		err = fmt.Errorf("invalid email address")
-	}
-
-	return err
-}
-
-// func stringValidator(s string) error {
-
-// 	if len(s) == 0 {
-// 		return fmt.Errorf("input cannot be empty")
-// 	}
-
-// 	return nil
-// }
-
 // initialModel returns the initial model for the program
-func initialModel() model {
-	// we'll create a slice of text inputs (for now just one)
-	var inputs []textinput.Model = make([]textinput.Model, 4)
+func initialModel(cfg *config.Config, keys keyMap) model {
+	account := cfg.DefaultAccount()
+
+	// we'll create a slice of text inputs, one for each header field
+	var inputs []textinput.Model = make([]textinput.Model, body)
 	inputs[to] = textinput.New()
-	inputs[to].Placeholder = "Enter to address here..."
+	inputs[to].Placeholder = tr("Enter to address here...")
 	inputs[to].Focus()
-	inputs[to].CharLimit = 50
-	inputs[to].Width = 50
+	inputs[to].CharLimit = 0 // no limit, a reply to everyone can have a long list of addresses
+	inputs[to].Width = defaultFieldWidth
 	inputs[to].Prompt = ""
-	// inputs[to].Validate = stringValidator
 
 	inputs[from] = textinput.New()
-	inputs[from].Placeholder = "Enter from address here..."
+	inputs[from].Placeholder = tr("Enter from address here...")
 	inputs[from].CharLimit = 50
-	inputs[from].Width = 50
+	inputs[from].Width = defaultFieldWidth
 	inputs[from].Prompt = ""
-	// inputs[from].Validate = stringValidator
 
 	inputs[subject] = textinput.New()
-	inputs[subject].Placeholder = "Enter subject here..."
-	inputs[subject].CharLimit = 50
-	inputs[subject].Width = 50
+	inputs[subject].Placeholder = tr("Enter subject here...")
+	inputs[subject].CharLimit = 0
+	inputs[subject].Width = defaultFieldWidth
 	inputs[subject].Prompt = ""
+	inputs[subject].Validate = validateSubject
 
-	inputs[body] = textinput.New()
-	inputs[body].Placeholder = "Send a message..."
-	inputs[body].CharLimit = 50
-	inputs[body].Width = 50
-	inputs[body].Prompt = ""
+	inputs[sendAt] = textinput.New()
+	inputs[sendAt].Placeholder = tr("Now, or e.g. 17:30, tomorrow 09:00, +2h...")
+	inputs[sendAt].CharLimit = 50
+	inputs[sendAt].Width = defaultFieldWidth
+	inputs[sendAt].Prompt = ""
 
-	return model{
+	// the body is a textarea so it can hold more than one line, e.g. a quoted reply
+	editor := textarea.New()
+	editor.Placeholder = tr("Send a message...")
+	editor.CharLimit = 0
+	editor.MaxHeight = 0
+	editor.ShowLineNumbers = false
+	editor.Prompt = ""
+	editor.FocusedStyle.CursorLine = lipgloss.NewStyle()
+	editor.FocusedStyle.Base = bodyStyle(true)
+	editor.BlurredStyle.Base = bodyStyle(false)
+	editor.Blur() // we'll blur it so the editor picks up the style we just set
+	editor.Cursor.Style = lipgloss.NewStyle().Foreground(focusColor)
+	for i := range inputs {
+		inputs[i].Cursor.Style = lipgloss.NewStyle().Foreground(focusColor)
+	}
+
+	// a blinking cursor redraws the screen, and a screen reader would read it
+	// out again every time, so in accessible mode it holds still
+	if accessible {
+		editor.Cursor.SetMode(cursor.CursorStatic)
+		editor.FocusedStyle.Placeholder = lipgloss.NewStyle()
+		editor.BlurredStyle.Placeholder = lipgloss.NewStyle()
+		for i := range inputs {
+			inputs[i].Cursor.SetMode(cursor.CursorStatic)
+			inputs[i].PlaceholderStyle = lipgloss.NewStyle()
+		}
+	}
+	editor.SetWidth(defaultFieldWidth)
+	editor.SetHeight(defaultEditorHeight)
+
+	// we paste ourselves, so pasted recipients are kept apart with commas
+	editor.KeyMap.Paste.SetEnabled(false)
+	for i := range inputs {
+		inputs[i].KeyMap.Paste.SetEnabled(false)
+	}
+
+	m := model{
 		inputs:  inputs,
+		editor:  editor,
+		keys:    keys,
+		help:    newHelp(),
 		focused: 0,
 		err:     nil,
+		cfg:     cfg,
+		account: account,
+		screen:  composeScreen,
+		inbox:   newInbox(account),
+		queue:   newQueue(),
+		history: newHistory(account),
+
+		followUps:    newFollowUps(account),
+		emojiPicker:  newEmoji(),
+		attach:       newAttach(),
+		invitePanel:  newInvite(),
+		headersPanel: newHeaders(),
+		templates:    newTemplates(),
+		previewPanel: newPreview(),
+		complete:     newComplete(account),
+		search:       newSearch(cfg.Notmuch),
+		reader:       newReader(imageProtocol(cfg)),
+		folders:      newFolders(),
+		pgp:          defaultPGP(account),
+		receipts:     defaultReceipts(account),
+		signature:    true,
 	}
+
+	// messages that couldn't be sent last time are still waiting in the outbox
+	if account != nil {
+		o, err := openOutbox(account)
+		if err != nil {
+			slog.Error("Could not open outbox", "err", err)
+		}
+		m.outbox = o
+		m.queue.store = m.history.store
+		m.queue.refresh(o)
+	}
+
+	// if there are drafts left over from last time we offer to resume one
+	folder, err := draftFolder(account)
+	if err != nil {
+		slog.Error("Could not open drafts", "err", err)
+		return m
+	}
+	m.drafts = folder
+
+	if drafts, err := loadDrafts(folder); err == nil && len(drafts) > 0 {
+		m.picker = newDraftPicker(drafts)
+		m.screen = draftsScreen
+	}
+
+	return m
 }
 
-// Init initializes the model with a command to blink the cursor
+// Init initializes the model with a command to blink the cursor,
+// starts loading the inbox in the background, starts autosaving and
+// sends anything left in the outbox
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	flushNow := func() tea.Msg { return outboxTickMsg{} }
+	return tea.Batch(textinput.Blink, m.inbox.load(), autosaveTick(), flushNow, loadDictionary(m.cfg))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	// we'll need to update each of the text inputs, so we'll create a slice
-	var cmds []tea.Cmd = make([]tea.Cmd, len(m.inputs))
+
+	// the terminal says it got or lost the focus, no screen needs to know
+	if focus, ok := focusReport(msg); ok {
+		m.focus = focus
+		return m, nil
+	}
+
+	// we're only waiting for the flush to finish, the keys can't change anything any more
+	if _, ok := msg.(tea.KeyMsg); ok && m.quitting {
+		return m, nil
+	}
+
+	// what is pasted into the compose view is taken in one piece
+	if m, cmd, ok := m.updatePasting(msg); ok {
+		return m, cmd
+	}
+
+	// these messages belong to the inbox no matter which screen is showing
+	switch msg := msg.(type) {
+
+	case newMailMsg:
+		// new mail arrived, so we bump the badge (unless the inbox is already showing) and reload the list
+		if m.screen != inboxScreen {
+			m.newMail += msg.count
+		}
+		return m, tea.Batch(m.inbox.load(), m.notifyDesktop("New mail", plural(msg.count, "new message")))
+
+	case pastedMsg:
+		if msg.err != nil {
+			m.status = "Could not paste: " + msg.err.Error()
+		} else if m.screen == composeScreen {
+			m.paste(msg.text)
+		}
+		return m, nil
+
+	case copiedMsg:
+		m.status = msg.status()
+		return m, nil
+
+	case autosaveMsg:
+		if err := m.saveDraft(); err != nil {
+			slog.Error("Could not save draft", "err", err)
+		}
+		return m, autosaveTick()
+
+	case undoTickMsg:
+		return m.updateUndo(msg)
+
+	case sentMsg:
+		return m.sent(msg)
+
+	case lookupTickMsg, lookupMsg:
+		return m.updateLookup(msg)
+
+	case configMsg:
+		return m.reloadConfig(msg)
+
+	case dictionaryMsg:
+		m.spell.dict, m.spell.err = msg.dict, msg.err
+		if msg.err != nil {
+			slog.Error("Could not load the dictionary", "err", msg.err)
+		}
+		return m, nil
+
+	case outboxTickMsg:
+		cmd := m.flush()
+		return m, tea.Batch(cmd, outboxTick())
+
+	case outboxFlushedMsg:
+		m.flushing, m.queue.flushing = false, false
+		m.queue.refresh(m.outbox)
+		if msg.err != nil {
+			slog.Error("Could not flush outbox", "err", msg.err)
+		}
+		if m.quitting {
+			return m.quitWhenFlushed()
+		}
+		var cmds []tea.Cmd
+		if msg.sent > 0 {
+			m.status = fmt.Sprintf("Sent %d queued messages", msg.sent)
+			cmds = append(cmds, m.notifyDesktop("Mail sent", "Sent "+plural(msg.sent, "queued message")))
+		}
+		if msg.failed > 0 {
+			cmds = append(cmds, m.notifyDesktop("Mail not sent", fmt.Sprintf("Could not send %s, they will be tried again", plural(msg.failed, "queued message"))))
+		}
+		return m, tea.Batch(cmds...)
+
+	case originalMsg:
+		// the message to reply to or forward has arrived, so we write the reply
+		if msg.err == nil {
+			msg.err = m.startReply(msg.raw, msg.mode)
+		}
+		if msg.err != nil {
+			m.status = "Could not open message: " + msg.err.Error()
+		}
+		m.inbox.list.Title = m.inbox.title("")
+		m.screen = composeScreen
+		return m, nil
+
+	case readMsg:
+		// the message to read has arrived from the server
+		m.inbox.list.Title = m.inbox.title("")
+		if msg.err == nil {
+			msg.err = m.openReader(msg.raw, inboxScreen, "", "")
+		}
+		if msg.err != nil {
+			m.inbox.list.Title = m.inbox.title("could not open message: " + msg.err.Error())
+		}
+		return m, nil
+
+	case imagesShownMsg:
+		if msg.err != nil {
+			m.reader.status = "Could not show the images: " + msg.err.Error()
+		}
+		return m, nil
+
+	case notmuchMsg:
+		// an answer to a query that has since been typed over is of no use
+		if msg.query != m.search.input.Value() {
+			return m, nil
+		}
+		m.search.err = msg.err
+		if msg.err == nil {
+			// the same query again, after tagging, stays on the message it was on
+			selected := 0
+			if msg.query == m.search.shown {
+				selected = min(m.search.list.Index(), len(msg.items)-1)
+			}
+			m.search.shown = msg.query
+			m.search.list.SetItems(msg.items)
+			m.search.list.Select(selected)
+		}
+		return m, nil
+
+	case taggedMsg:
+		if msg.err != nil {
+			m.search.err = msg.err
+			return m, nil
+		}
+		// the search runs again to show the new tags, some may no longer match
+		m.search.status = "Tagged"
+		return m, m.search.run(m.account)
+
+	case indexedMsg:
+		m.search.indexing = false
+		m.search.index, m.search.err = msg.index, msg.err
+		if msg.err != nil {
+			return m, nil
+		}
+		return m, m.search.run(m.account)
+
+	case reachMsg:
+		m.reach.done(msg)
+		return m, nil
+
+	case discoveredMsg:
+		m.pgpKeys.discovered(msg)
+		return m, nil
+
+	case acceptedMsg:
+		if msg.err != nil {
+			m.status = "Could not import the key for " + msg.addr + ": " + msg.err.Error()
+		} else {
+			m.status = "Imported the key for " + msg.addr + ", the message can be encrypted to them"
+		}
+		m.checkKeys()
+		return m, nil
+
+	case spamMsg:
+		// the summary may have been closed, or opened again for a changed message
+		if msg.check == m.confirm.check {
+			c := &m.confirm
+			c.scoring, c.spamErr = false, msg.err
+			if msg.err == nil {
+				c.spam = &msg.report
+			}
+		}
+		return m, nil
+
+	case repliesMsg:
+		// the messages that got their reply no longer wait for one
+		if msg.found > 0 {
+			m.followUps.refresh()
+			m.history.refresh()
+		}
+		return m, nil
+
+	case bouncesMsg:
+		// the history shows which messages bounced, so it's brought up to date
+		if msg.found > 0 {
+			m.history.refresh()
+			m.status = fmt.Sprintf("%d recipients of sent messages bounced, see the sent history", msg.found)
+		}
+		return m, nil
+
+	case envelopesMsg, flagMsg, movedMsg, expungedMsg:
+		var cmd tea.Cmd
+		m.inbox, cmd = m.inbox.Update(msg)
+		return m, cmd
+
+	case foldersMsg:
+		f := &m.folders
+		f.status, f.err = msg.status, msg.err
+		if msg.err == nil {
+			f.show(msg.folders, m.inbox.folder)
+		}
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		var cmd tea.Cmd
+		m.inbox, cmd = m.inbox.Update(msg)
+		m.queue, _ = m.queue.Update(msg)
+		m.history, _ = m.history.Update(msg)
+		m.templates, _ = m.templates.Update(msg)
+		m.previewPanel, _ = m.previewPanel.Update(msg)
+		m.headersPanel.resize(msg.Width)
+		m.invitePanel.resize(msg.Width)
+		m.resize(msg.Width, msg.Height)
+		m.attach.resize(msg.Height)
+		m.search.resize(msg.Width, msg.Height)
+		m.reader.resize(msg.Width, msg.Height)
+		m.folders.resize(msg.Width, msg.Height)
+		m.followUps.resize(msg.Width, msg.Height)
+		if m.screen == draftsScreen {
+			m.picker, _ = m.picker.Update(msg)
+		}
+		return m, cmd
+	}
+
+	switch m.screen {
+	case inboxScreen:
+		return m.updateInbox(msg)
+	case draftsScreen:
+		return m.updateDrafts(msg)
+	case queueScreen:
+		return m.updateQueue(msg)
+	case sentScreen:
+		return m.updateHistory(msg)
+	case headersScreen:
+		return m.updateHeaders(msg)
+	case templatesScreen:
+		return m.updateTemplates(msg)
+	case previewScreen:
+		return m.updatePreview(msg)
+	case sendingScreen:
+		return m.updateSending(msg)
+	case confirmScreen:
+		return m.updateConfirm(msg)
+	case quitScreen:
+		return m.updateQuit(msg)
+	case attachScreen:
+		return m.updateAttach(msg)
+	case inviteScreen:
+		return m.updateInvite(msg)
+	case searchScreen:
+		return m.updateSearch(msg)
+	case readerScreen:
+		return m.updateReader(msg)
+	case foldersScreen:
+		return m.updateFolders(msg)
+	case followUpsScreen:
+		return m.updateFollowUps(msg)
+	case emojiScreen:
+		return m.updateEmoji(msg)
+	case pgpKeysScreen:
+		return m.updatePGPKeys(msg)
+	}
+
+	// we'll need to update each of the text inputs and the editor, so we'll create a slice
+	var cmds []tea.Cmd = make([]tea.Cmd, len(m.inputs)+1)
 
 	// we'll handle the messages for each input and update them accordingly
 	switch msg := msg.(type) {
@@ -125,47 +699,185 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// KeyMsg is sent when a key is pressed while the component is in focus
 	case tea.KeyMsg:
 
-		// we want to handle the key presses for the inputs ourselves
-		switch msg.Type {
+		// while a misspelled word is being corrected the keys choose the correction
+		if m.spell.open {
+			return m.updateSpell(msg)
+		}
 
-		// we'll handle the enter, tab, and ctrl+n keys to focus the next input
-		case tea.KeyEnter, tea.KeyTab, tea.KeyCtrlN:
-			// we only really want to check whether the user has provided a To and From address.
-			// subject and body can be empty as the email can be sent without them.
-			if m.focused == to || m.focused == from {
-				m.err = m.validateAddress()
-				if m.err != nil {
-					return m, nil
-				}
+		// in vim's normal mode the keys move around instead of typing
+		if m.cfg.Vim && !m.vim.insert && !m.actionKey(msg) {
+			return m.updateNormal(msg)
+		}
+
+		// while there are suggestions for the To field the arrows and tab pick one
+		if m.updateSuggestions(msg) {
+			return m, nil
+		}
+
+		// we want to handle the key presses for the inputs ourselves, the
+		// keys for each action are in the key map and can be changed in the config
+		switch {
+
+		// we'll handle esc in vim's insert mode to go back to normal mode
+		case m.cfg.Vim && msg.Type == tea.KeyEsc:
+			m.vim.insert = false
+			return m, nil
+
+		// we'll handle the enter, tab, and ctrl+n keys to focus the next input,
+		// except for enter in the body where it starts a new line
+		case key.Matches(msg, m.keys.next):
+			if m.focused == body && msg.Type == tea.KeyEnter {
+				break
+			}
+			if !m.leaveField() {
+				return m, nil
 			}
 			m.nextInput()
 
 		// we'll handle shift+tab to focus the previous input
-		case tea.KeyShiftTab:
+		case key.Matches(msg, m.keys.prev):
 			m.prevInput()
 
 		// we'll handle ctrl+s to send the message
-		case tea.KeyCtrlS:
-			// we don't want to send the message if there's an error
-			if m.err != nil {
+		case key.Matches(msg, m.keys.send):
+			return m.send()
+
+		// we'll handle ctrl+z to undo a send while it is still being held back
+		case key.Matches(msg, m.keys.undo):
+			if m.undo.ID != "" {
+				m.undoSend()
+			}
+			return m, nil
+
+		// we'll handle ctrl+o to open the inbox
+		case key.Matches(msg, m.keys.inbox):
+			return m.openInbox()
+
+		// we'll handle ctrl+q to open the outbox
+		case key.Matches(msg, m.keys.outbox):
+			m.queue.refresh(m.outbox)
+			m.queue.status = ""
+			m.screen = queueScreen
+			return m, nil
+
+		// we'll handle ctrl+g to switch between signing and encrypting the message
+		case key.Matches(msg, m.keys.pgp):
+			m.pgp = m.pgp.next()
+			m.checkKeys()
+			return m, nil
+
+		// we'll handle alt+r to ask for a read receipt or a delivery report
+		case key.Matches(msg, m.keys.receipts):
+			m.receipts = m.receipts.next()
+			return m, nil
+
+		// we'll handle alt+p to make the message more or less important
+		case key.Matches(msg, m.keys.priority):
+			m.priority = m.priority.next()
+			return m, nil
+
+		// we'll handle alt+a to send as the account's next identity
+		case key.Matches(msg, m.keys.identity):
+			m.nextSender()
+			return m, nil
+
+		// we'll handle ctrl+y to leave the signature off this message, or put it back
+		case key.Matches(msg, m.keys.signature):
+			m.signature = !m.signature
+			return m, nil
+
+		// we'll handle ctrl+a to pick a file to attach
+		case key.Matches(msg, m.keys.attach):
+			m.screen = attachScreen
+			return m, m.attach.open()
+
+		// we'll handle alt+i to invite the recipients to a meeting
+		case key.Matches(msg, m.keys.invite):
+			m.invitePanel.open(m.meeting)
+			m.screen = inviteScreen
+			return m, nil
+
+		// we'll handle ctrl+x to add extra headers to the message
+		case key.Matches(msg, m.keys.headers):
+			m.headersPanel.open()
+			m.screen = headersScreen
+			return m, nil
+
+		// we'll handle ctrl+l to start the message from a template
+		case key.Matches(msg, m.keys.templates):
+			if err := m.templates.open(); err != nil {
+				m.status = err.Error()
 				return m, nil
 			}
-			m.sendMsg()
-			return m, tea.Quit
+			m.screen = templatesScreen
+			return m, nil
 
-		// we'll handle ctrl+c to quit the program
-		case tea.KeyCtrlC:
-			log.Println("Quitting...")
-			return m, tea.Quit
-		}
+		// we'll handle ctrl+r to see the message exactly as it would be sent
+		case key.Matches(msg, m.keys.preview):
+			raw, signed, err := m.preview()
+			if err != nil {
+				m.status = "Could not preview message: " + err.Error()
+				return m, nil
+			}
+			m.previewPanel.open(raw, signed, m.inputs[subject].Value())
+			m.screen = previewScreen
+			return m, nil
+
+		// we'll handle ctrl+t to browse the messages we've sent
+		case key.Matches(msg, m.keys.sent):
+			return m.openHistory()
+
+		// we'll handle alt+w to see the sent messages waiting for a reply
+		case key.Matches(msg, m.keys.followUps):
+			return m.openFollowUps()
+
+		// we'll handle alt+/ to search the sent mail and the drafts
+		case key.Matches(msg, m.keys.search):
+			return m.openSearch()
+
+		// we'll handle ctrl+j to pick an emoji to put in the subject or the body
+		case key.Matches(msg, m.keys.emoji):
+			cmd := m.pickEmoji("", 0)
+			return m, cmd
+
+		// we'll handle alt+k to review the keys found for the recipients
+		case key.Matches(msg, m.keys.pgpKeys):
+			return m.openPGPKeys()
+
+		// we'll handle ctrl+v to paste from the clipboard into the field being edited
+		case key.Matches(msg, m.keys.paste):
+			return m, pasteClipboard
+
+		// we'll handle alt+y to copy the field being edited to the clipboard
+		case key.Matches(msg, m.keys.copy):
+			return m, m.copyField()
 
-		// we blur all the inputs so we can focus the one we want
-		for i := range m.inputs {
-			m.inputs[i].Blur()
+		// we'll handle alt+s to correct the spelling of the subject or the body
+		case key.Matches(msg, m.keys.spell):
+			m.checkSpelling()
+			return m, nil
+
+		// we'll handle alt+t to fix the domains in the To field that look mistyped
+		case key.Matches(msg, m.keys.fix):
+			m.fixDomains()
+			return m, nil
+
+		// we'll handle f1 to show every key, or just the main ones again
+		case key.Matches(msg, m.keys.help):
+			m.toggleHelp()
+			return m, nil
+
+		// we'll handle ctrl+c to quit the program
+		case key.Matches(msg, m.keys.quit):
+			return m.quit()
 		}
 
 		// we focus the input we want
-		m.inputs[m.focused].Focus()
+		m.focusField(m.focused)
+
+	// MouseMsg is sent when the mouse is clicked or its wheel turned, if it is on in the config
+	case tea.MouseMsg:
+		return m.updateMouse(msg)
 
 	// errMsg is sent when an error is returned from a text input's Validate function
 	case errMsg:
@@ -182,51 +894,207 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// we also store the updated input in the inputs slice
 		m.inputs[i], cmds[i] = m.inputs[i].Update(msg)
 	}
+	m.editor, cmds[len(m.inputs)] = m.editor.Update(msg)
+
+	// what is in the To field may have changed, so the suggestions might have too
+	cmds = append(cmds, m.suggest())
+
+	// and once it has been left, its domains can be checked
+	cmds = append(cmds, m.checkReach())
+
+	// and the keys we don't have for encrypting to its recipients looked up
+	cmds = append(cmds, m.discoverKeys())
+
+	// a colon and two letters typed into the subject or the body start picking an emoji
+	if query, ok := m.emojiShorthand(msg); ok {
+		cmds = append(cmds, m.pickEmoji(query, len([]rune(query))+1))
+	}
 
 	// we return the updated model and a batch of all the commands we received
 	return m, tea.Batch(cmds...)
 }
 
-// View renders the model to the screen
-func (m model) View() string {
+// updateInbox handles messages while the inbox is showing
+func (m model) updateInbox(msg tea.Msg) (tea.Model, tea.Cmd) {
 
-	if m.err != nil {
-		return fmt.Sprintf(`
-	%s
-	%s
-	
-	%s
-	%s
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
 
-	%s
-	%s
+		// we'll handle esc to go back to the compose view, unless the list is using it
+		case tea.KeyEsc:
+			if !m.inbox.filtering() {
+				m.screen = composeScreen
+				return m, nil
+			}
 
-	%s
-	%s
+		// we'll handle enter to read the selected message
+		case tea.KeyEnter:
+			if !m.inbox.filtering() {
+				return m, m.inbox.fetchToRead()
+			}
+		}
 
-	%s`,
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+
+		// we'll handle a, A and f to reply to, reply to everyone or forward the selected message
+		if mode, ok := replyKeys[msg.String()]; ok && !m.inbox.filtering() {
+			return m, m.inbox.fetchOriginal(mode)
+		}
+
+		// we'll handle m to move the selected message into another folder, and F to open one
+		if !m.inbox.filtering() && m.inbox.enabled() {
+			switch msg.String() {
+			case "m":
+				if item, ok := m.inbox.list.SelectedItem().(envelopeItem); ok {
+					return m.openFolders(item.ID)
+				}
+				return m, nil
+			case "F":
+				return m.openFolders("")
+			}
+		}
+	}
 
-			// renders the to header and input
-			inputStyle.Width(50).Render("To:"),
-			m.inputs[to].View(),
+	var cmd tea.Cmd
+	m.inbox, cmd = m.inbox.Update(msg)
+	return m, cmd
+}
 
-			// renders the from header and input
-			inputStyle.Width(50).Render("From:"),
-			m.inputs[from].View(),
+// openInbox shows the inbox
+func (m model) openInbox() (tea.Model, tea.Cmd) {
+	m.screen = inboxScreen
+	m.newMail = 0
+	return m, nil
+}
 
-			// renders the subject header and input
-			inputStyle.Width(50).Render("Subject:"),
-			m.inputs[subject].View(),
+// openHistory shows the messages we've sent
+func (m model) openHistory() (tea.Model, tea.Cmd) {
+	m.history.refresh()
+	m.history.status = ""
+	m.screen = sentScreen
+	return m, nil
+}
+
+// badge renders the new mail and outbox indicators shown next to the continue prompt
+func (m model) badge() string {
 
-			// renders the body header and input
-			inputStyle.Width(50).Render("Body:"),
-			m.inputs[body].View(),
+	var badge string
 
-			// renders the continue prompt at the bottom of the screen
-			continueStyle.Render("(ctrl + c to quit or ctrl + s to send) ->")) + "\n" + m.err.Error() + "\n"
+	if m.newMail > 0 {
+		badge += " " + inputStyle.Render(trf("✉ %d new (%s)", m.newMail, keyHelp(m.keys.inbox)))
 	}
 
-	return fmt.Sprintf(`
+	if n := len(m.headers); n > 0 {
+		badge += " " + inputStyle.Render(trf("✎ %d extra headers (%s)", n, keyHelp(m.keys.headers)))
+	}
+
+	if m.meeting != nil {
+		badge += " " + inputStyle.Render(fmt.Sprintf("📅 %s, %s (%s)", m.meeting.summary, m.meeting.when(), keyHelp(m.keys.invite)))
+	}
+
+	if n := m.queue.count(); n > 0 {
+		badge += " " + inputStyle.Render(trf("⧗ %d queued (%s)", n, keyHelp(m.keys.outbox)))
+	}
+
+	if n := m.followUps.due(); n > 0 {
+		badge += " " + inputStyle.Render(trf("⏰ %d to follow up (%s)", n, keyHelp(m.keys.followUps)))
+	}
+
+	if status := m.pgpStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.smimeStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.domainStatus(); status != "" {
+		badge += "\n" + status
+	}
+	if status := m.reachStatus(); status != "" {
+		badge += "\n" + status
+	}
+	if status := m.senderStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.signatureStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.receiptStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.priorityStatus(); status != "" {
+		badge += "\n" + continueStyle.Render(status)
+	}
+	if status := m.spellStatus(m.misspelled()); status != "" {
+		badge += "\n" + inputStyle.Render(status)
+	}
+	if m.spell.open {
+		badge += "\n" + continueStyle.Render(spellHelp)
+	}
+
+	if m.undo.ID != "" {
+		badge += "\n" + continueStyle.Render(m.undoStatus())
+	} else if m.status != "" {
+		badge += "\n" + continueStyle.Render(m.status)
+	}
+
+	return badge
+}
+
+// View renders the model to the screen
+func (m model) View() string {
+
+	switch m.screen {
+	case inboxScreen:
+		return m.inbox.View()
+	case draftsScreen:
+		return m.picker.View()
+	case queueScreen:
+		return m.queue.View()
+	case sentScreen:
+		return m.history.View()
+	case headersScreen:
+		return m.viewHeaders()
+	case templatesScreen:
+		return m.viewTemplates()
+	case previewScreen:
+		return m.viewPreview()
+	case sendingScreen:
+		return m.viewSending()
+	case confirmScreen:
+		return m.viewConfirm()
+	case quitScreen:
+		return m.viewQuit()
+	case attachScreen:
+		return m.viewAttach()
+	case inviteScreen:
+		return m.viewInvite()
+	case searchScreen:
+		return m.viewSearch()
+	case readerScreen:
+		return m.viewReader()
+	case foldersScreen:
+		return m.viewFolders()
+	case followUpsScreen:
+		return m.viewFollowUps()
+	case emojiScreen:
+		return m.viewEmoji()
+	case pgpKeysScreen:
+		return m.viewPGPKeys()
+	}
+
+	return m.viewForm()
+}
+
+// viewForm renders the compose form
+func (m model) viewForm() string {
+
+	// misspelled words are underlined wherever they are
+	bad := m.misspelled()
+
+	form := fmt.Sprintf(`
 	%s
 	%s
 	
@@ -239,42 +1107,266 @@ func (m model) View() string {
 	%s
 	%s
 
+	%s
+	%s
+
 	%s`,
 
 		// renders the to header and input
-		inputStyle.Width(50).Render("To:"),
-		m.inputs[to].View(),
+		m.label(to, tr(fieldLabels[to])),
+		m.inputs[to].View()+m.suggestionList(),
 
 		// renders the from header and input
-		inputStyle.Width(50).Render("From:"),
+		m.label(from, tr(fieldLabels[from])),
 		m.inputs[from].View(),
 
 		// renders the subject header and input
-		inputStyle.Width(50).Render("Subject:"),
-		m.inputs[subject].View(),
+		m.label(subject, tr(fieldLabels[subject])),
+		underline(m.inputs[subject].View(), bad),
 
-		// renders the body header and input
-		inputStyle.Width(50).Render("Body:"),
-		m.inputs[body].View(),
+		// renders the send at header and input
+		m.label(sendAt, tr(fieldLabels[sendAt])),
+		m.inputs[sendAt].View(),
+
+		// renders the body header and editor
+		m.label(body, tr(fieldLabels[body])),
+		// the form is indented with a tab, so every line of the editor needs one too
+		strings.ReplaceAll(underline(m.editor.View(), bad), "\n", "\n\t")+m.attachmentList(),
 
 		// renders the continue prompt at the bottom of the screen
-		continueStyle.Render("(ctrl + c to quit or ctrl + s to send) ->")) + "\n"
+		m.helpView()) + m.badge() + m.modeLine() + m.announcement() + "\n"
+
+	// the error, if there is one, goes below everything else, the
+	// announcement has already said it in accessible mode
+	if m.err != nil && !accessible {
+		form += errorStyle.Render(m.err.Error()) + "\n"
+	}
+
+	return form
+}
+
+// attachmentList renders the names and sizes of the attachments below the body
+func (m model) attachmentList() string {
+
+	if len(m.attachments) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(m.attachments))
+	for i, a := range m.attachments {
+		names[i] = fmt.Sprintf("%s (%s)", a.Filename, email.FormatSize(len(a.Data)))
+	}
+
+	return "\n\t" + continueStyle.Render("📎 "+strings.Join(names, ", "))
+}
+
+// focusField blurs every field and focuses the given one
+func (m *model) focusField(i int) {
+
+	for n := range m.inputs {
+		m.inputs[n].Blur()
+	}
+	m.editor.Blur()
+
+	m.focused = i
+	if i == body {
+		m.editor.Focus()
+	} else {
+		m.inputs[i].Focus()
+	}
+}
+
+// leaveField checks the focused field before we move on from it, and
+// reports whether it is fine to go
+func (m *model) leaveField() bool {
+
+	if m.focused == body {
+		return true
+	}
+
+	// from now on the field is checked as it is typed into, we only really
+	// want the To and From addresses, the rest can be left empty
+	m.checked[m.focused] = true
+	if m.fieldErr(m.focused) != nil {
+		return false
+	}
+
+	// once we know who it goes to we can tell whether it can be encrypted
+	if m.focused == to {
+		m.checkKeys()
+	}
+
+	return true
+}
+
+// send checks the message in the form and asks whether to send it
+func (m model) send() (tea.Model, tea.Cmd) {
+
+	// we don't want to send the message until every field is filled in
+	// properly, so we go to the first one that isn't
+	if field := m.checkFields(); field >= 0 {
+		m.focusField(field)
+		return m, nil
+	}
+
+	return m.openConfirm()
+}
+
+// sendNow sends the message in the form once it has been confirmed
+func (m model) sendNow() (tea.Model, tea.Cmd) {
+
+	queued, cmd, err := m.sendMsg()
+	if m.err = err; m.err != nil {
+		return m, nil
+	}
+	// a queued message is sent in the background, so we stay open and start a new one
+	if queued {
+		if err := m.discardDraft(); err != nil {
+			slog.Error("Could not remove draft", "err", err)
+		}
+		m.resetForm()
+		return m, cmd
+	}
+
+	// the message is on its way, we show how it goes and keep the draft until it has gone
+	m.screen = sendingScreen
+	return m, cmd
 }
 
 // nextInput focuses on the next input
 func (m *model) nextInput() {
 	// we want to focus on the next input by incrementing the focused index
 	// and wrapping around to the beginning if we're at the end
-	m.focused = (m.focused + 1) % len(m.inputs)
+	m.focused = (m.focused + 1) % (body + 1)
 }
 
 // prevInput focuses on the previous input
 func (m *model) prevInput() {
 	// we want to focus on the previous input by decrementing the focused index
 	// and wrapping around to the end if we're at the beginning
-	m.focused = (m.focused - 1 + len(m.inputs)) % len(m.inputs)
+	m.focused = (m.focused - 1 + body + 1) % (body + 1)
 }
 
-func (m *model) sendMsg() {
-	log.Println("Sending message...")
+// sendMsg builds the message from the form and returns cmd to send it in the
+// background. When the message is scheduled for later or it is held back so it
+// can be undone, it is put in the outbox instead, in which case queued is true
+// and cmd, if there is one, keeps track of it.
+func (m *model) sendMsg() (queued bool, cmd tea.Cmd, err error) {
+	slog.Info("Sending message")
+
+	msg, err := m.newMessage()
+	if err != nil {
+		return false, nil, err
+	}
+
+	t, err := newTransport(m.account)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// a message sent while another is still being held back pushes that one out first
+	if m.undo.ID != "" {
+		m.sendPendingNow()
+		m.undo = outbox.Entry{}
+	}
+
+	// a message with a send time waits in the outbox until it is due
+	if !msg.sendAt.IsZero() {
+		if m.outbox == nil {
+			return false, nil, fmt.Errorf("scheduling needs an account to queue the message in")
+		}
+		msg.date = msg.sendAt
+		raw, err := msg.bytes()
+		if err != nil {
+			return false, nil, err
+		}
+		if _, err := m.outbox.Schedule(msg.from.Address, msg.recipients(), msg.subject, raw, msg.sendAt); err != nil {
+			return false, nil, err
+		}
+		m.queue.refresh(m.outbox)
+		m.status = "Scheduled for " + msg.sendAt.Format("Mon 02 Jan 15:04")
+		return true, nil, nil
+	}
+
+	// with undo send turned on the message waits in the outbox for a little while first
+	if m.cfg.UndoDelay() > 0 {
+		cmd, err := m.holdForUndo(msg)
+		if err != nil {
+			return false, nil, err
+		}
+		m.status = ""
+		return true, cmd, nil
+	}
+
+	raw, err := msg.bytes()
+	if err != nil {
+		return false, nil, err
+	}
+
+	m.sending = sendingModel{
+		account: m.account,
+		t:       t,
+		from:    msg.from.Address,
+		to:      msg.recipients(),
+		subject: msg.subject,
+		id:      msg.id,
+		raw:     raw,
+	}
+	return false, m.sending.start(), nil
+}
+
+// resetForm empties the compose form so a new message can be written
+func (m *model) resetForm() {
+
+	for i := range m.inputs {
+		m.inputs[i].SetValue("")
+		m.inputs[i].Blur()
+	}
+	m.editor.Reset()
+	m.attachments = nil
+	m.thread = threadHeaders{}
+	m.headers = nil
+	m.meeting = nil
+	m.pgp = defaultPGP(m.account)
+	m.pgpMissing = nil
+	m.receipts = defaultReceipts(m.account)
+	m.priority = normalPriority
+	m.signature = true
+
+	m.checked = [body]bool{}
+	m.reach.value, m.reach.warnings = "", nil
+	m.focusField(to)
+	m.draftKey = ""
+	m.saved = draft{}
+}
+
+// saveSent keeps a copy of a sent message in the account's local Sent folder
+// and records how it went out in the sent history
+func saveSent(account *config.Account, t transport.Transport, rec store.SentRecord, raw []byte, result string) error {
+
+	dir, err := account.StoreDir()
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	rec.Sent = time.Now()
+	rec.Transport = t.Name()
+	rec.Result = result
+	rec.MessageID = messageID(raw)
+
+	// the recipients are suggested the next time the To field is typed in.
+	// They're counted before the history is written, which they start from.
+	if err := s.AddRecipients(rec.To, rec.Sent); err != nil {
+		slog.Error("Could not remember the recipients", "err", err)
+	}
+
+	// the copy we keep is the message as it went out
+	raw, _ = email.TakeDeliveryReport(raw)
+	_, err = s.SaveSent(rec, raw)
+	return err
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/eai"
+	"github.com/aidk/go-mailer/internal/templates"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// recipient is one row of a mail merge, the values are keyed by column name
+type recipient struct {
+	line   int
+	addr   *mail.Address
+	values map[string]string
+}
+
+// mergeCommand sends one message per row of a CSV file, filling in a template from the row
+//
+//	go-mailer merge [-account name] -template name [-rate 30] [-column email] [-unsubscribe-mailto addr] [-unsubscribe-url url] [-json] [-no-signature] recipients.csv
+func mergeCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	accountName := fs.String("account", "", "account to send from, defaults to the first one")
+	templateName := fs.String("template", "", "name of a template in the templates directory next to the config, or the path of a template file")
+	rate := fs.Int("rate", 30, "the most messages to send per minute")
+	column := fs.String("column", "email", "the column holding the recipient's address")
+	asJSON := fs.Bool("json", false, "print the results as JSON, the progress goes to stderr instead")
+	noSignature := fs.Bool("no-signature", false, "leave the account's signature off the messages")
+	unsubMailto := fs.String("unsubscribe-mailto", "", "address that unsubscribes whoever writes to it, for the List-Unsubscribe header")
+	unsubURL := fs.String("unsubscribe-url", "", "https URL that unsubscribes in one click, it can use the columns like the template")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *templateName == "" {
+		return fmt.Errorf("usage: go-mailer merge [-account name] -template name [-rate 30] [-column email] [-unsubscribe-mailto addr] [-unsubscribe-url url] [-json] [-no-signature] recipients.csv")
+	}
+	if *rate <= 0 {
+		return fmt.Errorf("rate must be at least one message per minute")
+	}
+
+	account, err := cfg.Account(*accountName)
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(account.Address)
+	if err != nil {
+		return fmt.Errorf("account %s has no valid address", account.Name)
+	}
+
+	tmpl, err := findTemplate(*templateName)
+	if err != nil {
+		return err
+	}
+	if !tmpl.HasSubject() {
+		return fmt.Errorf("template %s has no Subject: line, every message of a merge needs one", tmpl.Name)
+	}
+
+	unsub, err := newUnsubscribe(*unsubMailto, *unsubURL)
+	if err != nil {
+		return err
+	}
+
+	rcpts, err := readRecipients(fs.Arg(0), *column)
+	if err != nil {
+		return err
+	}
+
+	// we check that every placeholder has a column before anything is sent, half a merge is worse than none
+	today := time.Now().Format("2 January 2006")
+	for _, name := range append(tmpl.Vars, unsub.vars()...) {
+		if _, ok := rcpts[0].values[name]; !ok && name == "Date" {
+			// just like in the compose view, {{.Date}} is today's date unless the file says otherwise
+			for _, r := range rcpts {
+				r.values[name] = today
+			}
+			continue
+		}
+		if _, ok := rcpts[0].values[name]; !ok {
+			user := "template " + tmpl.Name
+			if !slices.Contains(tmpl.Vars, name) {
+				user = "the unsubscribe link"
+			}
+			return fmt.Errorf("%s uses {{.%s}} but %s has no %s column", user, name, fs.Arg(0), name)
+		}
+	}
+	if _, err := unsub.headers(rcpts[0].values); err != nil {
+		return err
+	}
+
+	t, err := newTransport(account)
+	if err != nil {
+		return err
+	}
+
+	// every message is the same but for who it goes to, its subject and its body
+	base := message{
+		from:    sender,
+		headers: withReplyTo(nil, account, sender.Address),
+		pgp:     defaultPGP(account),
+		signKey: account.PGP.Key,
+		smime:   account.SMIME,
+		wrap:    cfg.WrapColumn(),
+
+		encoding: cfg.TextEncoding(),
+		receipts: defaultReceipts(account),
+	}
+	if !*noSignature {
+		if base.signature, base.signatureHTML, err = accountSignature(account, sender.Address); err != nil {
+			return err
+		}
+	}
+
+	// with -json stdout is for the results alone
+	progress := os.Stdout
+	if *asJSON {
+		progress = os.Stderr
+	}
+
+	var (
+		results []sendResult
+		failed  []string
+	)
+	interval := time.Minute / time.Duration(*rate)
+	for i, r := range rcpts {
+		// we space the messages out so the server doesn't take us for a spammer
+		if i > 0 {
+			time.Sleep(interval)
+		}
+
+		fmt.Fprintf(progress, "[%d/%d] %s ... ", i+1, len(rcpts), r.addr.Address)
+		res := sendMerged(account, t, tmpl, unsub, base, r)
+		results = append(results, res)
+		if !res.OK {
+			fmt.Fprintln(progress, "failed:", res.Error.Message)
+			failed = append(failed, fmt.Sprintf("line %d, %s: %s", r.line, r.addr.Address, res.Error.Message))
+			continue
+		}
+		fmt.Fprintln(progress, "sent")
+	}
+
+	fmt.Fprintf(progress, "\nSent %d of %d messages\n", len(rcpts)-len(failed), len(rcpts))
+	if len(failed) > 0 {
+		fmt.Fprintf(progress, "%d failed:\n", len(failed))
+		for _, f := range failed {
+			fmt.Fprintln(progress, "  "+f)
+		}
+	}
+
+	if *asJSON {
+		summary := struct {
+			Sent     int          `json:"sent"`
+			Failed   int          `json:"failed"`
+			Messages []sendResult `json:"messages"`
+		}{len(rcpts) - len(failed), len(failed), results}
+		if err := printJSON(summary); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d messages could not be sent", len(failed), len(rcpts))
+	}
+	return nil
+}
+
+// sendMerged fills the template in for one recipient and sends it
+func sendMerged(account *config.Account, t transport.Transport, tmpl templates.Template, unsub unsubscribe, msg message, r recipient) sendResult {
+
+	subj, text, err := tmpl.Execute(r.values)
+	if err != nil {
+		return invalidResult(err)
+	}
+	// a quoted field can hold line breaks, which mustn't get into the header
+	if err := validateSubject(subj); err != nil {
+		return invalidResult(err)
+	}
+	headers, err := unsub.headers(r.values)
+	if err != nil {
+		return invalidResult(err)
+	}
+
+	msg.to = []*mail.Address{r.addr}
+	msg.subject, msg.body = subj, text
+	msg.headers = append(append([]header(nil), msg.headers...), headers...)
+	msg.id = email.NewID(msg.from.Address)
+
+	return deliver(account, t, msg)
+}
+
+// unsubscribe is how the recipients of a merge can stop getting it. Gmail
+// and Yahoo want bulk mail to say so in a List-Unsubscribe header (RFC
+// 2369), and with an https URL to unsubscribe in one click (RFC 8058).
+// Both can use the columns of the file, so every recipient gets their own.
+type unsubscribe struct {
+	mailto *templates.Template
+	url    *templates.Template
+}
+
+// newUnsubscribe reads the -unsubscribe-mailto and -unsubscribe-url flags, either can be empty
+func newUnsubscribe(mailto, url string) (unsubscribe, error) {
+
+	var u unsubscribe
+	if mailto = strings.TrimSpace(mailto); mailto != "" {
+		t, err := templates.Parse("unsubscribe-mailto", mailto)
+		if err != nil {
+			return unsubscribe{}, err
+		}
+		u.mailto = &t
+	}
+	if url = strings.TrimSpace(url); url != "" {
+		// one-click unsubscribing is only allowed over https
+		if !strings.HasPrefix(strings.ToLower(url), "https://") {
+			return unsubscribe{}, fmt.Errorf("the unsubscribe url has to start with https://")
+		}
+		t, err := templates.Parse("unsubscribe-url", url)
+		if err != nil {
+			return unsubscribe{}, err
+		}
+		u.url = &t
+	}
+
+	return u, nil
+}
+
+// vars returns the placeholders the unsubscribe address and URL use
+func (u unsubscribe) vars() []string {
+
+	var vars []string
+	for _, t := range []*templates.Template{u.mailto, u.url} {
+		if t != nil {
+			vars = append(vars, t.Vars...)
+		}
+	}
+
+	return vars
+}
+
+// headers returns the List-Unsubscribe headers for one recipient, none when
+// neither an address nor a URL was given
+func (u unsubscribe) headers(values map[string]string) ([]header, error) {
+
+	var links []string
+	if u.mailto != nil {
+		_, mailto, err := u.mailto.Execute(values)
+		if err != nil {
+			return nil, err
+		}
+		// a plain address gets a subject, so the message says what it wants
+		if !strings.HasPrefix(strings.ToLower(mailto), "mailto:") {
+			addr, err := mail.ParseAddress(mailto)
+			if err != nil {
+				return nil, fmt.Errorf("invalid unsubscribe address %q", mailto)
+			}
+			mailto = "mailto:" + addr.Address + "?subject=unsubscribe"
+		}
+		links = append(links, "<"+mailto+">")
+	}
+	if u.url != nil {
+		_, url, err := u.url.Execute(values)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, "<"+url+">")
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	headers := []header{{name: "List-Unsubscribe", value: strings.Join(links, ", ")}}
+	if u.url != nil {
+		headers = append(headers, header{name: "List-Unsubscribe-Post", value: "List-Unsubscribe=One-Click"})
+	}
+	for _, h := range headers {
+		if err := validateHeader(h.name, h.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", h.name, err)
+		}
+	}
+
+	return headers, nil
+}
+
+// findTemplate loads a template from a file, or by name from the templates directory
+func findTemplate(name string) (templates.Template, error) {
+
+	if data, err := os.ReadFile(name); err == nil {
+		base := filepath.Base(name)
+		return templates.Parse(strings.TrimSuffix(base, filepath.Ext(base)), string(data))
+	}
+
+	dir, err := config.TemplatesDir()
+	if err != nil {
+		return templates.Template{}, err
+	}
+	all, err := templates.Load(dir)
+	if err != nil {
+		return templates.Template{}, err
+	}
+	for _, t := range all {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	return templates.Template{}, fmt.Errorf("no template called %s in %s", name, dir)
+}
+
+// readRecipients reads the CSV file. The first row names the columns, which
+// become the placeholders of the template; the address column must be there.
+func readRecipients(path, column string) ([]recipient, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	names, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the columns of %s: %w", path, err)
+	}
+	addrColumn := -1
+	for i, name := range names {
+		names[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // spreadsheets like to start with a BOM
+		if strings.EqualFold(names[i], column) {
+			addrColumn = i
+		}
+	}
+	if addrColumn < 0 {
+		return nil, fmt.Errorf("%s has no %s column", path, column)
+	}
+
+	var rcpts []recipient
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+
+		values := make(map[string]string, len(names))
+		for i, name := range names {
+			values[name] = row[i]
+		}
+
+		// a bad address is a mistake in the file, so we stop before sending anything
+		addr, err := mail.ParseAddress(row[addrColumn])
+		if err == nil {
+			_, err = eai.Address(addr.Address)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid email address %q", path, line, row[addrColumn])
+		}
+		if addr.Name == "" {
+			addr.Name = values["Name"]
+		}
+
+		rcpts = append(rcpts, recipient{line: line, addr: addr, values: values})
+	}
+
+	if len(rcpts) == 0 {
+		return nil, fmt.Errorf("%s has no recipients", path)
+	}
+
+	return rcpts, nil
+}
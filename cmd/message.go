@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// message is an email built from the compose form
+type message struct {
+	from    *mail.Address
+	to      []*mail.Address
+	subject string
+	body    string
+	files   []email.Attachment
+	id      string        // the Message-ID, with its angle brackets
+	thread  threadHeaders // set when the message is a reply
+	headers []header      // extra headers, already validated
+	pgp     pgpMode       // whether to sign and encrypt it
+	signKey string        // the key to sign with, the sender's key if empty
+	smime   config.SMIME  // the certificate to sign with when PGP is off
+	wrap    int           // the column the body is wrapped at as format=flowed, 0 for as typed
+	date    time.Time     // when the message was written, now if it is zero
+	sendAt  time.Time     // when the message should go out, now if it is zero
+	meeting *meeting      // the meeting it invites its recipients to, if it does
+
+	signature     string // added below the body, if there is one
+	signatureHTML string // added below the HTML version of the body, which is only sent with one
+
+	receipts receiptMode // the read receipt and delivery report it asks for
+	priority priority    // how important it says it is
+	encoding string      // how its text parts are encoded, one of the email.Encoding constants
+}
+
+// newMessage builds a message from the values in the compose form
+func (m model) newMessage() (message, error) {
+
+	sender, err := mail.ParseAddress(m.inputs[from].Value())
+	if err != nil {
+		return message{}, fmt.Errorf("invalid from address")
+	}
+
+	rcpt, err := mail.ParseAddressList(trimAddressList(m.inputs[to].Value()))
+	if err != nil {
+		return message{}, fmt.Errorf("invalid to address")
+	}
+
+	at, err := parseSendAt(m.inputs[sendAt].Value(), time.Now())
+	if err != nil {
+		return message{}, err
+	}
+
+	var (
+		signKey string
+		smime   config.SMIME
+	)
+	if m.account != nil {
+		signKey, smime = m.account.PGP.Key, m.account.SMIME
+	}
+
+	msg := message{
+		from:    sender,
+		to:      rcpt,
+		subject: m.inputs[subject].Value(),
+		body:    m.editor.Value(),
+		files:   m.attachments,
+		id:      email.NewID(sender.Address),
+		thread:  m.thread,
+		headers: withReplyTo(m.headers, m.account, sender.Address),
+		pgp:     m.pgp,
+		signKey: signKey,
+		smime:   smime,
+		wrap:    m.cfg.WrapColumn(),
+		sendAt:  at,
+		meeting: m.meeting,
+
+		encoding: m.cfg.TextEncoding(),
+		receipts: m.receipts,
+		priority: m.priority,
+	}
+
+	if m.signature && m.account != nil {
+		if msg.signature, msg.signatureHTML, err = accountSignature(m.account, sender.Address); err != nil {
+			return message{}, err
+		}
+	}
+
+	return msg, nil
+}
+
+// accountSignature returns the plain text and HTML signatures of the
+// account's identity the message is from
+func accountSignature(account *config.Account, from string) (string, string, error) {
+
+	sender, _ := account.Sender(from)
+	plain, err := sender.Signature.Plain()
+	if err != nil {
+		return "", "", err
+	}
+	html, err := sender.Signature.HTMLText()
+	if err != nil {
+		return "", "", err
+	}
+
+	return plain, html, nil
+}
+
+// recipients returns the bare addresses the message should be delivered
+// to, those in To and in the Cc and Bcc headers added by hand
+func (msg message) recipients() []string {
+
+	var rcpts []string
+	seen := make(map[string]bool)
+	for _, list := range [][]*mail.Address{msg.to, msg.copied("Cc"), msg.copied("Bcc")} {
+		for _, a := range list {
+			if !seen[strings.ToLower(a.Address)] {
+				seen[strings.ToLower(a.Address)] = true
+				rcpts = append(rcpts, a.Address)
+			}
+		}
+	}
+	return rcpts
+}
+
+// copied returns the addresses in the Cc or Bcc headers of the message
+func (msg message) copied(name string) []*mail.Address {
+
+	var addrs []*mail.Address
+	for _, h := range msg.headers {
+		if !strings.EqualFold(h.name, name) {
+			continue
+		}
+		// the headers panel doesn't take a list it can't read
+		if list, err := mail.ParseAddressList(h.value); err == nil {
+			addrs = append(addrs, list...)
+		}
+	}
+	return addrs
+}
+
+// withReplyTo adds the Reply-To of the identity the message is from to the
+// extra headers, unless the message already says where replies go
+func withReplyTo(headers []header, account *config.Account, from string) []header {
+
+	if account == nil {
+		return headers
+	}
+	sender, _ := account.Sender(from)
+	if sender.ReplyTo == "" {
+		return headers
+	}
+	for _, h := range headers {
+		if strings.EqualFold(h.name, "Reply-To") {
+			return headers
+		}
+	}
+
+	return append(append([]header(nil), headers...), header{name: "Reply-To", value: sender.ReplyTo})
+}
+
+// bytes renders the message in RFC 5322 format, ready to hand to a transport.
+// It only fails if an image it shows can't be read, or the message can't be
+// signed or encrypted.
+func (msg message) bytes() ([]byte, error) {
+
+	// an HTML body goes with a plain text version made from it. A body that
+	// shows images needs an HTML version to show them in, the plain text
+	// version says what they are instead.
+	text, html := msg.body, ""
+	switch {
+	case isHTML(msg.body):
+		text, html = alternativeBody(msg.body, msg.signature, msg.signatureHTML)
+	case msg.signatureHTML != "" || hasImages(msg.body):
+		html = htmlBody(msg.body, msg.signatureHTML)
+		text = textImages(text)
+		fallthrough
+	default:
+		if msg.signature != "" {
+			text = appendSignature(text, msg.signature)
+		}
+	}
+
+	var images []email.Image
+	if html != "" {
+		var err error
+		if html, images, err = embedImages(html, msg.id); err != nil {
+			return nil, err
+		}
+	}
+
+	// an invitation goes in as another version of the body, which calendars
+	// show with buttons to accept or decline it, and as a file for the others
+	var calendar []byte
+	files := msg.files
+	if msg.meeting != nil {
+		calendar = msg.meeting.event(msg).Request()
+		files = append(files[:len(files):len(files)], email.Attachment{Filename: "invite.ics", ContentType: "application/ics", Data: calendar})
+	}
+
+	headers := msg.thread.headers()
+	for _, h := range msg.headers {
+		// Bcc only goes in the envelope, nobody gets to see who was blind copied
+		if strings.EqualFold(h.name, "Bcc") {
+			continue
+		}
+		headers = append(headers, email.Header{Name: h.name, Value: h.value})
+	}
+	headers = append(headers, msg.priority.headers()...)
+
+	e := email.Message{
+		From:        msg.from,
+		To:          msg.to,
+		Subject:     msg.subject,
+		Date:        msg.date,
+		ID:          msg.id,
+		Headers:     headers,
+		Text:        text,
+		HTML:        html,
+		Images:      images,
+		Calendar:    calendar,
+		Attachments: files,
+		Wrap:        msg.wrap,
+		Encoding:    msg.encoding,
+
+		ReadReceipt:    msg.receipts&receiptRead != 0,
+		DeliveryReport: msg.receipts&receiptDelivery != 0,
+	}
+	if msg.pgp == 0 && !msg.smime.Enabled() {
+		return e.Bytes(), nil
+	}
+
+	var b bytes.Buffer
+	e.WriteHeaders(&b)
+
+	// a signed entity has to reach the receiver unchanged, so it is written 7bit safe
+	var entity bytes.Buffer
+	e.WriteBody(&entity, true)
+
+	write := msg.writePGP
+	if msg.pgp == 0 {
+		write = msg.writeSMIME
+	}
+	if err := write(&b, entity.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// parseSendAt reads the time typed into the send at field. It accepts an
+// empty string (send now), a duration like +2h or +90m, a time today like
+// 17:30 (tomorrow if that has already passed), "tomorrow 09:00" and a full
+// "2006-01-02 15:04" date.
+func parseSendAt(s string, now time.Time) (time.Time, error) {
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	invalid := errors.New(tr("invalid send time, try 17:30, tomorrow 09:00, 2006-01-02 15:04 or +2h"))
+
+	if strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s[1:])
+		if err != nil || d <= 0 {
+			return time.Time{}, invalid
+		}
+		return now.Add(d), nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		if !t.After(now) {
+			return time.Time{}, errors.New(tr("send time is in the past"))
+		}
+		return t, nil
+	}
+
+	days := 0
+	if strings.HasPrefix(s, "tomorrow") {
+		days = 1
+		s = strings.TrimSpace(strings.TrimPrefix(s, "tomorrow"))
+	}
+
+	clock, err := time.Parse("15:04", s)
+	if err != nil {
+		return time.Time{}, invalid
+	}
+
+	t := time.Date(now.Year(), now.Month(), now.Day()+days, clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		// a time that has already gone today means tomorrow
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
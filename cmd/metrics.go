@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/metrics"
+)
+
+// latencyBuckets are the bounds of the latency histograms, in seconds
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// the metrics go-mailer serve shows on /metrics, by account
+var (
+	sentTotal    = metrics.NewCounter("go_mailer_messages_sent_total", "Messages the server took.", "account")
+	failedTotal  = metrics.NewCounter("go_mailer_messages_failed_total", "Messages refused for good.", "account")
+	retriedTotal = metrics.NewCounter("go_mailer_messages_retried_total", "Failed attempts at sending that will be tried again from the outbox.", "account")
+
+	connectSeconds  = metrics.NewHistogram("go_mailer_smtp_connect_seconds", "How long connecting to the SMTP server, switching to TLS and logging in took.", "account", latencyBuckets)
+	deliverySeconds = metrics.NewHistogram("go_mailer_delivery_seconds", "How long handing a message to the server took, connecting included.", "account", latencyBuckets)
+)
+
+// countEvent counts a message in the metrics of its outcome
+func countEvent(account *config.Account, event string) {
+	switch event {
+	case eventSent:
+		sentTotal.Inc(account.Name)
+	case eventFailed:
+		failedTotal.Inc(account.Name)
+	case eventDeferred:
+		retriedTotal.Inc(account.Name)
+	}
+}
+
+// writeMetrics writes every metric in the Prometheus text format
+func writeMetrics(w io.Writer, cfg *config.Config) {
+
+	sentTotal.Write(w)
+	failedTotal.Write(w)
+	retriedTotal.Write(w)
+	connectSeconds.Write(w)
+	deliverySeconds.Write(w)
+
+	// the outboxes are counted as they are now, so a restart doesn't lose them
+	queued := make(map[string]float64)
+	for i := range cfg.Accounts {
+		account := &cfg.Accounts[i]
+		o, err := openOutbox(account)
+		if err != nil {
+			slog.Error("Could not open the outbox", "account", account.Name, "err", err)
+			continue
+		}
+		entries, err := o.List()
+		if err != nil {
+			slog.Error("Could not read the outbox", "account", account.Name, "err", err)
+			continue
+		}
+		queued[account.Name] = float64(len(entries))
+	}
+	metrics.WriteGauge(w, "go_mailer_outbox_messages", "Messages waiting in the outbox.", "account", queued)
+}
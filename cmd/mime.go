@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/pgp"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// content is what we read out of a message body
+type content struct {
+	text  string
+	html  string // the HTML version of the body, if there is one
+	files []email.Attachment
+	pgp   pgpMode // how the message was protected, if it was
+}
+
+// parseBody reads the text and the attachments out of a message body with
+// the given headers. The first text/plain part that isn't an attachment is
+// the text, and the first text/html part the HTML version of it. Everything
+// else that has a name or isn't text is an attachment.
+// PGP/MIME and S/MIME signed messages are unwrapped, decrypting PGP if we have the key.
+func parseBody(header textproto.MIMEHeader, body io.Reader) (content, error) {
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// no or a broken content type means plain text, as RFC 2045 says
+		mediaType, params = "text/plain", nil
+	}
+
+	switch mediaType {
+	case "multipart/encrypted":
+		return parseEncrypted(body, params["boundary"])
+	case "application/pgp-signature", "application/pkcs7-signature", "application/x-pkcs7-signature":
+		// the signature of a signed message is no use once it is opened again
+		return content{}, nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var (
+			c     content
+			found bool
+		)
+
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return content{}, err
+			}
+
+			pc, err := parseBody(part.Header, part)
+			if err != nil {
+				return content{}, err
+			}
+			if !found && pc.text != "" {
+				c.text, found = pc.text, true
+			}
+			if c.html == "" {
+				c.html = pc.html
+			}
+			c.files = append(c.files, pc.files...)
+			c.pgp |= pc.pgp
+		}
+
+		if mediaType == "multipart/signed" && params["protocol"] == "application/pgp-signature" {
+			c.pgp |= pgpSign
+		}
+		return c, nil
+	}
+
+	data, err := io.ReadAll(decodePart(header, body))
+	if err != nil {
+		return content{}, err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+
+	if mediaType == "text/plain" && disposition != "attachment" {
+		// flowed text is put back into paragraphs, so they can be quoted and wrapped again
+		if strings.EqualFold(params["format"], "flowed") {
+			return content{text: email.Unflow(string(data), strings.EqualFold(params["delsp"], "yes"))}, nil
+		}
+		return content{text: string(data)}, nil
+	}
+
+	if mediaType == "text/html" && disposition != "attachment" && filename == "" {
+		return content{html: string(data)}, nil
+	}
+
+	// other text parts, such as a calendar invite's text, aren't attachments
+	if filename == "" && strings.HasPrefix(mediaType, "text/") {
+		return content{}, nil
+	}
+	if filename == "" {
+		filename = "attachment"
+	}
+
+	return content{files: []email.Attachment{{Filename: filename, ContentType: mediaType, Data: data}}}, nil
+}
+
+// parseEncrypted decrypts a multipart/encrypted body, see RFC 3156. The
+// second part holds the encrypted message, which is a MIME entity itself.
+func parseEncrypted(body io.Reader, boundary string) (content, error) {
+
+	r := multipart.NewReader(body, boundary)
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return content{}, fmt.Errorf("encrypted message has no encrypted part")
+		}
+		if err != nil {
+			return content{}, err
+		}
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType != "application/octet-stream" {
+			continue
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return content{}, err
+		}
+		plain, signed, err := pgp.Decrypt(data)
+		if err != nil {
+			return content{}, err
+		}
+
+		entity, err := mail.ReadMessage(bytes.NewReader(plain))
+		if err != nil {
+			return content{}, err
+		}
+		c, err := parseBody(textproto.MIMEHeader(entity.Header), entity.Body)
+		if err != nil {
+			return content{}, err
+		}
+
+		c.pgp |= pgpEncrypt
+		if signed {
+			c.pgp |= pgpSign
+		}
+		return c, nil
+	}
+}
+
+// decodePart undoes the part's content transfer encoding
+func decodePart(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		// the decoder skips the line breaks the encoded text is wrapped with
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
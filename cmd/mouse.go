@@ -0,0 +1,192 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tabWidth is how far the terminal moves for a tab, the form is indented with one
+const tabWidth = 8
+
+// ansiCode matches the escape codes lipgloss colors the view with
+var ansiCode = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// fieldLabels are the labels above the fields, each field starts on the line of its label
+var fieldLabels = []string{to: "To:", from: "From:", subject: "Subject:", sendAt: "Send at:", body: "Body:"}
+
+// updateMouse handles the clicks and the wheel in the compose view
+func (m model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+
+	// while a word is being corrected the keys choose the correction, so the mouse waits
+	if m.spell.open {
+		return m, nil
+	}
+
+	lines := m.screenLines()
+	labels, help := m.layout(lines)
+	field, onField := fieldAt(labels, help, msg.Y)
+	onHelp := msg.Y >= help && msg.Y < min(help+lipgloss.Height(m.helpView()), len(lines))
+
+	switch {
+
+	// we'll handle the wheel over the body to scroll it, by moving its cursor a line
+	case msg.Button == tea.MouseButtonWheelUp || msg.Button == tea.MouseButtonWheelDown:
+		if !onField || field != body || !m.focusClicked(body) {
+			return m, nil
+		}
+		if msg.Button == tea.MouseButtonWheelUp {
+			m.move(tea.KeyUp)
+		} else {
+			m.move(tea.KeyDown)
+		}
+
+	case msg.Action != tea.MouseActionPress || msg.Button != tea.MouseButtonLeft:
+		return m, nil
+
+	// we'll handle a click on the help line to do what was clicked, e.g. send
+	case onHelp:
+		return m.clickHelp(msg.X, lines[msg.Y])
+
+	// we'll handle a click on a field to focus it, and in a one line field
+	// to put the cursor where the click was
+	case onField:
+		if !m.focusClicked(field) {
+			return m, nil
+		}
+		if field != body && msg.Y == labels[field]+1 {
+			m.inputs[field].SetCursor(msg.X - tabWidth)
+		}
+	}
+
+	return m, nil
+}
+
+// focusClicked focuses the field that was clicked, as long as the one we're
+// leaving is filled in properly, the same as when tabbing out of it
+func (m *model) focusClicked(field int) bool {
+
+	if field == m.focused {
+		return true
+	}
+	if !m.leaveField() {
+		return false
+	}
+	m.focusField(field)
+
+	return true
+}
+
+// clickHelp runs the action whose key was clicked in the help line
+func (m model) clickHelp(x int, line string) (tea.Model, tea.Cmd) {
+
+	buttons := []struct {
+		binding key.Binding
+		run     func(model) (tea.Model, tea.Cmd)
+	}{
+		{m.keys.quit, model.quit},
+		{m.keys.inbox, model.openInbox},
+		{m.keys.sent, model.openHistory},
+		{m.keys.send, model.send},
+	}
+
+	for _, b := range buttons {
+		label := b.binding.Help().Key + " " + b.binding.Help().Desc
+		i := strings.Index(line, label)
+		if i < 0 {
+			continue
+		}
+		start := utf8.RuneCountInString(line[:i])
+		if x >= start && x < start+utf8.RuneCountInString(label) {
+			return b.run(m)
+		}
+	}
+
+	return m, nil
+}
+
+// screenLines returns the lines of the compose view the way the terminal
+// shows them, without the colors and with the tabs turned into spaces
+func (m model) screenLines() []string {
+
+	lines := strings.Split(ansiCode.ReplaceAllString(m.View(), ""), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+
+	return lines
+}
+
+// layout finds the line of each field's label and the first line of the
+// help below them, the fields grow and shrink with suggestions and badges
+// so we look for them instead of counting
+func (m model) layout(lines []string) (labels [body + 1]int, help int) {
+
+	n := 0
+	for field := to; field <= body; field++ {
+		for n < len(lines) && !isLabel(lines[n], tr(fieldLabels[field])) {
+			n++
+		}
+		labels[field] = n
+	}
+
+	helpLine, _, _ := strings.Cut(ansiCode.ReplaceAllString(m.helpView(), ""), "\n")
+	for help = labels[body]; help < len(lines); help++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[help]), strings.TrimSpace(helpLine)) {
+			break
+		}
+	}
+
+	return labels, help
+}
+
+// isLabel reports whether the line is the given label, with the field's error next to it or not
+func isLabel(line, label string) bool {
+	line = strings.TrimSpace(line)
+	return line == label || strings.HasPrefix(line, label+" ✗ ")
+}
+
+// fieldAt returns the field shown on the given line, everything from a
+// field's label to the next label belongs to it
+func fieldAt(labels [body + 1]int, help, y int) (int, bool) {
+
+	if y < labels[to] || y >= help {
+		return 0, false
+	}
+
+	field := to
+	for f := to; f <= body; f++ {
+		if labels[f] <= y {
+			field = f
+		}
+	}
+
+	return field, true
+}
+
+// expandTabs turns the tabs in a line into as many spaces as the terminal moves for them
+func expandTabs(line string) string {
+
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			col += spaces
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+
+	return b.String()
+}
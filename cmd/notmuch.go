@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/notmuch"
+	"github.com/aidk/go-mailer/internal/search"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// notmuchLimit is how many of the newest messages notmuch finds we show
+const notmuchLimit = 100
+
+type (
+	// notmuchMsg is sent with what notmuch found for the query
+	notmuchMsg struct {
+		query string
+		items []list.Item
+		err   error
+	}
+
+	// taggedMsg is sent once notmuch has tagged a message
+	taggedMsg struct {
+		err error
+	}
+)
+
+// indexNotmuch has notmuch index the mail saved since it last looked, so
+// what we've just sent can be found too
+func indexNotmuch(account *config.Account) tea.Cmd {
+
+	return func() tea.Msg {
+		if !notmuch.Available() {
+			return indexedMsg{err: fmt.Errorf("notmuch is set in the config, but it isn't installed")}
+		}
+		if err := notmuch.Index(); err != nil {
+			return indexedMsg{err: err}
+		}
+
+		// the mail we keep can only be found if notmuch looks where it is
+		s, err := mailStore(account)
+		if err != nil {
+			return indexedMsg{err: err}
+		}
+		root, err := notmuch.Root()
+		if err != nil {
+			return indexedMsg{err: err}
+		}
+		if _, ok := inside(root, s.Dir()); !ok {
+			return indexedMsg{err: fmt.Errorf("%s isn't under notmuch's database.path %s, so its mail can't be found", s.Dir(), root)}
+		}
+		return indexedMsg{}
+	}
+}
+
+// searchNotmuch asks notmuch for the messages matching the query in the background
+func searchNotmuch(account *config.Account, query string) tea.Cmd {
+
+	return func() tea.Msg {
+		files, err := notmuch.Files(query, notmuchLimit)
+		if err != nil {
+			return notmuchMsg{query: query, err: err}
+		}
+
+		dir := ""
+		if s, err := mailStore(account); err == nil {
+			dir = s.Dir()
+		}
+
+		var (
+			items []list.Item
+			ids   []string
+		)
+		for _, path := range files {
+			item, ok := notmuchResult(dir, path)
+			if !ok {
+				continue
+			}
+			items = append(items, item)
+			if item.id != "" {
+				ids = append(ids, item.id)
+			}
+		}
+
+		// the tags of all of them come in one go
+		tags, err := notmuch.Tags(ids)
+		if err != nil {
+			return notmuchMsg{query: query, err: err}
+		}
+		for i, item := range items {
+			r := item.(resultItem)
+			r.tags = tags[strings.Trim(r.id, "<>")]
+			items[i] = r
+		}
+
+		return notmuchMsg{query: query, items: items}
+	}
+}
+
+// notmuchResult reads the headers of a message notmuch found. Messages in
+// our own store know their folder and key, so drafts and sent mail can be
+// opened in the form again.
+func notmuchResult(storeDir, path string) (resultItem, bool) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		// notmuch may not know yet that the file was moved
+		return resultItem{}, false
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		return resultItem{}, false
+	}
+
+	item := resultItem{
+		Doc: search.Doc{
+			From:    decodedHeader(msg.Header, "From"),
+			To:      decodedHeader(msg.Header, "To"),
+			Subject: decodeText(msg.Header.Get("Subject")),
+		},
+		path: path,
+		id:   strings.TrimSpace(msg.Header.Get("Message-Id")),
+	}
+	item.Date, _ = msg.Header.Date()
+
+	// a maildir message is at <store>/<folder>/cur/<key>:2,<flags>
+	if rel, ok := inside(storeDir, path); ok && storeDir != "" {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) == 3 && (parts[1] == "cur" || parts[1] == "new") {
+			item.Folder = parts[0]
+			item.Key, _, _ = strings.Cut(parts[2], ":2,")
+		}
+	}
+
+	return item, true
+}
+
+// inside returns the path relative to dir, and whether it is inside it
+func inside(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// tagNotmuch changes the tags of the message in the background
+func tagNotmuch(id string, changes []string) tea.Cmd {
+	return func() tea.Msg {
+		return taggedMsg{err: notmuch.Tag(id, changes)}
+	}
+}
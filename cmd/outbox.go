@@ -0,0 +1,499 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/outbox"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/pkg/transport"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// outboxInterval is how often we check for queued messages that are due for another attempt
+const outboxInterval = 30 * time.Second
+
+type (
+	// outboxTickMsg is sent every outboxInterval to flush the outbox
+	outboxTickMsg struct{}
+
+	// outboxFlushedMsg is sent once a flush of the outbox has finished
+	outboxFlushedMsg struct {
+		sent   int
+		failed int
+		err    error
+	}
+)
+
+// outboxTick waits for the next outbox flush
+func outboxTick() tea.Cmd {
+	return tea.Tick(outboxInterval, func(time.Time) tea.Msg {
+		return outboxTickMsg{}
+	})
+}
+
+// openOutbox returns the outbox of the given account
+func openOutbox(account *config.Account) (*outbox.Outbox, error) {
+
+	dir, err := account.OutboxDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return outbox.Open(dir)
+}
+
+// flushOutbox tries to send every queued message that is due, in the background
+func flushOutbox(account *config.Account, o *outbox.Outbox) tea.Cmd {
+	return func() tea.Msg {
+		sent, failed, err := sendQueued(account, o)
+		return outboxFlushedMsg{sent: sent, failed: failed, err: err}
+	}
+}
+
+// sendQueued sends every queued message that is due, keeping a copy of each in Sent
+func sendQueued(account *config.Account, o *outbox.Outbox) (sent, failed int, err error) {
+
+	t, err := newTransport(account)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return o.Flush(func(e outbox.Entry, raw []byte) error {
+		result, raw, err := send(account, t, e.From, e.To, e.Subject, raw)
+
+		ev := webhookEvent{MessageID: messageID(raw), From: e.From, To: e.To, Subject: e.Subject, Queued: e.ID, Attempts: e.Attempts + 1, Reply: result}
+		if err != nil {
+			// the outbox stops trying after a permanent error, see outbox.Entry.GaveUp
+			ev.Event, ev.Error = eventDeferred, newResultError(errFailed, err)
+			if _, permanent := transport.Classify(err); permanent {
+				ev.Event = eventFailed
+			}
+			notify(account, ev)
+			return err
+		}
+		ev.Event = eventSent
+		notify(account, ev)
+
+		rec := store.SentRecord{From: e.From, To: e.To, Subject: e.Subject}
+		if err := saveSent(account, t, rec, raw, result); err != nil {
+			slog.Error("Could not save sent message", "err", err)
+		}
+		return nil
+	})
+}
+
+// recentStatus is how far back the queue shows the messages that were sent,
+// and maxRecent how many of them it shows at most
+const (
+	recentStatus = 7 * 24 * time.Hour
+	maxRecent    = 50
+)
+
+// entryItem lets us show an outbox entry in a bubbles list
+type entryItem struct {
+	outbox.Entry
+	sending bool // whether it is being sent right now
+}
+
+func (e entryItem) Title() string {
+	subject := e.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	return fmt.Sprintf("%s to %s", subject, strings.Join(e.To, ", "))
+}
+
+func (e entryItem) Description() string {
+
+	if e.sending {
+		return "sending now"
+	}
+
+	if e.Attempts == 0 {
+		if !e.SendAt.IsZero() && e.NextAttempt.After(time.Now()) {
+			return "scheduled for " + e.SendAt.Format("Mon 02 Jan 15:04")
+		}
+		return "queued, waiting to be sent"
+	}
+
+	help := e.LastError
+	if kind := kindHelp(e.ErrorKind, e.GaveUp); kind != "" {
+		help = kind + ": " + e.LastError
+	}
+
+	if e.GaveUp {
+		return fmt.Sprintf("%d failed attempts, not retrying unless you press r, %s", e.Attempts, help)
+	}
+
+	if !e.NextAttempt.After(time.Now()) {
+		return fmt.Sprintf("%d failed attempts, retrying now, %s", e.Attempts, help)
+	}
+	return fmt.Sprintf("deferred until %s after %d failed attempts, %s", e.NextAttempt.Format("Mon 02 Jan 15:04"), e.Attempts, help)
+}
+
+func (e entryItem) FilterValue() string {
+	return e.Subject + " " + strings.Join(e.To, " ")
+}
+
+// due reports whether the entry goes out with the next flush of the outbox
+func (e entryItem) due() bool {
+	return !e.GaveUp && !e.NextAttempt.After(time.Now())
+}
+
+// queueModel lists the messages waiting in the outbox, and below them the
+// ones sent lately with what the server said or why they bounced
+type queueModel struct {
+	list     list.Model
+	store    *store.Store // where the sent history is kept
+	queued   int          // how many of the items are in the outbox, they come first
+	flushing bool         // whether the messages that are due are being sent
+	status   string
+}
+
+// newQueue returns an empty queue list
+func newQueue() queueModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Title = "Queue & Status (r to send now or again, e to edit, d to cancel, enter to read, esc to go back)"
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+
+	return queueModel{list: l}
+}
+
+// refresh reloads the list from the outbox and the sent history
+func (q *queueModel) refresh(o *outbox.Outbox) {
+
+	if o == nil {
+		return
+	}
+
+	entries, err := o.List()
+	if err != nil {
+		slog.Error("Could not read outbox", "err", err)
+		return
+	}
+
+	items := make([]list.Item, 0, len(entries))
+	for _, e := range entries {
+		item := entryItem{Entry: e}
+		item.sending = e.Sending || q.flushing && item.due()
+		items = append(items, item)
+	}
+	q.queued = len(items)
+
+	q.list.SetItems(append(items, q.recent()...))
+}
+
+// recent returns the messages sent within recentStatus, newest first
+func (q queueModel) recent() []list.Item {
+
+	if q.store == nil {
+		return nil
+	}
+
+	records, err := q.store.History()
+	if err != nil {
+		slog.Error("Could not read sent history", "err", err)
+		return nil
+	}
+	bounces, err := q.store.Bounces()
+	if err != nil {
+		slog.Error("Could not read bounces", "err", err)
+	}
+	byID := bouncesByMessage(bounces)
+
+	var items []list.Item
+	for _, rec := range records {
+		if time.Since(rec.Sent) > recentStatus || len(items) == maxRecent {
+			break
+		}
+		item := sentItem{SentRecord: rec}
+		if rec.MessageID != "" {
+			item.bounces = byID[rec.MessageID]
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// count returns the number of queued messages
+func (q queueModel) count() int {
+	return q.queued
+}
+
+// selected returns the highlighted entry, if it is one of the queued messages
+func (q queueModel) selected() (outbox.Entry, bool) {
+	item, ok := q.list.SelectedItem().(entryItem)
+	return item.Entry, ok
+}
+
+// selectedSent returns the highlighted record and the message it describes,
+// if it is one of the messages that were sent
+func (q queueModel) selectedSent() (store.SentRecord, []byte, bool, error) {
+
+	item, ok := q.list.SelectedItem().(sentItem)
+	if !ok || q.store == nil {
+		return store.SentRecord{}, nil, false, nil
+	}
+
+	raw, err := q.store.Folder(store.Sent).Get(item.Key)
+	return item.SentRecord, raw, true, err
+}
+
+func (q queueModel) Update(msg tea.Msg) (queueModel, tea.Cmd) {
+
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		q.list.SetSize(msg.Width, msg.Height-3)
+		return q, nil
+	}
+
+	var cmd tea.Cmd
+	q.list, cmd = q.list.Update(msg)
+	return q, cmd
+}
+
+func (q queueModel) View() string {
+	return fmt.Sprintf("%s\n%s", q.list.View(), continueStyle.Render(q.status))
+}
+
+// updateQueue handles messages while the outbox is showing
+func (m model) updateQueue(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.queue.list.FilterState() != list.Filtering {
+		switch msg.String() {
+
+		// we'll handle r to retry the selected message straight away, or
+		// to send one that was sent already again, e.g. after it bounced
+		case "r":
+			if e, ok := m.queue.selected(); ok {
+				err := m.outbox.Retry(e.ID)
+				if errors.Is(err, outbox.ErrSending) {
+					m.queue.status = "That message is already being sent"
+					return m, nil
+				}
+				if err != nil {
+					slog.Error("Could not retry message", "err", err)
+				}
+				cmd := m.flush()
+				return m, cmd
+			}
+			rec, raw, ok, err := m.queue.selectedSent()
+			if !ok {
+				return m, nil
+			}
+			if err == nil {
+				_, err = m.outbox.Enqueue(rec.From, rec.To, rec.Subject, raw)
+			}
+			if err != nil {
+				m.queue.status = "Could not resend message: " + err.Error()
+				return m, nil
+			}
+			m.queue.status = "Resending " + sentItem{SentRecord: rec}.Title()
+			cmd := m.flush()
+			return m, cmd
+
+		// we'll handle enter to read the selected message, if it was sent
+		case "enter":
+			rec, raw, ok, err := m.queue.selectedSent()
+			if !ok {
+				return m, nil
+			}
+			if err == nil {
+				err = m.openReader(raw, queueScreen, store.Sent, rec.Key)
+			}
+			if err != nil {
+				m.queue.status = "Could not open message: " + err.Error()
+			}
+			return m, nil
+
+		// we'll handle e to take the selected message out of the outbox and back into the form
+		case "e":
+			if e, ok := m.queue.selected(); ok {
+				err := m.editQueued(e)
+				if errors.Is(err, outbox.ErrSending) {
+					m.queue.status = "That message is already being sent, it can't be edited"
+					return m, nil
+				}
+				if err != nil {
+					m.status = "Could not edit message: " + err.Error()
+				}
+				m.screen = composeScreen
+			}
+			return m, nil
+
+		// we'll handle d to cancel the selected message
+		case "d":
+			if e, ok := m.queue.selected(); ok {
+				err := m.outbox.Remove(e.ID)
+				if errors.Is(err, outbox.ErrSending) {
+					m.queue.status = "That message is already being sent, it can't be cancelled"
+				} else if err != nil {
+					slog.Error("Could not cancel message", "err", err)
+				}
+				m.queue.refresh(m.outbox)
+			} else if _, ok := m.queue.list.SelectedItem().(sentItem); ok {
+				m.queue.status = "That message has been sent, only queued ones can be cancelled"
+			}
+			return m, nil
+
+		// we'll handle esc to go back to the compose view, unless the list is using it
+		case "esc":
+			if m.queue.list.FilterState() == list.Unfiltered {
+				m.screen = composeScreen
+				return m, nil
+			}
+		}
+
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.queue, cmd = m.queue.Update(msg)
+	return m, cmd
+}
+
+// flush starts flushing the outbox, unless a flush is already running
+func (m *model) flush() tea.Cmd {
+
+	if m.outbox == nil || m.flushing {
+		return nil
+	}
+
+	m.flushing, m.queue.flushing = true, true
+	m.queue.refresh(m.outbox)
+	return flushOutbox(m.account, m.outbox)
+}
+
+// editQueued moves a queued message back into the compose form, keeping its send time
+func (m *model) editQueued(e outbox.Entry) error {
+
+	raw, err := m.outbox.Message(e.ID)
+	if err != nil {
+		return err
+	}
+
+	d, err := parseDraft("", raw)
+	if err != nil {
+		return err
+	}
+	if !e.SendAt.IsZero() {
+		d.sendAt = e.SendAt.Format("2006-01-02 15:04")
+	}
+
+	// whatever was in the form is kept as a draft rather than thrown away,
+	// it stays in the form too if the message turns out to be on its way
+	if err := m.saveDraft(); err != nil {
+		return err
+	}
+
+	if err := m.outbox.Remove(e.ID); err != nil {
+		return err
+	}
+	m.queue.refresh(m.outbox)
+
+	m.resetForm()
+	m.resumeDraft(d)
+	m.draftKey, m.saved = "", draft{}
+	return nil
+}
+
+// queueCommand lists the messages in the account's outbox, sends the ones
+// that are due, or retries or cancels one of them
+//
+//	go-mailer queue [-account name] [-json] [list | flush | retry id | cancel id]
+func queueCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	accountName := fs.String("account", "", "account whose outbox to use, defaults to the first one")
+	asJSON := fs.Bool("json", false, "list the messages as JSON, one per line")
+	fs.Parse(args)
+
+	usage := fmt.Errorf("usage: go-mailer queue [-account name] [-json] [list | flush | retry id | cancel id]")
+	action, id := "list", ""
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		action = fs.Arg(0)
+	case 2:
+		action, id = fs.Arg(0), fs.Arg(1)
+	default:
+		return usage
+	}
+	// only retry and cancel take the id of a message
+	if (id != "") != (action == "retry" || action == "cancel") {
+		return usage
+	}
+
+	account, err := cfg.Account(*accountName)
+	if err != nil {
+		return err
+	}
+	o, err := openOutbox(account)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		entries, err := o.List()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if *asJSON {
+				if err := printJSON(e); err != nil {
+					return err
+				}
+				continue
+			}
+			item := entryItem{Entry: e}
+			fmt.Printf("%s  %s, %s\n", e.ID, item.Title(), item.Description())
+		}
+		return nil
+
+	case "cancel":
+		if _, err := o.Message(id); err != nil {
+			return fmt.Errorf("no message %q in the outbox", id)
+		}
+		if err := o.Remove(id); err != nil {
+			return err
+		}
+		fmt.Printf("Cancelled %s\n", id)
+		return nil
+
+	case "retry":
+		if _, err := o.Message(id); err != nil {
+			return fmt.Errorf("no message %q in the outbox", id)
+		}
+		if err := o.Retry(id); err != nil {
+			return err
+		}
+		// like r in the TUI, it goes straight away along with whatever else is due
+		fallthrough
+
+	case "flush":
+		sent, failed, err := sendQueued(account, o)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sent %d messages, %d failed\n", sent, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d messages could not be sent, go-mailer queue lists why", failed)
+		}
+		return nil
+	}
+
+	return usage
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/audit"
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/eai"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// the codes in a resultError, so scripts don't have to pick error messages
+// apart. Apart from invalid they are the kinds of transport.Classify.
+const (
+	errInvalid  = "invalid" // the flags, the addresses or a file were wrong, nothing was sent
+	errRejected = transport.KindRejected
+	errFailed   = transport.KindOther
+)
+
+// the status of each recipient in a sendResult
+const (
+	statusSent    = "sent"
+	statusRefused = "refused"  // the server wouldn't take this recipient
+	statusNotSent = "not_sent" // the message didn't go out, but not because of this recipient
+	statusQueued  = "queued"   // the message waits in the outbox, see sendResult.Queued
+)
+
+// sendResult is how sending one message went, printed by the commands with -json
+type sendResult struct {
+	OK         bool              `json:"ok"`
+	MessageID  string            `json:"message_id,omitempty"`
+	Transport  string            `json:"transport,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+	Started    time.Time         `json:"started"`
+	Finished   time.Time         `json:"finished"`
+	Reply      string            `json:"reply,omitempty"`  // what the server said when it took the message
+	Queued     string            `json:"queued,omitempty"` // the outbox entry the message waits in, when it didn't go out straight away
+	Recipients []recipientStatus `json:"recipients"`
+	Error      *resultError      `json:"error,omitempty"`
+
+	err error // what sending failed with, for deciding whether to try again
+}
+
+type recipientStatus struct {
+	Address string       `json:"address"`
+	Status  string       `json:"status"`
+	Error   *resultError `json:"error,omitempty"`
+}
+
+type resultError struct {
+	Code     string `json:"code"`
+	SMTPCode int    `json:"smtp_code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// newResultError works out which code an error gets
+func newResultError(code string, err error) *resultError {
+
+	e := &resultError{Code: code, Message: err.Error()}
+
+	if kind, _ := transport.Classify(err); kind != transport.KindOther {
+		e.Code = kind
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		e.SMTPCode = reply.Code
+	}
+
+	return e
+}
+
+// invalidResult is the result of a message that couldn't even be built
+func invalidResult(err error) sendResult {
+	now := time.Now()
+	return sendResult{Started: now, Finished: now, Recipients: []recipientStatus{}, Error: newResultError(errInvalid, err)}
+}
+
+// send hands the message to the transport, timing it for the metrics and
+// noting the attempt in the audit log, whichever way it went. The account's
+// pre-send hooks can stop the message or change it first, so the message
+// that was sent is returned, and its post-send hooks are told how it went.
+func send(account *config.Account, t transport.Transport, from string, to []string, subject string, raw []byte) (string, []byte, error) {
+
+	run := hookRun{account: account, transport: t.Name(), from: from, to: to, subject: subject}
+
+	started := time.Now()
+	var reply string
+	hooked, err := preSend(run, raw)
+	if err == nil {
+		raw = hooked
+		reply, err = t.Send(from, to, raw)
+		deliverySeconds.Observe(account.Name, time.Since(started).Seconds())
+	}
+
+	e := audit.Entry{
+		Time:      started,
+		Account:   account.Name,
+		Transport: t.Name(),
+		MessageID: messageID(raw),
+		From:      from,
+		To:        to,
+		Subject:   audit.HashSubject(subject),
+		Result:    statusSent,
+		Reply:     reply,
+	}
+	if err != nil {
+		e.Result, e.Error = newResultError(errFailed, err).Code, err.Error()
+	}
+
+	// the message went out or it didn't, a log we can't write to doesn't change that
+	if path, perr := config.AuditPath(); perr != nil {
+		slog.Error("Could not write the audit log", "err", perr)
+	} else if _, perr := audit.Append(path, e); perr != nil {
+		slog.Error("Could not write the audit log", "err", perr)
+	}
+
+	run.reply, run.err = reply, err
+	postSend(run, raw)
+
+	return reply, raw, err
+}
+
+// deliver sends the message and keeps a copy in the account's Sent folder
+func deliver(account *config.Account, t transport.Transport, msg message) sendResult {
+
+	res := sendResult{MessageID: msg.id, Transport: t.Name(), Subject: msg.subject, Started: time.Now()}
+
+	raw, err := msg.bytes()
+	if err == nil {
+		res.Reply, raw, err = send(account, t, msg.from.Address, msg.recipients(), msg.subject, raw)
+	}
+	res.Finished = time.Now()
+	res.OK, res.err = err == nil, err
+	if err != nil {
+		res.Error = newResultError(errFailed, err)
+	}
+
+	var refused transport.RecipientError
+	errors.As(err, &refused)
+	for _, addr := range msg.recipients() {
+		status := recipientStatus{Address: addr, Status: statusSent}
+		if err != nil {
+			status.Status = statusNotSent
+			// the server was handed the ASCII form of the address
+			if ascii, _ := eai.Address(addr); refused.Addr != "" && (addr == refused.Addr || ascii == refused.Addr) {
+				status.Status, status.Error = statusRefused, newResultError(errRejected, refused.Err)
+			}
+		}
+		res.Recipients = append(res.Recipients, status)
+	}
+
+	if err != nil {
+		return res
+	}
+
+	// the message has gone out, so failing to keep a copy shouldn't look like a failed send
+	rec := store.SentRecord{From: msg.from.Address, To: msg.recipients(), Subject: msg.subject}
+	if err := saveSent(account, t, rec, raw, res.Reply); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not save sent message:", err)
+	}
+
+	return res
+}
+
+// printJSON writes v to stdout as a single line of JSON
+func printJSON(v any) error {
+	return writeJSON(os.Stdout, v)
+}
+
+// writeJSON writes v to w as a single line of JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	// message ids are in angle brackets, which should stay readable
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/pgp"
+)
+
+// pgpHeader keeps the PGP setting of a draft, it is never sent
+const pgpHeader = "X-Go-Mailer-PGP"
+
+// pgpMode says whether a message is signed, encrypted or both
+type pgpMode int
+
+const (
+	pgpSign pgpMode = 1 << iota
+	pgpEncrypt
+)
+
+// pgpCycle is the order ctrl+g steps through the modes in
+var pgpCycle = []pgpMode{0, pgpSign, pgpSign | pgpEncrypt, pgpEncrypt}
+
+// defaultPGP returns the mode new messages of the account start with
+func defaultPGP(account *config.Account) pgpMode {
+
+	var mode pgpMode
+	if account != nil && account.PGP.Sign {
+		mode |= pgpSign
+	}
+	if account != nil && account.PGP.Encrypt {
+		mode |= pgpEncrypt
+	}
+
+	return mode
+}
+
+// next returns the mode after this one in pgpCycle
+func (p pgpMode) next() pgpMode {
+	for i, mode := range pgpCycle {
+		if mode == p {
+			return pgpCycle[(i+1)%len(pgpCycle)]
+		}
+	}
+	return 0
+}
+
+// String names the mode, as used in the compose view and the pgpHeader of drafts
+func (p pgpMode) String() string {
+	switch p {
+	case pgpSign:
+		return "sign"
+	case pgpEncrypt:
+		return "encrypt"
+	case pgpSign | pgpEncrypt:
+		return "sign+encrypt"
+	}
+	return ""
+}
+
+// parsePGPMode reads a mode written by String back
+func parsePGPMode(s string) pgpMode {
+	var mode pgpMode
+	for _, part := range strings.Split(s, "+") {
+		switch strings.TrimSpace(part) {
+		case "sign":
+			mode |= pgpSign
+		case "encrypt":
+			mode |= pgpEncrypt
+		}
+	}
+	return mode
+}
+
+// checkKeys looks up the recipients' keys, so the compose view can warn
+// about the ones we can't encrypt to before the message is sent
+func (m *model) checkKeys() {
+
+	m.pgpMissing = nil
+	if m.pgp&pgpEncrypt == 0 {
+		return
+	}
+
+	rcpts, err := mail.ParseAddressList(trimAddressList(m.inputs[to].Value()))
+	if err != nil {
+		return
+	}
+
+	addrs := make([]string, len(rcpts))
+	for i, a := range rcpts {
+		addrs[i] = a.Address
+	}
+	m.pgpMissing = pgp.MissingKeys(addrs)
+}
+
+// pgpStatus renders whether the message will be signed and encrypted, shown below the form
+func (m model) pgpStatus() string {
+
+	var status string
+	switch m.pgp {
+	case 0:
+		return ""
+	case pgpSign:
+		status = "🔏 will be signed"
+	case pgpEncrypt:
+		status = "🔒 will be encrypted"
+	default:
+		status = "🔒 will be signed and encrypted"
+	}
+
+	if !pgp.Available() {
+		status += ", but gpg isn't installed"
+	} else if len(m.pgpMissing) > 0 {
+		status += ", but there is no key for " + strings.Join(m.pgpMissing, ", ") + m.keysStatus()
+	}
+
+	return status + " (" + keyHelp(m.keys.pgp) + " to change)"
+}
+
+// writePGP writes the body of the message as a PGP/MIME message, see RFC 3156.
+// The entity is the Content-Type header and body the message would have had.
+func (msg message) writePGP(b *bytes.Buffer, entity []byte) error {
+
+	signer := msg.signKey
+	if signer == "" {
+		signer = msg.from.Address
+	}
+
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	// encrypting also signs when asked to, all in one go
+	if msg.pgp&pgpEncrypt != 0 {
+		// we encrypt to ourselves too, so we can still read our copy in Sent
+		rcpts := append(msg.recipients(), msg.from.Address)
+
+		encrypted, err := pgp.Encrypt(rcpts, signer, msg.pgp&pgpSign != 0, entity)
+		if err != nil {
+			return fmt.Errorf("could not encrypt message: %w", err)
+		}
+
+		fmt.Fprintf(b, "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=%q\r\n", boundary)
+		b.WriteString("\r\n")
+		fmt.Fprintf(b, "--%s\r\n", boundary)
+		b.WriteString("Content-Type: application/pgp-encrypted\r\n")
+		b.WriteString("Content-Description: PGP/MIME version identification\r\n")
+		b.WriteString("\r\n")
+		b.WriteString("Version: 1\r\n")
+		fmt.Fprintf(b, "\r\n--%s\r\n", boundary)
+		b.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+		b.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+		b.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n")
+		b.WriteString("\r\n")
+		b.Write(crlf(encrypted))
+		fmt.Fprintf(b, "\r\n--%s--\r\n", boundary)
+		return nil
+	}
+
+	// the signature covers the entity exactly as it is sent, up to the line break before the boundary
+	signature, err := pgp.Sign(signer, entity)
+	if err != nil {
+		return fmt.Errorf("could not sign message: %w", err)
+	}
+
+	fmt.Fprintf(b, "Content-Type: multipart/signed; micalg=%s; protocol=\"application/pgp-signature\"; boundary=%q\r\n", pgp.MicAlg, boundary)
+	b.WriteString("\r\n")
+	fmt.Fprintf(b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-signature; name=\"signature.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP digital signature\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"signature.asc\"\r\n")
+	b.WriteString("\r\n")
+	b.Write(crlf(signature))
+	fmt.Fprintf(b, "\r\n--%s--\r\n", boundary)
+	return nil
+}
+
+// crlf turns the LF line endings gpg writes into CRLF
+func crlf(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
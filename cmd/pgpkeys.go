@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/pgp"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// discoverTimeout is how long looking up a recipient's key may take, across all the places it is looked for
+const discoverTimeout = 20 * time.Second
+
+// pgpKeysModel keeps track of the keys looked up for the recipients we can't
+// encrypt to, see the discover setting of the account's pgp
+type pgpKeysModel struct {
+	asked   map[string]bool // the addresses looked up already, found or not
+	looking int             // how many lookups are running in the background
+	found   []pgp.Found     // the keys found and not yet accepted or skipped
+}
+
+// discoveredMsg is sent once a recipient's key has been looked up
+type discoveredMsg struct {
+	addr  string
+	found pgp.Found
+	err   error
+}
+
+// acceptedMsg is sent once a key found has been imported and certified
+type acceptedMsg struct {
+	addr string
+	err  error
+}
+
+// discoverKeys looks up the keys of the recipients the keyring has none for,
+// in the background once the To field has been left. An address is only
+// looked up once, to not ask the servers again every time the field changes.
+func (m *model) discoverKeys() tea.Cmd {
+
+	if m.pgp&pgpEncrypt == 0 || m.focused == to || len(m.pgpMissing) == 0 {
+		return nil
+	}
+
+	var settings config.PGP
+	if m.account != nil {
+		settings = m.account.PGP
+	}
+	sources := settings.KeySources()
+	if len(sources) == 0 {
+		return nil
+	}
+
+	k := &m.pgpKeys
+	if k.asked == nil {
+		k.asked = make(map[string]bool)
+	}
+
+	var cmds []tea.Cmd
+	for _, addr := range m.pgpMissing {
+		if k.asked[strings.ToLower(addr)] {
+			continue
+		}
+		k.asked[strings.ToLower(addr)] = true
+		k.looking++
+
+		addr := addr
+		cmds = append(cmds, func() tea.Msg {
+			ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+			defer cancel()
+			found, err := pgp.Discover(ctx, addr, sources)
+			return discoveredMsg{addr: addr, found: found, err: err}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// discovered keeps the key looked up, for the user to review
+func (k *pgpKeysModel) discovered(msg discoveredMsg) {
+
+	k.looking--
+	switch {
+	case errors.Is(msg.err, pgp.ErrNotFound):
+		slog.Info("No PGP key found", "addr", msg.addr)
+	case msg.err != nil:
+		slog.Warn("Could not look up PGP key", "addr", msg.addr, "err", msg.err)
+	default:
+		k.found = append(k.found, msg.found)
+	}
+}
+
+// pendingKeys returns the keys found for the recipients still missing one, the
+// others were removed from the To field or got a key in another way
+func (m model) pendingKeys() []pgp.Found {
+
+	var pending []pgp.Found
+	for _, f := range m.pgpKeys.found {
+		for _, addr := range m.pgpMissing {
+			if strings.EqualFold(addr, f.Address) {
+				pending = append(pending, f)
+				break
+			}
+		}
+	}
+	return pending
+}
+
+// keysStatus says which recipients keys were found for, added to the pgpStatus
+func (m model) keysStatus() string {
+
+	if pending := m.pendingKeys(); len(pending) > 0 {
+		addrs := make([]string, len(pending))
+		for i, f := range pending {
+			addrs[i] = f.Address
+		}
+		return "; keys were found for " + strings.Join(addrs, ", ") + " (" + keyHelp(m.keys.pgpKeys) + " to review)"
+	}
+	if m.pgpKeys.looking > 0 {
+		return "; looking up their keys..."
+	}
+	return ""
+}
+
+// openPGPKeys shows the first key found, for the user to compare and accept
+func (m model) openPGPKeys() (tea.Model, tea.Cmd) {
+
+	pending := m.pendingKeys()
+	if len(pending) == 0 {
+		m.status = "No keys were found to review"
+		return m, nil
+	}
+
+	m.pgpKeys.found = pending
+	m.screen = pgpKeysScreen
+	return m, nil
+}
+
+// acceptKey imports and certifies the key in the background, gpg-agent may
+// need to ask for the passphrase of our own key to certify it
+func (m model) acceptKey(found pgp.Found) tea.Cmd {
+
+	// like signing, the account's key or else the sender's, and gpg's
+	// default key when there is neither
+	var signer string
+	if a, err := mail.ParseAddress(m.inputs[from].Value()); err == nil {
+		signer = a.Address
+	} else if m.account != nil {
+		signer = m.account.Address
+	}
+	if m.account != nil && m.account.PGP.Key != "" {
+		signer = m.account.PGP.Key
+	}
+
+	return func() tea.Msg {
+		return acceptedMsg{addr: found.Address, err: pgp.Accept(found, signer)}
+	}
+}
+
+// updatePGPKeys handles messages while a key found is showing
+func (m model) updatePGPKeys(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	key, ok := msg.(tea.KeyMsg)
+	if !ok || len(m.pgpKeys.found) == 0 {
+		return m, nil
+	}
+	found := m.pgpKeys.found[0]
+
+	switch key.String() {
+
+	// we'll handle y to trust the key, and show the next one if there is one
+	case "y":
+		m.pgpKeys.found = m.pgpKeys.found[1:]
+		m.status = "Importing the key for " + found.Address + "..."
+		if len(m.pgpKeys.found) == 0 {
+			m.screen = composeScreen
+		}
+		return m, m.acceptKey(found)
+
+	// we'll handle n to skip the key, it isn't asked about again
+	case "n":
+		m.pgpKeys.found = m.pgpKeys.found[1:]
+		if len(m.pgpKeys.found) == 0 {
+			m.screen = composeScreen
+		}
+
+	// we'll handle esc to go back, the keys can still be reviewed later
+	case "esc":
+		m.screen = composeScreen
+	}
+
+	return m, nil
+}
+
+// viewPGPKeys shows a key found, with its fingerprint to compare with what
+// the recipient says theirs is, before we trust it
+func (m model) viewPGPKeys() string {
+
+	found := m.pgpKeys.found[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", focusStyle.Render("Use this key for "+found.Address+"?"))
+	fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Found on:"), found.Source)
+	for _, k := range found.Keys {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Fingerprint:"), pgp.FormatFingerprint(k.Fingerprint))
+		for _, uid := range k.UserIDs {
+			fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("User ID:"), uid)
+		}
+		fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Created:"), k.Created.Format("2 Jan 2006"))
+		if !k.Expires.IsZero() {
+			fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Expires:"), k.Expires.Format("2 Jan 2006"))
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(continueStyle.Render("Anyone can publish a key under any address, check the fingerprint with the recipient.") + "\n")
+	b.WriteString(continueStyle.Render("(y to import and trust it, n to skip it, esc to go back)"))
+
+	return m.modal(b.String())
+}
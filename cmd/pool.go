@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[config.SMTP]*transport.Pool) // by settings, every account sending with the same ones shares them
+)
+
+// poolFor returns the pool of connections made with the SMTP settings, nil
+// when the settings say not to keep any. Settings that have changed, say
+// the password or the TLS policy after the config was reloaded, get a pool
+// of their own, the connections made with the old ones are left to expire.
+func poolFor(cfg config.SMTP) *transport.Pool {
+
+	if cfg.Pool() == 0 {
+		return nil
+	}
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	p, ok := pools[cfg]
+	if !ok {
+		p = transport.NewPool(cfg.Pool(), cfg.Idle())
+		pools[cfg] = p
+	}
+
+	return p
+}
+
+// closePools says goodbye on every connection still open, before the program exits
+func closePools() {
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	for _, p := range pools {
+		p.Close()
+	}
+}
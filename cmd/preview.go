@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// previewModel shows the message exactly as it would be sent, without sending it.
+// From there it can also be saved as an .eml file.
+type previewModel struct {
+	viewport viewport.Model
+	headers  viewport.Model // the headers, beside the body when the terminal is wide enough
+	text     string         // the message with its line endings made plain
+	width    int
+	height   int
+	raw      []byte          // the message as it is saved, without the transport's DKIM signature
+	saving   bool            // whether we're asking where to save it
+	path     textinput.Model // where to save it
+	status   string
+}
+
+// newPreview returns an empty preview
+func newPreview() previewModel {
+
+	path := textinput.New()
+	path.Placeholder = "message.eml"
+	path.CharLimit = 0
+	path.Width = 50
+	path.Prompt = "Save as: "
+
+	return previewModel{viewport: viewport.New(80, 20), headers: viewport.New(0, 0), width: 80, height: 24, path: path}
+}
+
+// wire returns the message as the transport would hand it to the server.
+// The SMTP transport adds its DKIM signature last, so we add it here too,
+// and the receipts noted for the transport are taken off.
+func wire(t transport.Transport, raw []byte) ([]byte, error) {
+
+	raw, _ = email.TakeDeliveryReport(raw)
+
+	if s, ok := t.(transport.SMTP); ok && s.DKIM != nil {
+		return s.DKIM.Sign(raw)
+	}
+
+	return raw, nil
+}
+
+// preview renders the message in the compose form, signed and encrypted just
+// like it would be, but without connecting to any server. It returns the
+// message and the message as it would go on the wire.
+func (m *model) preview() (raw, signed []byte, err error) {
+
+	msg, err := m.newMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	// a scheduled message is dated when it goes out
+	if !msg.sendAt.IsZero() {
+		msg.date = msg.sendAt
+	}
+
+	if raw, err = msg.bytes(); err != nil {
+		return nil, nil, err
+	}
+
+	// without a transport there is no DKIM signature to add, which is fine for a preview
+	t, err := newTransport(m.account)
+	if err != nil {
+		return raw, raw, nil
+	}
+
+	signed, err = wire(t, raw)
+	return raw, signed, err
+}
+
+// open shows the rendered message from the top, the file name it is saved as
+// is made from the subject
+func (p *previewModel) open(raw, signed []byte, subject string) {
+
+	p.raw, p.saving, p.status = raw, false, ""
+	p.path.SetValue(emlName(subject))
+	p.text = string(bytes.ReplaceAll(signed, []byte("\r\n"), []byte("\n")))
+	p.layout()
+	p.viewport.GotoTop()
+	p.headers.GotoTop()
+}
+
+// sideBySide reports whether the terminal is wide enough for the headers to go beside the body
+func (p previewModel) sideBySide() bool {
+	return p.width >= sideBySideWidth
+}
+
+// layout sizes the preview to the terminal, on a wide one the headers go
+// in a column on the left and the body on the right
+func (p *previewModel) layout() {
+
+	// we leave room for the title and the help line
+	height := max(p.height-4, 1)
+
+	if !p.sideBySide() {
+		p.viewport.Width, p.viewport.Height = p.width, height
+		p.viewport.SetContent(p.text)
+		return
+	}
+
+	head, body, _ := strings.Cut(p.text, "\n\n")
+	left := p.width * 2 / 5
+
+	// long headers are wrapped so they can still be read in the narrower column
+	p.headers.Width, p.headers.Height = left, height
+	p.headers.SetContent(lipgloss.NewStyle().Width(left - 2).Render(head))
+	p.viewport.Width, p.viewport.Height = p.width-left, height
+	p.viewport.SetContent(body)
+}
+
+// emlName turns a subject into a file name, e.g. "Hello, world!" into hello-world.eml
+func emlName(subject string) string {
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(subject) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		name = "message"
+	}
+
+	return name + ".eml"
+}
+
+// save writes the message to the file named in the path input
+func (p *previewModel) save() error {
+
+	path, err := config.ExpandHome(strings.TrimSpace(p.path.Value()))
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("no file name given")
+	}
+
+	// we don't want to overwrite an earlier export by accident
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(p.raw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// the file is saved relative to wherever go-mailer was started, so we say where that is
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	p.status = "Saved to " + path
+	return nil
+}
+
+func (p previewModel) Update(msg tea.Msg) (previewModel, tea.Cmd) {
+
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		p.width, p.height = msg.Width, msg.Height
+		p.layout()
+		return p, nil
+	}
+
+	// side by side the headers and the body scroll together
+	var cmd tea.Cmd
+	if p.sideBySide() {
+		p.headers, _ = p.headers.Update(msg)
+	}
+	p.viewport, cmd = p.viewport.Update(msg)
+	return p, cmd
+}
+
+// updatePreview handles messages while the preview is showing
+func (m model) updatePreview(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	p := &m.previewPanel
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+
+		// we'll handle enter to save the message once we know where
+		case p.saving && msg.Type == tea.KeyEnter:
+			if err := p.save(); err != nil {
+				p.status = "Could not save message: " + err.Error()
+				return m, nil
+			}
+			p.saving = false
+			p.path.Blur()
+			return m, nil
+
+		// we'll handle esc to stop saving, or to go back to the compose view
+		case msg.Type == tea.KeyEsc:
+			if p.saving {
+				p.saving, p.status = false, ""
+				p.path.Blur()
+				return m, nil
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle w to ask where to save the message
+		case !p.saving && msg.String() == "w":
+			p.saving, p.status = true, ""
+			p.path.CursorEnd()
+			return m, p.path.Focus()
+
+		case key.Matches(msg, m.keys.quit):
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	if p.saving {
+		p.path, cmd = p.path.Update(msg)
+		return m, cmd
+	}
+	m.previewPanel, cmd = m.previewPanel.Update(msg)
+	return m, cmd
+}
+
+// viewPreview renders the message as it would be sent
+func (m model) viewPreview() string {
+
+	p := m.previewPanel
+	title := lipgloss.NewStyle().Background(accentColor).Padding(0, 1).Render("Preview, nothing has been sent")
+
+	help := continueStyle.Render(fmt.Sprintf("%3.f%% (↑/↓ to scroll, w to save as .eml, esc to go back)", p.viewport.ScrollPercent()*100))
+	if p.saving {
+		help = p.path.View() + " " + continueStyle.Render("(enter to save, esc to cancel)")
+	}
+	if p.status != "" {
+		help += "\n" + continueStyle.Render(p.status)
+	}
+
+	message := p.viewport.View()
+	if p.sideBySide() {
+		message = lipgloss.JoinHorizontal(lipgloss.Top, p.headers.View(), message)
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n%s", title, message, help)
+}
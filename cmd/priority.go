@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// priority is how important a message says it is. Clients don't agree on
+// a header for it, so we write both X-Priority, which Outlook and most
+// others read, and Importance from RFC 2156.
+type priority int
+
+const (
+	normalPriority priority = iota
+	highPriority
+	lowPriority
+)
+
+// priorityCycle is the order alt+p steps through the priorities in
+var priorityCycle = []priority{normalPriority, highPriority, lowPriority}
+
+// next returns the priority after this one in priorityCycle
+func (p priority) next() priority {
+	for i, pr := range priorityCycle {
+		if pr == p {
+			return priorityCycle[(i+1)%len(priorityCycle)]
+		}
+	}
+	return normalPriority
+}
+
+// headers returns the priority headers, a message of normal priority has none
+func (p priority) headers() []email.Header {
+	switch p {
+	case highPriority:
+		return []email.Header{{Name: "X-Priority", Value: "1 (Highest)"}, {Name: "Importance", Value: "high"}}
+	case lowPriority:
+		return []email.Header{{Name: "X-Priority", Value: "5 (Lowest)"}, {Name: "Importance", Value: "low"}}
+	}
+	return nil
+}
+
+// readPriority reads the priority of a message back from its headers
+func readPriority(h mail.Header) priority {
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Importance"))) {
+	case "high":
+		return highPriority
+	case "low":
+		return lowPriority
+	}
+
+	// X-Priority goes from 1 for the highest to 5 for the lowest, 3 is normal
+	if x := strings.TrimSpace(h.Get("X-Priority")); x != "" {
+		switch x[0] {
+		case '1', '2':
+			return highPriority
+		case '4', '5':
+			return lowPriority
+		}
+	}
+
+	return normalPriority
+}
+
+// priorityStatus describes the priority of the message, for the compose view
+func (m model) priorityStatus() string {
+	switch m.priority {
+	case highPriority:
+		return "❗ high priority (" + keyHelp(m.keys.priority) + " to change)"
+	case lowPriority:
+		return "↓ low priority (" + keyHelp(m.keys.priority) + " to change)"
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// quit quits the program, but when there is something in the compose form
+// it asks whether to keep it as a draft first, so it isn't lost by accident
+func (m model) quit() (tea.Model, tea.Cmd) {
+
+	if m.currentDraft().empty() {
+		return m.saveAndQuit()
+	}
+
+	m.quitFrom = m.screen
+	m.screen = quitScreen
+	return m, nil
+}
+
+// saveAndQuit saves whatever is in the compose form as a draft and quits the program
+func (m model) saveAndQuit() (tea.Model, tea.Cmd) {
+	slog.Info("Quitting")
+
+	if err := m.saveDraft(); err != nil {
+		slog.Error("Could not save draft", "err", err)
+	}
+
+	return m.quitWhenFlushed()
+}
+
+// discardAndQuit throws away the message in the compose form and quits the program
+func (m model) discardAndQuit() (tea.Model, tea.Cmd) {
+	slog.Info("Quitting")
+
+	if err := m.discardDraft(); err != nil {
+		slog.Error("Could not remove draft", "err", err)
+	}
+
+	return m.quitWhenFlushed()
+}
+
+// quitWhenFlushed quits the program, once the flush running in the
+// background has finished. Quitting in the middle of it would leave the
+// message being sent claimed, and it would be sent again once the claim
+// has gone stale.
+func (m model) quitWhenFlushed() (tea.Model, tea.Cmd) {
+
+	if m.flushing {
+		m.quitting = true
+		if m.screen == quitScreen {
+			m.screen = m.quitFrom
+		}
+		m.status = "Quitting once the messages being sent are out"
+		return m, nil
+	}
+
+	m.sendPendingNow()
+	return m, tea.Quit
+}
+
+// updateQuit handles messages while we ask what to do with the message before quitting
+func (m model) updateQuit(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+
+		// we'll handle s to keep the message as a draft, and the quit key
+		// again for when we're in a hurry, that's what quitting used to do
+		case msg.String() == "s" || key.Matches(msg, m.keys.quit):
+			return m.saveAndQuit()
+
+		// we'll handle d to throw the message away
+		case msg.String() == "d":
+			return m.discardAndQuit()
+
+		// we'll handle c and esc to stay and go back to where we were
+		case msg.String() == "c" || msg.Type == tea.KeyEsc:
+			m.screen = m.quitFrom
+		}
+	}
+
+	return m, nil
+}
+
+// viewQuit asks what to do with the message before quitting
+func (m model) viewQuit() string {
+
+	subject := m.inputs[subject].Value()
+	if subject == "" {
+		subject = tr("(no subject)")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", focusStyle.Render(tr("Quit with a message still being written?")))
+	fmt.Fprintf(&b, "%s %s\n\n", inputStyle.Render(tr("Subject:")), subject)
+	fmt.Fprintf(&b, "%s\n", continueStyle.Render(trf("s or %s to save it as a draft", keyHelp(m.keys.quit))))
+	fmt.Fprintf(&b, "%s\n", continueStyle.Render(tr("d to discard it")))
+	b.WriteString(continueStyle.Render(tr("c or esc to go back to it")))
+
+	return m.modal(b.String())
+}
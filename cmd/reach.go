@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/eai"
+	"github.com/aidk/go-mailer/internal/mxcheck"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reachTimeout is how long the recipients' domains get to answer, one that
+// takes longer is checked again the next time the To field is left
+const reachTimeout = 10 * time.Second
+
+// reachModel keeps track of whether the recipients can receive mail, as far
+// as DNS and their mail servers tell us, see the check_recipients setting
+type reachModel struct {
+	value    string            // the To field as it was when it was last checked
+	checking bool              // whether lookups are running in the background
+	warnings map[string]string // why a recipient may not get the message, by address
+
+	// results keeps what the lookups found, by domain and, when the
+	// addresses are probed, by address, empty for those that are fine
+	results map[string]string
+}
+
+// reachMsg is sent once the lookups for the To field are done
+type reachMsg struct {
+	value   string
+	results map[string]string // what was looked up, as in reachModel.results
+}
+
+// checkReach looks up the recipients' domains in the background once the To
+// field has been left. Domains and addresses looked up before aren't looked
+// up again.
+func (m *model) checkReach() tea.Cmd {
+
+	mode := m.cfg.RecipientChecks()
+	if mode == config.CheckOff || m.focused == to {
+		return nil
+	}
+
+	r := &m.reach
+	value := trimAddressList(m.inputs[to].Value())
+	if value == r.value {
+		return nil
+	}
+	r.value, r.checking = value, false
+
+	addrs, err := parseAddressList(value)
+	if err != nil {
+		// the field says what's wrong with it already
+		r.warnings = nil
+		return nil
+	}
+
+	if r.results == nil {
+		r.results = make(map[string]string)
+	}
+	var todo []string
+	for _, a := range addrs {
+		addr := strings.ToLower(a.Address)
+		if _, ok := r.results[domainOf(addr)]; !ok {
+			todo = append(todo, addr)
+		} else if _, ok := r.results[addr]; mode == config.CheckProbe && !ok {
+			todo = append(todo, addr)
+		}
+	}
+	r.update()
+	if len(todo) == 0 {
+		return nil
+	}
+	r.checking = true
+
+	// a probe says who it's from, the address in the From field if it has one
+	var sender string
+	if a, err := mail.ParseAddress(m.inputs[from].Value()); err == nil {
+		sender = a.Address
+	}
+
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), reachTimeout)
+		defer cancel()
+		return reachMsg{value: value, results: lookupReach(ctx, todo, mode == config.CheckProbe, sender)}
+	}
+}
+
+// lookupReach checks the addresses, all at once since most of the time goes
+// into waiting for answers. What couldn't be found out in time is left out.
+func lookupReach(ctx context.Context, addrs []string, probe bool, sender string) map[string]string {
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]string)
+	)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			// the lookups need an international domain in its ASCII form
+			domain := domainOf(addr)
+			ascii, err := eai.ToASCII(domain)
+			if err != nil {
+				return
+			}
+			hosts, err := mxcheck.Domain(ctx, ascii)
+			addrResult := ""
+			if err == nil && probe {
+				if err := mxcheck.Probe(ctx, hosts, sender, addr); err != nil {
+					addrResult = err.Error()
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[domain] = ""
+			if err != nil {
+				results[domain] = err.Error()
+			}
+			if probe {
+				results[addr] = addrResult
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// done keeps the results of the lookups, and updates the warnings if the To
+// field hasn't changed since they started
+func (r *reachModel) done(msg reachMsg) {
+
+	for k, v := range msg.results {
+		r.results[k] = v
+	}
+	if msg.value == r.value {
+		r.checking = false
+		r.update()
+	}
+}
+
+// update works out the warnings for the To field from the results so far
+func (r *reachModel) update() {
+
+	r.warnings = nil
+	addrs, err := parseAddressList(r.value)
+	if err != nil {
+		return
+	}
+
+	for _, a := range addrs {
+		addr := strings.ToLower(a.Address)
+		warning := r.results[domainOf(addr)]
+		if warning == "" {
+			warning = r.results[addr]
+		}
+		if warning == "" {
+			continue
+		}
+		if r.warnings == nil {
+			r.warnings = make(map[string]string)
+		}
+		r.warnings[a.Address] = warning
+	}
+}
+
+// domainOf returns the domain of an address
+func domainOf(addr string) string {
+	return addr[strings.LastIndex(addr, "@")+1:]
+}
+
+// reachWarnings returns a line for each recipient that may not get the message
+func (r reachModel) reachWarnings() []string {
+
+	var lines []string
+	for addr, warning := range r.warnings {
+		lines = append(lines, "⚠ "+addr+" may not get the message: "+warning)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// reachStatus renders the recipients that may not get the message, shown below the form
+func (m model) reachStatus() string {
+
+	if m.reach.checking {
+		return continueStyle.Render("checking the recipients' domains...")
+	}
+
+	lines := m.reach.reachWarnings()
+	for i, line := range lines {
+		lines[i] = errorStyle.Render(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/htmltext"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/internal/termimage"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// readMsg is sent once a message in the inbox has been fetched to be read
+type readMsg struct {
+	raw []byte
+	err error
+}
+
+// readerModel shows a message the way it reads, with its headers decoded,
+// rather than as it is sent
+type readerModel struct {
+	viewport viewport.Model
+	raw      []byte
+	back     screen // the screen the message was opened from, esc goes back to it
+
+	// folder and key say where the message is kept, they're empty for a
+	// message fetched from the server
+	folder string
+	key    string
+
+	header mail.Header
+	text   string
+	html   string // the HTML version of the message, if it has one
+	files  []email.Attachment
+
+	selected int             // the attachment tab picked, -1 when none is
+	saving   bool            // whether we're asking where to save the attachments
+	path     textinput.Model // where to save them
+	status   string
+	width    int
+	height   int
+
+	protocol termimage.Protocol // how the terminal shows images, if it can
+}
+
+// newReader returns an empty reader, that shows images with the protocol
+func newReader(protocol termimage.Protocol) readerModel {
+
+	path := textinput.New()
+	path.CharLimit = 0
+	path.Width = 50
+	path.Prompt = "Save attachments in: "
+
+	return readerModel{viewport: viewport.New(80, 20), path: path, width: 80, height: 24, protocol: protocol}
+}
+
+// openReader shows the message, back is the screen to go back to and folder
+// and key where it is kept, if it is
+func (m *model) openReader(raw []byte, back screen, folder, key string) error {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	c, err := parseBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return err
+	}
+
+	r := &m.reader
+	r.raw, r.back, r.folder, r.key = raw, back, folder, key
+	r.header, r.files, r.html = msg.Header, c.files, c.html
+	r.text = strings.TrimRight(strings.ReplaceAll(c.text, "\r\n", "\n"), "\n")
+	r.saving, r.status, r.selected = false, "", -1
+	r.render()
+	r.viewport.GotoTop()
+
+	m.screen = readerScreen
+	return nil
+}
+
+// render lays the message out for the width of the terminal
+func (r *readerModel) render() {
+
+	var b strings.Builder
+	for _, name := range []string{"From", "To", "Cc", "Reply-To"} {
+		if r.header.Get(name) != "" {
+			fmt.Fprintf(&b, "%s %s\n", inputStyle.Render(name+":"), decodedHeader(r.header, name))
+		}
+	}
+	if date, err := r.header.Date(); err == nil {
+		fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Date:"), date.Local().Format("Mon 02 Jan 2006 15:04"))
+	}
+	fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("Subject:"), decodeText(r.header.Get("Subject")))
+	for i, f := range r.files {
+		size := email.FormatSize(len(f.Data))
+		if image := imageSize(f); image != "" {
+			size += ", " + image
+		}
+		line := fmt.Sprintf("%d. %s (%s)", i+1, f.Filename, size)
+		if i == r.selected {
+			line = focusStyle.Render("› " + line)
+		}
+		fmt.Fprintf(&b, "%s %s\n", inputStyle.Render("📎"), line)
+	}
+	b.WriteString("\n")
+
+	// a message that only comes as HTML is turned into text, rather than showing its markup
+	text := r.text
+	if text == "" && r.html != "" {
+		text = htmltext.Render(r.html, htmlStyles())
+	}
+
+	// long lines are wrapped, the way a mail client would show them
+	b.WriteString(lipgloss.NewStyle().Width(max(r.width-2, 20)).Render(text))
+
+	r.viewport.SetContent(b.String())
+}
+
+// htmlStyles are how headings, bold and italic text and links look in an
+// HTML message, they follow the theme
+func htmlStyles() htmltext.Styles {
+	style := func(s lipgloss.Style) func(string) string {
+		return func(text string) string { return s.Render(text) }
+	}
+	return htmltext.Styles{
+		Heading: style(focusStyle),
+		Bold:    style(lipgloss.NewStyle().Bold(true)),
+		Italic:  style(lipgloss.NewStyle().Italic(true)),
+		Link:    style(inputStyle),
+	}
+}
+
+// openHTML shows the HTML version of the message in the browser, from a
+// file of its own since it may be too long to pass as an address
+func (r *readerModel) openHTML() error {
+
+	f, err := os.CreateTemp("", "go-mailer-*.html")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(r.html); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// the browser reads the file once it has started, so it is left for the system to clean up
+	if err := openWithSystem(f.Name()); err != nil {
+		return err
+	}
+
+	r.status = "Opened the message in the browser"
+	return nil
+}
+
+// openWithSystem opens the file with the program the system opens files of its kind with
+func openWithSystem(path string) error {
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// resize fits the message in the terminal
+func (r *readerModel) resize(width, height int) {
+	r.width, r.height = width, height
+	r.viewport.Width, r.viewport.Height = width, height-4
+	r.path.Width = max(width-len(r.path.Prompt)-2, 10)
+	if r.header != nil {
+		r.render()
+	}
+}
+
+// picked returns the attachment tab picked, or all of them if none is
+func (r *readerModel) picked() []email.Attachment {
+	if r.selected >= 0 && r.selected < len(r.files) {
+		return r.files[r.selected : r.selected+1]
+	}
+	return r.files
+}
+
+// pick moves the pick by one attachment, past the last one nothing is picked
+func (r *readerModel) pick(by int) {
+	n := len(r.files) + 1
+	r.selected = (r.selected+1+by+n)%n - 1
+	r.status = ""
+	r.render()
+}
+
+// saveAttachments writes the picked attachments into the folder named in the
+// path input. Files that are already there are kept, the attachment gets a number.
+func (r *readerModel) saveAttachments() error {
+
+	dir, err := config.ExpandHome(strings.TrimSpace(r.path.Value()))
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	files := r.picked()
+	for _, f := range files {
+		if err := writeNew(dir, safeName(f.Filename), f.Data); err != nil {
+			return err
+		}
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if len(files) == 1 {
+		r.status = fmt.Sprintf("Saved %s in %s", files[0].Filename, dir)
+	} else {
+		r.status = fmt.Sprintf("Saved %d attachments in %s", len(files), dir)
+	}
+	return nil
+}
+
+// openAttachment opens the picked attachment, or the only one, with the
+// program the system has for its kind of file
+func (r *readerModel) openAttachment() error {
+
+	if len(r.picked()) != 1 {
+		return fmt.Errorf("pick one with tab first")
+	}
+	f := r.picked()[0]
+
+	// the program finds out what the file is from its name, so it keeps it, in a folder of its own
+	dir, err := os.MkdirTemp("", "go-mailer-")
+	if err != nil {
+		return err
+	}
+	name := safeName(f.Filename)
+	if err := os.WriteFile(filepath.Join(dir, name), f.Data, 0o600); err != nil {
+		return err
+	}
+	if err := openWithSystem(filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	r.status = "Opened " + f.Filename
+	return nil
+}
+
+// safeName makes the name the sender gave an attachment safe to save it as.
+// It mustn't lead out of the folder, hide the file or carry control
+// characters, and it has to fit in the file systems' limit.
+func safeName(name string) string {
+
+	// only the last part of a path is kept, whichever system's separators it has
+	name = name[strings.LastIndexAny(name, "/\\")+1:]
+	name = strings.Map(func(c rune) rune {
+		switch {
+		case c == ':':
+			return '_'
+		case c < ' ' || c == 0x7f:
+			return -1
+		}
+		return c
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+
+	// names that are too long are cut short, keeping the extension
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:200-len(ext)], "") + ext
+	}
+
+	if name == "" {
+		name = "attachment"
+	}
+	return name
+}
+
+// writeNew writes the data to a new file called name in dir, adding a
+// number to the name until it is one that isn't taken
+func writeNew(dir, name string, data []byte) error {
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// defaultDownloads is where attachments are saved unless another folder is typed in
+func defaultDownloads() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if info, err := os.Stat(filepath.Join(home, "Downloads")); err == nil && info.IsDir() {
+			return "~/Downloads"
+		}
+	}
+	return "."
+}
+
+// updateReader handles messages while a message is being read
+func (m model) updateReader(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	r := &m.reader
+
+	if msg, ok := msg.(tea.KeyMsg); ok && r.saving {
+		switch msg.Type {
+
+		// we'll handle enter to save the attachments once we know where
+		case tea.KeyEnter:
+			if err := r.saveAttachments(); err != nil {
+				r.status = "Could not save attachments: " + err.Error()
+				return m, nil
+			}
+			r.saving = false
+			r.path.Blur()
+			return m, nil
+
+		// we'll handle esc to stop saving
+		case tea.KeyEsc:
+			r.saving, r.status = false, ""
+			r.path.Blur()
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		r.path, cmd = r.path.Update(msg)
+		return m, cmd
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+
+		// we'll handle esc to go back to where the message was opened from
+		case "esc":
+			m.screen = r.back
+			return m, nil
+
+		// we'll handle s to ask where to save the attachments
+		case "s":
+			if len(r.files) == 0 {
+				r.status = "The message has no attachments"
+				return m, nil
+			}
+			r.saving, r.status = true, ""
+			if files := r.picked(); len(files) == 1 {
+				r.path.Prompt = "Save " + files[0].Filename + " in: "
+			} else {
+				r.path.Prompt = fmt.Sprintf("Save %d attachments in: ", len(files))
+			}
+			r.path.SetValue(defaultDownloads())
+			r.path.CursorEnd()
+			return m, r.path.Focus()
+
+		// we'll handle tab and shift+tab to pick an attachment
+		case "tab", "shift+tab":
+			if len(r.files) == 0 {
+				return m, nil
+			}
+			if msg.String() == "tab" {
+				r.pick(1)
+			} else {
+				r.pick(-1)
+			}
+			return m, nil
+
+		// we'll handle o to open the attachment with the system's program for it
+		case "o":
+			if len(r.files) == 0 {
+				r.status = "The message has no attachments"
+				return m, nil
+			}
+			if err := r.openAttachment(); err != nil {
+				r.status = "Could not open the attachment: " + err.Error()
+			}
+			return m, nil
+
+		// we'll handle i to look at the images, when the terminal can show them
+		case "i":
+			if !r.images() {
+				return m, nil
+			}
+			return m, r.showImages()
+
+		// we'll handle b to open the HTML version of the message in the browser
+		case "b":
+			if r.html == "" {
+				r.status = "The message has no HTML version"
+				return m, nil
+			}
+			if err := r.openHTML(); err != nil {
+				r.status = "Could not open the browser: " + err.Error()
+			}
+			return m, nil
+
+		// we'll handle e to carry on with a draft, or change a sent message and send it again
+		case "e":
+			if r.folder == "" {
+				return m, nil
+			}
+			var err error
+			if r.folder == store.Drafts {
+				err = m.resumeFound(r.key, r.raw)
+			} else {
+				err = m.reopenSent(r.raw)
+			}
+			if err != nil {
+				m.status = "Could not open message: " + err.Error()
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle a, A and f to reply to, or forward, the message
+		case "a", "A", "f":
+			if err := m.startReply(r.raw, replyKeys[msg.String()]); err != nil {
+				m.status = "Could not open message: " + err.Error()
+			}
+			m.screen = composeScreen
+			return m, nil
+		}
+
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	r.viewport, cmd = r.viewport.Update(msg)
+	return m, cmd
+}
+
+// resumeFound carries on with a stored draft, the form it replaces is kept
+// as a draft of its own
+func (m *model) resumeFound(key string, raw []byte) error {
+
+	// the form may already be the draft, with changes that aren't saved yet
+	if key == m.draftKey {
+		return nil
+	}
+
+	d, err := parseDraft(key, raw)
+	if err != nil {
+		return err
+	}
+	if err := m.saveDraft(); err != nil {
+		return err
+	}
+
+	m.resetForm()
+	m.resumeDraft(d)
+	return nil
+}
+
+// viewReader renders the message being read
+func (m model) viewReader() string {
+
+	r := m.reader
+
+	title := "Message"
+	if r.folder != "" {
+		title = r.folder
+	}
+	title = lipgloss.NewStyle().Background(accentColor).Padding(0, 1).Render(title)
+
+	keys := "↑/↓ to scroll"
+	if r.folder != "" {
+		keys += ", e to edit"
+	}
+	keys += ", a/A to reply, f to forward"
+	switch {
+	case len(r.files) == 1:
+		keys += ", s/o to save/open the attachment"
+	case len(r.files) > 1:
+		keys += ", tab to pick an attachment, s/o to save/open"
+	}
+	if r.images() {
+		keys += ", i to view images"
+	}
+	if r.html != "" {
+		keys += ", b for the browser"
+	}
+	help := continueStyle.Render(fmt.Sprintf("%3.f%% (%s, esc to go back)", r.viewport.ScrollPercent()*100, keys))
+	if r.saving {
+		help = r.path.View() + " " + continueStyle.Render("(enter to save, esc to cancel)")
+	}
+	if r.status != "" {
+		help += "\n" + continueStyle.Render(r.status)
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n%s", title, r.viewport.View(), help)
+}
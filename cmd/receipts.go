@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// receiptsHeader keeps the receipts asked for by a draft or a message
+// waiting to go out, see email.DeliveryReportHeader
+const receiptsHeader = email.DeliveryReportHeader
+
+// receiptMode says which receipts a message asks for
+type receiptMode int
+
+const (
+	// receiptRead asks the recipient's mail client to say when the message
+	// was read, with a Disposition-Notification-To header (RFC 8098)
+	receiptRead receiptMode = 1 << iota
+
+	// receiptDelivery asks the servers on the way to say whether the
+	// message was delivered or not (DSN, RFC 3461)
+	receiptDelivery
+)
+
+// receiptCycle is the order alt+r steps through the modes in
+var receiptCycle = []receiptMode{0, receiptRead, receiptRead | receiptDelivery, receiptDelivery}
+
+// defaultReceipts returns the receipts new messages of the account ask for
+func defaultReceipts(account *config.Account) receiptMode {
+
+	var mode receiptMode
+	if account != nil && account.Receipts.Read {
+		mode |= receiptRead
+	}
+	if account != nil && account.Receipts.Delivery {
+		mode |= receiptDelivery
+	}
+
+	return mode
+}
+
+// next returns the mode after this one in receiptCycle
+func (r receiptMode) next() receiptMode {
+	for i, mode := range receiptCycle {
+		if mode == r {
+			return receiptCycle[(i+1)%len(receiptCycle)]
+		}
+	}
+	return 0
+}
+
+// String names the mode, as used in the receiptsHeader
+func (r receiptMode) String() string {
+	switch r {
+	case receiptRead:
+		return "read"
+	case receiptDelivery:
+		return "delivery"
+	case receiptRead | receiptDelivery:
+		return "read+delivery"
+	}
+	return ""
+}
+
+// parseReceiptMode reads a mode written by String back
+func parseReceiptMode(s string) receiptMode {
+	var mode receiptMode
+	for _, part := range strings.Split(s, "+") {
+		switch strings.TrimSpace(part) {
+		case "read":
+			mode |= receiptRead
+		case "delivery":
+			mode |= receiptDelivery
+		}
+	}
+	return mode
+}
+
+// receiptStatus describes the receipts the message asks for, for the compose view
+func (m model) receiptStatus() string {
+
+	var status string
+	switch m.receipts {
+	case 0:
+		return ""
+	case receiptRead:
+		status = "🔔 asks for a read receipt"
+	case receiptDelivery:
+		status = "🔔 asks for a delivery report"
+	default:
+		status = "🔔 asks for a read receipt and a delivery report"
+	}
+
+	if m.receipts&receiptDelivery != 0 && m.account != nil && (m.account.BackendName() == config.BackendJMAP || m.account.Gmail.Enabled() || m.account.Graph.Enabled()) {
+		status += ", but delivery reports are only asked for over smtp"
+	}
+
+	return status + " (" + keyHelp(m.keys.receipts) + " to change)"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// configPollInterval is how often the config file is looked at for changes
+const configPollInterval = 2 * time.Second
+
+// configMsg carries the config once the file has changed, or why it couldn't be read
+type configMsg struct {
+	cfg *config.Config
+	err error
+}
+
+// watchConfig reads the config again whenever the file at path changes,
+// until ctx is done. There is no portable way to be told, so the file's
+// size and time are checked every configPollInterval.
+func watchConfig(ctx context.Context, path string, changed func(configMsg)) {
+
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// an editor may be saving it as a new file, we look again in a moment
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+
+		cfg, err := config.Load(path)
+		changed(configMsg{cfg: cfg, err: err})
+	}
+}
+
+// reloadConfig applies a config that was changed while go-mailer runs: the
+// theme, the keys, the log level, the dictionary and the account's
+// settings, its transport among them, as the next message is sent with
+// them. What is only set up at startup, like the account being used or the
+// language, needs a restart.
+func (m model) reloadConfig(msg configMsg) (model, tea.Cmd) {
+
+	if msg.err != nil {
+		m.status = fmt.Sprintf("The config wasn't reloaded: %v", msg.err)
+		return m, nil
+	}
+	cfg := msg.cfg
+
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		m.status = fmt.Sprintf("The config wasn't reloaded: %v", err)
+		return m, nil
+	}
+
+	// the flags given at startup still stand, and accessible mode is set up only once
+	cfg.Accessible = m.cfg.Accessible
+
+	m.status = "Reloaded the config"
+	if m.account != nil {
+		if account, err := cfg.Account(m.account.Name); err == nil {
+			m.account = account
+		} else {
+			m.status = fmt.Sprintf("Reloaded the config, %s keeps its old settings until go-mailer is restarted", m.account.Name)
+		}
+	}
+
+	var cmd tea.Cmd
+	if cfg.Dictionary != m.cfg.Dictionary {
+		m.spell = spellModel{}
+		cmd = loadDictionary(cfg)
+	}
+
+	m.cfg, m.keys = cfg, keys
+	setLogLevel(cfg)
+
+	// the config has already been checked, so the theme is one we know
+	if !cfg.Accessible {
+		theme, _ := cfg.Theme.Colors()
+		applyTheme(theme)
+		m.restyle()
+	}
+
+	return m, cmd
+}
+
+// restyle gives the fields the styles of the theme, which are copied into
+// them when they are made
+func (m *model) restyle() {
+
+	m.editor.FocusedStyle.Base = bodyStyle(true)
+	m.editor.BlurredStyle.Base = bodyStyle(false)
+	m.editor.Cursor.Style = lipgloss.NewStyle().Foreground(focusColor)
+	for i := range m.inputs {
+		m.inputs[i].Cursor.Style = lipgloss.NewStyle().Foreground(focusColor)
+	}
+}
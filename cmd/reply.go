@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/htmltext"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// replyMode is what we're doing with the original message
+type replyMode int
+
+const (
+	replySender replyMode = iota
+	replyAll
+	forwardMessage
+)
+
+// threadHeaders tie a reply to the message it answers, so the recipients'
+// clients can show them as one conversation. The ids keep their angle brackets.
+type threadHeaders struct {
+	inReplyTo  string
+	references []string
+}
+
+// replyThread returns the headers of a reply to the message with the given headers,
+// which refers to the original and everything the original referred to
+func replyThread(h mail.Header) threadHeaders {
+
+	id := strings.TrimSpace(h.Get("Message-Id"))
+	if id == "" {
+		return threadHeaders{}
+	}
+
+	var refs []string
+	for _, ref := range mailbox.ParseReferences(h.Get("References")) {
+		refs = append(refs, "<"+ref+">")
+	}
+	if len(refs) == 0 {
+		if parent := mailbox.NormalizeID(h.Get("In-Reply-To")); parent != "" {
+			refs = append(refs, "<"+parent+">")
+		}
+	}
+
+	return threadHeaders{inReplyTo: id, references: append(refs, id)}
+}
+
+// readThreadHeaders reads the threading headers of a saved message back
+func readThreadHeaders(h mail.Header) threadHeaders {
+
+	t := threadHeaders{inReplyTo: strings.TrimSpace(h.Get("In-Reply-To"))}
+	for _, ref := range mailbox.ParseReferences(h.Get("References")) {
+		t.references = append(t.references, "<"+ref+">")
+	}
+
+	return t
+}
+
+// headers returns the headers tying a reply to its thread, none for a message that isn't a reply
+func (t threadHeaders) headers() []email.Header {
+
+	var headers []email.Header
+	if t.inReplyTo != "" {
+		headers = append(headers, email.Header{Name: "In-Reply-To", Value: t.inReplyTo})
+	}
+
+	// a long conversation has a long list of references, they are folded onto as many lines as they need
+	if len(t.references) > 0 {
+		headers = append(headers, email.Header{Name: "References", Value: strings.Join(t.references, " ")})
+	}
+
+	return headers
+}
+
+// originalMsg is sent once the message being replied to or forwarded has been fetched
+type originalMsg struct {
+	raw  []byte
+	mode replyMode
+	err  error
+}
+
+// replyKeys maps the keys of the inbox and the sent history to what they do
+var replyKeys = map[string]replyMode{
+	"a": replySender,
+	"A": replyAll,
+	"f": forwardMessage,
+}
+
+// startReply fills the compose form with a reply to, or a forward of, the
+// raw message. Whatever was in the form is kept as a draft.
+func (m *model) startReply(raw []byte, mode replyMode) error {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+
+	c, err := parseBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return err
+	}
+	text, files := strings.TrimRight(strings.ReplaceAll(c.text, "\r\n", "\n"), "\n"), c.files
+
+	// a message that only comes as HTML is quoted as the text it reads as
+	if text == "" && c.html != "" {
+		text = htmltext.Render(c.html, htmltext.Styles{})
+	}
+
+	subj := decodeText(msg.Header.Get("Subject"))
+	sender := decodedHeader(msg.Header, "From")
+
+	if err := m.saveDraft(); err != nil {
+		return err
+	}
+	m.resetForm()
+
+	// a reply to an encrypted message shouldn't go out in the clear
+	if c.pgp&pgpEncrypt != 0 {
+		m.pgp |= pgpEncrypt
+	}
+
+	if m.account != nil {
+		m.inputs[from].SetValue(replyIdentity(m.account, msg.Header).From())
+	}
+
+	if mode == forwardMessage {
+		var b strings.Builder
+		b.WriteString("\n\n---------- Forwarded message ----------\n")
+		fmt.Fprintf(&b, "From: %s\n", sender)
+		fmt.Fprintf(&b, "Date: %s\n", msg.Header.Get("Date"))
+		fmt.Fprintf(&b, "Subject: %s\n", subj)
+		fmt.Fprintf(&b, "To: %s\n", decodedHeader(msg.Header, "To"))
+		b.WriteString("\n")
+		b.WriteString(text)
+
+		m.inputs[subject].SetValue(prefixSubject("Fwd: ", subj))
+		m.editor.SetValue(b.String())
+		// forwarding is the only time attachments come along
+		m.attachments = files
+		m.focusField(to)
+		return nil
+	}
+
+	rcpts := replyRecipients(msg.Header, mode == replyAll, m.ownAddresses())
+	addrs := make([]string, len(rcpts))
+	for i, a := range rcpts {
+		addrs[i] = a.String()
+	}
+
+	// we quote the original below an attribution line, leaving room to write underneath
+	attribution := sender + " wrote:"
+	if date, err := msg.Header.Date(); err == nil {
+		attribution = fmt.Sprintf("On %s, %s", date.Format("Mon, 02 Jan 2006 15:04"), attribution)
+	}
+
+	m.inputs[to].SetValue(strings.Join(addrs, ", "))
+	m.inputs[subject].SetValue(prefixSubject("Re: ", subj))
+	m.editor.SetValue(attribution + "\n" + quote(text) + "\n\n")
+	m.thread = replyThread(msg.Header)
+	m.checkKeys()
+	m.focusField(body)
+	return nil
+}
+
+// ownAddresses returns the addresses that are ours, which a reply shouldn't go to
+func (m model) ownAddresses() map[string]bool {
+
+	own := make(map[string]bool)
+
+	if m.account != nil {
+		for _, id := range m.account.Senders() {
+			if a, err := mail.ParseAddress(id.Address); err == nil {
+				own[strings.ToLower(a.Address)] = true
+			}
+		}
+	}
+	if a, err := mail.ParseAddress(m.inputs[from].Value()); err == nil {
+		own[strings.ToLower(a.Address)] = true
+	}
+
+	return own
+}
+
+// replyRecipients works out who a reply goes to. That's the Reply-To or From
+// address, unless we sent the message ourselves, in which case it goes to
+// the people we sent it to again. Replying to all adds every To and Cc.
+func replyRecipients(h mail.Header, all bool, own map[string]bool) []*mail.Address {
+
+	sender, err := h.AddressList("Reply-To")
+	if err != nil || len(sender) == 0 {
+		sender, _ = h.AddressList("From")
+	}
+	recipients, _ := h.AddressList("To")
+	cc, _ := h.AddressList("Cc")
+
+	ours := len(sender) > 0
+	for _, a := range sender {
+		if !own[strings.ToLower(a.Address)] {
+			ours = false
+		}
+	}
+
+	candidates := sender
+	if ours {
+		candidates = recipients
+	}
+	if all {
+		candidates = append(append(append([]*mail.Address{}, candidates...), recipients...), cc...)
+	}
+
+	// we drop duplicates and ourselves, unless that leaves nobody at all
+	var rcpts []*mail.Address
+	seen := make(map[string]bool)
+	for _, a := range candidates {
+		addr := strings.ToLower(a.Address)
+		if seen[addr] || own[addr] {
+			continue
+		}
+		seen[addr] = true
+		rcpts = append(rcpts, a)
+	}
+	if len(rcpts) == 0 {
+		return sender
+	}
+
+	return rcpts
+}
+
+// decodedHeader returns an address header in a readable form, which still parses as an address list
+func decodedHeader(h mail.Header, name string) string {
+
+	addrs, err := h.AddressList(name)
+	if err != nil {
+		return decodeText(h.Get(name))
+	}
+
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		parts[i] = a.Address
+		if a.Name == "" {
+			continue
+		}
+		// names like "Doe, John" need their quotes, or the comma would split them in two
+		display := a.Name
+		if strings.ContainsAny(display, "()<>[]:;@\\,.\"") {
+			display = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(display) + `"`
+		}
+		parts[i] = fmt.Sprintf("%s <%s>", display, a.Address)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// prefixSubject adds Re: or Fwd: to a subject, unless it already starts with it
+func prefixSubject(prefix, subject string) string {
+
+	lower := strings.ToLower(subject)
+	if strings.HasPrefix(lower, strings.ToLower(prefix)) {
+		return subject
+	}
+	// some clients shorten Fwd: to Fw:
+	if prefix == "Fwd: " && strings.HasPrefix(lower, "fw: ") {
+		return subject
+	}
+
+	return prefix + subject
+}
+
+// quote prefixes every line of the text with >, lines that are already quoted just get another >
+func quote(text string) string {
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ">") || line == "" {
+			lines[i] = ">" + line
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
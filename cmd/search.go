@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/search"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/internal/vault"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// indexFile is where the search index is kept, in the account's store
+const indexFile = ".search-index"
+
+// searchFolders are the folders that are searched, mail that only we have
+var searchFolders = []string{store.Sent, store.Drafts}
+
+// indexedMsg is sent once the index has caught up with the folders
+type indexedMsg struct {
+	index *search.Index
+	err   error
+}
+
+// resultItem lets us show a message that was found in a bubbles list
+type resultItem struct {
+	search.Doc
+
+	// messages found by notmuch are read from their file, and can be tagged
+	path string
+	id   string // the Message-ID
+	tags []string
+}
+
+func (r resultItem) Title() string {
+	subject := r.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	return subject
+}
+
+func (r resultItem) Description() string {
+
+	date := r.Date.Format("Mon 02 Jan 2006 15:04")
+	var desc string
+	switch r.Folder {
+	case store.Sent:
+		desc = fmt.Sprintf("sent %s to %s", date, r.To)
+	case store.Drafts:
+		desc = fmt.Sprintf("draft %s to %s", date, r.To)
+	default:
+		desc = fmt.Sprintf("%s from %s", date, r.From)
+	}
+
+	if len(r.tags) > 0 {
+		desc += " · " + strings.Join(r.tags, " ")
+	}
+	return desc
+}
+
+func (r resultItem) FilterValue() string {
+	return r.Subject
+}
+
+// searchModel finds messages in the sent mail and the drafts
+type searchModel struct {
+	input    textinput.Model
+	list     list.Model
+	index    *search.Index
+	indexing bool  // whether the index is catching up in the background
+	err      error // what is wrong with the query, or with the index
+
+	notmuch bool            // whether notmuch searches instead of our own index
+	tagging bool            // whether we're asking how to tag the highlighted message
+	tags    textinput.Model // the tags to add and take off
+	shown   string          // the query whose results are in the list
+	status  string
+}
+
+// newSearch returns an empty search, one that asks notmuch if notmuch is set
+func newSearch(notmuch bool) searchModel {
+
+	input := textinput.New()
+	input.Placeholder = "invoice from:ann after:2024-03-01"
+	input.Prompt = "Search: "
+	input.CharLimit = 0
+	input.Width = 50
+
+	tags := textinput.New()
+	tags.Placeholder = "+todo -inbox"
+	tags.Prompt = "Tags: "
+	tags.CharLimit = 0
+	tags.Width = 50
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Title = "Sent mail and drafts (enter to read, esc to go back)"
+	if notmuch {
+		input.Placeholder = "tag:inbox and from:ann date:1w.."
+		l.Title = "notmuch (enter to read, tab to tag, esc to go back)"
+	}
+	l.Styles = themedListStyles()
+	l.SetShowFilter(false)
+	l.SetFilteringEnabled(false)
+	l.DisableQuitKeybindings()
+
+	return searchModel{input: input, list: l, notmuch: notmuch, tags: tags}
+}
+
+// indexMail brings the account's search index up to date in the background,
+// only the messages saved since it was last brought up to date are read
+func indexMail(account *config.Account) tea.Cmd {
+
+	return func() tea.Msg {
+		s, err := mailStore(account)
+		if err != nil {
+			return indexedMsg{err: err}
+		}
+		ix, err := search.Open(filepath.Join(s.Dir(), indexFile))
+		if err != nil {
+			return indexedMsg{err: err}
+		}
+
+		changed := false
+		for _, folder := range searchFolders {
+			keys, err := s.Folder(folder).Keys()
+			if err != nil {
+				return indexedMsg{err: err}
+			}
+			before := ix.Len()
+			ix.Keep(folder, keys)
+			changed = changed || ix.Len() != before
+
+			for _, k := range keys {
+				if ix.Has(folder, k) {
+					continue
+				}
+				raw, err := s.Folder(folder).Get(k)
+				if err != nil {
+					continue
+				}
+				// sent messages read the same way drafts do
+				d, err := parseDraft(k, raw)
+				if err != nil {
+					slog.Error("Could not index message", "folder", folder, "key", k, "err", err)
+					continue
+				}
+				ix.Add(search.Doc{Folder: folder, Key: k, From: d.from, To: d.to, Subject: d.subject, Date: d.date}, d.body)
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := ix.Save(); err != nil {
+				slog.Error("Could not save the search index", "err", err)
+			}
+		}
+		return indexedMsg{index: ix}
+	}
+}
+
+// mailStore opens the account's store. Like the drafts, the search works
+// without an account, on the store of an unnamed one.
+func mailStore(account *config.Account) (*store.Store, error) {
+
+	if account == nil {
+		account = &config.Account{}
+	}
+
+	dir, err := account.StoreDir()
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(dir)
+}
+
+// openSearch shows the search, and brings the index up to date
+func (m model) openSearch() (tea.Model, tea.Cmd) {
+	m.screen = searchScreen
+	m.search.indexing = true
+	if m.search.notmuch {
+		return m, tea.Batch(m.search.input.Focus(), indexNotmuch(m.account))
+	}
+	return m, tea.Batch(m.search.input.Focus(), indexMail(m.account))
+}
+
+// run searches for what is in the search field. notmuch is asked in the
+// background, our own index right away.
+func (s *searchModel) run(account *config.Account) tea.Cmd {
+
+	s.err = nil
+	if s.notmuch {
+		return searchNotmuch(account, s.input.Value())
+	}
+	if s.index == nil {
+		return nil
+	}
+
+	q, err := search.Parse(s.input.Value())
+	if err != nil {
+		s.err = err
+		return nil
+	}
+
+	docs := s.index.Search(q)
+	items := make([]list.Item, len(docs))
+	for i, d := range docs {
+		items[i] = resultItem{Doc: d}
+	}
+	s.list.SetItems(items)
+	s.list.Select(0)
+	return nil
+}
+
+// openFound reads the message that was found
+func (m *model) openFound(item resultItem) error {
+
+	if item.path != "" {
+		raw, err := os.ReadFile(item.path)
+		if err != nil {
+			return err
+		}
+		if raw, err = vault.Open(raw); err != nil {
+			return err
+		}
+		// only our own sent mail and drafts can be opened in the form again
+		if item.Folder != store.Sent && item.Folder != store.Drafts {
+			return m.openReader(raw, searchScreen, "", "")
+		}
+		return m.openReader(raw, searchScreen, item.Folder, item.Key)
+	}
+
+	s, err := mailStore(m.account)
+	if err != nil {
+		return err
+	}
+	raw, err := s.Folder(item.Folder).Get(item.Key)
+	if err != nil {
+		return err
+	}
+
+	return m.openReader(raw, searchScreen, item.Folder, item.Key)
+}
+
+// resize fits the list below the search field
+func (s *searchModel) resize(width, height int) {
+	s.input.Width = max(width-len(s.input.Prompt)-2, 10)
+	s.tags.Width = max(width-len(s.tags.Prompt)-2, 10)
+	s.list.SetSize(width, height-4)
+}
+
+// updateSearch handles messages while the search is showing
+func (m model) updateSearch(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	s := &m.search
+
+	if msg, ok := msg.(tea.KeyMsg); ok && s.tagging {
+		switch msg.Type {
+
+		// we'll handle enter to tag the highlighted message
+		case tea.KeyEnter:
+			s.tagging = false
+			s.tags.Blur()
+			item, ok := s.list.SelectedItem().(resultItem)
+			if !ok {
+				return m, s.input.Focus()
+			}
+			return m, tea.Batch(s.input.Focus(), tagNotmuch(item.id, strings.Fields(s.tags.Value())))
+
+		// we'll handle esc to stop tagging
+		case tea.KeyEsc:
+			s.tagging = false
+			s.tags.Blur()
+			return m, s.input.Focus()
+		}
+
+		var cmd tea.Cmd
+		s.tags, cmd = s.tags.Update(msg)
+		return m, cmd
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+
+		// we'll handle esc to go back to the compose view
+		case msg.Type == tea.KeyEsc:
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle enter to read the highlighted message
+		case msg.Type == tea.KeyEnter:
+			item, ok := s.list.SelectedItem().(resultItem)
+			if !ok {
+				return m, nil
+			}
+			if err := m.openFound(item); err != nil {
+				s.err = err
+			}
+			return m, nil
+
+		// we'll handle tab to ask how to tag the highlighted message, notmuch keeps the tags
+		case msg.Type == tea.KeyTab && s.notmuch:
+			item, ok := s.list.SelectedItem().(resultItem)
+			if !ok {
+				return m, nil
+			}
+			if item.id == "" {
+				s.status = "The message has no Message-ID to tag it by"
+				return m, nil
+			}
+			s.tagging, s.status = true, ""
+			s.tags.SetValue("")
+			s.input.Blur()
+			return m, s.tags.Focus()
+
+		// we'll handle the keys that move through the results, everything else is typed into the search
+		case msg.Type == tea.KeyUp || msg.Type == tea.KeyDown || msg.Type == tea.KeyPgUp || msg.Type == tea.KeyPgDown:
+			var cmd tea.Cmd
+			s.list, cmd = s.list.Update(msg)
+			return m, cmd
+
+		case key.Matches(msg, m.keys.quit):
+			return m.quit()
+		}
+	}
+
+	before := s.input.Value()
+	var cmd tea.Cmd
+	s.input, cmd = s.input.Update(msg)
+	if s.input.Value() != before {
+		s.status = ""
+		cmd = tea.Batch(cmd, s.run(m.account))
+	}
+	return m, cmd
+}
+
+// viewSearch renders the search field and what it found
+func (m model) viewSearch() string {
+
+	s := m.search
+
+	status := ""
+	switch {
+	case s.indexing:
+		status = continueStyle.Render("indexing...")
+	case s.err != nil:
+		status = errorStyle.Render("✗ " + s.err.Error())
+	case s.status != "":
+		status = continueStyle.Render(s.status)
+	case strings.TrimSpace(s.input.Value()) == "" && s.notmuch:
+		status = continueStyle.Render("any notmuch query, like tag:inbox, from:ann, subject:invoice or date:1w.., and tab tags the highlighted message")
+	case strings.TrimSpace(s.input.Value()) == "":
+		status = continueStyle.Render("from:, to:, subject: and body: search one field, after: and before: take a day, in:sent or in:drafts a folder, * ends a prefix")
+	case len(s.list.Items()) == 0:
+		status = continueStyle.Render("nothing found")
+	}
+
+	input := s.input.View()
+	if s.tagging {
+		input = s.tags.View() + " " + continueStyle.Render("(+tag adds and -tag takes off, enter to tag, esc to cancel)")
+	}
+
+	return fmt.Sprintf("%s\n%s\n\n%s", input, status, s.list.View())
+}
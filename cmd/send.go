@@ -0,0 +1,286 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/eai"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// listFlag is a flag that can be given more than once, e.g. -attach a.pdf -attach b.pdf
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sendCommand sends a message without starting the TUI, for scripts and cron jobs.
+// The body is read from -body-file, or from stdin when it isn't a terminal.
+//
+//	go-mailer send [-account name] -to addr [-from addr] [-reply-to addr] [-subject text] [-body-file file] [-attach file] [-json] [-dry-run] [-no-signature] [-read-receipt] [-delivery-report]
+func sendCommand(cfg *config.Config, args []string) error {
+
+	var rcpts, files listFlag
+
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	accountName := fs.String("account", "", "account to send from, defaults to the first one")
+	fs.Var(&rcpts, "to", "address to send to, can be given more than once or as a comma separated list")
+	sender := fs.String("from", "", "address to send from, defaults to the account's")
+	replyTo := fs.String("reply-to", "", "address replies should go to, defaults to the account's reply_to")
+	subj := fs.String("subject", "", "subject of the message")
+	bodyFile := fs.String("body-file", "", "file holding the body, - for stdin")
+	fs.Var(&files, "attach", "file to attach, can be given more than once")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	dryRun := fs.Bool("dry-run", false, "print the message exactly as it would be sent, without sending it")
+	noSignature := fs.Bool("no-signature", false, "leave the account's signature off the message")
+	readReceipt := fs.Bool("read-receipt", false, "ask for a read receipt, even when the account doesn't")
+	deliveryReport := fs.Bool("delivery-report", false, "ask for a delivery report, even when the account doesn't")
+	fs.Parse(args)
+
+	if len(rcpts) == 0 || fs.NArg() != 0 {
+		return fmt.Errorf("usage: go-mailer send [-account name] -to addr [-from addr] [-subject text] [-body-file file] [-attach file] [-json] [-dry-run]")
+	}
+
+	req := sendRequest{
+		Account:        *accountName,
+		From:           *sender,
+		ReplyTo:        *replyTo,
+		To:             rcpts,
+		Subject:        *subj,
+		NoSignature:    *noSignature,
+		ReadReceipt:    *readReceipt,
+		DeliveryReport: *deliveryReport,
+	}
+
+	var (
+		res     sendResult
+		account *config.Account
+		t       transport.Transport
+		msg     message
+	)
+	err := req.readFiles(*bodyFile, files)
+	if err == nil {
+		account, t, msg, err = buildSend(cfg, req)
+	}
+	if err == nil && *dryRun {
+		return printMessage(t, msg)
+	}
+	if err != nil {
+		res = invalidResult(err)
+	} else {
+		res = deliver(account, t, msg)
+	}
+
+	if *asJSON {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	}
+	if !res.OK {
+		return fmt.Errorf("could not send message: %s", res.Error.Message)
+	}
+
+	if !*asJSON {
+		fmt.Printf("Sent %s to %s\n", msg.id, strings.Join(msg.recipients(), ", "))
+	}
+	return nil
+}
+
+// printMessage writes the message to stdout as it would go on the wire, without connecting to any server
+func printMessage(t transport.Transport, msg message) error {
+
+	raw, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+	if raw, err = wire(t, raw); err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(raw)
+	return err
+}
+
+// sendRequest is a message to send without the TUI, from the flags of the
+// send command or a request to the API of the serve command
+type sendRequest struct {
+	Account        string   `json:"account"` // the first one if empty
+	From           string   `json:"from"`    // the account's address if empty
+	ReplyTo        string   `json:"reply_to"`
+	To             []string `json:"to"`
+	Subject        string   `json:"subject"`
+	Body           string   `json:"body"`
+	NoSignature    bool     `json:"no_signature"`
+	ReadReceipt    bool     `json:"read_receipt"`
+	DeliveryReport bool     `json:"delivery_report"`
+
+	files []email.Attachment
+}
+
+// readFiles reads the body and the attachments of the request from files
+func (req *sendRequest) readFiles(bodyFile string, files []string) error {
+
+	var err error
+	if req.Body, err = readBody(bodyFile); err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		a, err := readAttachment(path)
+		if err != nil {
+			return err
+		}
+		req.files = append(req.files, a)
+	}
+
+	return nil
+}
+
+// buildSend works out the account, the transport and the message of a request
+func buildSend(cfg *config.Config, req sendRequest) (*config.Account, transport.Transport, message, error) {
+
+	account, err := cfg.Account(req.Account)
+	if err != nil {
+		return nil, nil, message{}, err
+	}
+	if err := validateSubject(req.Subject); err != nil {
+		return nil, nil, message{}, err
+	}
+	// the API takes any string, none of them may break out of its header line
+	for _, addr := range append([]string{req.From, req.ReplyTo}, req.To...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return nil, nil, message{}, fmt.Errorf("the address %q can't contain line breaks", addr)
+		}
+	}
+	sender := req.From
+	if sender == "" {
+		sender = account.Address
+	}
+
+	msg := message{
+		subject: req.Subject,
+		body:    req.Body,
+		files:   req.files,
+		pgp:     defaultPGP(account),
+		signKey: account.PGP.Key,
+		smime:   account.SMIME,
+		wrap:    cfg.WrapColumn(),
+
+		encoding: cfg.TextEncoding(),
+		receipts: defaultReceipts(account),
+	}
+
+	senders, err := parseAddressList(sender)
+	if err != nil || len(senders) != 1 {
+		return nil, nil, message{}, fmt.Errorf("invalid from address %q", sender)
+	}
+	msg.from = senders[0]
+	msg.headers = withReplyTo(nil, account, msg.from.Address)
+	if req.ReplyTo != "" {
+		// it takes the place of the account's reply_to, the only header added so far
+		if _, err = mail.ParseAddressList(req.ReplyTo); err != nil {
+			return nil, nil, message{}, fmt.Errorf("invalid reply-to address %q", req.ReplyTo)
+		}
+		msg.headers = []header{{name: "Reply-To", value: req.ReplyTo}}
+	}
+	for _, r := range req.To {
+		addrs, err := parseAddressList(r)
+		if err != nil {
+			return nil, nil, message{}, fmt.Errorf("invalid to address %q: %w", r, err)
+		}
+		msg.to = append(msg.to, addrs...)
+	}
+	if len(msg.to) == 0 {
+		return nil, nil, message{}, fmt.Errorf("the message has no one to go to")
+	}
+	msg.id = email.NewID(msg.from.Address)
+
+	if !req.NoSignature {
+		if msg.signature, msg.signatureHTML, err = accountSignature(account, msg.from.Address); err != nil {
+			return nil, nil, message{}, err
+		}
+	}
+	if req.ReadReceipt {
+		msg.receipts |= receiptRead
+	}
+	if req.DeliveryReport {
+		msg.receipts |= receiptDelivery
+	}
+
+	t, err := newTransport(account)
+	if err != nil {
+		return nil, nil, message{}, err
+	}
+
+	return account, t, msg, nil
+}
+
+// parseAddressList parses a comma separated list of addresses, checking that
+// their domains are ones DNS can look up
+func parseAddressList(s string) ([]*mail.Address, error) {
+
+	addrs, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if _, err := eai.Address(a.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	return addrs, nil
+}
+
+// readBody reads the body from the file, or from stdin if the file is - or
+// none was given. A terminal on stdin means there is nothing piped in, so
+// the body is left empty rather than waiting for someone to type it.
+func readBody(path string) (string, error) {
+
+	if path != "" && path != "-" {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+
+	if path == "" {
+		info, err := os.Stdin.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+			return "", nil
+		}
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("could not read the body from stdin: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// readAttachment reads a file to attach, guessing its type from its extension
+func readAttachment(path string) (email.Attachment, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return email.Attachment{}, fmt.Errorf("could not attach %s: %w", path, err)
+	}
+
+	// the type can come with parameters like a charset, which don't fit in with the filename
+	contentType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+
+	return email.Attachment{Filename: filepath.Base(path), ContentType: contentType, Data: data}, nil
+}
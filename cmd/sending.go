@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/store"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// sendingModel sends a message in the background, so the screen doesn't
+// freeze while we wait for the server, and then shows how it went
+type sendingModel struct {
+	spinner spinner.Model
+	done    bool
+
+	account *config.Account
+	t       transport.Transport
+	from    string
+	to      []string
+	subject string
+	id      string // the Message-ID, so a sent message can be found again
+	raw     []byte
+
+	result string // what the server said when it took the message
+	err    error
+	queued bool // whether the message failed and was put in the outbox to be retried
+}
+
+// sentMsg tells us how sending went
+type sentMsg struct {
+	result string
+	err    error
+}
+
+// start sends the message in the background, with the spinner turning until it's done
+func (s *sendingModel) start() tea.Cmd {
+
+	s.done, s.result, s.err, s.queued = false, "", nil, false
+	s.spinner = spinner.New()
+	s.spinner.Spinner = spinner.Dot
+	s.spinner.Style = lipgloss.NewStyle().Foreground(accentColor)
+
+	// the goroutine gets its own copy, the model may have moved on by the time it's done
+	account, t, from, to, subject, raw := s.account, s.t, s.from, s.to, s.subject, s.raw
+	send := func() tea.Msg {
+		result, raw, err := send(account, t, from, to, subject, raw)
+		if err != nil {
+			return sentMsg{err: err}
+		}
+
+		// the message has gone out, so failing to keep a copy shouldn't look like a failed send
+		rec := store.SentRecord{From: from, To: to, Subject: subject}
+		if err := saveSent(account, t, rec, raw, result); err != nil {
+			slog.Error("Could not save sent message", "err", err)
+		}
+		return sentMsg{result: result}
+	}
+
+	// a spinner redraws the screen every tick, a screen reader would keep
+	// reading it out, so in accessible mode the line just says it's sending
+	if accessible {
+		return send
+	}
+	return tea.Batch(s.spinner.Tick, send)
+}
+
+// sent shows how sending went, once it has gone out there's no need for the draft anymore
+func (m model) sent(msg sentMsg) (tea.Model, tea.Cmd) {
+
+	s := &m.sending
+	s.done, s.result, s.err = true, msg.result, msg.err
+	if msg.err != nil {
+		slog.Error("Could not send message", "err", msg.err)
+		// we may just be offline, the outbox keeps trying without being asked to
+		if m.outbox != nil && queueable(msg.err) {
+			m.queueFailed()
+		}
+		return m, nil
+	}
+
+	if err := m.discardDraft(); err != nil {
+		slog.Error("Could not remove draft", "err", err)
+	}
+	return m, nil
+}
+
+// queueable reports whether a message that couldn't be sent should be
+// retried from the outbox. A server that can't be reached or says to try
+// later may take it then, a refusal or a problem of our own won't get
+// better by trying again.
+func queueable(err error) bool {
+	kind, permanent := transport.Classify(err)
+	return kind != transport.KindOther && !permanent
+}
+
+// queueFailed puts the message that couldn't be sent in the outbox, where
+// it is retried in the background
+func (m *model) queueFailed() {
+
+	s := &m.sending
+
+	e, err := m.outbox.Enqueue(s.from, s.to, s.subject, s.raw)
+	if err != nil {
+		s.err = fmt.Errorf("%v, and it could not be queued: %w", s.err, err)
+		return
+	}
+	m.outbox.Failed(e.ID, s.err)
+	m.queue.refresh(m.outbox)
+	if err := m.discardDraft(); err != nil {
+		slog.Error("Could not remove draft", "err", err)
+	}
+	s.queued = true
+}
+
+// updateSending handles messages while a message is being sent
+func (m model) updateSending(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	s := &m.sending
+
+	switch msg := msg.(type) {
+	case spinner.TickMsg:
+		if s.done {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		s.spinner, cmd = s.spinner.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		switch {
+
+		// we'll handle enter once the message has gone, or is queued, to start a new one
+		case s.done && (s.err == nil || s.queued) && (msg.Type == tea.KeyEnter || msg.Type == tea.KeyEsc):
+			m.resetForm()
+			m.screen = composeScreen
+
+		// we'll handle r to try sending it again
+		case s.done && s.err != nil && !s.queued && msg.String() == "r":
+			return m, s.start()
+
+		// we'll handle esc to go back to the message and change it
+		case s.done && s.err != nil && !s.queued && msg.Type == tea.KeyEsc:
+			m.screen = composeScreen
+
+		// we'll handle ctrl+c to quit, once the message has gone or is queued there's no draft to keep
+		case key.Matches(msg, m.keys.quit):
+			if s.done && (s.err == nil || s.queued) {
+				m.resetForm()
+			}
+			return m.quit()
+		}
+	}
+
+	return m, nil
+}
+
+// kindHelp says what kind of error sending failed with, see
+// transport.Classify, and whether waiting will help. It is empty for the
+// errors we can't tell anything about.
+func kindHelp(kind string, permanent bool) string {
+
+	var what string
+	switch kind {
+	case transport.KindRejected:
+		what = "the server refused the message for good"
+	case transport.KindTemporary:
+		what = "the server asked us to try again later"
+	case transport.KindDNS:
+		what = "the server's name couldn't be looked up"
+		if permanent {
+			what = "the server's name doesn't exist"
+		}
+	case transport.KindTimeout:
+		what = "the server didn't answer in time"
+	case transport.KindConnect:
+		what = "the server couldn't be reached"
+	case transport.KindTLS:
+		what = "the server's certificate can't be trusted"
+	default:
+		return ""
+	}
+
+	if permanent {
+		return what + ", waiting won't help"
+	}
+	return what + ", waiting will likely help"
+}
+
+// viewSending renders the spinner while the message is sent, and then how it went
+func (m model) viewSending() string {
+
+	s := m.sending
+	to := strings.Join(s.to, ", ")
+
+	var b strings.Builder
+	switch {
+	case !s.done:
+		spin := s.spinner.View() + " "
+		if accessible {
+			spin = ""
+		}
+		fmt.Fprintf(&b, "\n\t%sSending %q to %s via %s...\n", spin, s.subject, to, s.t.Name())
+
+	case s.err == nil:
+		fmt.Fprintf(&b, "\n\t%s\n\n", inputStyle.Render(fmt.Sprintf("✓ Sent %q to %s", s.subject, to)))
+		fmt.Fprintf(&b, "\tMessage-ID: %s\n", s.id)
+		if s.result != "" {
+			fmt.Fprintf(&b, "\tThe server said: %s\n", s.result)
+		}
+		fmt.Fprintf(&b, "\n\t%s\n", continueStyle.Render(fmt.Sprintf("(enter to write another, %s %s)", keyHelp(m.keys.quit), m.keys.quit.Help().Desc)))
+
+	default:
+		fmt.Fprintf(&b, "\n\t%s\n\n", errorStyle.Render(fmt.Sprintf("✗ Could not send %q to %s", s.subject, to)))
+		fmt.Fprintf(&b, "\t%s\n", strings.ReplaceAll(s.err.Error(), "\n", "\n\t"))
+		if help := kindHelp(transport.Classify(s.err)); help != "" {
+			fmt.Fprintf(&b, "\n\t%s.\n", strings.ToUpper(help[:1])+help[1:])
+		}
+		if s.queued {
+			fmt.Fprintf(&b, "\n\tThe message is queued and will be retried in the background.\n")
+			fmt.Fprintf(&b, "\n\t%s\n", continueStyle.Render(fmt.Sprintf("(enter to write another, %s %s)", keyHelp(m.keys.quit), m.keys.quit.Help().Desc)))
+			break
+		}
+		help := fmt.Sprintf("r to retry, esc to change the message, %s %s", keyHelp(m.keys.quit), m.keys.quit.Help().Desc)
+		fmt.Fprintf(&b, "\n\t%s\n", continueStyle.Render("("+help+")"))
+	}
+
+	return b.String()
+}
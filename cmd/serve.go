@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// messageRequest is the JSON body of POST /v1/messages
+type messageRequest struct {
+	sendRequest
+	Attachments []apiAttachment `json:"attachments"`
+	SendAt      time.Time       `json:"send_at"` // when the message should go out, now if it is zero
+}
+
+// apiAttachment is an attachment in a messageRequest, its data is base64 encoded
+type apiAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// serveCommand runs go-mailer as the mail gateway of the machine. Other
+// programs hand it messages over HTTP, and it sends them with the accounts
+// in the config, queueing the ones that can't go out yet in their outboxes.
+//
+//	go-mailer serve [-listen 127.0.0.1:8025] -token-file file | -insecure
+func serveCommand(cfg *config.Config, args []string) error {
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8025", "address to listen on")
+	tokenFile := fs.String("token-file", "", "file holding the token requests have to bring, as Authorization: Bearer <token>")
+	insecure := fs.Bool("insecure", false, "take requests without a token, from anyone who can reach the address")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: go-mailer serve [-listen 127.0.0.1:8025] -token-file file | -insecure")
+	}
+	// anyone on the machine can reach 127.0.0.1, without a token they could
+	// all send mail as the accounts
+	if *tokenFile == "" && !*insecure {
+		return fmt.Errorf("serve needs a -token-file, or -insecure to take requests from anyone")
+	}
+
+	var token string
+	if *tokenFile != "" {
+		path, err := config.ExpandHome(*tokenFile)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read the token: %w", err)
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			return fmt.Errorf("%s is empty", *tokenFile)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		postMessage(cfg, w, r)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, cfg)
+	})
+	srv := &http.Server{Addr: *listen, Handler: withToken(token, mux), ReadHeaderTimeout: 10 * time.Second}
+
+	// messages waiting in the outboxes are sent once they are due, as the TUI does
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go flushOutboxes(ctx, cfg)
+
+	// ctrl+c or a service manager stopping us lets the requests being handled finish
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		shutdown, done := context.WithTimeout(context.Background(), 30*time.Second)
+		defer done()
+		srv.Shutdown(shutdown)
+	}()
+
+	slog.Info("Listening", "url", "http://"+*listen+"/v1/messages")
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// withToken only lets requests bringing the token through to h, all of them
+// when there is none, which serve only allows with -insecure
+func withToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid token is needed", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether the request brings the token
+func authorized(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// postMessage sends the message in the request, or schedules it when it
+// has a send time. It answers with the sendResult, with 200 when the
+// message went out and 202 when it waits in the outbox.
+func postMessage(cfg *config.Config, w http.ResponseWriter, r *http.Request) {
+
+	// the attachments are base64 encoded, which makes them a third bigger
+	r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxSize())*2)
+
+	var req messageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, invalidResult(fmt.Errorf("invalid request: %w", err)))
+		return
+	}
+	for _, a := range req.Attachments {
+		if a.Filename == "" {
+			respond(w, http.StatusBadRequest, invalidResult(fmt.Errorf("an attachment needs a filename")))
+			return
+		}
+		req.files = append(req.files, email.Attachment{Filename: a.Filename, ContentType: a.ContentType, Data: a.Data})
+	}
+
+	account, t, msg, err := buildSend(cfg, req.sendRequest)
+	if err != nil {
+		respond(w, http.StatusBadRequest, invalidResult(err))
+		return
+	}
+
+	if !req.SendAt.IsZero() && req.SendAt.After(time.Now()) {
+		msg.sendAt, msg.date = req.SendAt, req.SendAt
+		res, err := queue(account, msg, nil)
+		if err != nil {
+			respond(w, http.StatusInternalServerError, invalidResult(err))
+			return
+		}
+		slog.Info("Scheduled message", "id", msg.id, "to", strings.Join(msg.recipients(), ", "), "send_at", msg.sendAt)
+		respond(w, http.StatusAccepted, res)
+		return
+	}
+
+	res := deliver(account, t, msg)
+	if res.OK {
+		slog.Info("Sent message", "id", msg.id, "to", strings.Join(msg.recipients(), ", "))
+		notify(account, messageEvent(eventSent, msg, res))
+		respond(w, http.StatusOK, res)
+		return
+	}
+
+	// a server that can't be reached or says to try later gets the message
+	// again from the outbox
+	if queueable(res.err) {
+		queued, err := queue(account, msg, res.err)
+		if err == nil {
+			slog.Warn("Queued message to try again", "id", msg.id, "err", res.Error.Message)
+			queued.Error = res.Error
+			notify(account, messageEvent(eventDeferred, msg, queued))
+			respond(w, http.StatusAccepted, queued)
+			return
+		}
+		slog.Error("Could not queue message", "id", msg.id, "err", err)
+	}
+
+	slog.Error("Could not send message", "id", msg.id, "err", res.Error.Message)
+	notify(account, messageEvent(eventFailed, msg, res))
+	status := http.StatusBadGateway
+	if res.Error.Code == errFailed {
+		status = http.StatusInternalServerError
+	}
+	respond(w, status, res)
+}
+
+// queue puts the message in the account's outbox, to go out at its send
+// time, or to be retried when sending failed with sendErr
+func queue(account *config.Account, msg message, sendErr error) (sendResult, error) {
+
+	o, err := openOutbox(account)
+	if err != nil {
+		return sendResult{}, err
+	}
+	raw, err := msg.bytes()
+	if err != nil {
+		return sendResult{}, err
+	}
+
+	res := sendResult{MessageID: msg.id, Subject: msg.subject, Started: time.Now()}
+	if sendErr != nil {
+		e, err := o.Enqueue(msg.from.Address, msg.recipients(), msg.subject, raw)
+		if err != nil {
+			return sendResult{}, err
+		}
+		o.Failed(e.ID, sendErr)
+		res.Queued = e.ID
+	} else {
+		e, err := o.Schedule(msg.from.Address, msg.recipients(), msg.subject, raw, msg.sendAt)
+		if err != nil {
+			return sendResult{}, err
+		}
+		res.Queued, res.OK = e.ID, true
+	}
+	res.Finished = time.Now()
+
+	for _, addr := range msg.recipients() {
+		res.Recipients = append(res.Recipients, recipientStatus{Address: addr, Status: statusQueued})
+	}
+
+	return res, nil
+}
+
+// respond writes the result of a request as JSON
+func respond(w http.ResponseWriter, status int, res sendResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSON(w, res)
+}
+
+// flushOutboxes sends what is due in the outbox of every account, every
+// outboxInterval until ctx is done
+func flushOutboxes(ctx context.Context, cfg *config.Config) {
+
+	tick := time.NewTicker(outboxInterval)
+	defer tick.Stop()
+
+	for {
+		for i := range cfg.Accounts {
+			account := &cfg.Accounts[i]
+			o, err := openOutbox(account)
+			if err != nil {
+				slog.Error("Could not open the outbox", "account", account.Name, "err", err)
+				continue
+			}
+			if sent, failed, err := sendQueued(account, o); err != nil {
+				slog.Error("Could not send the outbox", "account", account.Name, "err", err)
+			} else if sent+failed > 0 {
+				slog.Info("Sent the outbox", "account", account.Name, "sent", sent, "failed", failed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
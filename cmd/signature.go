@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// signatureHeader keeps a draft from getting the account's signature, it is never sent
+const signatureHeader = "X-Go-Mailer-Signature"
+
+// signatureOff is the value of the signatureHeader of a draft sent without a signature
+const signatureOff = "off"
+
+// appendSignature adds the signature below the body, after the "-- " line
+// that tells mail clients where the signature starts
+func appendSignature(body, signature string) string {
+	return strings.TrimRight(body, "\n") + "\n\n" + email.SignatureSeparator + "\n" + signature
+}
+
+// stripSignature takes the signature back off a body it was added to, e.g.
+// when a sent message is opened again, so it isn't added twice
+func stripSignature(body, signature string) (string, bool) {
+
+	if signature == "" {
+		return body, false
+	}
+
+	block := email.SignatureSeparator + "\n" + signature
+	if body == block {
+		return "", true
+	}
+	if rest, ok := strings.CutSuffix(body, "\n"+block); ok {
+		return strings.TrimRight(rest, "\n"), true
+	}
+
+	return body, false
+}
+
+// htmlBody returns the HTML version of a plain text body, with its images
+// and the HTML signature below it if there is one
+func htmlBody(body, signature string) string {
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<body>\n<div>")
+	for i, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		if i > 0 {
+			b.WriteString("<br>\n")
+		}
+		b.WriteString(htmlLine(line))
+	}
+	b.WriteString("</div>\n")
+	if signature != "" {
+		b.WriteString("<div>-- <br>\n")
+		b.WriteString(signature)
+		b.WriteString("\n</div>\n")
+	}
+	b.WriteString("</body>\n</html>")
+
+	return b.String()
+}
+
+// signatureStatus tells the user whether the signature of the identity the message is from will be added
+func (m model) signatureStatus() string {
+
+	if !m.sender().Signature.Enabled() {
+		return ""
+	}
+	if !m.signature {
+		return "✍ no signature (" + keyHelp(m.keys.signature) + ")"
+	}
+
+	return "✍ signature (" + keyHelp(m.keys.signature) + ")"
+}
+
+// resumeSignature works out whether a message opened from a draft, a sent
+// message or the outbox should get the signature, taking it off the body of
+// messages it had already been added to
+func (m *model) resumeSignature(body string, off bool) string {
+
+	m.signature = !off
+	if m.account == nil {
+		return body
+	}
+
+	plain, err := m.sender().Signature.Plain()
+	if err != nil {
+		return body
+	}
+	if stripped, ok := stripSignature(body, plain); ok {
+		m.signature = true
+		return stripped
+	}
+
+	return body
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+
+	"github.com/aidk/go-mailer/internal/smime"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// smimeStatus renders whether the message will be signed with S/MIME, shown
+// below the form. PGP takes over when it is on, a message only gets one signature.
+func (m model) smimeStatus() string {
+
+	if m.account == nil || !m.account.SMIME.Enabled() || m.pgp != 0 {
+		return ""
+	}
+
+	status := "🔏 will be signed with S/MIME"
+	if !smime.Available() {
+		status += ", but openssl isn't installed"
+	}
+
+	return status
+}
+
+// writeSMIME writes the body of the message as an S/MIME signed message, see RFC 8551.
+// The entity is the Content-Type header and body the message would have had.
+func (msg message) writeSMIME(b *bytes.Buffer, entity []byte) error {
+
+	p12, err := msg.smime.CertificatePath()
+	if err != nil {
+		return err
+	}
+
+	// like with PGP, the signature covers the entity exactly as it is sent
+	signature, err := smime.Sign(p12, msg.smime.Password, entity)
+	if err != nil {
+		return fmt.Errorf("could not sign message: %w", err)
+	}
+
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	fmt.Fprintf(b, "Content-Type: multipart/signed; micalg=%s; protocol=\"application/pkcs7-signature\"; boundary=%q\r\n", smime.MicAlg, boundary)
+	b.WriteString("\r\n")
+	fmt.Fprintf(b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n")
+	b.WriteString("\r\n")
+	email.WriteBase64(b, signature)
+	fmt.Fprintf(b, "--%s--\r\n", boundary)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/spamcheck"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// spamRules is how many of the rules that fired the summary lists
+const spamRules = 5
+
+// spamMsg is sent with the spam score of the message waiting to be confirmed
+type spamMsg struct {
+	check  int // which time the summary was opened, older scores are for another version of the message
+	report spamcheck.Report
+	err    error
+}
+
+// scoreSpam scores the message in the background, the way the config says
+func scoreSpam(how string, check int, raw []byte) tea.Cmd {
+
+	return func() tea.Msg {
+		var (
+			report spamcheck.Report
+			err    error
+		)
+		if how == config.SpamSpamAssassin {
+			report, err = spamcheck.Spamc(raw)
+		} else {
+			report, err = spamcheck.Heuristic(raw)
+		}
+		return spamMsg{check: check, report: report, err: err}
+	}
+}
+
+// spamLines sums up the spam score for the summary, with the rules that
+// added most to it so they can be fixed
+func (c confirmModel) spamLines() []string {
+
+	switch {
+	case c.scoring:
+		return []string{continueStyle.Render("Scoring for spam...")}
+	case c.spamErr != nil:
+		return []string{errorStyle.Render("⚠ Could not score for spam: " + c.spamErr.Error())}
+	case c.spam == nil:
+		return nil
+	}
+
+	r := c.spam
+	score := fmt.Sprintf("%s %.1f of %.1f", inputStyle.Render("Spam score:"), r.Score, r.Threshold)
+	if r.Spam() {
+		score = errorStyle.Render(fmt.Sprintf("⚠ Spam score: %.1f of %.1f, it may be taken for spam", r.Score, r.Threshold))
+	}
+	lines := []string{score}
+
+	// rules that take points off don't need fixing
+	var shown int
+	for _, rule := range r.Rules {
+		if rule.Score <= 0 {
+			continue
+		}
+		if shown == spamRules {
+			lines = append(lines, continueStyle.Render("  and more"))
+			break
+		}
+		lines = append(lines, continueStyle.Render(fmt.Sprintf("  %4.1f %s: %s", rule.Score, rule.Name, rule.Description)))
+		shown++
+	}
+	return lines
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/spell"
+)
+
+// maxSpellSuggestions is how many corrections we offer, one for each of the keys 1 to 9
+const maxSpellSuggestions = 9
+
+// spellModel keeps the dictionary and the word being corrected
+type spellModel struct {
+	dict *spell.Dictionary
+	err  error // why there is no dictionary, if one was asked for
+
+	// while a word is being corrected, which field it is in, where it is and what it could be instead
+	open        bool
+	field       int
+	word        spell.Word
+	suggestions []string
+	skipped     map[string]bool // the words left as they are this time round
+}
+
+// dictionaryMsg carries the dictionary once it has been loaded in the background
+type dictionaryMsg struct {
+	dict *spell.Dictionary
+	err  error
+}
+
+// loadDictionary loads the dictionary in the config in the background, a big
+// one takes a moment and we don't want to keep the form waiting
+func loadDictionary(cfg *config.Config) tea.Cmd {
+
+	if cfg.Dictionary == "" {
+		return nil
+	}
+
+	return func() tea.Msg {
+		dic, aff, err := cfg.DictionaryFiles()
+		if err != nil {
+			return dictionaryMsg{err: err}
+		}
+		dict, err := spell.Load(dic, aff)
+		if err != nil {
+			return dictionaryMsg{err: err}
+		}
+
+		// the words the user added last time
+		if path, err := config.WordsPath(); err == nil {
+			if err := dict.AddFile(path); err != nil {
+				slog.Error("Could not read your words", "err", err)
+			}
+		}
+
+		return dictionaryMsg{dict: dict}
+	}
+}
+
+// fieldText returns the text of the subject or the body and where the cursor is in it, counted in runes
+func (m model) fieldText(field int) (string, int) {
+
+	if field != body {
+		return m.inputs[field].Value(), m.inputs[field].Position()
+	}
+
+	// the editor only tells us the line the cursor is on and where it is in that line
+	lines := strings.Split(m.editor.Value(), "\n")
+	cursor := 0
+	for _, line := range lines[:m.editor.Line()] {
+		cursor += len([]rune(line)) + 1
+	}
+	info := m.editor.LineInfo()
+
+	return m.editor.Value(), cursor + info.StartColumn + info.ColumnOffset
+}
+
+// setFieldText replaces the text of the subject or the body and puts the cursor at the given rune
+func (m *model) setFieldText(field int, text string, cursor int) {
+
+	if field != body {
+		m.inputs[field].SetValue(text)
+		m.inputs[field].SetCursor(cursor)
+		return
+	}
+
+	// setting the value leaves the cursor at the end, so we walk it back to the line it was on
+	before := []rune(text)[:cursor]
+	row := strings.Count(string(before), "\n")
+	col := len(before) - strings.LastIndex(string(before), "\n") - 1
+
+	m.editor.SetValue(text)
+	for m.editor.Line() > row {
+		m.editor.CursorUp()
+	}
+	m.editor.SetCursor(col)
+}
+
+// checkSpelling starts correcting the misspelled word the cursor is on, or the next one after it
+func (m *model) checkSpelling() {
+
+	if m.spell.dict == nil {
+		switch {
+		case m.spell.err != nil:
+			m.status = "Could not load the dictionary: " + m.spell.err.Error()
+		case m.cfg.Dictionary == "":
+			m.status = "Spell checking is off, set dictionary in the config file to turn it on"
+		default:
+			m.status = "The dictionary is still loading"
+		}
+		return
+	}
+
+	// the addresses and the send time aren't words, so from there we check the subject
+	field := m.focused
+	if field != body {
+		field = subject
+	}
+
+	text, cursor := m.fieldText(field)
+	bad := m.spell.dict.Misspelled(text)
+	if len(bad) == 0 {
+		m.status = "No spelling mistakes in the " + fieldName(field)
+		return
+	}
+
+	word := bad[0]
+	for _, w := range bad {
+		if w.End >= cursor {
+			word = w
+			break
+		}
+	}
+
+	m.focusField(field)
+	m.spell.skipped = make(map[string]bool)
+	m.correct(field, word)
+}
+
+// correct offers the corrections for a misspelled word
+func (m *model) correct(field int, word spell.Word) {
+	m.spell.open = true
+	m.spell.field = field
+	m.spell.word = word
+	m.spell.suggestions = m.spell.dict.Suggest(word.Text, maxSpellSuggestions)
+	m.status = ""
+}
+
+// nextMistake moves on to the next misspelled word after the rune at from,
+// going round to the start of the field for the ones before where we began,
+// and stops once there are no more
+func (m *model) nextMistake(from int) {
+
+	text, _ := m.fieldText(m.spell.field)
+	var first *spell.Word
+	for _, w := range m.spell.dict.Misspelled(text) {
+		if m.spell.skipped[w.Text] {
+			continue
+		}
+		if w.Start >= from {
+			m.correct(m.spell.field, w)
+			return
+		}
+		if first == nil {
+			first = &w
+		}
+	}
+	if first != nil {
+		m.correct(m.spell.field, *first)
+		return
+	}
+
+	m.spell.open = false
+	m.status = "No more spelling mistakes in the " + fieldName(m.spell.field)
+}
+
+// updateSpell handles the keys while a word is being corrected
+func (m model) updateSpell(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+
+	w := m.spell.word
+	switch pressed := msg.String(); {
+
+	// we'll handle 1 to 9 to swap the word for one of the corrections
+	case len(pressed) == 1 && pressed >= "1" && pressed <= "9":
+		n, _ := strconv.Atoi(pressed)
+		if n > len(m.spell.suggestions) {
+			return m, nil
+		}
+		replacement := m.spell.suggestions[n-1]
+		text, _ := m.fieldText(m.spell.field)
+		runes := []rune(text)
+		text = string(runes[:w.Start]) + replacement + string(runes[w.End:])
+		end := w.Start + len([]rune(replacement))
+		m.setFieldText(m.spell.field, text, end)
+		m.nextMistake(end)
+
+	// we'll handle a to add the word to the dictionary, so it is never flagged again
+	case pressed == "a":
+		m.spell.dict.Add(w.Text)
+		if err := addWord(w.Text); err != nil {
+			m.status = "Could not save the word: " + err.Error()
+		}
+		m.nextMistake(w.End)
+
+	// we'll handle n and tab to leave the word as it is and go to the next one
+	case pressed == "n" || pressed == "tab":
+		m.spell.skipped[w.Text] = true
+		m.nextMistake(w.End)
+
+	// we'll handle esc to stop correcting
+	case pressed == "esc":
+		m.spell.open = false
+
+	// we'll handle ctrl+c to quit the program
+	case key.Matches(msg, m.keys.quit):
+		return m.quit()
+	}
+
+	return m, nil
+}
+
+// addWord keeps a word the user added to the dictionary for next time
+func addWord(word string) error {
+
+	path, err := config.WordsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, word); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// fieldName is how we talk about the field in messages to the user
+func fieldName(field int) string {
+	if field == body {
+		return "body"
+	}
+	return "subject"
+}
+
+// misspelled returns the misspelled words in the subject and the body
+func (m model) misspelled() map[string]bool {
+
+	if m.spell.dict == nil {
+		return nil
+	}
+
+	bad := make(map[string]bool)
+	for _, text := range []string{m.inputs[subject].Value(), m.editor.Value()} {
+		for _, w := range m.spell.dict.Misspelled(text) {
+			bad[w.Text] = true
+		}
+	}
+
+	return bad
+}
+
+// renderedWord finds the words in a rendered field, skipping over the
+// escape codes that color it so we don't mistake them for text
+var renderedWord = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|[\p{L}\p{Mn}'’]+`)
+
+// underline marks the misspelled words in a rendered field
+func underline(view string, bad map[string]bool) string {
+
+	if len(bad) == 0 {
+		return view
+	}
+
+	return renderedWord.ReplaceAllStringFunc(view, func(s string) string {
+		word := strings.Trim(s, "'’")
+		if strings.HasPrefix(s, "\x1b") || !bad[word] {
+			return s
+		}
+		return strings.Replace(s, word, spellStyle.Render(word), 1)
+	})
+}
+
+// spellHelp tells the user what they can do with a misspelled word
+const spellHelp = "(1-9 to correct, a to add to the dictionary, n for the next one, esc to stop)"
+
+// spellStatus renders the corrections for the word being corrected, or how many words are misspelled
+func (m model) spellStatus(bad map[string]bool) string {
+
+	if !m.spell.open {
+		if len(bad) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("✗ %d misspelled (%s)", len(bad), keyHelp(m.keys.spell))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q in the %s:", m.spell.word.Text, fieldName(m.spell.field))
+	if len(m.spell.suggestions) == 0 {
+		b.WriteString(" no suggestions")
+	}
+	for i, s := range m.spell.suggestions {
+		fmt.Fprintf(&b, "  %d %s", i+1, s)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/templates"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// templateItem lets us show a template in a bubbles list
+type templateItem struct {
+	templates.Template
+}
+
+func (t templateItem) Title() string {
+	return t.Name
+}
+
+func (t templateItem) Description() string {
+	if len(t.Vars) == 0 {
+		return "no placeholders"
+	}
+	return "fills in " + strings.Join(t.Vars, ", ")
+}
+
+func (t templateItem) FilterValue() string {
+	return t.Name
+}
+
+// templatesModel picks a template and then asks for the values of its placeholders
+type templatesModel struct {
+	list    list.Model
+	chosen  *templates.Template // the template being filled in, nil while picking
+	inputs  []textinput.Model   // one for each of the chosen template's placeholders
+	focused int
+	err     error
+	width   int // how wide the placeholders' inputs are
+}
+
+// newTemplates returns an empty template picker
+func newTemplates() templatesModel {
+
+	l := list.New(nil, themedDelegate(), 50, 20)
+	l.Title = "Templates (/ to search, enter to use, esc to go back)"
+	l.Styles = themedListStyles()
+	l.DisableQuitKeybindings()
+
+	return templatesModel{list: l, width: defaultFieldWidth}
+}
+
+// open reloads the templates from disk, so new ones show up without a restart
+func (t *templatesModel) open() error {
+
+	t.chosen, t.err = nil, nil
+
+	dir, err := config.TemplatesDir()
+	if err != nil {
+		return err
+	}
+	loaded, err := templates.Load(dir)
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return fmt.Errorf("no templates yet, add some to %s", dir)
+	}
+
+	items := make([]list.Item, len(loaded))
+	for i, tmpl := range loaded {
+		items[i] = templateItem{tmpl}
+	}
+	t.list.SetItems(items)
+	return nil
+}
+
+// choose starts filling in the template, with an input for each placeholder
+func (t *templatesModel) choose(tmpl templates.Template) {
+
+	t.chosen = &tmpl
+	t.inputs = make([]textinput.Model, len(tmpl.Vars))
+	for i, name := range tmpl.Vars {
+		t.inputs[i] = textinput.New()
+		t.inputs[i].Placeholder = name + "..."
+		t.inputs[i].Width = t.width
+		t.inputs[i].Prompt = ""
+		// today's date is the value a {{.Date}} almost always wants
+		if name == "Date" {
+			t.inputs[i].SetValue(time.Now().Format("2 January 2006"))
+		}
+	}
+	t.focused = 0
+	if len(t.inputs) > 0 {
+		t.inputs[0].Focus()
+	}
+}
+
+// values returns what was typed for each placeholder
+func (t templatesModel) values() map[string]string {
+	values := make(map[string]string, len(t.inputs))
+	for i, name := range t.chosen.Vars {
+		values[name] = t.inputs[i].Value()
+	}
+	return values
+}
+
+func (t templatesModel) Update(msg tea.Msg) (templatesModel, tea.Cmd) {
+
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		t.list.SetSize(msg.Width, msg.Height-2)
+		t.width = fieldWidth(msg.Width)
+		for i := range t.inputs {
+			t.inputs[i].Width = t.width
+		}
+		return t, nil
+	}
+
+	var cmd tea.Cmd
+	if t.chosen == nil {
+		t.list, cmd = t.list.Update(msg)
+	} else if len(t.inputs) > 0 {
+		t.inputs[t.focused], cmd = t.inputs[t.focused].Update(msg)
+	}
+	return t, cmd
+}
+
+// updateTemplates handles messages while the template picker is showing
+func (m model) updateTemplates(msg tea.Msg) (tea.Model, tea.Cmd) {
+
+	t := &m.templates
+
+	if msg, ok := msg.(tea.KeyMsg); ok && t.list.FilterState() != list.Filtering {
+		switch msg.Type {
+
+		// we'll handle tab and shift+tab to move between the placeholders
+		case tea.KeyTab, tea.KeyShiftTab:
+			if t.chosen != nil && len(t.inputs) > 0 {
+				t.inputs[t.focused].Blur()
+				if msg.Type == tea.KeyTab {
+					t.focused = (t.focused + 1) % len(t.inputs)
+				} else {
+					t.focused = (t.focused + len(t.inputs) - 1) % len(t.inputs)
+				}
+				t.inputs[t.focused].Focus()
+				return m, nil
+			}
+
+		// we'll handle enter to pick a template, then to move on and finally to fill the form in
+		case tea.KeyEnter:
+			if t.chosen == nil {
+				if item, ok := t.list.SelectedItem().(templateItem); ok {
+					t.choose(item.Template)
+				}
+				if len(t.inputs) > 0 {
+					return m, nil
+				}
+			}
+			if t.focused < len(t.inputs)-1 {
+				t.inputs[t.focused].Blur()
+				t.focused++
+				t.inputs[t.focused].Focus()
+				return m, nil
+			}
+
+			if t.err = m.applyTemplate(*t.chosen, t.values()); t.err != nil {
+				return m, nil
+			}
+			m.screen = composeScreen
+			return m, nil
+
+		// we'll handle esc to go back to the list, or to the compose view
+		case tea.KeyEsc:
+			if t.chosen != nil {
+				t.chosen, t.err = nil, nil
+				return m, nil
+			}
+			if t.list.FilterState() == list.Unfiltered {
+				m.screen = composeScreen
+				return m, nil
+			}
+		}
+
+		// we'll handle ctrl+c to quit the program
+		if key.Matches(msg, m.keys.quit) {
+			return m.quit()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.templates, cmd = m.templates.Update(msg)
+	return m, cmd
+}
+
+// applyTemplate fills the subject and the body of the form in from the template.
+// Who the message goes to is left as it is, so a template can be picked at any time.
+func (m *model) applyTemplate(tmpl templates.Template, values map[string]string) error {
+
+	subj, text, err := tmpl.Execute(values)
+	if err != nil {
+		return err
+	}
+
+	if tmpl.HasSubject() {
+		m.inputs[subject].SetValue(subj)
+	}
+	m.editor.SetValue(text)
+	m.focusField(body)
+	return nil
+}
+
+// viewTemplates renders the template picker, or the placeholders of the chosen template
+func (m model) viewTemplates() string {
+
+	t := m.templates
+	if t.chosen == nil {
+		return t.list.View()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\t%s\n\n", lipgloss.NewStyle().Foreground(accentColor).Render("Template: "+t.chosen.Name))
+	for i, name := range t.chosen.Vars {
+		fmt.Fprintf(&b, "\t%s\n\t%s\n\n", inputStyle.Copy().Width(t.inputs[i].Width).Render(name+":"), t.inputs[i].View())
+	}
+	if len(t.chosen.Vars) == 0 {
+		b.WriteString("\t" + continueStyle.Render("This template has no placeholders.") + "\n\n")
+	}
+
+	b.WriteString("\t" + continueStyle.Render("(tab to move, enter to fill in the message, esc to pick another)") + "\n")
+
+	if t.err != nil {
+		b.WriteString("\t" + t.err.Error() + "\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// we'll use these styles to render the inputs, the continue prompt and
+// everything else, they start out with the default theme and are set from
+// the theme in the config when go-mailer starts
+var (
+	accentColor  lipgloss.TerminalColor = lipgloss.Color("#FF0687") // a nice hot pink
+	mutedColor   lipgloss.TerminalColor = lipgloss.Color("#767676") // a dark grey
+	focusColor   lipgloss.TerminalColor = lipgloss.Color("#FF0687")
+	borderColor  lipgloss.TerminalColor = lipgloss.NoColor{}
+	bodyBordered bool
+
+	inputStyle    = lipgloss.NewStyle().Foreground(accentColor)
+	continueStyle = lipgloss.NewStyle().Foreground(mutedColor)
+	focusStyle    = lipgloss.NewStyle().Foreground(focusColor).Bold(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5F5F"))
+
+	// spellStyle underlines the misspelled words in the subject and the body
+	spellStyle = lipgloss.NewStyle().Underline(true).Foreground(lipgloss.Color("#FF5F5F"))
+)
+
+// applyTheme sets the styles from the theme's colors
+func applyTheme(t config.Theme) {
+
+	accentColor = themeColor(t.Accent)
+	mutedColor = themeColor(t.Muted)
+	focusColor = themeColor(t.Focus)
+	borderColor = themeColor(t.Border)
+	bodyBordered = t.Border.IsSet()
+	errorColor := themeColor(t.Error)
+
+	inputStyle = lipgloss.NewStyle().Foreground(accentColor)
+	continueStyle = lipgloss.NewStyle().Foreground(mutedColor)
+	focusStyle = lipgloss.NewStyle().Foreground(focusColor).Bold(true)
+	errorStyle = lipgloss.NewStyle().Foreground(errorColor)
+	spellStyle = lipgloss.NewStyle().Underline(true).Foreground(errorColor)
+}
+
+// themeColor turns a color from the config into one lipgloss can render,
+// picking the light or dark version to suit the terminal's background
+func themeColor(c config.Color) lipgloss.TerminalColor {
+
+	switch {
+	case !c.IsSet():
+		return lipgloss.NoColor{}
+	case c.Light == c.Dark:
+		return lipgloss.Color(c.Dark)
+	}
+
+	return lipgloss.AdaptiveColor{Light: c.Light, Dark: c.Dark}
+}
+
+// themedDelegate renders the items of a list, with the selected one in the accent color
+func themedDelegate() list.DefaultDelegate {
+
+	if accessible {
+		return plainDelegate()
+	}
+
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(accentColor).BorderLeftForeground(accentColor)
+	d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(accentColor).BorderLeftForeground(accentColor)
+
+	return d
+}
+
+// themedListStyles styles a list, with its title in the accent color
+func themedListStyles() list.Styles {
+
+	s := list.DefaultStyles()
+	s.Title = s.Title.Background(accentColor)
+
+	// in accessible mode the title starts its line, without colors or padding
+	if accessible {
+		s.Title = lipgloss.NewStyle()
+		s.TitleBar = lipgloss.NewStyle()
+		s.StatusBar = lipgloss.NewStyle()
+		s.NoItems = lipgloss.NewStyle()
+	}
+
+	return s
+}
+
+// bodyStyle is the frame around the body editor, with the focus color while it is being edited
+func bodyStyle(focused bool) lipgloss.Style {
+
+	if !bodyBordered {
+		return lipgloss.NewStyle()
+	}
+
+	color := borderColor
+	if focused {
+		color = focusColor
+	}
+
+	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(color)
+}
+
+// label renders the name of a field above it, the one being edited stands out
+func (m model) label(field int, name string) string {
+
+	// we copy the style, setting its width would set it on the style everything else uses too
+	style := inputStyle.Copy()
+	if m.focused == field {
+		style = focusStyle.Copy()
+	}
+
+	// a field that isn't filled in properly says what's wrong next to its label
+	if err := m.fieldErr(field); err != nil {
+		return style.Render(name) + " " + errorStyle.Render("✗ "+err.Error())
+	}
+
+	// the label is as wide as the fields
+	return style.Width(m.inputs[to].Width).Render(name)
+}
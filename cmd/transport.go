@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/dkim"
+	"github.com/aidk/go-mailer/internal/jmap"
+	"github.com/aidk/go-mailer/internal/paths"
+	"github.com/aidk/go-mailer/internal/tlspolicy"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// newTransport returns the transport for the account's backend
+func newTransport(account *config.Account) (transport.Transport, error) {
+
+	if account == nil {
+		return nil, fmt.Errorf("no account configured")
+	}
+
+	// with --capture nothing leaves the machine, whatever the account says
+	if capture != nil {
+		return captureTransport{transport.SMTP{Addr: capture.Addr, Insecure: true, Log: smtpLog(account)}}, nil
+	}
+
+	switch account.BackendName() {
+	case config.BackendJMAP:
+		if !account.JMAP.Enabled() {
+			return nil, fmt.Errorf("account %q has no jmap settings", account.Name)
+		}
+		return jmapTransport{cfg: account.JMAP}, nil
+
+	default:
+		// the Gmail API or Microsoft Graph send instead of SMTP, whichever
+		// way the mail is read
+		if account.Gmail.Enabled() {
+			return gmailTransport{client: gmailFor(account.Gmail)}, nil
+		}
+		if account.Graph.Enabled() {
+			c, err := graphFor(account)
+			if err != nil {
+				return nil, err
+			}
+			return graphTransport{client: c}, nil
+		}
+		if !account.SMTP.Enabled() {
+			return nil, fmt.Errorf("account %q has no smtp settings", account.Name)
+		}
+
+		cfg := account.SMTP
+		t := transport.SMTP{
+			Addr:        cfg.Addr(),
+			ImplicitTLS: cfg.ImplicitTLS(),
+			Insecure:    cfg.Insecure,
+			Username:    cfg.Username,
+			Password:    cfg.Password,
+			ReturnPath:  cfg.ReturnPath,
+			Pool:        poolFor(cfg),
+			Connected: func(d time.Duration) {
+				connectSeconds.Observe(account.Name, d.Seconds())
+			},
+			Log: smtpLog(account),
+		}
+		if cfg.TLSPolicyName() != config.TLSPolicyNone {
+			t.Policy = tlsPolicy(cfg)
+		}
+		if account.DKIM.Enabled() {
+			signer, err := newDKIMSigner(account)
+			if err != nil {
+				return nil, err
+			}
+			t.DKIM = signer
+		}
+		return t, nil
+	}
+}
+
+// tlsPolicy returns the lookup of the MTA-STS and DANE policies for the server
+func tlsPolicy(cfg config.SMTP) func(host string, to []string) (transport.TLSPolicy, error) {
+
+	return func(host string, to []string) (transport.TLSPolicy, error) {
+
+		_, port, err := net.SplitHostPort(cfg.Addr())
+		if err != nil {
+			return nil, err
+		}
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+
+		domains := make([]string, 0, len(to))
+		for _, rcpt := range to {
+			domains = append(domains, rcpt[strings.LastIndex(rcpt, "@")+1:])
+		}
+
+		dir, err := paths.Cache()
+		if err != nil {
+			return nil, err
+		}
+
+		policy, err := tlspolicy.Lookup(host, portNum, domains, cfg.TLSPolicyName() == config.TLSPolicyStrict, filepath.Join(dir, "mta-sts.json"))
+		if err != nil {
+			return nil, fmt.Errorf("could not check the TLS policy of %s: %w", host, err)
+		}
+
+		return policy, nil
+	}
+}
+
+// newDKIMSigner reads the account's DKIM key
+func newDKIMSigner(account *config.Account) (*dkim.Signer, error) {
+
+	domain := account.DKIM.Domain
+	if domain == "" {
+		addr, err := mail.ParseAddress(account.Address)
+		if err != nil {
+			return nil, fmt.Errorf("account %q: dkim needs a domain", account.Name)
+		}
+		domain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	}
+
+	path, err := account.DKIM.KeyPath()
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read dkim key: %w", err)
+	}
+
+	return dkim.New(domain, account.DKIM.Selector, key)
+}
+
+// jmapTransport sends mail with a JMAP EmailSubmission
+type jmapTransport struct {
+	cfg config.JMAP
+}
+
+func (t jmapTransport) Name() string {
+	return "jmap"
+}
+
+func (t jmapTransport) Send(from string, to []string, msg []byte) (string, error) {
+
+	// we don't ask for delivery reports over jmap, only over smtp
+	msg, _ = email.TakeDeliveryReport(msg)
+
+	c, err := jmap.Dial(t.cfg)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := c.Send(from, to, msg)
+	if err != nil {
+		return "", err
+	}
+
+	return "submission " + id, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/outbox"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// undoTickMsg is sent every second while a sent message can still be undone
+type undoTickMsg struct {
+	id string
+}
+
+// undoTick waits a second before checking on the pending message again
+func undoTick(id string) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return undoTickMsg{id: id}
+	})
+}
+
+// holdForUndo puts the message in the outbox, due once the undo window has passed,
+// so it isn't handed to the transport until then
+func (m *model) holdForUndo(msg message) (tea.Cmd, error) {
+
+	if m.outbox == nil {
+		return nil, fmt.Errorf("undo send needs an account to queue the message in")
+	}
+
+	raw, err := msg.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(m.cfg.UndoDelay())
+	e, err := m.outbox.Schedule(msg.from.Address, msg.recipients(), msg.subject, raw, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	m.undo = e
+	m.queue.refresh(m.outbox)
+	return undoTick(e.ID), nil
+}
+
+// updateUndo counts down the undo window and sends the message once it has passed
+func (m model) updateUndo(msg undoTickMsg) (tea.Model, tea.Cmd) {
+
+	// the message was undone, or a newer one replaced it
+	if msg.id != m.undo.ID {
+		return m, nil
+	}
+
+	if time.Now().Before(m.undo.NextAttempt) {
+		return m, undoTick(msg.id)
+	}
+
+	// it's due, so it goes out with the next flush, if one is already
+	// running we check back shortly
+	if m.flushing {
+		return m, undoTick(msg.id)
+	}
+
+	m.undo = outbox.Entry{}
+	cmd := m.flush()
+	return m, cmd
+}
+
+// undoSend takes the pending message back out of the outbox and puts it in the form again
+func (m *model) undoSend() {
+
+	e := m.undo
+	m.undo = outbox.Entry{}
+
+	// it wasn't scheduled by the user, so the form shouldn't say it was
+	e.SendAt = time.Time{}
+
+	err := m.editQueued(e)
+	if errors.Is(err, outbox.ErrSending) {
+		m.status = "Too late to undo, the message is already being sent"
+		return
+	}
+	if err != nil {
+		m.status = "Could not undo: " + err.Error()
+		return
+	}
+
+	m.status = "Send undone"
+}
+
+// sendPendingNow sends a message still waiting out its undo window
+// straight away, since nothing will send it once we've quit
+func (m *model) sendPendingNow() {
+
+	if m.undo.ID == "" || m.outbox == nil {
+		return
+	}
+
+	slog.Info("Sending message")
+	err := m.outbox.Retry(m.undo.ID)
+	if errors.Is(err, outbox.ErrSending) || errors.Is(err, os.ErrNotExist) {
+		// a flush is sending it or has already sent it, quit waits for the
+		// one running here
+		return
+	}
+	if err != nil {
+		slog.Error("Could not send message", "err", err)
+		return
+	}
+
+	if msg, ok := flushOutbox(m.account, m.outbox)().(outboxFlushedMsg); ok && msg.err != nil {
+		slog.Error("Could not send message", "err", msg.err)
+	}
+}
+
+// undoStatus renders the countdown shown while a message can still be undone
+func (m model) undoStatus() string {
+
+	left := time.Until(m.undo.NextAttempt).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+
+	return fmt.Sprintf("Sending in %s (%s to undo)", left, keyHelp(m.keys.undo))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aidk/go-mailer/internal/eai"
+)
+
+// maxSubjectLength is the longest a line of a message may be, so the
+// subject can't be longer than this and still fit on its header line
+const maxSubjectLength = 998
+
+// validators check what is typed into each field, the body can hold anything
+// so it has none. They run as the field is typed into, once it has been left
+// or the message sent, so the error next to it goes away as soon as it is fixed.
+var validators = [body]func(string) error{
+	to:      validateTo,
+	from:    validateFrom,
+	subject: validateSubject,
+	sendAt:  validateSendAt,
+}
+
+// validateTo checks the to field, it takes a list of addresses, e.g. when replying to everyone
+func validateTo(s string) error {
+
+	s = trimAddressList(s)
+	if s == "" {
+		return errors.New(tr("who is it to?"))
+	}
+
+	addrs, err := mail.ParseAddressList(s)
+	if err != nil {
+		return errors.New(tr("invalid email address"))
+	}
+
+	return checkDomains(addrs)
+}
+
+// validateFrom checks the from field, it takes a single address
+func validateFrom(s string) error {
+
+	if strings.TrimSpace(s) == "" {
+		return errors.New(tr("who is it from?"))
+	}
+
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return errors.New(tr("invalid email address"))
+	}
+
+	return checkDomains([]*mail.Address{a})
+}
+
+// checkDomains checks the addresses can be delivered to, non-ASCII
+// addresses are fine as long as the domain is one DNS can look up
+func checkDomains(addrs []*mail.Address) error {
+
+	for _, a := range addrs {
+		if _, err := eai.Address(a.Address); err != nil {
+			return fmt.Errorf(tr("invalid email address: %w"), err)
+		}
+	}
+
+	return nil
+}
+
+// validateSubject checks the subject fits on its header line, it can be left empty
+func validateSubject(s string) error {
+
+	// a line break would end the header, and what follows could be anything
+	if strings.ContainsAny(s, "\r\n") {
+		return errors.New(tr("the subject can't contain line breaks"))
+	}
+	if n := utf8.RuneCountInString(s); n > maxSubjectLength {
+		return fmt.Errorf(tr("the subject is too long, it can be at most %d characters"), maxSubjectLength)
+	}
+
+	return nil
+}
+
+// validateSendAt checks the send time makes sense, it is optional
+func validateSendAt(s string) error {
+	_, err := parseSendAt(s, time.Now())
+	return err
+}
+
+// fieldErr returns what is wrong with a field, if anything. A field isn't
+// checked until it has been left, so an empty form doesn't start out in red.
+func (m model) fieldErr(field int) error {
+
+	if field == body {
+		return nil
+	}
+
+	// the subject's Validate turns away keys that would make it too long, and says so
+	if err := m.inputs[field].Err; err != nil {
+		return err
+	}
+
+	if !m.checked[field] {
+		return nil
+	}
+
+	return validators[field](m.inputs[field].Value())
+}
+
+// checkFields checks every field before the message is sent, and returns the
+// first one that isn't filled in properly, or -1 if they all are
+func (m *model) checkFields() int {
+
+	for field := to; field < body; field++ {
+		m.checked[field] = true
+	}
+
+	for field := to; field < body; field++ {
+		if m.fieldErr(field) != nil {
+			return field
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/vault"
+	"golang.org/x/term"
+)
+
+// passphraseEnv holds the passphrase when there is no terminal to ask it
+// on, e.g. for go-mailer serve or a command run by a script
+const passphraseEnv = "GO_MAILER_PASSPHRASE"
+
+// unlockVault asks for the passphrase and unlocks the encrypted storage.
+// The first time, the passphrase is asked twice and the key file made.
+func unlockVault() error {
+
+	path, err := config.KeyPath()
+	if err != nil {
+		return err
+	}
+	exists := vault.Exists(path)
+
+	if p := os.Getenv(passphraseEnv); p != "" {
+		if !exists {
+			return vault.Create(path, []byte(p))
+		}
+		return vault.Unlock(path, []byte(p))
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("encrypt is set, go-mailer needs the passphrase in %s", passphraseEnv)
+	}
+
+	if !exists {
+		pass, err := readPassphrase("New passphrase for go-mailer's storage: ")
+		if err != nil {
+			return err
+		}
+		if len(pass) == 0 {
+			return errors.New("the passphrase can't be empty")
+		}
+		again, err := readPassphrase("Once more: ")
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(pass, again) {
+			return errors.New("the passphrases don't match")
+		}
+		return vault.Create(path, pass)
+	}
+
+	// three tries, like sudo
+	for i := 0; ; i++ {
+		pass, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = vault.Unlock(path, pass)
+		if !errors.Is(err, vault.ErrPassphrase) || i == 2 {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrong passphrase, try again")
+	}
+}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it
+func readPassphrase(prompt string) ([]byte, error) {
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// vimModel keeps track of the mode when vim = true is in the config. In
+// normal mode the keys move between and around the fields, in insert
+// mode they type, and : starts a command like :send or :q.
+type vimModel struct {
+	insert     bool
+	commanding bool   // whether a command is being typed after a :
+	command    string // the command typed so far
+}
+
+// actionKey reports whether the key is bound to one of the actions of the
+// compose view, which work the same in both modes. Moving between the
+// fields is left out, normal mode does that itself.
+func (m model) actionKey(msg tea.KeyMsg) bool {
+
+	for _, a := range keyActions {
+		if a.name == "next" || a.name == "prev" {
+			continue
+		}
+		if key.Matches(msg, *a.binding(&m.keys)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateNormal handles the keys in normal mode
+func (m model) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+
+	if m.vim.commanding {
+		return m.updateCommand(msg)
+	}
+
+	switch pressed := msg.String(); {
+
+	// we'll handle : to start typing a command
+	case pressed == ":":
+		m.vim.commanding = true
+		m.vim.command = ""
+		m.status = ""
+
+	// we'll handle i, a, I and A to start typing before or after the cursor, or at the start or end of the line
+	case pressed == "i":
+		m.vim.insert = true
+	case pressed == "a":
+		m.move(tea.KeyRight)
+		m.vim.insert = true
+	case pressed == "I":
+		m.move(tea.KeyHome)
+		m.vim.insert = true
+	case pressed == "A":
+		m.move(tea.KeyEnd)
+		m.vim.insert = true
+
+	// we'll handle o to open a new line below the cursor in the body
+	case pressed == "o" && m.focused == body:
+		m.move(tea.KeyEnd)
+		m.move(tea.KeyEnter)
+		m.vim.insert = true
+
+	// we'll handle h and l to move the cursor, and w and b to move a word at a time
+	case pressed == "h" || pressed == "left":
+		m.move(tea.KeyLeft)
+	case pressed == "l" || pressed == "right":
+		m.move(tea.KeyRight)
+	case pressed == "w":
+		m.moveWord(tea.KeyRight)
+	case pressed == "b":
+		m.moveWord(tea.KeyLeft)
+	case pressed == "0" || pressed == "home":
+		m.move(tea.KeyHome)
+	case pressed == "$" || pressed == "end":
+		m.move(tea.KeyEnd)
+
+	// we'll handle x to delete the letter under the cursor, there is none at the end of a line
+	case pressed == "x" && !m.atLineEnd():
+		m.move(tea.KeyDelete)
+
+	// we'll handle j and k to go down and up, a line at a time in the body
+	// and a field at a time everywhere else
+	case pressed == "j" || pressed == "down" || pressed == "enter" || key.Matches(msg, m.keys.next):
+		switch {
+		case m.focused != body:
+			if !m.leaveField() {
+				return m, nil
+			}
+			m.nextInput()
+			m.focusField(m.focused)
+		case m.editor.Line() < m.editor.LineCount()-1:
+			m.move(tea.KeyDown)
+		}
+	case pressed == "k" || pressed == "up" || key.Matches(msg, m.keys.prev):
+		switch {
+		case m.focused == body && (m.editor.Line() > 0 || m.editor.LineInfo().RowOffset > 0):
+			m.move(tea.KeyUp)
+		case m.focused != to:
+			m.prevInput()
+			m.focusField(m.focused)
+		}
+
+	// we'll handle ? to show every key, as vim users would expect
+	case pressed == "?":
+		m.toggleHelp()
+
+	// we'll handle g and G to go to the first field and to the body
+	case pressed == "g":
+		m.focusField(to)
+	case pressed == "G":
+		m.focusField(body)
+	}
+
+	return m, nil
+}
+
+// updateCommand handles the keys while a command is being typed
+func (m model) updateCommand(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.vim.commanding = false
+	case tea.KeyBackspace:
+		// deleting the : as well gives up on the command, like vim does
+		if m.vim.command == "" {
+			m.vim.commanding = false
+		}
+		if n := len([]rune(m.vim.command)); n > 0 {
+			m.vim.command = string([]rune(m.vim.command)[:n-1])
+		}
+	case tea.KeyEnter:
+		m.vim.commanding = false
+		return m.runCommand(strings.TrimSpace(m.vim.command))
+	case tea.KeyRunes, tea.KeySpace:
+		m.vim.command += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+// runCommand runs a command typed after a :
+func (m model) runCommand(command string) (tea.Model, tea.Cmd) {
+
+	switch command {
+	case "send":
+		return m.send()
+
+	// :w saves the draft
+	case "w":
+		if err := m.saveDraft(); err != nil {
+			m.status = "Could not save draft: " + err.Error()
+			return m, nil
+		}
+		m.status = "Draft saved"
+	// :q asks what to do with the message, :wq and :x keep it as a draft
+	// and :q! throws it away, like vim does with a file
+	case "q":
+		return m.quit()
+	case "wq", "x":
+		return m.saveAndQuit()
+	case "q!":
+		return m.discardAndQuit()
+
+	case "":
+	default:
+		m.status = "Not a command: " + command + " (the commands are :send, :w, :q, :wq and :q!)"
+	}
+
+	return m, nil
+}
+
+// move sends a key to the focused field, so it moves its cursor or deletes the way it always does
+func (m *model) move(k tea.KeyType) {
+	m.press(tea.KeyMsg{Type: k})
+}
+
+// moveWord moves the cursor of the focused field a word to the left or the right
+func (m *model) moveWord(k tea.KeyType) {
+	m.press(tea.KeyMsg{Type: k, Alt: true})
+}
+
+// press hands a key to the focused field
+func (m *model) press(msg tea.KeyMsg) {
+
+	if m.focused == body {
+		m.editor, _ = m.editor.Update(msg)
+		return
+	}
+	m.inputs[m.focused], _ = m.inputs[m.focused].Update(msg)
+}
+
+// atLineEnd reports whether the cursor of the focused field is after the last letter of its line
+func (m model) atLineEnd() bool {
+
+	if m.focused != body {
+		return m.inputs[m.focused].Position() >= len([]rune(m.inputs[m.focused].Value()))
+	}
+
+	text, cursor := m.fieldText(body)
+	rest := []rune(text)[cursor:]
+
+	return len(rest) == 0 || rest[0] == '\n'
+}
+
+// modeLine renders the mode we're in, or the command being typed, below the form
+func (m model) modeLine() string {
+
+	switch {
+	case !m.cfg.Vim:
+		return ""
+	case m.vim.commanding:
+		return "\n" + inputStyle.Render(":"+m.vim.command)
+	case m.vim.insert:
+		return "\n" + continueStyle.Render("-- INSERT -- (esc for normal mode)")
+	}
+
+	return "\n" + continueStyle.Render("-- NORMAL -- (i to type, hjkl to move, :send to send, :q to quit)")
+}
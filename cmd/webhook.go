@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// the events a webhook is told about
+const (
+	eventSent     = "sent"     // the server took the message
+	eventDeferred = "deferred" // it didn't go out, it waits in the outbox for another try
+	eventFailed   = "failed"   // it was refused for good and won't be tried again
+)
+
+// webhookTimeout is how long a webhook has to answer
+const webhookTimeout = 10 * time.Second
+
+// webhooks tracks the posts still on their way, so they aren't cut off when the program exits
+var webhooks sync.WaitGroup
+
+// webhookEvent is the JSON we post to the account's webhook
+type webhookEvent struct {
+	Event     string       `json:"event"`
+	Account   string       `json:"account"`
+	Time      time.Time    `json:"time"`
+	MessageID string       `json:"message_id,omitempty"`
+	From      string       `json:"from"`
+	To        []string     `json:"to"`
+	Subject   string       `json:"subject"`
+	Queued    string       `json:"queued,omitempty"`   // the outbox entry, if the message was or still is in it
+	Attempts  int          `json:"attempts,omitempty"` // how often sending it from the outbox was tried
+	Reply     string       `json:"reply,omitempty"`    // what the server said when it took the message
+	Error     *resultError `json:"error,omitempty"`
+}
+
+// notify counts the event in the metrics and posts it to the account's
+// webhook in the background, if it has one
+func notify(account *config.Account, ev webhookEvent) {
+
+	countEvent(account, ev.Event)
+	if !account.Webhook.Enabled() {
+		return
+	}
+	ev.Account, ev.Time = account.Name, time.Now()
+
+	webhooks.Add(1)
+	go func() {
+		defer webhooks.Done()
+		if err := postWebhook(account.Webhook, ev); err != nil {
+			slog.Error("Could not post to the webhook", "account", ev.Account, "id", ev.MessageID, "event", ev.Event, "err", err)
+		}
+	}()
+}
+
+// waitWebhooks waits for the posts still on their way, before the program exits
+func waitWebhooks() {
+	webhooks.Wait()
+}
+
+// postWebhook posts the event, signed with the webhook's secret. Only a
+// 2xx answer counts, a webhook that isn't there isn't tried again.
+func postWebhook(hook config.Webhook, ev webhookEvent) error {
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-mailer")
+	req.Header.Set("X-Go-Mailer-Event", ev.Event)
+	if hook.Secret != "" {
+		req.Header.Set("X-Go-Mailer-Signature", "sha256="+sign(hook.Secret, body))
+	}
+
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body made with secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// messageID returns the Message-ID of a rendered message, empty if it has none
+func messageID(raw []byte) string {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(msg.Header.Get("Message-Id"))
+}
+
+// messageEvent is the event of a message sent by go-mailer serve
+func messageEvent(event string, msg message, res sendResult) webhookEvent {
+	return webhookEvent{
+		Event:     event,
+		MessageID: msg.id,
+		From:      msg.from.Address,
+		To:        msg.recipients(),
+		Subject:   msg.subject,
+		Queued:    res.Queued,
+		Reply:     res.Reply,
+		Error:     res.Error,
+	}
+}
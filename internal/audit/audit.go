@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one attempt at sending a message. The entries are chained, each
+// holds the hash of the one before it, so an entry that was changed, taken
+// out or put in between the others breaks the chain from there on.
+type Entry struct {
+	Seq       int       `json:"seq"`
+	Time      time.Time `json:"time"`
+	Account   string    `json:"account"`
+	Transport string    `json:"transport"`
+	MessageID string    `json:"message_id,omitempty"`
+	From      string    `json:"from"`
+	To        []string  `json:"to"`
+
+	// Subject is the SHA-256 of the subject, see HashSubject, so the log
+	// can tell which message it was without giving away what it was about
+	Subject string `json:"subject_sha256"`
+
+	Result string `json:"result"`          // "sent", or the reason it wasn't, e.g. "rejected"
+	Reply  string `json:"reply,omitempty"` // what the server said when it took the message
+	Error  string `json:"error,omitempty"`
+
+	Prev string `json:"prev"` // the hash of the entry before, empty for the first one
+	Hash string `json:"hash"` // the SHA-256 of the entry with Hash left empty
+}
+
+// mu keeps two sends in the same process from appending at the same time,
+// see lock for the ones in other processes
+var mu sync.Mutex
+
+// HashSubject returns the hex encoded SHA-256 of a subject
+func HashSubject(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:])
+}
+
+// hash returns the hash of the entry, which covers everything but Hash itself
+func (e Entry) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Append adds the entry at the end of the log in the file at path, chained
+// to the last one. It fills in Seq, Prev and Hash, and Time if it's zero,
+// and returns the entry as it was written.
+func Append(path string, e Entry) (Entry, error) {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return Entry{}, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return Entry{}, fmt.Errorf("could not open the audit log: %w", err)
+	}
+	defer f.Close()
+
+	// another go-mailer may be appending too, the lock keeps us from both
+	// chaining to the same last entry
+	if err := lock(f); err != nil {
+		return Entry{}, fmt.Errorf("could not lock the audit log: %w", err)
+	}
+
+	last, err := lastEntry(f)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Seq, e.Prev = last.Seq+1, last.Hash
+	e.Hash = e.hash()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Entry{}, err
+	}
+
+	// an entry that is only in the page cache isn't much of a record
+	return e, f.Sync()
+}
+
+// lastEntry returns the last entry in the file, the zero Entry if it is empty.
+// Only the end of the file is read, unless the last entry is a very long one.
+func lastEntry(f *os.File) (Entry, error) {
+
+	info, err := f.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	size := info.Size()
+
+	for chunk := int64(64 << 10); ; chunk *= 4 {
+		start := max(size-chunk, 0)
+		data := make([]byte, size-start)
+		if _, err := f.ReadAt(data, start); err != nil && !errors.Is(err, io.EOF) {
+			return Entry{}, err
+		}
+
+		data = bytes.TrimRight(data, "\n")
+		if len(data) == 0 {
+			return Entry{}, nil
+		}
+
+		// the line has to start in the chunk, or at the start of the file
+		i := bytes.LastIndexByte(data, '\n')
+		if i < 0 && start > 0 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(data[i+1:], &e); err != nil {
+			return Entry{}, fmt.Errorf("the last entry of the audit log can't be read: %w", err)
+		}
+		return e, nil
+	}
+}
+
+// Read returns every entry in the log in the file at path, oldest first.
+// A log that doesn't exist yet has no entries.
+func Read(path string) ([]Entry, error) {
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d of the audit log can't be read: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Verify checks that the entries, as Read returns them, form an unbroken
+// chain. It returns an error naming the first entry that doesn't fit.
+// Entries taken off the end leave the chain intact, so compare the hash of
+// the last one with one kept somewhere else to notice those.
+func Verify(entries []Entry) error {
+
+	prev := ""
+	for i, e := range entries {
+		switch {
+		case e.Seq != i+1:
+			return fmt.Errorf("entry %d is numbered %d, entries were taken out or added", i+1, e.Seq)
+		case e.Prev != prev:
+			return fmt.Errorf("entry %d doesn't follow the one before it", e.Seq)
+		case e.hash() != e.Hash:
+			return fmt.Errorf("entry %d was changed after it was written", e.Seq)
+		}
+		prev = e.Hash
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// appendsPerProcess is how many entries each appender in TestConcurrentAppend writes
+const appendsPerProcess = 50
+
+// TestConcurrentAppend runs appenders in processes of their own, as the
+// TUI, go-mailer queue flush and serve are, so mu can't keep them apart,
+// and checks that the chain they leave is unbroken
+func TestConcurrentAppend(t *testing.T) {
+
+	if path := os.Getenv("AUDIT_TEST_APPEND"); path != "" {
+		appendEntries(t, path)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	const processes = 4
+	var wg sync.WaitGroup
+	errs := make([]error, processes)
+	for i := 0; i < processes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestConcurrentAppend$")
+			cmd.Env = append(os.Environ(), "AUDIT_TEST_APPEND="+path, "AUDIT_TEST_APPENDER="+strconv.Itoa(i))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs[i] = fmt.Errorf("appender %d: %v\n%s", i, err, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != processes*appendsPerProcess {
+		t.Errorf("the log has %d entries, want %d", len(entries), processes*appendsPerProcess)
+	}
+	if err := Verify(entries); err != nil {
+		t.Errorf("the chain is broken: %v", err)
+	}
+}
+
+// appendEntries is what each appender process of TestConcurrentAppend does
+func appendEntries(t *testing.T, path string) {
+
+	account := "appender " + os.Getenv("AUDIT_TEST_APPENDER")
+	for i := 0; i < appendsPerProcess; i++ {
+		e := Entry{Account: account, Transport: "smtp", From: "ann@example.com", To: []string{"bob@example.com"}, Subject: HashSubject("hi"), Result: "sent"}
+		if _, err := Append(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 3; i++ {
+		if _, err := Append(path, Entry{Account: "work", Result: "sent"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	good, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func([]Entry) []Entry
+		ok     bool
+	}{
+		{"untouched", func(e []Entry) []Entry { return e }, true},
+		{"last taken off", func(e []Entry) []Entry { return e[:2] }, true},
+		{"changed", func(e []Entry) []Entry { e[1].Result = "rejected"; return e }, false},
+		{"taken out", func(e []Entry) []Entry { return append(e[:1], e[2:]...) }, false},
+		{"same place twice", func(e []Entry) []Entry { return append(e[:2], e[1]) }, false},
+		{"renumbered", func(e []Entry) []Entry { e[2].Seq = 7; return e }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.change(append([]Entry(nil), good...))
+			if err := Verify(entries); (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lock does nothing where there is no flock, only mu keeps the appends
+// of one process apart there
+func lock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package audit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock waits for an exclusive lock on the log file, which holds across
+// processes. The TUI, go-mailer queue flush and serve can all be sending
+// at once, and each has to see the entry the one before it appended.
+// Closing the file lets go of the lock.
+func lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
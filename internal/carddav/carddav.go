@@ -0,0 +1,96 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/contacts"
+	"github.com/aidk/go-mailer/internal/vcard"
+)
+
+// maxResults is how many cards we ask the server for, enough to pick from while typing
+const maxResults = 20
+
+// queryTemplate is an addressbook-query REPORT, see RFC 6352 section 8.6.
+// It asks for the cards whose name or any address contains the query.
+const queryTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:prop><C:address-data/></D:prop>
+  <C:filter test="anyof">
+    <C:prop-filter name="FN"><C:text-match match-type="contains">%[1]s</C:text-match></C:prop-filter>
+    <C:prop-filter name="EMAIL"><C:text-match match-type="contains">%[1]s</C:text-match></C:prop-filter>
+  </C:filter>
+  <C:limit><C:nresults>%[2]d</C:nresults></C:limit>
+</C:addressbook-query>`
+
+// multistatus is the part of the server's reply we care about, the cards
+// themselves are in the address-data of every response
+type multistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			AddressData string `xml:"prop>address-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Search returns the contacts in the address book matching the query
+func Search(ctx context.Context, cfg config.CardDAV, query string) ([]contacts.Contact, error) {
+
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(query))
+	body := fmt.Sprintf(queryTemplate, escaped.String(), maxResults)
+
+	req, err := http.NewRequestWithContext(ctx, "REPORT", cfg.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("carddav: %s replied %s", cfg.URL, resp.Status)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("carddav: could not read the reply: %w", err)
+	}
+
+	var found []contacts.Contact
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if ps.AddressData == "" {
+				continue
+			}
+			// one broken card shouldn't hide all the others
+			cards, err := vcard.Parse(strings.NewReader(ps.AddressData))
+			if err != nil {
+				continue
+			}
+			for _, card := range cards {
+				if len(card.Emails) > 0 {
+					found = append(found, contacts.Contact{Name: card.Name, Emails: card.Emails, Organization: card.Organization})
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
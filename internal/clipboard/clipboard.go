@@ -0,0 +1,121 @@
+package clipboard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when none of the tools that reach the clipboard are installed
+var ErrUnavailable = errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+
+// tool is a command that copies what it reads to the clipboard, and one
+// that prints what is on it
+type tool struct {
+	copy  []string
+	paste []string
+}
+
+// tools returns the clipboard tools that can work here, the best first.
+// Wayland and X11 each have their own clipboard, so it depends on which
+// one the terminal runs under.
+func tools() []tool {
+
+	switch runtime.GOOS {
+	case "darwin":
+		return []tool{{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}}
+	case "windows":
+		return []tool{{
+			copy:  []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+			paste: []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "Get-Clipboard -Raw"},
+		}}
+	}
+
+	var found []tool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		found = append(found, tool{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		found = append(found,
+			tool{copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-out"}},
+			tool{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}},
+		)
+	}
+	// on Android, in Termux
+	found = append(found, tool{copy: []string{"termux-clipboard-set"}, paste: []string{"termux-clipboard-get"}})
+
+	return found
+}
+
+// installed returns the first of the tools that is installed
+func installed() (tool, bool) {
+	for _, t := range tools() {
+		if _, err := exec.LookPath(t.copy[0]); err == nil {
+			return t, true
+		}
+	}
+	return tool{}, false
+}
+
+// Read returns what is on the clipboard
+func Read() (string, error) {
+
+	t, ok := installed()
+	if !ok {
+		return "", ErrUnavailable
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(t.paste[0], t.paste[1:]...)
+	cmd.Stdout = &stdout
+	if err := run(cmd); err != nil {
+		return "", err
+	}
+
+	// Windows ends its lines with \r\n, a message ends them with \n
+	return strings.ReplaceAll(stdout.String(), "\r\n", "\n"), nil
+}
+
+// Write puts the text on the clipboard
+func Write(text string) error {
+
+	t, ok := installed()
+	if !ok {
+		return ErrUnavailable
+	}
+
+	// xclip and wl-copy stay in the background to hand out what was copied,
+	// holding on to their output, so we don't wait for it
+	cmd := exec.Command(t.copy[0], t.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// run runs the tool, and says what it said when it fails
+func run(cmd *exec.Cmd) error {
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s failed: %s", cmd.Args[0], msg)
+		}
+		return fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// OSC52 returns the sequence that asks the terminal to put the text on the
+// clipboard itself. It works without any tool and even over ssh, in the
+// terminals that allow it.
+func OSC52(text string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
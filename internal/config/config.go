@@ -0,0 +1,1074 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aidk/go-mailer/internal/paths"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// Config is the top level configuration for the program
+// it is loaded from a TOML file in the user's home directory
+type Config struct {
+	// UndoSend is how many seconds a sent message is held back
+	// so it can still be cancelled, 0 sends straight away
+	UndoSend int `toml:"undo_send"`
+
+	// Flowed sends the text of messages as format=flowed, wrapped at Wrap
+	// columns (72 if it isn't set), so long paragraphs reflow nicely in the
+	// recipients' clients but still read well as plain text
+	Flowed bool `toml:"flowed"`
+	Wrap   int  `toml:"wrap"`
+
+	// Encoding is how the text parts of messages are encoded, see the
+	// email.Encoding constants. "auto" (the default) picks for each part.
+	Encoding string `toml:"encoding"`
+
+	// SizeLimit is how many megabytes a message can be before we warn
+	// that it may be too big to be delivered, 25 if it isn't set
+	SizeLimit int `toml:"size_limit"`
+
+	// Dictionary turns on spell checking, it is the name of a hunspell
+	// dictionary like "en_US" or the path of its .dic file
+	Dictionary string `toml:"dictionary"`
+
+	// Keys changes the keys of the compose view, e.g. send = "ctrl+j" or
+	// next = ["tab", "down"], the actions that aren't in it keep their keys
+	Keys map[string]Keys `toml:"keys"`
+
+	// Vim makes the compose view modal like vim, keys move between the
+	// fields in normal mode and only type in insert mode
+	Vim bool `toml:"vim"`
+
+	// Mouse lets the fields be clicked and the body scrolled with the
+	// wheel, go-mailer takes up the whole terminal while it is on
+	Mouse bool `toml:"mouse"`
+
+	// Theme sets the colors, see theme.go
+	Theme Theme `toml:"theme"`
+
+	// LogLevel is how much goes in go-mailer.log in the data directory, one of
+	// "debug", "info" (the default), "warn" or "error". With "debug" the
+	// dialogue with the SMTP servers is logged too, like with --verbose.
+	LogLevel string `toml:"log_level"`
+
+	// CheckRecipients looks up the domains of the recipients once the To
+	// field is left, to warn about those that can't receive mail. It is one
+	// of the Check constants, "off" (the default), "mx" or "probe".
+	CheckRecipients string `toml:"check_recipients"`
+
+	// Images is how the reader shows images, one of the Images constants.
+	// "auto" (the default) picks the protocol of the terminals known to
+	// show images, and leaves them out in the others.
+	Images string `toml:"images"`
+
+	// Notmuch searches the mail with notmuch rather than go-mailer's own
+	// index, in notmuch's query syntax, and lets the messages found be
+	// tagged. The account's store has to be under notmuch's database.path.
+	Notmuch bool `toml:"notmuch"`
+
+	// Notify shows a desktop notification when new mail arrives or the
+	// outbox is sent in the background, while go-mailer isn't the window in
+	// front. It needs notify-send on Linux.
+	Notify bool `toml:"notify"`
+
+	// Accessible suits the TUI to a screen reader, with no colors, borders
+	// or animations, and the field being edited and any errors said in words
+	Accessible bool `toml:"accessible"`
+
+	// Language is the language of the TUI, like "de" or "pt_BR". Without
+	// it the TUI follows LANG, and speaks English when there's no
+	// translation for that.
+	Language string `toml:"language"`
+
+	// SpamCheck scores the message before it is sent, to show what spam
+	// filters may hold against it. It is one of the Spam constants, "off"
+	// (the default), "builtin" or "spamassassin".
+	SpamCheck string `toml:"spam_check"`
+
+	// Encrypt keeps drafts, the outbox and the sent mail and its history
+	// encrypted with a key derived from a passphrase, which is asked for
+	// when go-mailer starts. Only go-mailer can read them then.
+	Encrypt bool `toml:"encrypt"`
+
+	Accounts []Account `toml:"accounts"`
+}
+
+// the ways the recipients can be checked before a message is sent
+const (
+	CheckOff   = "off"   // don't check them
+	CheckMX    = "mx"    // check their domains have somewhere to deliver mail to
+	CheckProbe = "probe" // ask the domain's mail server about each address too
+)
+
+// the ways a message can be scored for spam before it is sent
+const (
+	SpamOff          = "off"          // don't score it
+	SpamBuiltin      = "builtin"      // go-mailer's own rules
+	SpamSpamAssassin = "spamassassin" // a local SpamAssassin, through spamc
+)
+
+// the ways images can be shown in the terminal
+const (
+	ImagesAuto  = "auto"  // use the protocol of the terminal, if we know it
+	ImagesKitty = "kitty" // the Kitty graphics protocol
+	ImagesSixel = "sixel" // sixel graphics
+	ImagesOff   = "off"   // don't show images
+)
+
+// Keys is the keys an action is bound to, written as one key or a list of them
+type Keys []string
+
+// UnmarshalTOML lets a single key be written without the brackets of a list
+func (k *Keys) UnmarshalTOML(v interface{}) error {
+
+	switch v := v.(type) {
+	case string:
+		*k = Keys{v}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("keys should be strings like \"ctrl+s\", not %v", item)
+			}
+			*k = append(*k, s)
+		}
+	default:
+		return fmt.Errorf("keys should be a string like \"ctrl+s\" or a list of them, not %v", v)
+	}
+
+	return nil
+}
+
+// the backends an account can use to read and send mail
+const (
+	BackendIMAP = "imap" // IMAP for reading and SMTP for sending
+	BackendJMAP = "jmap" // JMAP for both
+	BackendPOP3 = "pop3" // POP3 for downloading mail and SMTP for sending
+)
+
+// the ways we can check the SMTP server's MTA-STS and DANE policies before sending
+const (
+	TLSPolicyNone          = "none"          // don't look for policies at all
+	TLSPolicyOpportunistic = "opportunistic" // honor the policies we find, ignore the lookups that fail
+	TLSPolicyStrict        = "strict"        // a failed lookup stops the message, testing policies are enforced too
+)
+
+// Account holds the settings for a single mail account
+type Account struct {
+	Name    string `toml:"name"`
+	Address string `toml:"address"`
+
+	// ReplyTo is where replies should go when that isn't the From address,
+	// a message can still set its own Reply-To in the headers panel
+	ReplyTo string `toml:"reply_to"`
+
+	// Backend is one of "imap" (the default), "jmap" or "pop3"
+	Backend string `toml:"backend"`
+
+	// Maildir is where the account's local mail is kept, it defaults to
+	// mail/<name> in the data directory but can point at an existing maildir tree
+	Maildir string `toml:"maildir"`
+
+	IMAP  IMAP  `toml:"imap"`
+	SMTP  SMTP  `toml:"smtp"`
+	JMAP  JMAP  `toml:"jmap"`
+	Gmail Gmail `toml:"gmail"`
+	Graph Graph `toml:"graph"`
+	POP3  POP3  `toml:"pop3"`
+	PGP   PGP   `toml:"pgp"`
+	SMIME SMIME `toml:"smime"`
+	DKIM  DKIM  `toml:"dkim"`
+
+	Signature Signature `toml:"signature"`
+	Receipts  Receipts  `toml:"receipts"`
+
+	// Webhook is told how the mail sent from the outbox and by go-mailer serve went
+	Webhook Webhook `toml:"webhook"`
+
+	// Hooks are programs run before and after every message is sent
+	Hooks Hooks `toml:"hooks"`
+
+	// CardDAV and LDAP are directories searched for addresses as you type them
+	CardDAV CardDAV `toml:"carddav"`
+	LDAP    LDAP    `toml:"ldap"`
+
+	// Identities are the other addresses the account sends as, through the
+	// same server and with the same login
+	Identities []Identity `toml:"identities"`
+}
+
+// Identity is a name and address an account sends as, e.g. support@ next
+// to the account's own personal@
+type Identity struct {
+	Name    string `toml:"name"`
+	Address string `toml:"address"`
+	ReplyTo string `toml:"reply_to"`
+
+	// Signature is added to messages from this identity, the account's
+	// signature is used when it has none of its own
+	Signature Signature `toml:"signature"`
+}
+
+// From returns the identity the way it is written in the From field
+func (i Identity) From() string {
+	if i.Name == "" {
+		return i.Address
+	}
+	return i.Name + " <" + i.Address + ">"
+}
+
+// Senders returns every identity the account sends as, starting with the
+// account's own address
+func (a Account) Senders() []Identity {
+
+	senders := []Identity{{Address: a.Address, ReplyTo: a.ReplyTo, Signature: a.Signature}}
+	for _, id := range a.Identities {
+		if !id.Signature.Enabled() {
+			id.Signature = a.Signature
+		}
+		senders = append(senders, id)
+	}
+
+	return senders
+}
+
+// Sender returns the identity with the address of from. When from isn't
+// one of them it returns the account's own, and false.
+func (a Account) Sender(from string) (Identity, bool) {
+
+	senders := a.Senders()
+	if addr, err := mail.ParseAddress(from); err == nil {
+		for _, id := range senders {
+			if own, err := mail.ParseAddress(id.Address); err == nil && strings.EqualFold(own.Address, addr.Address) {
+				return id, true
+			}
+		}
+	}
+
+	return senders[0], false
+}
+
+// BackendName returns the configured backend or imap if none was set
+func (a Account) BackendName() string {
+	if a.Backend == "" {
+		return BackendIMAP
+	}
+	return a.Backend
+}
+
+// StoreDir returns the directory where the account's local mail is kept
+func (a Account) StoreDir() (string, error) {
+
+	if a.Maildir != "" {
+		return ExpandHome(a.Maildir)
+	}
+
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "mail", a.slug()), nil
+}
+
+// OutboxDir returns the directory where the account's unsent messages are queued
+func (a Account) OutboxDir() (string, error) {
+
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "outbox", a.slug()), nil
+}
+
+// GraphTokenPath returns the file the account's Microsoft Graph refresh
+// token is kept in, see Graph
+func (a Account) GraphTokenPath() (string, error) {
+
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "graph", a.slug()+".json"), nil
+}
+
+// slug returns the account's name in a form that is safe to use in a path
+func (a Account) slug() string {
+
+	name := a.Name
+	if name == "" {
+		name = a.Address
+	}
+
+	// the name ends up in a path, so we make sure it can't point anywhere else
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		name = "default"
+	}
+
+	return name
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(path string) (string, error) {
+
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// IMAP holds the connection settings for an IMAP server
+type IMAP struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// Mailbox is the mailbox shown in the inbox view, defaults to INBOX
+	Mailbox string `toml:"mailbox"`
+
+	// Insecure disables TLS, this should only be used for local testing
+	Insecure bool `toml:"insecure"`
+}
+
+// Enabled reports whether the IMAP settings have been filled in
+func (i IMAP) Enabled() bool {
+	return i.Host != ""
+}
+
+// Addr returns the host:port address of the IMAP server
+func (i IMAP) Addr() string {
+	port := i.Port
+	if port == 0 {
+		// 993 is the default port for IMAP over TLS, 143 is plain IMAP
+		port = 993
+		if i.Insecure {
+			port = 143
+		}
+	}
+	return fmt.Sprintf("%s:%d", i.Host, port)
+}
+
+// MailboxName returns the configured mailbox or INBOX if none was set
+func (i IMAP) MailboxName() string {
+	if i.Mailbox == "" {
+		return "INBOX"
+	}
+	return i.Mailbox
+}
+
+// SMTP holds the connection settings for an SMTP server
+type SMTP struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// Insecure allows sending without TLS, this should only be used for local testing
+	Insecure bool `toml:"insecure"`
+
+	// TLSPolicy is one of "none" (the default), "opportunistic" or
+	// "strict", see the TLSPolicy constants
+	TLSPolicy string `toml:"tls_policy"`
+
+	// ReturnPath is the envelope sender given in MAIL FROM, where bounces
+	// go. It defaults to the From address of the message.
+	ReturnPath string `toml:"return_path"`
+
+	// PoolSize is how many connections are kept open between messages, one
+	// unless it is set, and -1 connects again for every message.
+	// IdleTimeout is how many seconds an unused connection is kept, 30 by default.
+	PoolSize    int `toml:"pool_size"`
+	IdleTimeout int `toml:"idle_timeout"`
+}
+
+// Enabled reports whether the SMTP settings have been filled in
+func (s SMTP) Enabled() bool {
+	return s.Host != ""
+}
+
+// Addr returns the host:port address of the SMTP server
+func (s SMTP) Addr() string {
+	port := s.Port
+	if port == 0 {
+		// 587 is the submission port, we upgrade to TLS with STARTTLS
+		port = 587
+	}
+	return fmt.Sprintf("%s:%d", s.Host, port)
+}
+
+// Pool returns how many connections to keep open between messages, 0 for none
+func (s SMTP) Pool() int {
+	switch {
+	case s.PoolSize < 0:
+		return 0
+	case s.PoolSize == 0:
+		return 1
+	}
+	return s.PoolSize
+}
+
+// Idle returns how long an unused connection is kept open
+func (s SMTP) Idle() time.Duration {
+	if s.IdleTimeout == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.IdleTimeout) * time.Second
+}
+
+// TLSPolicyName returns the configured TLS policy mode or none if none was set
+func (s SMTP) TLSPolicyName() string {
+	if s.TLSPolicy == "" {
+		return TLSPolicyNone
+	}
+	return s.TLSPolicy
+}
+
+// ImplicitTLS reports whether we should connect with TLS straight away instead of using STARTTLS
+func (s SMTP) ImplicitTLS() bool {
+	return s.Port == 465
+}
+
+// JMAP holds the settings for a JMAP server such as Fastmail
+type JMAP struct {
+	// SessionURL is where the JMAP session resource lives,
+	// e.g. https://api.fastmail.com/jmap/session
+	SessionURL string `toml:"session_url"`
+
+	// Token is used for bearer authentication, if it is empty we fall
+	// back to basic authentication with the username and password
+	Token    string `toml:"token"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// Enabled reports whether the JMAP settings have been filled in
+func (j JMAP) Enabled() bool {
+	return j.SessionURL != ""
+}
+
+// Gmail sends the account's mail through the Gmail API instead of SMTP,
+// for workspaces where SMTP is turned off. ClientID and ClientSecret are
+// those of an OAuth client of the desktop kind, and RefreshToken is what
+// go-mailer gmail-auth prints once access has been granted.
+type Gmail struct {
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RefreshToken string `toml:"refresh_token"`
+}
+
+// Enabled reports whether the Gmail settings have been filled in
+func (g Gmail) Enabled() bool {
+	return g.ClientID != ""
+}
+
+// Graph sends the account's mail through Microsoft Graph instead of SMTP,
+// for Microsoft 365 tenants that turn SMTP AUTH off. ClientID is the
+// application registered in the tenant. Without ClientSecret go-mailer
+// sends as the user who signed in with go-mailer graph-auth, with it the
+// application sends as the account's address itself (app-only), which
+// needs the Mail.Send application permission.
+type Graph struct {
+	// Tenant is the tenant's id or one of its domains, "organizations"
+	// lets anyone from a work or school account sign in
+	Tenant       string `toml:"tenant"`
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+}
+
+// Enabled reports whether the Graph settings have been filled in
+func (g Graph) Enabled() bool {
+	return g.ClientID != ""
+}
+
+// AppOnly reports whether the application sends on its own, rather than for a signed in user
+func (g Graph) AppOnly() bool {
+	return g.ClientSecret != ""
+}
+
+// TenantName returns the configured tenant or organizations if none was set
+func (g Graph) TenantName() string {
+	if g.Tenant == "" {
+		return "organizations"
+	}
+	return g.Tenant
+}
+
+// CardDAV holds the settings for an address book on a CardDAV server
+type CardDAV struct {
+	// URL is the address book collection itself, e.g.
+	// https://dav.example.com/addressbooks/ann/contacts/
+	URL      string `toml:"url"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// Enabled reports whether the CardDAV settings have been filled in
+func (c CardDAV) Enabled() bool {
+	return c.URL != ""
+}
+
+// LDAP holds the settings for an LDAP directory, such as a company's
+type LDAP struct {
+	// URL is ldaps://host for TLS straight away or ldap://host, which
+	// switches to TLS with StartTLS unless insecure is set
+	URL      string `toml:"url"`
+	BaseDN   string `toml:"base_dn"`
+	Insecure bool   `toml:"insecure"`
+
+	// BindDN and Password log in, without them we search anonymously
+	BindDN   string `toml:"bind_dn"`
+	Password string `toml:"password"`
+}
+
+// Enabled reports whether the LDAP settings have been filled in
+func (l LDAP) Enabled() bool {
+	return l.URL != "" && l.BaseDN != ""
+}
+
+// POP3 holds the connection settings for a POP3 server
+type POP3 struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// LeaveOnServer keeps downloaded messages on the server instead of deleting them,
+	// we use UIDL to avoid downloading them again
+	LeaveOnServer bool `toml:"leave_on_server"`
+
+	// Insecure disables TLS, this should only be used for local testing
+	Insecure bool `toml:"insecure"`
+}
+
+// Enabled reports whether the POP3 settings have been filled in
+func (p POP3) Enabled() bool {
+	return p.Host != ""
+}
+
+// Addr returns the host:port address of the POP3 server
+func (p POP3) Addr() string {
+	port := p.Port
+	if port == 0 {
+		// 995 is the default port for POP3 over TLS, 110 is plain POP3
+		port = 995
+		if p.Insecure {
+			port = 110
+		}
+	}
+	return fmt.Sprintf("%s:%d", p.Host, port)
+}
+
+// PGP holds the OpenPGP defaults for new messages, the keys themselves
+// live in the GnuPG keyring and are used through the gpg command
+type PGP struct {
+	// Sign and Encrypt turn signing and encrypting on for every new
+	// message, both can still be toggled per message
+	Sign    bool `toml:"sign"`
+	Encrypt bool `toml:"encrypt"`
+
+	// Key is the key to sign with, it defaults to the key for the sender's address
+	Key string `toml:"key"`
+
+	// Discover is where the keys of recipients the keyring has no key for
+	// are looked up, in order: "wkd" for the Web Key Directory of their own
+	// domain, and keyservers like "hkps://keys.openpgp.org". It defaults to
+	// just "wkd", an empty list turns looking up keys off.
+	Discover []string `toml:"discover"`
+}
+
+// KeySources returns where the recipients' keys are looked up, see Discover
+func (p PGP) KeySources() []string {
+	if p.Discover == nil {
+		return []string{KeySourceWKD}
+	}
+	return p.Discover
+}
+
+// KeySourceWKD is the Web Key Directory in the pgp discover setting
+const KeySourceWKD = "wkd"
+
+// Receipts are the receipts every new message of the account asks for,
+// both can still be toggled per message
+type Receipts struct {
+	// Read asks the recipient's mail client to say when the message is read
+	Read bool `toml:"read"`
+
+	// Delivery asks the servers on the way to say whether the message was
+	// delivered, it only works over SMTP and with servers that offer it
+	Delivery bool `toml:"delivery"`
+}
+
+// Webhook is a URL we post to when a message sent in the background went
+// out, was put off for another try or was refused for good
+type Webhook struct {
+	URL string `toml:"url"`
+
+	// Secret signs every post, the X-Go-Mailer-Signature header holds the
+	// HMAC-SHA256 of the body made with it
+	Secret string `toml:"secret"`
+}
+
+// Enabled reports whether a webhook has been set up
+func (w Webhook) Enabled() bool {
+	return w.URL != ""
+}
+
+// Hooks are programs that are given every message the account sends, as
+// an .eml file on stdin, with what it is about in GO_MAILER_ variables
+type Hooks struct {
+	// PreSend run before the message goes out, in order. One that exits
+	// with an error stops the message, one that prints a message sends
+	// that instead.
+	PreSend []string `toml:"pre_send"`
+
+	// PostSend run once it has gone out or failed to, to log it somewhere
+	// or tell a CRM, they can't change anything
+	PostSend []string `toml:"post_send"`
+
+	// Timeout is how many seconds each hook has, 10 by default
+	Timeout int `toml:"timeout"`
+}
+
+// TimeLimit returns how long each hook has before it is stopped
+func (h Hooks) TimeLimit() time.Duration {
+	if h.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+// SMIME holds the S/MIME certificate we sign outgoing mail with
+type SMIME struct {
+	// Certificate is the path of a PKCS#12 (.p12 or .pfx) file holding
+	// the certificate and its private key, a leading ~ is expanded
+	Certificate string `toml:"certificate"`
+	Password    string `toml:"password"`
+
+	// Sign turns signing on for every message that isn't protected with PGP
+	Sign bool `toml:"sign"`
+}
+
+// Enabled reports whether messages should be signed with S/MIME
+func (s SMIME) Enabled() bool {
+	return s.Sign && s.Certificate != ""
+}
+
+// CertificatePath returns the path of the PKCS#12 file with ~ expanded
+func (s SMIME) CertificatePath() (string, error) {
+	return ExpandHome(s.Certificate)
+}
+
+// DKIM holds the key mail sent over SMTP is signed with, for servers that
+// relay mail without signing it themselves
+type DKIM struct {
+	// Domain is the d= of the signature, it defaults to the domain of the account's address
+	Domain string `toml:"domain"`
+
+	// Selector names the DNS record the public key is published in,
+	// <selector>._domainkey.<domain>
+	Selector string `toml:"selector"`
+
+	// PrivateKey is the path of a PEM encoded RSA or Ed25519 key, a leading ~ is expanded
+	PrivateKey string `toml:"private_key"`
+}
+
+// Enabled reports whether the DKIM settings have been filled in
+func (d DKIM) Enabled() bool {
+	return d.Selector != "" && d.PrivateKey != ""
+}
+
+// KeyPath returns the path of the private key with ~ expanded
+func (d DKIM) KeyPath() (string, error) {
+	return ExpandHome(d.PrivateKey)
+}
+
+// Signature is added below the body of every message sent from the account
+type Signature struct {
+	// Text is the plain text signature, or File the path of a file holding it
+	Text string `toml:"text"`
+	File string `toml:"file"`
+
+	// HTML is the signature shown by clients that prefer HTML, or HTMLFile
+	// the path of a file holding it. With one of these set, messages get
+	// an HTML version of the body too.
+	HTML     string `toml:"html"`
+	HTMLFile string `toml:"html_file"`
+}
+
+// Enabled reports whether the account has a signature
+func (s Signature) Enabled() bool {
+	return s.Text != "" || s.File != "" || s.HTML != "" || s.HTMLFile != ""
+}
+
+// Plain returns the plain text signature, reading it from its file if there is one
+func (s Signature) Plain() (string, error) {
+	return signatureText(s.Text, s.File)
+}
+
+// HTMLText returns the HTML signature, reading it from its file if there is one
+func (s Signature) HTMLText() (string, error) {
+	return signatureText(s.HTML, s.HTMLFile)
+}
+
+// signatureText returns text, or the contents of the file if text is empty
+func signatureText(text, file string) (string, error) {
+
+	if text != "" || file == "" {
+		return strings.TrimRight(text, "\n"), nil
+	}
+
+	path, err := ExpandHome(file)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read signature: %w", err)
+	}
+
+	return strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), nil
+}
+
+// TemplatesDir returns the directory message templates are kept in
+func TemplatesDir() (string, error) {
+	dir, err := paths.Config()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// ContactsPath returns the path of the address book
+func ContactsPath() (string, error) {
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "contacts.json"), nil
+}
+
+// KeyPath returns the path of the file the encryption key is derived with,
+// see Encrypt
+func KeyPath() (string, error) {
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "key.json"), nil
+}
+
+// AuditPath returns the path of the audit log of the mail sent
+func AuditPath() (string, error) {
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// LogPath returns the path of the log file
+func LogPath() (string, error) {
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-mailer.log"), nil
+}
+
+// WordsPath returns the path of the file with the words the user added to the dictionary
+func WordsPath() (string, error) {
+	dir, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "words.txt"), nil
+}
+
+// DefaultPath returns the path of the config file
+func DefaultPath() (string, error) {
+	dir, err := paths.Config()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// Load reads the config file at the given path
+// a missing file is not an error, we simply return an empty config
+func Load(path string) (*Config, error) {
+	var cfg Config
+
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &cfg, nil
+		}
+		return nil, fmt.Errorf("could not load config: %w", err)
+	}
+
+	if cfg.UndoSend < 0 {
+		return nil, fmt.Errorf("undo_send can't be negative")
+	}
+
+	if cfg.SizeLimit < 0 {
+		return nil, fmt.Errorf("size_limit can't be negative")
+	}
+
+	// RFC 5322 doesn't allow lines longer than 998 characters
+	if cfg.Wrap != 0 && (cfg.Wrap < 20 || cfg.Wrap > 998) {
+		return nil, fmt.Errorf("wrap must be between 20 and 998")
+	}
+
+	switch cfg.Encoding {
+	case "", email.EncodingAuto, email.EncodingQuotedPrintable, email.EncodingBase64:
+	default:
+		return nil, fmt.Errorf("unknown encoding %q, it should be %q, %q or %q", cfg.Encoding, email.EncodingAuto, email.EncodingQuotedPrintable, email.EncodingBase64)
+	}
+
+	switch strings.ToLower(cfg.LogLevel) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return nil, fmt.Errorf("unknown log_level %q, it should be debug, info, warn or error", cfg.LogLevel)
+	}
+
+	switch cfg.CheckRecipients {
+	case "", CheckOff, CheckMX, CheckProbe:
+	default:
+		return nil, fmt.Errorf("unknown check_recipients %q, it should be %q, %q or %q", cfg.CheckRecipients, CheckOff, CheckMX, CheckProbe)
+	}
+
+	switch cfg.SpamCheck {
+	case "", SpamOff, SpamBuiltin, SpamSpamAssassin:
+	default:
+		return nil, fmt.Errorf("unknown spam_check %q, it should be %q, %q or %q", cfg.SpamCheck, SpamOff, SpamBuiltin, SpamSpamAssassin)
+	}
+
+	switch cfg.Images {
+	case "", ImagesAuto, ImagesKitty, ImagesSixel, ImagesOff:
+	default:
+		return nil, fmt.Errorf("unknown images %q, it should be %q, %q, %q or %q", cfg.Images, ImagesAuto, ImagesKitty, ImagesSixel, ImagesOff)
+	}
+
+	if _, err := cfg.Theme.Colors(); err != nil {
+		return nil, fmt.Errorf("theme: %w", err)
+	}
+
+	for _, a := range cfg.Accounts {
+		switch a.BackendName() {
+		case BackendIMAP, BackendJMAP, BackendPOP3:
+		default:
+			return nil, fmt.Errorf("account %q: unknown backend %q", a.Name, a.Backend)
+		}
+
+		if a.SMTP.IdleTimeout < 0 {
+			return nil, fmt.Errorf("account %q: idle_timeout can't be negative", a.Name)
+		}
+		if a.Hooks.Timeout < 0 {
+			return nil, fmt.Errorf("account %q: the hooks' timeout can't be negative", a.Name)
+		}
+
+		switch a.SMTP.TLSPolicyName() {
+		case TLSPolicyNone, TLSPolicyOpportunistic, TLSPolicyStrict:
+		default:
+			return nil, fmt.Errorf("account %q: unknown tls_policy %q", a.Name, a.SMTP.TLSPolicy)
+		}
+
+		if a.ReplyTo != "" {
+			if _, err := mail.ParseAddressList(a.ReplyTo); err != nil {
+				return nil, fmt.Errorf("account %q: invalid reply_to %q", a.Name, a.ReplyTo)
+			}
+		}
+		for _, id := range a.Identities {
+			if _, err := mail.ParseAddress(id.Address); err != nil {
+				return nil, fmt.Errorf("account %q: invalid identity address %q", a.Name, id.Address)
+			}
+			if id.ReplyTo != "" {
+				if _, err := mail.ParseAddressList(id.ReplyTo); err != nil {
+					return nil, fmt.Errorf("account %q: invalid reply_to %q for %s", a.Name, id.ReplyTo, id.Address)
+				}
+			}
+		}
+		if a.Webhook.Enabled() {
+			u, err := url.Parse(a.Webhook.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("account %q: invalid webhook url %q", a.Name, a.Webhook.URL)
+			}
+		}
+		for _, source := range a.PGP.Discover {
+			if source == KeySourceWKD {
+				continue
+			}
+			u, err := url.Parse(source)
+			if err != nil || (u.Scheme != "hkp" && u.Scheme != "hkps" && u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("account %q: pgp discover %q should be %q or a keyserver like hkps://keys.openpgp.org", a.Name, source, KeySourceWKD)
+			}
+		}
+		if a.SMTP.ReturnPath != "" {
+			if _, err := mail.ParseAddress(a.SMTP.ReturnPath); err != nil {
+				return nil, fmt.Errorf("account %q: invalid return_path %q", a.Name, a.SMTP.ReturnPath)
+			}
+		}
+		if a.Gmail.Enabled() && a.BackendName() == BackendJMAP {
+			return nil, fmt.Errorf("account %q: gmail can't send for a jmap account", a.Name)
+		}
+		if a.Graph.Enabled() && a.BackendName() == BackendJMAP {
+			return nil, fmt.Errorf("account %q: graph can't send for a jmap account", a.Name)
+		}
+		if a.Graph.Enabled() && a.Gmail.Enabled() {
+			return nil, fmt.Errorf("account %q: mail can be sent through gmail or graph, not both", a.Name)
+		}
+		if a.Graph.AppOnly() && a.Graph.Tenant == "" {
+			return nil, fmt.Errorf("account %q: graph needs the tenant to send with a client_secret", a.Name)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Account returns the account with the given name, or the default
+// account if name is empty
+func (c *Config) Account(name string) (*Account, error) {
+
+	if name == "" {
+		if a := c.DefaultAccount(); a != nil {
+			return a, nil
+		}
+		return nil, fmt.Errorf("no account configured")
+	}
+
+	for i := range c.Accounts {
+		if c.Accounts[i].Name == name {
+			return &c.Accounts[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no account named %q", name)
+}
+
+// UndoDelay returns how long sent messages are held back for
+func (c *Config) UndoDelay() time.Duration {
+	return time.Duration(c.UndoSend) * time.Second
+}
+
+// MaxSize returns how many bytes a message can be before we warn it is too big
+func (c *Config) MaxSize() int {
+	if c.SizeLimit == 0 {
+		// most providers turn away messages bigger than this
+		return 25 << 20
+	}
+	return c.SizeLimit << 20
+}
+
+// WrapColumn returns the column message text is wrapped at, 0 if it isn't sent as format=flowed
+func (c *Config) WrapColumn() int {
+	if !c.Flowed {
+		return 0
+	}
+	if c.Wrap == 0 {
+		// RFC 3676 suggests 72 or fewer
+		return 72
+	}
+	return c.Wrap
+}
+
+// TextEncoding returns how the text parts of messages are encoded, one of the email.Encoding constants
+func (c *Config) TextEncoding() string {
+	if c.Encoding == "" {
+		return email.EncodingAuto
+	}
+	return c.Encoding
+}
+
+// RecipientChecks returns how the recipients are checked, CheckOff if it isn't set
+func (c *Config) RecipientChecks() string {
+	if c.CheckRecipients == "" {
+		return CheckOff
+	}
+	return c.CheckRecipients
+}
+
+// SpamChecks returns how messages are scored for spam, SpamOff if it isn't set
+func (c *Config) SpamChecks() string {
+	if c.SpamCheck == "" {
+		return SpamOff
+	}
+	return c.SpamCheck
+}
+
+// ImagePreview returns how images are shown, ImagesAuto if it isn't set
+func (c *Config) ImagePreview() string {
+	if c.Images == "" {
+		return ImagesAuto
+	}
+	return c.Images
+}
+
+// Level returns the level of the log, slog.LevelInfo if it isn't set
+func (c *Config) Level() slog.Level {
+	var level slog.Level
+	if c.LogLevel != "" {
+		// the config has already been checked, so the level is one we know
+		level.UnmarshalText([]byte(c.LogLevel))
+	}
+	return level
+}
+
+// DictionaryFiles returns the .dic and .aff files of the spell checking
+// dictionary. A dictionary given by name is looked for in
+// the dictionaries next to the config and then where hunspell keeps its dictionaries.
+func (c *Config) DictionaryFiles() (dic, aff string, err error) {
+
+	if strings.HasSuffix(c.Dictionary, ".dic") {
+		dic, err = ExpandHome(c.Dictionary)
+		if err != nil {
+			return "", "", err
+		}
+		return dic, strings.TrimSuffix(dic, ".dic") + ".aff", nil
+	}
+
+	dirs := []string{"/usr/share/hunspell", "/usr/share/myspell", "/usr/share/myspell/dicts", "/usr/local/share/hunspell", "/opt/homebrew/share/hunspell"}
+	if dir, err := paths.Config(); err == nil {
+		dirs = append([]string{filepath.Join(dir, "dictionaries")}, dirs...)
+	}
+	for _, d := range dirs {
+		dic = filepath.Join(d, c.Dictionary+".dic")
+		if _, err := os.Stat(dic); err == nil {
+			return dic, filepath.Join(d, c.Dictionary+".aff"), nil
+		}
+	}
+
+	dir, _ := paths.Config()
+	return "", "", fmt.Errorf("no dictionary named %s, put %s.dic and %s.aff in %s", c.Dictionary, c.Dictionary, c.Dictionary, filepath.Join(dir, "dictionaries"))
+}
+
+// DefaultAccount returns the first configured account, or nil if there are none
+func (c *Config) DefaultAccount() *Account {
+	if len(c.Accounts) == 0 {
+		return nil
+	}
+	return &c.Accounts[0]
+}
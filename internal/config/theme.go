@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Theme holds the colors of the TUI. Name picks one of the built-in themes,
+// the colors set next to it replace the ones the theme has.
+type Theme struct {
+	Name string `toml:"name"`
+
+	Accent Color `toml:"accent"` // field labels, titles and the selected item
+	Muted  Color `toml:"muted"`  // hints, the help line and messages below the form
+	Error  Color `toml:"error"`  // errors and misspelled words
+	Focus  Color `toml:"focus"`  // the label of the field being edited and the cursor
+	Border Color `toml:"border"` // the border around the body, there is none without it
+}
+
+// Color is a color for terminals with a light background and one for those
+// with a dark background. Written as a single color like "#FF0687" or "205"
+// it is used for both, or as { light = "#D7005F", dark = "#FF0687" }.
+type Color struct {
+	Light string
+	Dark  string
+}
+
+// colorPattern matches the colors a terminal understands, #RGB, #RRGGBB or an ANSI color from 0 to 255
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[0-9]{1,3})$`)
+
+// UnmarshalTOML reads a color written either way
+func (c *Color) UnmarshalTOML(v interface{}) error {
+
+	switch v := v.(type) {
+	case string:
+		c.Light, c.Dark = v, v
+	case map[string]interface{}:
+		for key, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("the %s color should be a string like \"#FF0687\"", key)
+			}
+			switch key {
+			case "light":
+				c.Light = s
+			case "dark":
+				c.Dark = s
+			default:
+				return fmt.Errorf("a color has a light and a dark version, not %s", key)
+			}
+		}
+		// a color only given for one kind of terminal is used for both
+		if c.Light == "" {
+			c.Light = c.Dark
+		}
+		if c.Dark == "" {
+			c.Dark = c.Light
+		}
+	default:
+		return fmt.Errorf("a color should be a string like \"#FF0687\" or { light = \"...\", dark = \"...\" }")
+	}
+
+	for _, s := range []string{c.Light, c.Dark} {
+		if !colorPattern.MatchString(s) {
+			return fmt.Errorf("%q is not a color, use #RRGGBB or a number from 0 to 255", s)
+		}
+	}
+
+	return nil
+}
+
+// IsSet reports whether the color has been given
+func (c Color) IsSet() bool {
+	return c.Light != "" || c.Dark != ""
+}
+
+// same is a color that looks the same on light and dark terminals
+func same(color string) Color {
+	return Color{Light: color, Dark: color}
+}
+
+// Themes are the built-in themes
+var Themes = map[string]Theme{
+	// the hot pink and grey go-mailer has always had
+	"default": {
+		Accent: same("#FF0687"),
+		Muted:  same("#767676"),
+		Error:  same("#FF5F5F"),
+		Focus:  same("#FF0687"),
+	},
+	// blues and greens, darker on a light background so they can still be read
+	"ocean": {
+		Accent: Color{Light: "#005F87", Dark: "#5FAFFF"},
+		Muted:  Color{Light: "#6C6C6C", Dark: "#8A8A8A"},
+		Error:  Color{Light: "#AF0000", Dark: "#FF5F5F"},
+		Focus:  Color{Light: "#008700", Dark: "#5FD787"},
+		Border: Color{Light: "#005F87", Dark: "#5F87AF"},
+	},
+	// the sixteen ANSI colors, which follow the terminal's own color scheme
+	"terminal": {
+		Accent: same("5"),
+		Muted:  same("8"),
+		Error:  same("1"),
+		Focus:  same("6"),
+		Border: same("8"),
+	},
+}
+
+// ThemeNames lists the built-in themes, for error messages
+func ThemeNames() string {
+
+	var names []string
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// Colors returns the colors of the theme, the built-in one it names with the colors set in the config on top
+func (t Theme) Colors() (Theme, error) {
+
+	name := t.Name
+	if name == "" {
+		name = "default"
+	}
+	base, ok := Themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("there is no theme called %q, the themes are %s", t.Name, ThemeNames())
+	}
+	base.Name = name
+
+	for _, c := range []struct {
+		from Color
+		to   *Color
+	}{
+		{t.Accent, &base.Accent},
+		{t.Muted, &base.Muted},
+		{t.Error, &base.Error},
+		{t.Focus, &base.Focus},
+		{t.Border, &base.Border},
+	} {
+		if c.from.IsSet() {
+			*c.to = c.from
+		}
+	}
+
+	return base, nil
+}
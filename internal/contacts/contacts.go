@@ -0,0 +1,166 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Contact is someone in the address book
+type Contact struct {
+	Name         string   `json:"name"`
+	Emails       []string `json:"emails"`
+	Organization string   `json:"organization,omitempty"`
+}
+
+// Book is the address book, kept as a JSON file
+type Book struct {
+	path     string
+	Contacts []Contact
+}
+
+// Open reads the address book at path, a missing file is an empty book
+func Open(path string) (*Book, error) {
+
+	b := &Book{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &b.Contacts); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Add puts a contact in the book. Someone already in it, going by their
+// addresses, is merged with the new details rather than added twice.
+// It reports whether the contact is a new one.
+func (b *Book) Add(c Contact) bool {
+
+	for i := range b.Contacts {
+		existing := &b.Contacts[i]
+		if !existing.shares(c) {
+			continue
+		}
+
+		if c.Name != "" {
+			existing.Name = c.Name
+		}
+		if c.Organization != "" {
+			existing.Organization = c.Organization
+		}
+		for _, addr := range c.Emails {
+			if !existing.has(addr) {
+				existing.Emails = append(existing.Emails, addr)
+			}
+		}
+		return false
+	}
+
+	b.Contacts = append(b.Contacts, c)
+	return true
+}
+
+// shares reports whether the contacts have an address in common
+func (c Contact) shares(o Contact) bool {
+	for _, addr := range o.Emails {
+		if c.has(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// has reports whether the contact has the address, addresses are compared ignoring case
+func (c Contact) has(addr string) bool {
+	for _, a := range c.Emails {
+		if strings.EqualFold(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the book back to its file, sorted by name
+func (b *Book) Save() error {
+
+	sort.SliceStable(b.Contacts, func(i, j int) bool {
+		return strings.ToLower(b.Contacts[i].Name) < strings.ToLower(b.Contacts[j].Name)
+	})
+
+	data, err := json.MarshalIndent(b.Contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil {
+		return err
+	}
+
+	// we write a new file and move it into place, so a crash can't leave half a book behind
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.path)
+}
+
+// Search returns the contacts whose name or an address contains the query,
+// ignoring case. Those where it is the start of a word come first, they are
+// most likely the ones being typed.
+func (b *Book) Search(query string) []Contact {
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var starts, contains []Contact
+	for _, c := range b.Contacts {
+		switch c.match(query) {
+		case matchStart:
+			starts = append(starts, c)
+		case matchAnywhere:
+			contains = append(contains, c)
+		}
+	}
+
+	return append(starts, contains...)
+}
+
+// how well a contact matches a search
+const (
+	matchNone = iota
+	matchAnywhere
+	matchStart
+)
+
+// match reports how well the contact matches a lower case query
+func (c Contact) match(query string) int {
+
+	best := matchNone
+	for _, field := range append([]string{c.Name}, c.Emails...) {
+		field = strings.ToLower(field)
+		i := strings.Index(field, query)
+		if i < 0 {
+			continue
+		}
+		if i == 0 || strings.ContainsRune(" .-_@", rune(field[i-1])) {
+			return matchStart
+		}
+		best = matchAnywhere
+	}
+
+	return best
+}
@@ -0,0 +1,76 @@
+package desktop
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Notify shows a desktop notification, with the tools each system comes with:
+// notify-send, which talks to the notification daemon over D-Bus, on
+// Linux and the BSDs, osascript on macOS and PowerShell's toasts on Windows
+func Notify(title, body string) error {
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleString(body), appleString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript(title, body))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=go-mailer", "--", title, body)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s failed: %s", cmd.Args[0], msg)
+		}
+		return fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// appleString quotes s as an AppleScript string
+func appleString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// toastScript is the PowerShell that shows a toast with the title and body.
+// The texts go into XML inside a PowerShell string, so they're escaped for both.
+func toastScript(title, body string) string {
+
+	text := func(s string) string {
+		var b strings.Builder
+		for _, r := range s {
+			switch r {
+			case '<':
+				b.WriteString("&lt;")
+			case '>':
+				b.WriteString("&gt;")
+			case '&':
+				b.WriteString("&amp;")
+			case '"':
+				b.WriteString("&quot;")
+			case '\'':
+				// a single quote ends a PowerShell string unless it is doubled
+				b.WriteString("''")
+			default:
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+
+	return `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$xml = New-Object Windows.Data.Xml.Dom.XmlDocument
+$xml.LoadXml('<toast><visual><binding template="ToastGeneric"><text>` + text(title) + `</text><text>` + text(body) + `</text></binding></visual></toast>')
+$toast = New-Object Windows.UI.Notifications.ToastNotification $xml
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('go-mailer').Show($toast)`
+}
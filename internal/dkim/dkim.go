@@ -0,0 +1,235 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// signedHeaders are the headers we sign when the message has them. From
+// is listed twice, so nobody can add a second From without breaking the
+// signature, as RFC 6376 section 8.15 suggests. One-click unsubscribing
+// only counts when the List-Unsubscribe headers are signed (RFC 8058).
+var signedHeaders = []string{
+	"From", "From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// Signer adds a DKIM-Signature header to messages, see RFC 6376
+type Signer struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+}
+
+// New returns a signer for the domain, using the private key published in
+// DNS at <selector>._domainkey.<domain>. The key is a PEM encoded RSA or
+// Ed25519 key, in PKCS#1 or PKCS#8 form.
+func New(domain, selector string, keyPEM []byte) (*Signer, error) {
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("dkim key is not in PEM format")
+	}
+
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(crypto.Signer); !ok {
+				err = fmt.Errorf("unsupported key type")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read dkim key: %w", err)
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("dkim keys must be RSA or Ed25519")
+	}
+
+	return &Signer{domain: domain, selector: selector, key: key}, nil
+}
+
+// algorithm returns the a= tag for the signer's key
+func (s *Signer) algorithm() string {
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		return "ed25519-sha256"
+	}
+	return "rsa-sha256"
+}
+
+// Sign returns the message with a DKIM-Signature header in front of it. Both
+// the headers and the body use relaxed canonicalization, which survives the
+// small changes relays like to make to whitespace.
+func (s *Signer) Sign(msg []byte) ([]byte, error) {
+
+	fields, body, err := split(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// headers are signed from the bottom up, so a header that appears twice
+	// uses its last copy first
+	var (
+		names  []string
+		signed bytes.Buffer
+	)
+	used := make(map[string]int)
+	for _, name := range signedHeaders {
+		key := strings.ToLower(name)
+		if field, ok := nth(fields, key, used[key]); ok {
+			signed.WriteString(relaxedHeader(field) + "\r\n")
+		} else if key != "from" {
+			continue
+		}
+		used[key]++
+		names = append(names, key)
+	}
+
+	value := strings.Join([]string{
+		"v=1; a=" + s.algorithm() + "; c=relaxed/relaxed;",
+		"d=" + s.domain + "; s=" + s.selector + "; t=" + fmt.Sprint(time.Now().Unix()) + ";",
+		"h=" + strings.Join(names, ":") + ";",
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";",
+		"b=",
+	}, "\r\n\t")
+
+	// the signature covers its own header too, with b= still empty and without the final CRLF
+	signed.WriteString(relaxedHeader("DKIM-Signature: " + value))
+	hash := sha256.Sum256(signed.Bytes())
+
+	var sig []byte
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		// RFC 8463 signs the hash, not the data itself
+		sig, err = s.key.Sign(rand.Reader, hash[:], crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not sign message: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("DKIM-Signature: " + value + fold(base64.StdEncoding.EncodeToString(sig)) + "\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// split cuts a message into its header fields, continuation lines included, and its body
+func split(msg []byte) ([]string, []byte, error) {
+
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, fmt.Errorf("message has no body")
+	}
+
+	var fields []string
+	for _, line := range strings.Split(string(msg[:end]), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+
+	return fields, msg[end+4:], nil
+}
+
+// nth returns the n-th field with the given name, counting from the bottom
+func nth(fields []string, name string, n int) (string, bool) {
+
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fieldName(fields[i]) != name {
+			continue
+		}
+		if n == 0 {
+			return fields[i], true
+		}
+		n--
+	}
+
+	return "", false
+}
+
+// fieldName returns the lower case name of a header field
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// relaxedHeader canonicalizes a header field as in RFC 6376 section 3.4.2:
+// a lower case name, no folding, and every run of whitespace made one space
+func relaxedHeader(field string) string {
+
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value
+}
+
+// relaxedBody canonicalizes a body as in RFC 6376 section 3.4.4: no
+// whitespace at line ends, runs of it made one space and no empty lines at the end
+func relaxedBody(body []byte) []byte {
+
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		fields := strings.FieldsFunc(line, isWSP)
+		lines[i] = strings.Join(fields, " ")
+		if len(fields) > 0 && isWSP(rune(line[0])) {
+			lines[i] = " " + lines[i]
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// isWSP reports whether the rune is a space or a tab
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// fold breaks the signature over several lines, which relaxed canonicalization ignores
+func fold(sig string) string {
+
+	var b strings.Builder
+	for len(sig) > 64 {
+		b.WriteString(sig[:64] + "\r\n\t ")
+		sig = sig[64:]
+	}
+	b.WriteString(sig)
+
+	return b.String()
+}
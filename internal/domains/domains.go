@@ -0,0 +1,161 @@
+package domains
+
+import "strings"
+
+// disposable are providers of throwaway addresses, which stop working after
+// a few minutes or are read by anyone who knows the address
+var disposable = map[string]bool{
+	"10minutemail.com":   true,
+	"20minutemail.com":   true,
+	"33mail.com":         true,
+	"burnermail.io":      true,
+	"discard.email":      true,
+	"dispostable.com":    true,
+	"emailondeck.com":    true,
+	"fakeinbox.com":      true,
+	"getairmail.com":     true,
+	"getnada.com":        true,
+	"grr.la":             true,
+	"guerrillamail.biz":  true,
+	"guerrillamail.com":  true,
+	"guerrillamail.de":   true,
+	"guerrillamail.info": true,
+	"guerrillamail.net":  true,
+	"guerrillamail.org":  true,
+	"inboxkitten.com":    true,
+	"mailcatch.com":      true,
+	"maildrop.cc":        true,
+	"mailinator.com":     true,
+	"mailnesia.com":      true,
+	"mintemail.com":      true,
+	"moakt.com":          true,
+	"mohmal.com":         true,
+	"mytemp.email":       true,
+	"sharklasers.com":    true,
+	"spam4.me":           true,
+	"spamgourmet.com":    true,
+	"temp-mail.org":      true,
+	"tempail.com":        true,
+	"tempmail.com":       true,
+	"tempmailo.com":      true,
+	"tempr.email":        true,
+	"throwawaymail.com":  true,
+	"trashmail.com":      true,
+	"trashmail.de":       true,
+	"yopmail.com":        true,
+	"yopmail.fr":         true,
+}
+
+// common are the domains most people's addresses are at, a domain that is
+// almost one of them is most likely a typo
+var common = []string{
+	"aol.com",
+	"comcast.net",
+	"fastmail.com",
+	"gmail.com",
+	"gmx.com",
+	"gmx.de",
+	"gmx.net",
+	"googlemail.com",
+	"hey.com",
+	"hotmail.co.uk",
+	"hotmail.com",
+	"hotmail.fr",
+	"icloud.com",
+	"live.com",
+	"mac.com",
+	"mail.com",
+	"mail.ru",
+	"me.com",
+	"msn.com",
+	"orange.fr",
+	"outlook.com",
+	"proton.me",
+	"protonmail.com",
+	"t-online.de",
+	"web.de",
+	"yahoo.co.uk",
+	"yahoo.com",
+	"yahoo.fr",
+	"yandex.ru",
+	"ymail.com",
+	"zoho.com",
+}
+
+// Disposable reports whether the domain, or the domain it is under, gives
+// out throwaway addresses
+func Disposable(domain string) bool {
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for {
+		if disposable[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Suggest returns the common domain the domain is most likely a typo of,
+// e.g. gmail.com for gmial.com. It returns false for the common domains
+// themselves and for those that aren't close to one.
+func Suggest(domain string) (string, bool) {
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	best, bestDistance := "", 0
+	for _, c := range common {
+		if c == domain {
+			return "", false
+		}
+
+		// short domains are a letter away from too many real ones to
+		// guess, and a longer domain has room for one more slip of the finger
+		allowed := 1
+		switch {
+		case len(c) < 8:
+			continue
+		case len(c) >= 10:
+			allowed = 2
+		}
+		if d := distance(domain, c); d <= allowed && (best == "" || d < bestDistance) {
+			best, bestDistance = c, d
+		}
+	}
+
+	return best, best != ""
+}
+
+// distance is the number of letters that have to be added, taken out,
+// changed or swapped with the one next to them to turn a into b, see
+// https://en.wikipedia.org/wiki/Damerau%E2%80%93Levenshtein_distance
+func distance(a, b string) int {
+
+	// the row before the last one is needed to notice swapped letters
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+
+	return prev[len(b)]
+}
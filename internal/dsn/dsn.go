@@ -0,0 +1,173 @@
+package dsn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Report is a delivery status notification, the multipart/report a server
+// sends back when it couldn't deliver a message, see RFC 3464
+type Report struct {
+	ReportingMTA string // the server that wrote the report
+	EnvelopeID   string // the ENVID the message was sent with, if it was
+
+	// OriginalID and OriginalSubject come from the headers of the message
+	// that bounced, which most servers send back with the report
+	OriginalID      string
+	OriginalSubject string
+	Original        []byte // the whole message that bounced, if the server sent it back
+
+	Recipients []Recipient
+}
+
+// Recipient is what the report says about one recipient of the message
+type Recipient struct {
+	Address    string // the Final-Recipient, without its "rfc822;" type
+	Original   string // the Original-Recipient, when the address was rewritten on the way
+	Action     string // failed, delayed, delivered, relayed or expanded
+	Status     string // the enhanced status code, e.g. 5.1.1
+	Diagnostic string // what the remote server said, e.g. 550 5.1.1 no such user
+}
+
+// Failed reports whether the message didn't and won't reach the recipient
+func (r Recipient) Failed() bool {
+	return strings.EqualFold(r.Action, "failed")
+}
+
+// Parse reads a delivery status notification. It returns false for any
+// other message, including a multipart/report of another kind, such as a
+// read receipt.
+func Parse(raw []byte) (Report, bool) {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Report{}, false
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "delivery-status") {
+		return Report{}, false
+	}
+
+	var (
+		report Report
+		found  bool
+	)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextRawPart()
+		if err != nil {
+			break
+		}
+		data, err := io.ReadAll(decode(part.Header, part))
+		if err != nil {
+			break
+		}
+
+		// the global types of RFC 6533 are the same, with UTF-8 allowed in them
+		switch t, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); t {
+		case "message/delivery-status", "message/global-delivery-status":
+			if err := report.readStatus(data); err == nil {
+				found = true
+			}
+		case "message/rfc822", "message/global":
+			report.Original = data
+			report.readOriginal(data)
+		case "text/rfc822-headers", "message/global-headers":
+			report.readOriginal(data)
+		}
+	}
+
+	return report, found
+}
+
+// readStatus reads the delivery-status part, a group of fields about the
+// message followed by a group for each recipient, separated by empty lines
+func (r *Report) readStatus(data []byte) error {
+
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(bytes.TrimLeft(data, "\r\n"))))
+
+	fields, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	r.ReportingMTA = typed(fields.Get("Reporting-MTA"))
+	r.EnvelopeID = fields.Get("Original-Envelope-Id")
+
+	for {
+		skipEmpty(tp)
+		fields, err := tp.ReadMIMEHeader()
+		if len(fields) > 0 {
+			r.Recipients = append(r.Recipients, Recipient{
+				Address:    typed(fields.Get("Final-Recipient")),
+				Original:   typed(fields.Get("Original-Recipient")),
+				Action:     strings.ToLower(fields.Get("Action")),
+				Status:     fields.Get("Status"),
+				Diagnostic: typed(fields.Get("Diagnostic-Code")),
+			})
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if len(r.Recipients) == 0 {
+		return errors.New("the report has no recipients")
+	}
+	return nil
+}
+
+// readOriginal reads the Message-ID and subject of the message that bounced
+func (r *Report) readOriginal(data []byte) {
+
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	h, _ := tp.ReadMIMEHeader()
+
+	r.OriginalID = strings.TrimSpace(h.Get("Message-Id"))
+	subject := h.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	r.OriginalSubject = subject
+}
+
+// typed takes the type off a field such as "rfc822; ann@example.com" or
+// "smtp; 550 5.1.1 no such user"
+func typed(value string) string {
+	if _, v, ok := strings.Cut(value, ";"); ok {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(value)
+}
+
+// skipEmpty skips the empty lines between two groups of fields, some
+// servers write more than one
+func skipEmpty(tp *textproto.Reader) {
+	for {
+		b, err := tp.R.Peek(1)
+		if err != nil || (b[0] != '\r' && b[0] != '\n') {
+			return
+		}
+		tp.R.ReadByte()
+	}
+}
+
+// decode undoes the part's content transfer encoding
+func decode(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
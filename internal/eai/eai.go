@@ -0,0 +1,91 @@
+package eai
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// dots are the characters IDNA treats as the dot between labels, people
+// typing in Chinese or Japanese often get the wide ones
+var dots = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII turns an internationalized domain like bücher.de into the ASCII
+// form DNS and SMTP servers understand, xn--bcher-kva.de. Labels that are
+// ASCII already are only lower cased.
+func ToASCII(domain string) (string, error) {
+
+	domain = strings.TrimSuffix(dots.Replace(domain), ".")
+	if domain == "" {
+		return "", fmt.Errorf("domain is empty")
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		// RFC 5891 wants labels in NFC before they are encoded
+		label = norm.NFC.String(strings.ToLower(label))
+		if label == "" {
+			return "", fmt.Errorf("domain %q has an empty label", domain)
+		}
+
+		if !isASCII(label) {
+			encoded, err := punycode(label)
+			if err != nil {
+				return "", err
+			}
+			label = "xn--" + encoded
+		}
+
+		if len(label) > 63 {
+			return "", fmt.Errorf("domain %q has a label longer than 63 characters", domain)
+		}
+		labels[i] = label
+	}
+
+	ascii := strings.Join(labels, ".")
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("domain %q is too long", domain)
+	}
+
+	return ascii, nil
+}
+
+// Address returns the address with its domain in ASCII. The local part
+// stays as it is, only the server it is delivered to can make sense of it.
+func Address(addr string) (string, error) {
+
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return "", fmt.Errorf("address %q has no domain", addr)
+	}
+
+	domain, err := ToASCII(addr[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	return addr[:i+1] + domain, nil
+}
+
+// NeedsSMTPUTF8 reports whether the address can only be sent to by a server
+// that supports SMTPUTF8, because its local part isn't ASCII (RFC 6531)
+func NeedsSMTPUTF8(addr string) bool {
+
+	local := addr
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		local = addr[:i]
+	}
+
+	return !isASCII(local)
+}
+
+// isASCII reports whether the string only holds ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
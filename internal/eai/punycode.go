@@ -0,0 +1,113 @@
+package eai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the parameters of punycode, see RFC 3492 section 5
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+)
+
+// punycode encodes a label as RFC 3492 describes. The ASCII characters are
+// copied first, then each other character is encoded as how many steps
+// it takes to get to it, counting through code points and positions.
+func punycode(label string) (string, error) {
+
+	runes := []rune(label)
+
+	var out strings.Builder
+	for _, r := range runes {
+		if r < 0x80 {
+			out.WriteRune(r)
+		}
+	}
+	basic := out.Len()
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := rune(initialN), 0, initialBias
+	for handled := basic; handled < len(runes); {
+		// the smallest code point we haven't encoded yet
+		m := rune(0x10ffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", fmt.Errorf("label %q is too long to encode", label)
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := base; ; k += base {
+				t := k - bias
+				if t < tmin {
+					t = tmin
+				} else if t > tmax {
+					t = tmax
+				}
+				if q < t {
+					break
+				}
+				out.WriteByte(digit(t + (q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out.WriteByte(digit(q))
+
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return out.String(), nil
+}
+
+// adapt works out the bias for the next character, see RFC 3492 section 6.1
+func adapt(delta, points int, first bool) int {
+
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+
+	k := 0
+	for delta > (base-tmin)*tmax/2 {
+		delta /= base - tmin
+		k += base
+	}
+
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+// digit returns the character for a digit, a to z are 0 to 25 and 0 to 9 are 26 to 35
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
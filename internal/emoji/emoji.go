@@ -0,0 +1,114 @@
+package emoji
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// the characters the picker offers, see the top of the file for how it's laid out
+//
+//go:embed emoji.txt
+var list string
+
+// Emoji is an emoji or a symbol, with the name it is typed as, like :smile:
+type Emoji struct {
+	Char     string
+	Name     string
+	Keywords []string
+}
+
+// All is every emoji and symbol, in the order of the list
+var All = parse(list)
+
+// parse reads the list, leaving out the comments and anything longer than
+// one code point, whose width terminals don't agree on
+func parse(list string) []Emoji {
+
+	var all []Emoji
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if utf8.RuneCountInString(fields[0]) != 1 {
+			continue
+		}
+		all = append(all, Emoji{Char: fields[0], Name: fields[1], Keywords: fields[2:]})
+	}
+	return all
+}
+
+// Named returns the emoji with exactly this name
+func Named(name string) (Emoji, bool) {
+	for _, e := range All {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Emoji{}, false
+}
+
+// Search returns the emoji whose name or keywords match the query, the best
+// matches first: the name itself, then names and keywords starting with
+// it, then the ones that have it somewhere in them
+func Search(query string) []Emoji {
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return All
+	}
+
+	type match struct {
+		e     Emoji
+		score int
+	}
+	var matches []match
+	for _, e := range All {
+		if score, ok := rank(e, query); ok {
+			matches = append(matches, match{e, score})
+		}
+	}
+
+	// of the matches that score the same the shorter names are closer to the
+	// query, and a stable sort keeps the rest in the order of the list
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return len(matches[i].e.Name) < len(matches[j].e.Name)
+	})
+
+	found := make([]Emoji, len(matches))
+	for i, m := range matches {
+		found[i] = m.e
+	}
+	return found
+}
+
+// rank scores how well the emoji matches the query, lower is better
+func rank(e Emoji, query string) (int, bool) {
+
+	switch {
+	case e.Name == query:
+		return 0, true
+	case strings.HasPrefix(e.Name, query):
+		return 1, true
+	}
+
+	for _, k := range e.Keywords {
+		if strings.HasPrefix(k, query) {
+			return 2, true
+		}
+	}
+	if strings.Contains(e.Name, query) {
+		return 3, true
+	}
+	for _, k := range e.Keywords {
+		if strings.Contains(k, query) {
+			return 4, true
+		}
+	}
+	return 0, false
+}
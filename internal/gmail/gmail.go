@@ -0,0 +1,268 @@
+package gmail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// where Google's OAuth and the Gmail API live
+const (
+	authURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	tokenURL = "https://oauth2.googleapis.com/token"
+	sendURL  = "https://gmail.googleapis.com/gmail/v1/users/me/messages/send"
+)
+
+// Scope only lets go-mailer send mail, it can't read any
+const Scope = "https://www.googleapis.com/auth/gmail.send"
+
+// Client sends mail through the Gmail API on behalf of one account. It
+// keeps the access token between messages, until it is about to expire.
+type Client struct {
+	cfg  config.Gmail
+	http *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New returns a client for the Gmail settings
+func New(cfg config.Gmail) *Client {
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Send sends a rendered message with users.messages.send, which also puts
+// it in the Sent folder in Gmail. It returns the id Gmail gave the message.
+func (c *Client) Send(to []string, msg []byte) (string, error) {
+
+	token, err := c.accessToken()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(struct {
+		Raw string `json:"raw"`
+	}{base64.URLEncoding.EncodeToString(email.AddBcc(msg, to))})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sendURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return "", err
+	}
+
+	return res.ID, nil
+}
+
+// accessToken returns a token that is good for a while yet, getting a new
+// one with the refresh token when needed
+func (c *Client) accessToken() (string, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+	if c.cfg.RefreshToken == "" {
+		return "", errors.New("gmail has no refresh_token, run go-mailer gmail-auth to get one")
+	}
+
+	res, err := c.tokenRequest(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.cfg.RefreshToken},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.token = res.AccessToken
+	c.expires = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// tokenResponse is what Google's token endpoint answers with
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenRequest asks the token endpoint for a token, with the client's credentials
+func (c *Client) tokenRequest(form url.Values) (tokenResponse, error) {
+
+	form.Set("client_id", c.cfg.ClientID)
+	form.Set("client_secret", c.cfg.ClientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var res tokenResponse
+	if err := c.do(req, &res); err != nil {
+		return tokenResponse{}, fmt.Errorf("could not get a gmail access token: %w", err)
+	}
+	return res, nil
+}
+
+// do sends the request and decodes the JSON response into v. Errors are
+// returned as a transport.HTTPError, so they are retried or not by status.
+func (c *Client) do(req *http.Request, v interface{}) error {
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return &transport.HTTPError{Code: res.StatusCode, Msg: errorMessage(body)}
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// errorMessage returns what went wrong from the body of an error response,
+// the API and the token endpoint each say it their own way
+func errorMessage(body []byte) string {
+
+	var e struct {
+		Error json.RawMessage `json:"error"`
+		Desc  string          `json:"error_description"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		var api struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(e.Error, &api) == nil && api.Message != "" {
+			return api.Message
+		}
+		var code string
+		if json.Unmarshal(e.Error, &code) == nil && code != "" {
+			if e.Desc != "" {
+				return code + ", " + e.Desc
+			}
+			return code
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Authorize lets the user grant go-mailer access to send as them, in their
+// browser, and returns the refresh token to keep in the config. It follows
+// the flow for desktop apps: Google sends the browser back to a server on
+// the loopback address once access is granted, with PKCE so the code is no
+// use to anyone else. open is given the address to visit.
+func Authorize(cfg config.Gmail, open func(url string)) (string, error) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	redirect := "http://" + l.Addr().String()
+
+	verifier, err := random()
+	if err != nil {
+		return "", err
+	}
+	state, err := random()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	open(authURL + "?" + url.Values{
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirect},
+		"response_type":         {"code"},
+		"scope":                 {Scope},
+		"access_type":           {"offline"},
+		"prompt":                {"consent"},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode())
+
+	// the browser comes back once, with the code or why there is none
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("state") != state:
+			http.Error(w, "This isn't the answer go-mailer is waiting for.", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			fmt.Fprintln(w, "go-mailer wasn't given access, you can close this page.")
+			errs <- fmt.Errorf("access wasn't granted: %s", q.Get("error"))
+		default:
+			fmt.Fprintln(w, "go-mailer can send your mail now, you can close this page.")
+			codes <- q.Get("code")
+		}
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return "", err
+	case <-time.After(5 * time.Minute):
+		return "", errors.New("gave up waiting for access to be granted")
+	}
+
+	res, err := New(cfg).tokenRequest(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.RefreshToken == "" {
+		return "", errors.New("google didn't hand out a refresh token")
+	}
+
+	return res.RefreshToken, nil
+}
+
+// random returns a random string fit for the state and the PKCE verifier
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,326 @@
+package graph
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/vault"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// where Microsoft's identity platform and Graph live
+const (
+	loginURL = "https://login.microsoftonline.com/"
+	apiURL   = "https://graph.microsoft.com/v1.0/"
+)
+
+// the permissions asked for: a signed in user only lets go-mailer send
+// mail, and stay signed in, an application gets what it was granted
+const (
+	delegatedScope = "offline_access https://graph.microsoft.com/Mail.Send"
+	appScope       = "https://graph.microsoft.com/.default"
+)
+
+// maxRequest is the most sendMail takes in one request, and the message
+// is sent base64 encoded
+const maxRequest = 4 << 20
+
+// Client sends mail through Microsoft Graph on behalf of one account. It
+// keeps the access token between messages, until it is about to expire.
+type Client struct {
+	cfg       config.Graph
+	tokenPath string
+	http      *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New returns a client for the Graph settings. tokenPath is where the
+// refresh token of the signed in user is kept, see SignIn.
+func New(cfg config.Graph, tokenPath string) *Client {
+	return &Client{cfg: cfg, tokenPath: tokenPath, http: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// Send sends a rendered message as MIME with sendMail, attachments and
+// all, which also saves it to the Sent Items folder of the mailbox. An
+// application sends from the mailbox of the from address.
+func (c *Client) Send(from string, to []string, msg []byte) error {
+
+	body := base64.StdEncoding.EncodeToString(email.AddBcc(msg, to))
+	if len(body) > maxRequest {
+		return fmt.Errorf("the message is too big for microsoft graph, which takes about %d MB", maxRequest*3/4>>20)
+	}
+
+	endpoint := apiURL + "me/sendMail"
+	if c.cfg.AppOnly() {
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return fmt.Errorf("invalid from address %q: %w", from, err)
+		}
+		endpoint = apiURL + "users/" + url.PathEscape(addr.Address) + "/sendMail"
+	}
+
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return c.do(req, nil)
+}
+
+// accessToken returns a token that is good for a while yet, getting a new
+// one when needed
+func (c *Client) accessToken() (string, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {appScope}}
+	if !c.cfg.AppOnly() {
+		refresh, err := c.refreshToken()
+		if err != nil {
+			return "", err
+		}
+		form = url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refresh}, "scope": {delegatedScope}}
+	}
+
+	res, err := c.tokenRequest(form)
+	if err != nil {
+		return "", err
+	}
+
+	// a signed in user gets a new refresh token every time, the old one
+	// runs out in the end
+	if res.RefreshToken != "" {
+		if err := c.saveRefreshToken(res.RefreshToken); err != nil {
+			return "", err
+		}
+	}
+
+	c.token = res.AccessToken
+	c.expires = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// tokenFile is what is kept in the token file
+type tokenFile struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshToken reads the refresh token of the signed in user
+func (c *Client) refreshToken() (string, error) {
+
+	data, err := os.ReadFile(c.tokenPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.New("nobody has signed in to microsoft graph, run go-mailer graph-auth")
+	}
+	if err != nil {
+		return "", err
+	}
+	if data, err = vault.Open(data); err != nil {
+		return "", err
+	}
+
+	var f tokenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", fmt.Errorf("the token file %s is corrupt: %w", c.tokenPath, err)
+	}
+	return f.RefreshToken, nil
+}
+
+// saveRefreshToken replaces the refresh token in the token file, encrypted
+// when encryption is turned on
+func (c *Client) saveRefreshToken(refresh string) error {
+
+	data, err := json.Marshal(tokenFile{RefreshToken: refresh})
+	if err != nil {
+		return err
+	}
+	if data, err = vault.Seal(data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.tokenPath), 0o700); err != nil {
+		return err
+	}
+	tmp := c.tokenPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.tokenPath)
+}
+
+// tokenResponse is what the token endpoint answers with
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenRequest asks the tenant's token endpoint for a token, with the client's credentials
+func (c *Client) tokenRequest(form url.Values) (tokenResponse, error) {
+
+	form.Set("client_id", c.cfg.ClientID)
+	if c.cfg.AppOnly() {
+		form.Set("client_secret", c.cfg.ClientSecret)
+	}
+
+	var res tokenResponse
+	if err := c.post(c.endpoint("token"), form, &res); err != nil {
+		return tokenResponse{}, fmt.Errorf("could not get a microsoft graph access token: %w", err)
+	}
+	return res, nil
+}
+
+// endpoint returns the address of one of the tenant's OAuth endpoints
+func (c *Client) endpoint(name string) string {
+	return loginURL + url.PathEscape(c.cfg.TenantName()) + "/oauth2/v2.0/" + name
+}
+
+// post sends a form and decodes the JSON response into v
+func (c *Client) post(endpoint string, form url.Values, v interface{}) error {
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.do(req, v)
+}
+
+// do sends the request and decodes the JSON response into v, if it isn't
+// nil. Errors are returned as a transport.HTTPError, so they are retried
+// or not by status.
+func (c *Client) do(req *http.Request, v interface{}) error {
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 2048))
+		return &transport.HTTPError{Code: res.StatusCode, Msg: errorMessage(body)}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// errorMessage returns what went wrong from the body of an error response,
+// Graph and the token endpoint each say it their own way
+func errorMessage(body []byte) string {
+
+	var e struct {
+		Error json.RawMessage `json:"error"`
+		Desc  string          `json:"error_description"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		var api struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(e.Error, &api) == nil && api.Message != "" {
+			return api.Code + ", " + api.Message
+		}
+		var code string
+		if json.Unmarshal(e.Error, &code) == nil && code != "" {
+			if e.Desc != "" {
+				// the description goes on with a trace id and a timestamp
+				desc, _, _ := strings.Cut(e.Desc, "\r\n")
+				return code + ", " + desc
+			}
+			return code
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// SignIn signs the user in with the device code flow, which suits a
+// terminal: show is given what to tell the user, a code to enter on a page
+// in any browser, and once they have SignIn keeps the refresh token in
+// the token file
+func (c *Client) SignIn(show func(message string)) error {
+
+	if c.cfg.AppOnly() {
+		return errors.New("an application with a client_secret doesn't sign in, it sends on its own")
+	}
+
+	var code struct {
+		DeviceCode string `json:"device_code"`
+		Message    string `json:"message"`
+		ExpiresIn  int    `json:"expires_in"`
+		Interval   int    `json:"interval"`
+	}
+	form := url.Values{"client_id": {c.cfg.ClientID}, "scope": {delegatedScope}}
+	if err := c.post(c.endpoint("devicecode"), form, &code); err != nil {
+		return fmt.Errorf("could not start signing in: %w", err)
+	}
+	show(code.Message)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	// the token endpoint says to wait until the user has signed in
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var res tokenResponse
+		err := c.post(c.endpoint("token"), url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"client_id":   {c.cfg.ClientID},
+			"device_code": {code.DeviceCode},
+		}, &res)
+
+		var status *transport.HTTPError
+		switch {
+		case err == nil:
+			if res.RefreshToken == "" {
+				return errors.New("microsoft didn't hand out a refresh token")
+			}
+			return c.saveRefreshToken(res.RefreshToken)
+		case errors.As(err, &status) && strings.HasPrefix(status.Msg, "authorization_pending"):
+			continue
+		case errors.As(err, &status) && strings.HasPrefix(status.Msg, "slow_down"):
+			interval += 5 * time.Second
+			continue
+		default:
+			return fmt.Errorf("could not sign in: %w", err)
+		}
+	}
+
+	return errors.New("the code ran out before anyone signed in")
+}
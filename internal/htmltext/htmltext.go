@@ -0,0 +1,446 @@
+package htmltext
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Styles changes how parts of the text look, e.g. with lipgloss. A style
+// that is nil leaves its text as it is.
+type Styles struct {
+	Heading func(string) string
+	Bold    func(string) string
+	Italic  func(string) string
+	Link    func(string) string // the number of a link's footnote
+}
+
+// Plain styles text that is read as it is, like the plain text version of
+// a mail: headings are underlined, and bold and italic text is marked the
+// way people write it by hand
+var Plain = Styles{
+	Heading: func(s string) string { return s + "\n" + strings.Repeat("=", utf8.RuneCountInString(s)) },
+	Bold:    func(s string) string { return "*" + s + "*" },
+	Italic:  func(s string) string { return "_" + s + "_" },
+}
+
+// blocks are the tags that start on a new line, and end one
+var blocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "center": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "tr": true, "ul": true,
+}
+
+// paragraphs are the blocks that get an empty line around them
+var paragraphs = map[string]bool{
+	"blockquote": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "ol": true, "p": true, "pre": true, "table": true, "ul": true,
+}
+
+// hidden are the tags whose content isn't shown
+var hidden = map[string]bool{"head": true, "script": true, "style": true, "title": true, "template": true}
+
+// renderer builds the text as the HTML is read
+type renderer struct {
+	styles Styles
+	out    strings.Builder
+	line   strings.Builder // the line being written, before it is quoted and styled
+
+	newlines int  // line breaks waiting to be written, before the next text
+	space    bool // whether a space is waiting to be written
+	pre      int  // how many <pre> we're in, where white space is kept
+	quote    int  // how many <blockquote> we're in, each one quotes with a >
+	hide     int  // how many hidden tags we're in
+	lists    []int
+
+	// styled is the text of the tag being styled, e.g. a heading, with the style to use
+	styled []styledText
+
+	links   []string
+	linkURL string // the link we're in, if we're in one
+	linkAt  int    // where its text started in the line
+}
+
+// styledText is the text of a styled tag, collected until it ends
+type styledText struct {
+	tag   string
+	style func(string) string
+	start int
+}
+
+// Render turns HTML into text that reads well in a terminal. Paragraphs,
+// lists and quotes are laid out the way a browser would, hidden parts such
+// as scripts are left out, and links are numbered with the addresses they
+// go to listed at the end.
+func Render(doc string, styles Styles) string {
+
+	r := &renderer{styles: styles}
+
+	for len(doc) > 0 {
+		i := strings.IndexByte(doc, '<')
+		if i < 0 {
+			r.text(doc)
+			break
+		}
+		r.text(doc[:i])
+		doc = doc[i:]
+
+		// comments and the doctype aren't shown
+		if strings.HasPrefix(doc, "<!--") {
+			end := strings.Index(doc, "-->")
+			if end < 0 {
+				break
+			}
+			doc = doc[end+3:]
+			continue
+		}
+
+		end := tagEnd(doc)
+		if end < 0 {
+			// a < that doesn't start a tag is just a <
+			r.text("<")
+			doc = doc[1:]
+			continue
+		}
+		r.tag(doc[1:end])
+		doc = doc[end+1:]
+	}
+
+	r.flush()
+	text := strings.Trim(r.out.String(), "\n")
+
+	if len(r.links) > 0 {
+		text += "\n\n"
+		for i, url := range r.links {
+			text += fmt.Sprintf("%s %s\n", r.style(r.styles.Link, fmt.Sprintf("[%d]", i+1)), url)
+		}
+	}
+
+	return strings.TrimRight(text, "\n")
+}
+
+// tagEnd returns where the tag at the start of doc ends, skipping > in quoted
+// attributes, or -1 if it isn't a tag
+func tagEnd(doc string) int {
+
+	if len(doc) < 2 || !(isLetter(doc[1]) || doc[1] == '/' || doc[1] == '!') {
+		return -1
+	}
+
+	var quote byte
+	for i := 1; i < len(doc); i++ {
+		switch c := doc[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// tag handles a tag, without its < and >
+func (r *renderer) tag(tag string) {
+
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+	name, attrs := tag, ""
+	if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 {
+		name, attrs = tag[:i], tag[i:]
+	}
+	name = strings.ToLower(strings.TrimRight(name, "/"))
+	if name == "" || strings.HasPrefix(name, "!") {
+		return
+	}
+
+	if hidden[name] {
+		if closing {
+			r.hide = max(r.hide-1, 0)
+		} else if !strings.HasSuffix(tag, "/") {
+			r.hide++
+		}
+		return
+	}
+	if r.hide > 0 {
+		return
+	}
+
+	if blocks[name] {
+		paragraph := paragraphs[name]
+		// a list in a list carries on without an empty line
+		if name == "ul" || name == "ol" {
+			if closing {
+				paragraph = len(r.lists) <= 1
+			} else {
+				paragraph = len(r.lists) == 0
+			}
+		}
+		r.block(paragraph)
+	}
+
+	switch name {
+	case "br":
+		r.breakLine(1)
+	case "hr":
+		r.write("────────")
+		r.block(false)
+	case "pre":
+		if closing {
+			r.pre = max(r.pre-1, 0)
+		} else {
+			r.pre++
+		}
+	case "blockquote":
+		// the line so far is quoted as much as it was when it was written
+		r.flush()
+		if closing {
+			r.quote = max(r.quote-1, 0)
+		} else {
+			r.quote++
+		}
+	case "ul", "ol":
+		if closing {
+			if len(r.lists) > 0 {
+				r.lists = r.lists[:len(r.lists)-1]
+			}
+		} else if name == "ol" {
+			r.lists = append(r.lists, 1)
+		} else {
+			r.lists = append(r.lists, 0)
+		}
+	case "li":
+		if closing {
+			return
+		}
+		indent := strings.Repeat("  ", max(len(r.lists)-1, 0))
+		bullet := "• "
+		if n := len(r.lists); n > 0 && r.lists[n-1] > 0 {
+			bullet = fmt.Sprintf("%d. ", r.lists[n-1])
+			r.lists[n-1]++
+		}
+		r.write(indent + bullet)
+	case "td", "th":
+		if !closing {
+			r.space = true
+		}
+	case "img":
+		if alt := attr(attrs, "alt"); alt != "" {
+			r.text("[image: " + alt + "]")
+		}
+	case "a":
+		r.link(closing, attr(attrs, "href"))
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.styleTag(name, closing, r.styles.Heading)
+	case "b", "strong":
+		r.styleTag(name, closing, r.styles.Bold)
+	case "i", "em":
+		r.styleTag(name, closing, r.styles.Italic)
+	}
+}
+
+// link starts or ends a link, links that go somewhere get a footnote
+func (r *renderer) link(closing bool, href string) {
+
+	if !closing {
+		r.linkURL, r.linkAt = href, r.line.Len()
+		return
+	}
+	url := r.linkURL
+	r.linkURL = ""
+
+	// a link that shows its own address doesn't need a footnote
+	if url == "" || strings.HasPrefix(url, "#") || strings.HasPrefix(strings.ToLower(url), "javascript:") {
+		return
+	}
+	text := strings.TrimSpace(r.line.String()[min(r.linkAt, r.line.Len()):])
+	if text == url || "mailto:"+text == url {
+		return
+	}
+
+	r.links = append(r.links, url)
+	r.write(r.style(r.styles.Link, fmt.Sprintf("[%d]", len(r.links))))
+}
+
+// styleTag starts collecting the text of a styled tag, or styles it when it ends
+func (r *renderer) styleTag(name string, closing bool, style func(string) string) {
+
+	if !closing {
+		r.styled = append(r.styled, styledText{tag: name, style: style, start: r.line.Len()})
+		return
+	}
+
+	n := len(r.styled)
+	if n == 0 || r.styled[n-1].tag != name {
+		return
+	}
+	s := r.styled[n-1]
+	r.styled = r.styled[:n-1]
+	if s.style == nil || s.start > r.line.Len() {
+		return
+	}
+
+	// only the part on the current line is styled, which is all of it for most tags
+	line := r.line.String()
+	r.line.Reset()
+	r.line.WriteString(line[:s.start] + s.style(line[s.start:]))
+}
+
+// style applies the style, if there is one
+func (r *renderer) style(style func(string) string, s string) string {
+	if style == nil {
+		return s
+	}
+	return style(s)
+}
+
+// text writes the text between tags, with its entities decoded and, outside
+// <pre>, its white space collapsed
+func (r *renderer) text(s string) {
+
+	if r.hide > 0 || s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+
+	if r.pre > 0 {
+		lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+		for i, l := range lines {
+			if i > 0 {
+				r.breakLine(1)
+			}
+			r.write(l)
+		}
+		return
+	}
+
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		r.space = r.space || s != ""
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n\f") != s {
+		r.space = true
+	}
+	for i, w := range words {
+		if i > 0 {
+			r.space = true
+		}
+		r.write(w)
+	}
+	if strings.TrimRight(s, " \t\r\n\f") != s {
+		r.space = true
+	}
+}
+
+// write adds the text to the line, after the breaks and space waiting for it
+func (r *renderer) write(s string) {
+
+	if r.newlines > 0 {
+		r.flush()
+		for i := 0; i < r.newlines; i++ {
+			r.out.WriteString("\n")
+		}
+		r.newlines, r.space = 0, false
+	}
+	if r.space && r.line.Len() > 0 {
+		// the space belongs before a style or link that starts here, not in it
+		at := r.line.Len()
+		r.line.WriteString(" ")
+		for i := range r.styled {
+			if r.styled[i].start == at {
+				r.styled[i].start++
+			}
+		}
+		if r.linkAt == at {
+			r.linkAt++
+		}
+	}
+	r.space = false
+	r.line.WriteString(s)
+}
+
+// breakLine ends the line, n is how many line breaks there are at least
+func (r *renderer) breakLine(n int) {
+	r.newlines = max(r.newlines, n)
+	if r.line.Len() == 0 && r.out.Len() == 0 {
+		r.newlines = 0
+	}
+}
+
+// block ends the line before a block starts or after it ends, paragraphs
+// get an empty line around them
+func (r *renderer) block(paragraph bool) {
+	if paragraph {
+		r.breakLine(2)
+	} else {
+		r.breakLine(1)
+	}
+}
+
+// flush writes the line being built to the text, quoted if we're in a quote
+func (r *renderer) flush() {
+
+	if r.line.Len() == 0 {
+		return
+	}
+	if r.quote > 0 {
+		r.out.WriteString(strings.Repeat("> ", r.quote))
+	}
+	r.out.WriteString(r.line.String())
+	r.line.Reset()
+
+	// the styles that are still open carry on from the start of the next line
+	for i := range r.styled {
+		r.styled[i].start = 0
+	}
+	r.linkAt = 0
+}
+
+// attr returns the value of the named attribute
+func attr(attrs, name string) string {
+
+	for attrs != "" {
+		attrs = strings.TrimLeft(attrs, " \t\r\n/")
+		i := strings.IndexAny(attrs, "= \t\r\n>")
+		if i < 0 {
+			return ""
+		}
+		key := strings.ToLower(attrs[:i])
+		attrs = strings.TrimLeft(attrs[i:], " \t\r\n")
+		if !strings.HasPrefix(attrs, "=") {
+			continue
+		}
+		attrs = strings.TrimLeft(attrs[1:], " \t\r\n")
+
+		var value string
+		if attrs != "" && (attrs[0] == '"' || attrs[0] == '\'') {
+			end := strings.IndexByte(attrs[1:], attrs[0])
+			if end < 0 {
+				return ""
+			}
+			value, attrs = attrs[1:end+1], attrs[end+2:]
+		} else {
+			end := strings.IndexAny(attrs, " \t\r\n")
+			if end < 0 {
+				end = len(attrs)
+			}
+			value, attrs = attrs[:end], attrs[end:]
+		}
+
+		if key == name {
+			return html.UnescapeString(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package i18n
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// the translations that come with go-mailer. A locale file maps what the TUI
+// says in English to what it says in the language, e.g.
+//
+//	"Subject:" = "Betreff:"
+//
+//go:embed locales/*.toml
+var builtin embed.FS
+
+// Catalog holds the translations of one language. A nil Catalog is English.
+type Catalog struct {
+	Lang     string
+	messages map[string]string
+}
+
+// T translates s, what has no translation stays in English
+func (c *Catalog) T(s string) string {
+	if c == nil {
+		return s
+	}
+	if t, ok := c.messages[s]; ok && t != "" {
+		return t
+	}
+	return s
+}
+
+// Load returns the translations for the language, like "de" or "pt_BR".
+// The locale files in dir, if there are any, are read on top of the
+// built-in ones, so a translation can be changed or a language added.
+// English needs no translations, it returns a nil Catalog.
+func Load(dir, lang string) (*Catalog, error) {
+
+	lang = Normalize(lang)
+	if lang == "" || lang == "en" || strings.HasPrefix(lang, "en_") {
+		return nil, nil
+	}
+
+	// a regional variant like pt_BR starts from what pt says
+	variants := []string{lang}
+	if base, _, ok := strings.Cut(lang, "_"); ok {
+		variants = []string{base, lang}
+	}
+
+	c := &Catalog{Lang: lang, messages: make(map[string]string)}
+	found := false
+	for _, v := range variants {
+		data, err := builtin.ReadFile("locales/" + v + ".toml")
+		if err == nil {
+			if err := c.add(v+".toml", data); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+
+		if dir == "" {
+			continue
+		}
+		data, err = os.ReadFile(filepath.Join(dir, v+".toml"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := c.add(filepath.Join(dir, v+".toml"), data); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("there is no translation for %q, there are translations for %s", lang, strings.Join(Languages(dir), ", "))
+	}
+	return c, nil
+}
+
+// add reads a locale file into the catalog
+func (c *Catalog) add(name string, data []byte) error {
+	messages := make(map[string]string)
+	if _, err := toml.Decode(string(data), &messages); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for k, v := range messages {
+		c.messages[k] = v
+	}
+	return nil
+}
+
+// Languages returns the languages there are translations for, English included
+func Languages(dir string) []string {
+
+	langs := map[string]bool{"en": true}
+	if entries, err := builtin.ReadDir("locales"); err == nil {
+		for _, e := range entries {
+			langs[strings.TrimSuffix(e.Name(), ".toml")] = true
+		}
+	}
+	if entries, err := os.ReadDir(dir); err == nil && dir != "" {
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".toml") {
+				langs[strings.TrimSuffix(e.Name(), ".toml")] = true
+			}
+		}
+	}
+
+	var names []string
+	for l := range langs {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Normalize turns a locale like de_DE.UTF-8 or pt-BR into the name of its
+// locale file, de_DE or pt_BR. C and POSIX, the locales of no language, are empty.
+func Normalize(locale string) string {
+
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "-", "_")
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+
+	lang, region, ok := strings.Cut(locale, "_")
+	if !ok {
+		return strings.ToLower(lang)
+	}
+	return strings.ToLower(lang) + "_" + strings.ToUpper(region)
+}
+
+// FromEnv returns the language the environment asks for, the way the C
+// library picks it, or empty if it doesn't ask for one
+func FromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return Normalize(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// We write meeting invitations in iCalendar, see RFC 5545. The calendar
+// uses METHOD:REQUEST from iTIP (RFC 5546), which mail clients like
+// Outlook and Google Calendar show as an invitation that can be accepted
+// or declined. Lines longer than 75 octets are folded.
+
+// Person is the organizer or an attendee of an event
+type Person struct {
+	Name    string
+	Address string
+}
+
+// Event is a meeting to invite people to
+type Event struct {
+	UID         string // stays the same when the invitation is sent again, so it updates the meeting
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Organizer   Person
+	Attendees   []Person
+	Stamp       time.Time // when the invitation was sent
+}
+
+// utcFormat is how times are written, in UTC so no time zone has to be described
+const utcFormat = "20060102T150405Z"
+
+// Request returns the calendar inviting the attendees to the event
+func (e Event) Request() []byte {
+
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("PRODID:-//go-mailer//EN")
+	line("VERSION:2.0")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:REQUEST")
+	line("BEGIN:VEVENT")
+	line("UID:" + e.UID)
+	line("DTSTAMP:" + e.Stamp.UTC().Format(utcFormat))
+	line("DTSTART:" + e.Start.UTC().Format(utcFormat))
+	line("DTEND:" + e.End.UTC().Format(utcFormat))
+	line("SUMMARY:" + escape(e.Summary))
+	if e.Location != "" {
+		line("LOCATION:" + escape(e.Location))
+	}
+	if e.Description != "" {
+		line("DESCRIPTION:" + escape(e.Description))
+	}
+	line("ORGANIZER" + cn(e.Organizer.Name) + ":mailto:" + e.Organizer.Address)
+	for _, a := range e.Attendees {
+		line("ATTENDEE" + cn(a.Name) + ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + a.Address)
+	}
+	line("SEQUENCE:0")
+	line("STATUS:CONFIRMED")
+	line("TRANSP:OPAQUE")
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// escape escapes the characters that mean something in a text value
+func escape(s string) string {
+
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// cn returns the CN parameter with a person's name, a parameter value can't
+// hold a double quote so those are dropped
+func cn(name string) string {
+
+	name = strings.ReplaceAll(strings.TrimSpace(name), `"`, "")
+	if name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(`;CN="%s"`, name)
+}
+
+// fold breaks a line into lines of at most 75 octets, each one after the
+// first starting with a space. A character is never split in two.
+func fold(s string) string {
+
+	const limit = 75
+
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+
+	return b.String()
+}
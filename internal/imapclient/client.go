@@ -0,0 +1,311 @@
+package imapclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// Client wraps an IMAP connection which has already been logged in
+type Client struct {
+	c *client.Client
+}
+
+// Dial connects to the IMAP server and logs in with the configured credentials
+func Dial(cfg config.IMAP) (*Client, error) {
+
+	var (
+		c   *client.Client
+		err error
+	)
+
+	if cfg.Insecure {
+		c, err = client.Dial(cfg.Addr())
+	} else {
+		c, err = client.DialTLS(cfg.Addr(), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", cfg.Addr(), err)
+	}
+
+	if err = c.Login(cfg.Username, cfg.Password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("could not log in: %w", err)
+	}
+
+	return &Client{c: c}, nil
+}
+
+// Close logs out and closes the connection
+func (c *Client) Close() error {
+	return c.c.Logout()
+}
+
+// Envelopes returns the envelopes of the newest messages in the mailbox,
+// newest first, up to the given limit
+func (c *Client) Envelopes(name string, limit int) ([]mailbox.Envelope, error) {
+
+	status, err := c.c.Select(name, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not select %s: %w", name, err)
+	}
+
+	if status.Messages == 0 {
+		return nil, nil
+	}
+
+	// sequence numbers start at 1, so we fetch the last `limit` of them
+	from := uint32(1)
+	if status.Messages > uint32(limit) {
+		from = status.Messages - uint32(limit) + 1
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(from, status.Messages)
+
+	// the envelope has no References, so we fetch that header on its own
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid, referencesSection.FetchItem()}
+
+	messages := make(chan *imap.Message, limit)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.c.Fetch(seqset, items, messages)
+	}()
+
+	var envelopes []mailbox.Envelope
+	for msg := range messages {
+		envelopes = append([]mailbox.Envelope{toEnvelope(msg)}, envelopes...)
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("could not fetch messages: %w", err)
+	}
+
+	return envelopes, nil
+}
+
+// Message returns the raw message with the given UID, without marking it as seen
+func (c *Client) Message(name, id string) ([]byte, error) {
+
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %q", id)
+	}
+
+	if _, err := c.c.Select(name, true); err != nil {
+		return nil, fmt.Errorf("could not select %s: %w", name, err)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+
+	// BODY.PEEK[] fetches the whole message and leaves the \Seen flag alone
+	section := &imap.BodySectionName{Peek: true}
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.c.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var raw []byte
+	for msg := range messages {
+		if r := msg.GetBody(section); r != nil {
+			if raw, err = io.ReadAll(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("could not fetch message: %w", err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("message %s is no longer in %s", id, name)
+	}
+
+	return raw, nil
+}
+
+// Folders returns the names of every folder on the server, in order
+func (c *Client) Folders() ([]string, error) {
+
+	mailboxes := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.c.List("", "*", mailboxes)
+	}()
+
+	var names []string
+	for m := range mailboxes {
+		// some servers list folders that only hold other folders, they can't be opened
+		if !hasAttribute(m.Attributes, imap.NoSelectAttr) {
+			names = append(names, m.Name)
+		}
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("could not list folders: %w", err)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateFolder makes a new, empty folder
+func (c *Client) CreateFolder(name string) error {
+	if err := c.c.Create(name); err != nil {
+		return fmt.Errorf("could not create %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteFolder removes a folder, and the messages in it, from the server
+func (c *Client) DeleteFolder(name string) error {
+	if err := c.c.Delete(name); err != nil {
+		return fmt.Errorf("could not delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// SetFlag sets or clears one of the mailbox flags on the message with the given UID
+func (c *Client) SetFlag(name, id, flag string, on bool) error {
+
+	seqset, err := uidSet(id)
+	if err != nil {
+		return err
+	}
+	imapFlag, ok := flags[flag]
+	if !ok {
+		return fmt.Errorf("unknown flag %q", flag)
+	}
+
+	if _, err := c.c.Select(name, false); err != nil {
+		return fmt.Errorf("could not select %s: %w", name, err)
+	}
+
+	var op imap.FlagsOp = imap.AddFlags
+	if !on {
+		op = imap.RemoveFlags
+	}
+	// the server doesn't need to tell us the flags it ended up with, we know them
+	if err := c.c.UidStore(seqset, imap.FormatFlagsOp(op, true), []interface{}{imapFlag}, nil); err != nil {
+		return fmt.Errorf("could not change flags: %w", err)
+	}
+	return nil
+}
+
+// Move moves the message with the given UID into another folder. Servers
+// without the MOVE extension get a copy, and the original is deleted.
+func (c *Client) Move(name, id, dest string) error {
+
+	seqset, err := uidSet(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.c.Select(name, false); err != nil {
+		return fmt.Errorf("could not select %s: %w", name, err)
+	}
+	if err := c.c.UidMove(seqset, dest); err != nil {
+		return fmt.Errorf("could not move message to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// Expunge removes the messages marked as deleted from the folder for good
+func (c *Client) Expunge(name string) error {
+
+	if _, err := c.c.Select(name, false); err != nil {
+		return fmt.Errorf("could not select %s: %w", name, err)
+	}
+	if err := c.c.Expunge(nil); err != nil {
+		return fmt.Errorf("could not expunge %s: %w", name, err)
+	}
+	return nil
+}
+
+// flags maps the mailbox flags to IMAP's
+var flags = map[string]string{
+	mailbox.FlagSeen:    imap.SeenFlag,
+	mailbox.FlagFlagged: imap.FlaggedFlag,
+	mailbox.FlagDeleted: imap.DeletedFlag,
+}
+
+// uidSet parses a message id, which is its UID, into a set holding just it
+func uidSet(id string) (*imap.SeqSet, error) {
+
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %q", id)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+	return seqset, nil
+}
+
+// hasAttribute reports whether the folder has the attribute
+func hasAttribute(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesSection is the References header of a message, fetched without marking it as seen
+var referencesSection = &imap.BodySectionName{
+	BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: []string{"References"}},
+	Peek:         true,
+}
+
+// toEnvelope converts a fetched message into an Envelope,
+// the message's UID is used as its ID
+func toEnvelope(msg *imap.Message) mailbox.Envelope {
+
+	e := mailbox.Envelope{ID: strconv.FormatUint(uint64(msg.Uid), 10)}
+
+	if msg.Envelope != nil {
+		e.Subject = msg.Envelope.Subject
+		e.Date = msg.Envelope.Date
+		e.MessageID = msg.Envelope.MessageId
+		e.InReplyTo = msg.Envelope.InReplyTo
+		if len(msg.Envelope.From) > 0 {
+			from := msg.Envelope.From[0]
+			e.From = from.PersonalName
+			if e.From == "" {
+				e.From = from.Address()
+			}
+		}
+	}
+
+	if r := msg.GetBody(referencesSection); r != nil {
+		if h, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader(); err == nil {
+			e.References = mailbox.ParseReferences(h.Get("References"))
+		}
+	}
+
+	for _, flag := range msg.Flags {
+		switch flag {
+		case imap.SeenFlag:
+			e.Seen = true
+		case imap.FlaggedFlag:
+			e.Flagged = true
+		case imap.DeletedFlag:
+			e.Deleted = true
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,107 @@
+package imapclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/emersion/go-imap/client"
+)
+
+// maxBackoff is the longest we'll wait before reconnecting after an error
+const maxBackoff = 5 * time.Minute
+
+// Watch keeps an IDLE connection open on the configured mailbox and calls
+// onNew with the number of new messages whenever the server reports that
+// messages have arrived. If the connection drops, Watch reconnects with
+// an increasing delay. It only returns once the context is cancelled.
+func Watch(ctx context.Context, cfg config.IMAP, onNew func(count uint32)) {
+
+	backoff := time.Second
+
+	for {
+		started := time.Now()
+		_ = watch(ctx, cfg, onNew)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// if the connection stayed up for a while it was probably a one off,
+		// so we start backing off from the beginning again
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watch runs a single IDLE session until the connection fails or the context is cancelled
+func watch(ctx context.Context, cfg config.IMAP, onNew func(count uint32)) error {
+
+	c, err := Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	status, err := c.c.Select(cfg.MailboxName(), true)
+	if err != nil {
+		return err
+	}
+	known := status.Messages
+
+	// the client blocks until updates are read, so the loop below must keep draining this channel
+	updates := make(chan client.Update, 16)
+	c.c.Updates = updates
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.c.Idle(stop, nil)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(stop)
+			return waitIdle(done, updates)
+
+		case err := <-done:
+			return err
+
+		case update := <-updates:
+			switch u := update.(type) {
+			case *client.MailboxUpdate:
+				if u.Mailbox.Messages > known {
+					onNew(u.Mailbox.Messages - known)
+				}
+				known = u.Mailbox.Messages
+			case *client.ExpungeUpdate:
+				if known > 0 {
+					known--
+				}
+			}
+		}
+	}
+}
+
+// waitIdle waits for the IDLE command to finish while discarding any late updates
+func waitIdle(done <-chan error, updates <-chan client.Update) error {
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-updates:
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package jmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// the capabilities we use, see RFC 8620 and RFC 8621
+const (
+	coreCapability       = "urn:ietf:params:jmap:core"
+	mailCapability       = "urn:ietf:params:jmap:mail"
+	submissionCapability = "urn:ietf:params:jmap:submission"
+)
+
+// session is the subset of the JMAP session resource we care about
+type session struct {
+	APIURL          string            `json:"apiUrl"`
+	UploadURL       string            `json:"uploadUrl"`
+	DownloadURL     string            `json:"downloadUrl"`
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+}
+
+// invocation is a single method call or response, which JMAP sends as
+// a three element array of [name, arguments, call id]
+type invocation struct {
+	Name   string
+	Args   json.RawMessage
+	CallID string
+}
+
+func (i invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{i.Name, i.Args, i.CallID})
+}
+
+func (i *invocation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("jmap: invocation has %d parts, expected 3", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &i.Name); err != nil {
+		return err
+	}
+	i.Args = parts[1]
+	return json.Unmarshal(parts[2], &i.CallID)
+}
+
+// methodError is the arguments of an "error" response
+type methodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Client talks to a JMAP server on behalf of one account
+type Client struct {
+	cfg     config.JMAP
+	http    *http.Client
+	session session
+}
+
+// Dial fetches the JMAP session so we know where to send requests
+func Dial(cfg config.JMAP) (*Client, error) {
+
+	c := &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cfg.SessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.do(req, &c.session); err != nil {
+		return nil, fmt.Errorf("could not fetch jmap session: %w", err)
+	}
+
+	if c.session.APIURL == "" || c.mailAccount() == "" {
+		return nil, fmt.Errorf("jmap server does not offer mail for this account")
+	}
+
+	return c, nil
+}
+
+// mailAccount returns the id of the account that holds our mail
+func (c *Client) mailAccount() string {
+	return c.session.PrimaryAccounts[mailCapability]
+}
+
+// submissionAccount returns the id of the account we submit mail through
+func (c *Client) submissionAccount() string {
+	if id := c.session.PrimaryAccounts[submissionCapability]; id != "" {
+		return id
+	}
+	return c.mailAccount()
+}
+
+// authorize adds the configured credentials to a request
+func (c *Client) authorize(req *http.Request) {
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+		return
+	}
+	req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+}
+
+// do sends the request and decodes the JSON response into v
+func (c *Client) do(req *http.Request, v interface{}) error {
+
+	c.authorize(req)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("jmap server returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// call makes a single API request containing the given method calls and
+// returns the responses keyed by call id. If any call failed we return
+// its error instead.
+func (c *Client) call(calls ...invocation) (map[string]invocation, error) {
+
+	body, err := json.Marshal(struct {
+		Using       []string     `json:"using"`
+		MethodCalls []invocation `json:"methodCalls"`
+	}{
+		Using:       []string{coreCapability, mailCapability, submissionCapability},
+		MethodCalls: calls,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.session.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		MethodResponses []invocation `json:"methodResponses"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]invocation, len(res.MethodResponses))
+	for _, r := range res.MethodResponses {
+		if r.Name == "error" {
+			var e methodError
+			json.Unmarshal(r.Args, &e)
+			return nil, fmt.Errorf("jmap: %s failed: %s %s", r.CallID, e.Type, e.Description)
+		}
+		responses[r.CallID] = r
+	}
+
+	return responses, nil
+}
+
+// method builds an invocation from its name, arguments and call id
+func method(name string, args interface{}, id string) invocation {
+	raw, _ := json.Marshal(args)
+	return invocation{Name: name, Args: raw, CallID: id}
+}
+
+// ref is a JMAP result reference, letting one call use the result of an earlier one
+type ref struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
@@ -0,0 +1,316 @@
+package jmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/mailbox"
+)
+
+// emailAddress is how JMAP represents an address in headers and envelopes
+type emailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// email is the subset of the Email object we fetch for the inbox
+type email struct {
+	ID         string          `json:"id"`
+	From       []emailAddress  `json:"from"`
+	Subject    string          `json:"subject"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Keywords   map[string]bool `json:"keywords"`
+	MessageID  []string        `json:"messageId"`
+	InReplyTo  []string        `json:"inReplyTo"`
+	References []string        `json:"references"`
+}
+
+// mailboxes returns the ids of the account's mailboxes keyed by role, e.g. "inbox" or "sent"
+func (c *Client) mailboxes() (map[string]string, error) {
+
+	res, err := c.call(method("Mailbox/get", map[string]interface{}{
+		"accountId":  c.mailAccount(),
+		"properties": []string{"id", "role"},
+	}, "mailboxes"))
+	if err != nil {
+		return nil, err
+	}
+
+	var got struct {
+		List []struct {
+			ID   string `json:"id"`
+			Role string `json:"role"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(res["mailboxes"].Args, &got); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]string)
+	for _, m := range got.List {
+		if m.Role != "" {
+			roles[m.Role] = m.ID
+		}
+	}
+
+	return roles, nil
+}
+
+// Envelopes returns the newest messages in the inbox, newest first, up to the given limit
+func (c *Client) Envelopes(limit int) ([]mailbox.Envelope, error) {
+
+	roles, err := c.mailboxes()
+	if err != nil {
+		return nil, err
+	}
+
+	inbox, ok := roles["inbox"]
+	if !ok {
+		return nil, fmt.Errorf("jmap account has no inbox")
+	}
+
+	// we query and fetch in one round trip by referencing the ids the query returns
+	res, err := c.call(
+		method("Email/query", map[string]interface{}{
+			"accountId": c.mailAccount(),
+			"filter":    map[string]string{"inMailbox": inbox},
+			"sort":      []map[string]interface{}{{"property": "receivedAt", "isAscending": false}},
+			"limit":     limit,
+		}, "query"),
+		method("Email/get", map[string]interface{}{
+			"accountId":  c.mailAccount(),
+			"#ids":       ref{ResultOf: "query", Name: "Email/query", Path: "/ids"},
+			"properties": []string{"id", "from", "subject", "receivedAt", "keywords", "messageId", "inReplyTo", "references"},
+		}, "get"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var got struct {
+		List []email `json:"list"`
+	}
+	if err := json.Unmarshal(res["get"].Args, &got); err != nil {
+		return nil, err
+	}
+
+	envelopes := make([]mailbox.Envelope, len(got.List))
+	for i, e := range got.List {
+		envelopes[i] = mailbox.Envelope{
+			ID:      e.ID,
+			Subject: e.Subject,
+			Date:    e.ReceivedAt,
+			Seen:    e.Keywords["$seen"],
+
+			References: e.References,
+		}
+		if len(e.MessageID) > 0 {
+			envelopes[i].MessageID = e.MessageID[0]
+		}
+		if len(e.InReplyTo) > 0 {
+			envelopes[i].InReplyTo = e.InReplyTo[0]
+		}
+		if len(e.From) > 0 {
+			envelopes[i].From = e.From[0].Name
+			if envelopes[i].From == "" {
+				envelopes[i].From = e.From[0].Email
+			}
+		}
+	}
+
+	return envelopes, nil
+}
+
+// Message returns the raw message with the given email id
+func (c *Client) Message(id string) ([]byte, error) {
+
+	res, err := c.call(method("Email/get", map[string]interface{}{
+		"accountId":  c.mailAccount(),
+		"ids":        []string{id},
+		"properties": []string{"blobId"},
+	}, "get"))
+	if err != nil {
+		return nil, err
+	}
+
+	var got struct {
+		List []struct {
+			BlobID string `json:"blobId"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(res["get"].Args, &got); err != nil {
+		return nil, err
+	}
+	if len(got.List) == 0 {
+		return nil, fmt.Errorf("jmap message %s no longer exists", id)
+	}
+
+	// the download url is a template, see RFC 8620 section 6.2
+	link := strings.NewReplacer(
+		"{accountId}", url.PathEscape(c.mailAccount()),
+		"{blobId}", url.PathEscape(got.List[0].BlobID),
+		"{type}", url.QueryEscape("message/rfc822"),
+		"{name}", url.PathEscape("message.eml"),
+	).Replace(c.session.DownloadURL)
+
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+
+	r, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, fmt.Errorf("could not download message: jmap server returned %s", r.Status)
+	}
+
+	return io.ReadAll(r.Body)
+}
+
+// upload stores the raw message on the server and returns its blob id
+func (c *Client) upload(msg []byte) (string, error) {
+
+	url := strings.ReplaceAll(c.session.UploadURL, "{accountId}", c.mailAccount())
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(msg))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "message/rfc822")
+
+	var res struct {
+		BlobID string `json:"blobId"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return "", fmt.Errorf("could not upload message: %w", err)
+	}
+
+	return res.BlobID, nil
+}
+
+// identity returns the id of the sending identity for the given address
+func (c *Client) identity(from string) (string, error) {
+
+	res, err := c.call(method("Identity/get", map[string]interface{}{
+		"accountId": c.submissionAccount(),
+	}, "identities"))
+	if err != nil {
+		return "", err
+	}
+
+	var got struct {
+		List []struct {
+			ID    string `json:"id"`
+			Email string `json:"email"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(res["identities"].Args, &got); err != nil {
+		return "", err
+	}
+
+	for _, i := range got.List {
+		if strings.EqualFold(i.Email, from) {
+			return i.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("no jmap identity allows sending as %s", from)
+}
+
+// Send submits the raw message for delivery. The message is uploaded and
+// imported into Drafts, then submitted with the given envelope. Once the
+// server accepts the submission it moves the message into Sent. It returns
+// the id of the submission.
+func (c *Client) Send(from string, to []string, msg []byte) (string, error) {
+
+	roles, err := c.mailboxes()
+	if err != nil {
+		return "", err
+	}
+
+	drafts, sent := roles["drafts"], roles["sent"]
+	if drafts == "" || sent == "" {
+		return "", fmt.Errorf("jmap account needs a drafts and a sent mailbox")
+	}
+
+	identity, err := c.identity(from)
+	if err != nil {
+		return "", err
+	}
+
+	blob, err := c.upload(msg)
+	if err != nil {
+		return "", err
+	}
+
+	rcpts := make([]emailAddress, len(to))
+	for i, addr := range to {
+		rcpts[i] = emailAddress{Email: addr}
+	}
+
+	res, err := c.call(
+		method("Email/import", map[string]interface{}{
+			"accountId": c.mailAccount(),
+			"emails": map[string]interface{}{
+				"draft": map[string]interface{}{
+					"blobId":     blob,
+					"mailboxIds": map[string]bool{drafts: true},
+					"keywords":   map[string]bool{"$draft": true, "$seen": true},
+				},
+			},
+		}, "import"),
+		method("EmailSubmission/set", map[string]interface{}{
+			"accountId": c.submissionAccount(),
+			"create": map[string]interface{}{
+				"submission": map[string]interface{}{
+					"identityId": identity,
+					"emailId":    "#draft",
+					"envelope": map[string]interface{}{
+						"mailFrom": emailAddress{Email: from},
+						"rcptTo":   rcpts,
+					},
+				},
+			},
+			// once it has been submitted the message stops being a draft
+			"onSuccessUpdateEmail": map[string]interface{}{
+				"#submission": map[string]interface{}{
+					"mailboxIds/" + drafts: nil,
+					"mailboxIds/" + sent:   true,
+					"keywords/$draft":      nil,
+				},
+			},
+		}, "submit"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	// set methods report per object failures in notCreated rather than as method errors
+	var submission string
+	for _, id := range []string{"import", "submit"} {
+		var set struct {
+			Created map[string]struct {
+				ID string `json:"id"`
+			} `json:"created"`
+			NotCreated map[string]methodError `json:"notCreated"`
+		}
+		json.Unmarshal(res[id].Args, &set)
+		for _, e := range set.NotCreated {
+			return "", fmt.Errorf("jmap: %s failed: %s %s", id, e.Type, e.Description)
+		}
+		submission = set.Created["submission"].ID
+	}
+
+	return submission, nil
+}
@@ -0,0 +1,491 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/contacts"
+)
+
+// We only need to look people up, so rather than pulling in a whole LDAP
+// library we speak just enough of the protocol, see RFC 4511: a bind, a
+// search and an unbind. Every message is BER encoded, which means each value
+// is a tag, its length and then its contents, and values nest inside others.
+
+// maxResults is how many entries we ask the directory for, enough to pick from while typing
+const maxResults = 20
+
+// startTLS is the name of the extended operation which switches the connection to TLS, RFC 4511 section 4.14
+const startTLS = "1.3.6.1.4.1.1466.20037"
+
+// the BER tags we send and receive
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+
+	tagBindRequest      = 0x60
+	tagBindResponse     = 0x61
+	tagUnbindRequest    = 0x42
+	tagSearchRequest    = 0x63
+	tagSearchEntry      = 0x64
+	tagSearchDone       = 0x65
+	tagSearchReference  = 0x73
+	tagExtendedRequest  = 0x77
+	tagExtendedResponse = 0x78
+	tagSimpleAuth       = 0x80
+	tagExtendedName     = 0x80
+	tagFilterOr         = 0xa1
+	tagFilterSubstrings = 0xa4
+	tagSubstringsAny    = 0x81
+)
+
+// result codes we treat as success, a directory which has more entries
+// than we asked for says so with sizeLimitExceeded but still sends them
+const (
+	resultSuccess           = 0
+	resultSizeLimitExceeded = 4
+)
+
+// attributes are what we ask for of every entry
+var attributes = []string{"cn", "displayName", "mail", "o"}
+
+// element is a decoded BER value, the contents of constructed ones are
+// split into their children with children()
+type element struct {
+	tag      byte
+	contents []byte
+}
+
+// Search returns the people in the directory whose name or address contains the query
+func Search(ctx context.Context, cfg config.LDAP, query string) ([]contacts.Contact, error) {
+
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if cfg.BindDN != "" {
+		if err := c.bind(cfg.BindDN, cfg.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.search(cfg.BaseDN, query)
+}
+
+// conn is a connection to the directory
+type conn struct {
+	net.Conn
+	r  *bufio.Reader
+	id int // the message ID of the last request
+}
+
+// dial connects to the directory, switching to TLS first when it should
+func dial(ctx context.Context, cfg config.LDAP) (*conn, error) {
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %q is not a valid URL: %w", cfg.URL, err)
+	}
+
+	port := u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("ldap: %q should start with ldap:// or ldaps://", cfg.URL)
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	tlsConfig := &tls.Config{ServerName: u.Hostname()}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+
+	// a lookup happens while typing, so it has to give up rather than hang
+	deadline := time.Now().Add(10 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	raw.SetDeadline(deadline)
+
+	if u.Scheme == "ldaps" {
+		raw = tls.Client(raw, tlsConfig)
+	}
+	c := &conn{Conn: raw, r: bufio.NewReader(raw)}
+
+	if u.Scheme == "ldap" && !cfg.Insecure {
+		if err := c.startTLS(); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(raw, tlsConfig)
+		c.Conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	return c, nil
+}
+
+// startTLS asks the server to switch the plain connection to TLS
+func (c *conn) startTLS() error {
+
+	resp, err := c.request(tlv(tagExtendedRequest, tlv(tagExtendedName, []byte(startTLS))), tagExtendedResponse)
+	if err != nil {
+		return fmt.Errorf("ldap: StartTLS failed: %w", err)
+	}
+
+	return checkResult(resp, "StartTLS")
+}
+
+// bind logs in with a name and a password
+func (c *conn) bind(dn, password string) error {
+
+	req := tlv(tagBindRequest,
+		integer(3),
+		octetString(dn),
+		tlv(tagSimpleAuth, []byte(password)),
+	)
+
+	resp, err := c.request(req, tagBindResponse)
+	if err != nil {
+		return fmt.Errorf("ldap: could not log in: %w", err)
+	}
+
+	return checkResult(resp, "logging in")
+}
+
+// search looks for entries under the base whose name or address contains the query
+func (c *conn) search(base, query string) ([]contacts.Contact, error) {
+
+	// (|(cn=*query*)(mail=*query*)(displayName=*query*))
+	var filters [][]byte
+	for _, attr := range []string{"cn", "mail", "displayName"} {
+		filters = append(filters, tlv(tagFilterSubstrings,
+			octetString(attr),
+			tlv(tagSequence, tlv(tagSubstringsAny, []byte(query))),
+		))
+	}
+
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, octetString(a))
+	}
+
+	req := tlv(tagSearchRequest,
+		octetString(base),
+		enumerated(2), // the whole subtree under the base
+		enumerated(0), // never dereference aliases
+		integer(maxResults),
+		integer(5), // seconds the server may spend on it
+		tlv(tagBoolean, []byte{0}),
+		tlv(tagFilterOr, filters...),
+		tlv(tagSequence, attrs...),
+	)
+	if err := c.send(req); err != nil {
+		return nil, err
+	}
+
+	// the server sends an entry per match, then a message saying it is done
+	var found []contacts.Contact
+	for {
+		op, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case tagSearchEntry:
+			if contact, ok := entryContact(op); ok {
+				found = append(found, contact)
+			}
+		case tagSearchReference:
+			// a pointer to another server, we don't follow those
+		case tagSearchDone:
+			if err := checkResult(op, "searching"); err != nil {
+				return nil, err
+			}
+			return found, nil
+		default:
+			return nil, fmt.Errorf("ldap: unexpected reply %#x to a search", op.tag)
+		}
+	}
+}
+
+// close says goodbye to the server and hangs up
+func (c *conn) close() {
+	c.id++
+	c.Write(tlv(tagSequence, integer(c.id), []byte{tagUnbindRequest, 0}))
+	c.Conn.Close()
+}
+
+// request sends an operation and reads the reply, which should have the given tag
+func (c *conn) request(op []byte, want byte) (element, error) {
+
+	if err := c.send(op); err != nil {
+		return element{}, err
+	}
+
+	resp, err := c.receive()
+	if err != nil {
+		return element{}, err
+	}
+	if resp.tag != want {
+		return element{}, fmt.Errorf("unexpected reply %#x", resp.tag)
+	}
+
+	return resp, nil
+}
+
+// send wraps an operation in a message with the next message ID
+func (c *conn) send(op []byte) error {
+	c.id++
+	_, err := c.Write(tlv(tagSequence, integer(c.id), op))
+	return err
+}
+
+// receive reads the next message and returns the operation in it
+func (c *conn) receive() (element, error) {
+
+	msg, err := readElement(c.r)
+	if err != nil {
+		return element{}, fmt.Errorf("ldap: could not read the reply: %w", err)
+	}
+	if msg.tag != tagSequence {
+		return element{}, fmt.Errorf("ldap: the reply is not an LDAP message")
+	}
+
+	parts, err := msg.children()
+	if err != nil || len(parts) < 2 {
+		return element{}, fmt.Errorf("ldap: the reply is not an LDAP message")
+	}
+
+	return parts[1], nil
+}
+
+// checkResult returns an error for a reply whose result code isn't a success
+func checkResult(resp element, doing string) error {
+
+	parts, err := resp.children()
+	if err != nil || len(parts) < 3 || parts[0].tag != tagEnumerated {
+		return fmt.Errorf("ldap: the reply to %s is broken", doing)
+	}
+
+	code := parts[0].integer()
+	if code == resultSuccess || code == resultSizeLimitExceeded {
+		return nil
+	}
+
+	message := string(parts[2].contents)
+	if message == "" {
+		message = fmt.Sprintf("result code %d", code)
+	}
+
+	return fmt.Errorf("ldap: %s failed: %s", doing, message)
+}
+
+// entryContact turns a search result entry into a contact, entries without an address are skipped
+func entryContact(entry element) (contacts.Contact, bool) {
+
+	parts, err := entry.children()
+	if err != nil || len(parts) < 2 {
+		return contacts.Contact{}, false
+	}
+	attrs, err := parts[1].children()
+	if err != nil {
+		return contacts.Contact{}, false
+	}
+
+	var c contacts.Contact
+	var cn string
+	for _, attr := range attrs {
+		pair, err := attr.children()
+		if err != nil || len(pair) < 2 {
+			continue
+		}
+		vals, err := pair[1].children()
+		if err != nil || len(vals) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(string(pair[0].contents)) {
+		case "displayname":
+			c.Name = string(vals[0].contents)
+		case "cn":
+			cn = string(vals[0].contents)
+		case "o":
+			c.Organization = string(vals[0].contents)
+		case "mail":
+			for _, v := range vals {
+				c.Emails = append(c.Emails, string(v.contents))
+			}
+		}
+	}
+
+	// the display name is the one people chose, the common name is what's left otherwise
+	if c.Name == "" {
+		c.Name = cn
+	}
+
+	return c, len(c.Emails) > 0
+}
+
+// tlv encodes a value with its tag and length in front of it
+func tlv(tag byte, contents ...[]byte) []byte {
+
+	var body []byte
+	for _, c := range contents {
+		body = append(body, c...)
+	}
+
+	// a short length fits in one byte, a longer one is preceded by how many bytes it takes
+	out := []byte{tag}
+	n := len(body)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return append(out, body...)
+}
+
+// integer encodes a small non negative number
+func integer(n int) []byte {
+	return tlv(tagInteger, intBytes(n))
+}
+
+// enumerated encodes one of a list of choices
+func enumerated(n int) []byte {
+	return tlv(tagEnumerated, intBytes(n))
+}
+
+// octetString encodes a string
+func octetString(s string) []byte {
+	return tlv(tagOctetString, []byte(s))
+}
+
+// intBytes returns the shortest big endian encoding of n, with a leading
+// zero when the top bit is set so it isn't read as negative
+func intBytes(n int) []byte {
+
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if n == 0 {
+			break
+		}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+
+	return b
+}
+
+// readElement reads one BER value from r
+func readElement(r io.ByteReader) (element, error) {
+
+	tag, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return element{}, err
+	}
+
+	contents := make([]byte, length)
+	for i := range contents {
+		if contents[i], err = r.ReadByte(); err != nil {
+			return element{}, err
+		}
+	}
+
+	return element{tag: tag, contents: contents}, nil
+}
+
+// readLength reads the length of a value, up to 16MB which is far more than any reply we expect
+func readLength(r io.ByteReader) (int, error) {
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+
+	count := int(first & 0x7f)
+	if count == 0 || count > 3 {
+		return 0, errors.New("unsupported length")
+	}
+
+	length := 0
+	for i := 0; i < count; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	return length, nil
+}
+
+// children splits a constructed value into the values inside it
+func (e element) children() ([]element, error) {
+
+	var out []element
+	r := strings.NewReader(string(e.contents))
+	for r.Len() > 0 {
+		child, err := readElement(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, child)
+	}
+
+	return out, nil
+}
+
+// integer reads the value as a number
+func (e element) integer() int {
+
+	n := 0
+	for i, b := range e.contents {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int(b)
+	}
+
+	return n
+}
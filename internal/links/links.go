@@ -0,0 +1,130 @@
+package links
+
+import (
+	"html"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Link is a link found in a message. In HTML it has the text it is shown as,
+// which can say one thing while the link goes somewhere else.
+type Link struct {
+	URL  string
+	Text string // what the link says in HTML, empty in plain text
+}
+
+var (
+	// a link in plain text, with or without its scheme
+	plainLink = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"'` + "`" + `]+`)
+
+	// an anchor in HTML, its href and what's inside it
+	anchor = regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)[^>]*>(.*?)</a\s*>`)
+
+	// any tag, it is taken out of the text of an anchor
+	tag = regexp.MustCompile(`(?s)<[^>]*>`)
+
+	// something that looks like a host name, like example.com
+	hostLike = regexp.MustCompile(`(?i)^(?:[a-z][a-z0-9+.-]*://)?(?:[a-z0-9-]+\.)+[a-z]{2,}(?:[:/?#].*)?$`)
+)
+
+// Find returns the links in plain text, in the order they come in
+func Find(text string) []Link {
+
+	var links []Link
+	for _, u := range plainLink.FindAllString(text, -1) {
+		links = append(links, Link{URL: trim(u)})
+	}
+	return links
+}
+
+// trim takes the punctuation a sentence puts after a link off its end,
+// leaving closing brackets whose opening one is in the link
+func trim(u string) string {
+
+	for u != "" {
+		last := u[len(u)-1]
+		switch {
+		case strings.ContainsRune(".,;:!?'\"", rune(last)):
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"):
+		case last == ']' && strings.Count(u, "[") < strings.Count(u, "]"):
+		default:
+			return u
+		}
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
+// Anchors returns the links in HTML, with the text they are shown as
+func Anchors(doc string) []Link {
+
+	var links []Link
+	for _, m := range anchor.FindAllStringSubmatch(doc, -1) {
+		href := strings.Trim(m[1], `"'`)
+		text := html.UnescapeString(tag.ReplaceAllString(m[2], ""))
+		links = append(links, Link{
+			URL:  strings.TrimSpace(html.UnescapeString(href)),
+			Text: strings.Join(strings.Fields(text), " "),
+		})
+	}
+	return links
+}
+
+// Mismatched reports whether the text of the link reads like an address,
+// but of another site than the one the link goes to. That is what phishing
+// looks like, and what a link pasted over the wrong text looks like too.
+func (l Link) Mismatched() bool {
+
+	if l.Text == "" || !hostLike.MatchString(l.Text) {
+		return false
+	}
+	shown, goes := host(l.Text), host(l.URL)
+	if goes == "" {
+		// a mailto: or a link inside the message doesn't go to a site
+		return false
+	}
+	return shown != goes
+}
+
+// Internal reports whether the link goes somewhere only reachable from
+// inside a network, so it won't work for whoever gets the message
+func (l Link) Internal() bool {
+
+	h := host(l.URL)
+	if h == "" {
+		return false
+	}
+	if ip := net.ParseIP(h); ip != nil {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+	}
+	if !strings.Contains(h, ".") {
+		// like http://intranet/ or http://localhost:8080/
+		return true
+	}
+	for _, suffix := range []string{".local", ".localhost", ".internal", ".intranet", ".corp", ".lan", ".home.arpa"} {
+		if strings.HasSuffix(h, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// host returns the host a link goes to, in lower case and without a
+// leading www., or empty if it doesn't go to one
+func host(link string) string {
+
+	if !strings.Contains(link, "://") {
+		if strings.Contains(link, ":") && !hostLike.MatchString(link) {
+			// mailto:, tel: and the like
+			return ""
+		}
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
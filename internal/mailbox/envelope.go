@@ -0,0 +1,27 @@
+package mailbox
+
+import "time"
+
+// Envelope is a summary of a message shown in the inbox list,
+// every backend converts its own message type into one of these
+type Envelope struct {
+	ID      string
+	From    string
+	Subject string
+	Date    time.Time
+	Seen    bool
+	Flagged bool
+	Deleted bool // marked to be removed the next time the folder is expunged
+
+	// the threading headers, used to group the inbox by conversation
+	MessageID  string
+	InReplyTo  string
+	References []string
+}
+
+// the flags a message can be marked with, every backend maps them to its own
+const (
+	FlagSeen    = "seen"
+	FlagFlagged = "flagged"
+	FlagDeleted = "deleted"
+)
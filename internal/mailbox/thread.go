@@ -0,0 +1,95 @@
+package mailbox
+
+import (
+	"sort"
+	"strings"
+)
+
+// Threads groups envelopes into conversations using their Message-ID,
+// In-Reply-To and References headers. Messages in a conversation are
+// oldest first and conversations are ordered by their newest message,
+// so the thread with the latest activity comes first.
+func Threads(envelopes []Envelope) [][]Envelope {
+
+	// every message id we know of points towards the root of its thread, we
+	// link a message with every message it refers to, so threads join up
+	// even when some of the messages in between aren't in the list
+	parent := make(map[string]string)
+	var root func(id string) string
+	root = func(id string) string {
+		p, ok := parent[id]
+		if !ok || p == id {
+			parent[id] = id
+			return id
+		}
+		r := root(p)
+		parent[id] = r
+		return r
+	}
+	link := func(a, b string) {
+		if ra, rb := root(a), root(b); ra != rb {
+			parent[ra] = rb
+		}
+	}
+
+	keys := make([]string, len(envelopes))
+	for i, e := range envelopes {
+		// messages without an id only ever thread with themselves
+		keys[i] = NormalizeID(e.MessageID)
+		if keys[i] == "" {
+			keys[i] = "\x00" + e.ID
+		}
+		root(keys[i])
+
+		for _, ref := range e.References {
+			if ref = NormalizeID(ref); ref != "" {
+				link(keys[i], ref)
+			}
+		}
+		if ref := NormalizeID(e.InReplyTo); ref != "" {
+			link(keys[i], ref)
+		}
+	}
+
+	groups := make(map[string][]Envelope)
+	var order []string
+	for i, e := range envelopes {
+		r := root(keys[i])
+		if _, ok := groups[r]; !ok {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], e)
+	}
+
+	threads := make([][]Envelope, len(order))
+	for i, r := range order {
+		thread := groups[r]
+		sort.SliceStable(thread, func(a, b int) bool { return thread[a].Date.Before(thread[b].Date) })
+		threads[i] = thread
+	}
+
+	sort.SliceStable(threads, func(a, b int) bool {
+		return threads[a][len(threads[a])-1].Date.After(threads[b][len(threads[b])-1].Date)
+	})
+
+	return threads
+}
+
+// NormalizeID strips the angle brackets and spaces around a message id,
+// backends don't agree on whether to keep them
+func NormalizeID(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
+}
+
+// ParseReferences splits a References header into its message ids
+func ParseReferences(header string) []string {
+
+	var ids []string
+	for _, id := range strings.Fields(strings.NewReplacer("<", " <", ">", "> ").Replace(header)) {
+		if id = NormalizeID(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
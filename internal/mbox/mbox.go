@@ -0,0 +1,135 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// We use the mboxrd variant, where every line starting with any number of
+// '>' followed by "From " gets one more '>' when written and loses one when
+// read back. Unlike the original mbox format this is fully reversible.
+// See https://www.loc.gov/preservation/digital/formats/fdd/fdd000385.shtml
+
+// Writer appends messages to an mbox file
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer writing to w, call Flush when done
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage writes a raw message preceded by its "From " separator line
+func (w *Writer) WriteMessage(sender string, date time.Time, raw []byte) error {
+
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+
+	if _, err := fmt.Fprintf(w.w, "From %s %s\n", sender, date.UTC().Format(time.ANSIC)); err != nil {
+		return err
+	}
+
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if isFromLine(line) {
+			w.w.WriteByte('>')
+		}
+		if _, err := w.w.Write(line); err != nil {
+			return err
+		}
+	}
+
+	// every message ends with a newline followed by an empty line
+	if !bytes.HasSuffix(raw, []byte("\n")) {
+		w.w.WriteByte('\n')
+	}
+	return w.w.WriteByte('\n')
+}
+
+// Flush writes any buffered data to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads the messages out of an mbox file one at a time
+type Reader struct {
+	r    *bufio.Reader
+	next []byte // the separator line of the next message, if we've read it
+	done bool
+}
+
+// NewReader returns a Reader reading from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next raw message, or io.EOF once there are none left
+func (r *Reader) Next() ([]byte, error) {
+
+	// the first thing in the file has to be a separator
+	if r.next == nil {
+		if r.done {
+			return nil, io.EOF
+		}
+
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			r.done = true
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if !bytes.HasPrefix(line, []byte("From ")) {
+			return nil, fmt.Errorf("mbox: file does not start with a From line")
+		}
+		r.next = line
+	}
+
+	var msg bytes.Buffer
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if bytes.HasPrefix(line, []byte("From ")) {
+			r.next = line
+			break
+		}
+
+		if len(line) > 0 {
+			if isFromLine(line[1:]) && line[0] == '>' {
+				line = line[1:]
+			}
+			msg.Write(line)
+		}
+
+		if err == io.EOF {
+			r.next = nil
+			r.done = true
+			break
+		}
+	}
+
+	// the empty line before the next separator belongs to the mbox, not the message
+	raw := msg.Bytes()
+	if bytes.HasSuffix(raw, []byte("\n\n")) {
+		raw = raw[:len(raw)-1]
+	}
+
+	return raw, nil
+}
+
+// isFromLine reports whether a line is "From " with any number of '>' in front
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From "))
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Counter counts something for each value of its label, e.g. the messages
+// sent by each account. It is written in the Prometheus text format.
+type Counter struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter returns a counter, its name should end in _total
+func NewCounter(name, help, label string) *Counter {
+	return &Counter{name: name, help: help, label: label, values: make(map[string]float64)}
+}
+
+// Inc adds one to the count for the label value
+func (c *Counter) Inc(value string) {
+	c.mu.Lock()
+	c.values[value]++
+	c.mu.Unlock()
+}
+
+// Write writes the counter in the Prometheus text format
+func (c *Counter) Write(w io.Writer) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, v := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, label(c.label, v), formatFloat(c.values[v]))
+	}
+}
+
+// Histogram counts observations, e.g. how long something took, in buckets
+// for each value of its label
+type Histogram struct {
+	name, help, label string
+	buckets           []float64 // the upper bounds, in increasing order
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is what a histogram observed for one label value
+type series struct {
+	counts []uint64 // the observations in each bucket, not counting the ones below it
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a histogram with the given upper bounds, in increasing order
+func NewHistogram(name, help, label string, buckets []float64) *Histogram {
+	return &Histogram{name: name, help: help, label: label, buckets: buckets, series: make(map[string]*series)}
+}
+
+// Observe adds an observation for the label value
+func (h *Histogram) Observe(value string, v float64) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[value]
+	if !ok {
+		s = &series{counts: make([]uint64, len(h.buckets))}
+		h.series[value] = s
+	}
+
+	// the first bucket it fits in, values above them all only go in +Inf
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Write writes the histogram in the Prometheus text format, whose buckets
+// count everything up to their bound
+func (h *Histogram) Write(w io.Writer) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	values := make([]string, 0, len(h.series))
+	for v := range h.series {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	for _, v := range values {
+		s := h.series[v]
+		l := label(h.label, v)
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, l, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, l, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, l, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, l, s.count)
+	}
+}
+
+// WriteGauge writes a gauge whose values are worked out as it is written,
+// e.g. the messages waiting in each outbox
+func WriteGauge(w io.Writer, name, help, labelName string, values map[string]float64) {
+
+	writeHeader(w, name, help, "gauge")
+	for _, v := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, label(labelName, v), formatFloat(values[v]))
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// label writes a label, escaping its value as the text format wants
+func label(name, value string) string {
+	return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
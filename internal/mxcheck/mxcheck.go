@@ -0,0 +1,110 @@
+package mxcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// Domain checks that the domain can receive mail, it has to have a mail
+// server (MX) record, or an address for mail to go to instead, and it
+// mustn't say it takes no mail at all with a null MX, see RFC 7505. It
+// returns the mail servers, best first, so they can be probed.
+//
+// A lookup that fails for another reason, such as the resolver not
+// answering, isn't an error, we only want to warn about domains we know
+// can't receive mail.
+func Domain(ctx context.Context, domain string) ([]string, error) {
+
+	mxs, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err == nil {
+		if len(mxs) == 1 && strings.TrimSuffix(mxs[0].Host, ".") == "" {
+			return nil, fmt.Errorf("%s doesn't take mail", domain)
+		}
+		hosts := make([]string, len(mxs))
+		for i, mx := range mxs {
+			hosts[i] = strings.TrimSuffix(mx.Host, ".")
+		}
+		return hosts, nil
+	}
+	if !notFound(err) {
+		return nil, nil
+	}
+
+	// without MX records mail goes to the domain's own address, if it has one
+	_, err = net.DefaultResolver.LookupIPAddr(ctx, domain)
+	switch {
+	case err == nil:
+		return []string{domain}, nil
+	case notFound(err):
+		return nil, fmt.Errorf("%s has no mail server", domain)
+	}
+	return nil, nil
+}
+
+// notFound reports whether a lookup failed because there is no such
+// domain or record, rather than because we couldn't ask
+func notFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// Probe asks the first of the domain's mail servers that answers whether it
+// would take mail for the address, without sending any. Only a server that
+// refuses the address for good is an error: plenty of networks don't let
+// us reach port 25, and some servers take every address and bounce later.
+func Probe(ctx context.Context, hosts []string, from, addr string) error {
+
+	var d net.Dialer
+	for _, host := range hosts {
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "25"))
+		if err != nil {
+			continue
+		}
+
+		// the dialer's deadline only covered connecting, so we set our own
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		err = rcpt(conn, host, from, addr)
+		conn.Close()
+
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 && reply.Code < 600 {
+			return fmt.Errorf("%s refuses it: %d %s", host, reply.Code, reply.Msg)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// rcpt goes as far as RCPT TO with the server, then gives up on the message.
+// It only returns what the server said to RCPT TO, if it got that far.
+func rcpt(conn net.Conn, host, from, addr string) error {
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return nil
+	}
+	defer c.Quit()
+
+	name, err := os.Hostname()
+	if err != nil {
+		name = "localhost"
+	}
+	// a server telling us off for who we are isn't telling us about the recipient
+	if err := c.Hello(name); err != nil {
+		return nil
+	}
+	if err := c.Mail(from); err != nil {
+		return nil
+	}
+	return c.Rcpt(addr)
+}
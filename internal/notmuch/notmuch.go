@@ -0,0 +1,155 @@
+package notmuch
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// binary is the notmuch command we run, it is looked up in the PATH. Going
+// through it means the mail is searched and tagged in the user's own
+// database, with the same tags their other notmuch tools see.
+const binary = "notmuch"
+
+// Available reports whether notmuch is installed
+func Available() bool {
+	_, err := exec.LookPath(binary)
+	return err == nil
+}
+
+// run runs notmuch and returns what it wrote to stdout. If it fails, the
+// error holds what it complained about.
+func run(args ...string) ([]byte, error) {
+
+	cmd := exec.Command(binary, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		complaint := strings.TrimSpace(stderr.String())
+		if complaint == "" {
+			complaint = err.Error()
+		}
+		// notmuch can explain itself over several lines, the first one says what went wrong
+		complaint, _, _ = strings.Cut(complaint, "\n")
+		return nil, fmt.Errorf("notmuch %s failed: %s", args[0], complaint)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Index adds the mail that arrived since it was last run to the database
+func Index() error {
+	_, err := run("new", "--quiet")
+	return err
+}
+
+// Root returns the directory the database indexes the mail under
+func Root() (string, error) {
+
+	// newer versions can keep the mail apart from the database, older ones only know database.path
+	for _, key := range []string{"database.mail_root", "database.path"} {
+		if out, err := run("config", "get", key); err == nil && strings.TrimSpace(string(out)) != "" {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", fmt.Errorf("notmuch has no database.path set, run notmuch setup first")
+}
+
+// Files returns the files of the newest messages matching the query, in
+// notmuch's query syntax, e.g. "tag:inbox and from:ann"
+func Files(query string, limit int) ([]string, error) {
+
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	// text0 ends every name with a NUL, which can't be in one
+	out, err := run("search", "--format=text0", "--output=files", "--sort=newest-first", "--limit="+strconv.Itoa(limit), "--", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Tags returns the tags of each of the messages, by their Message-IDs
+func Tags(ids []string) (map[string][]string, error) {
+
+	tags := make(map[string][]string)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	terms := make([]string, len(ids))
+	for i, id := range ids {
+		terms[i] = idTerm(id)
+	}
+	out, err := run("dump", "--format=batch-tag", "--", strings.Join(terms, " or "))
+	if err != nil {
+		return nil, err
+	}
+
+	// every line is like "+inbox +unread -- id:1234@example.com", see notmuch-dump(1)
+	for _, line := range strings.Split(string(out), "\n") {
+		ops, id, ok := strings.Cut(line, " -- id:")
+		if !ok {
+			ops, id, ok = strings.Cut(line, "-- id:")
+		}
+		if !ok {
+			continue
+		}
+		id = decode(id)
+		tags[id] = []string{}
+		for _, op := range strings.Fields(ops) {
+			if strings.HasPrefix(op, "+") {
+				tags[id] = append(tags[id], decode(op[1:]))
+			}
+		}
+	}
+	return tags, nil
+}
+
+// Tag changes the tags of the message with the Message-ID, each change is a
+// tag to add with a +, or one to take off with a -
+func Tag(id string, changes []string) error {
+
+	for _, c := range changes {
+		if len(c) < 2 || (c[0] != '+' && c[0] != '-') {
+			return fmt.Errorf("%q should be +tag to add a tag or -tag to take one off", c)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	_, err := run(append(append([]string{"tag"}, changes...), "--", idTerm(id))...)
+	return err
+}
+
+// idTerm is the query for the message with the Message-ID, which notmuch
+// keeps without its angle brackets
+func idTerm(id string) string {
+	id = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+	return `id:"` + strings.ReplaceAll(id, `"`, `""`) + `"`
+}
+
+// decode undoes the hex encoding dump uses for characters that would get
+// in the way, like %20 for a space
+func decode(s string) string {
+	if d, err := url.PathUnescape(s); err == nil {
+		return d
+	}
+	return s
+}
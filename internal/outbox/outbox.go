@@ -0,0 +1,425 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/vault"
+	"github.com/aidk/go-mailer/pkg/transport"
+)
+
+// the delay before the first retry, it doubles after every failed attempt
+// up to maxDelay, less a random part, see backoff
+const (
+	firstDelay = 30 * time.Second
+	maxDelay   = time.Hour
+)
+
+// Entry describes a message waiting in the outbox, the message itself is kept next to it
+type Entry struct {
+	ID      string   `json:"id"`
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+
+	// SendAt is set when the message was scheduled to go out at a later time
+	SendAt time.Time `json:"send_at"`
+
+	Created     time.Time `json:"created"`
+	NextAttempt time.Time `json:"next_attempt"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	// ErrorKind is the kind of the last error, see transport.Classify
+	ErrorKind string `json:"error_kind,omitempty"`
+
+	// GaveUp is set when the last attempt failed in a way trying again
+	// won't fix, e.g. the server refusing a recipient for good. The entry
+	// stays in the outbox, but isn't sent again until Retry.
+	GaveUp bool `json:"gave_up,omitempty"`
+
+	// Sending is set when a flush, here or in another go-mailer, has
+	// claimed the entry and is sending it right now
+	Sending bool `json:"-"`
+}
+
+// Outbox is a durable queue of messages waiting to be sent. Every entry is
+// stored as two files, <id>.eml holding the message and <id>.json holding
+// the entry, so queued mail survives restarts and crashes.
+type Outbox struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// ErrSending is returned when an entry can't be changed because it is being sent
+var ErrSending = errors.New("the message is already being sent")
+
+// claimedExt is what an entry's .json is renamed to while it is being
+// sent. A rename either works or it doesn't, so of every flush of the
+// outbox, in the TUI, go-mailer queue flush or serve, only one sends it.
+const claimedExt = ".sending"
+
+// staleClaim is how long a claim holds. One older than that was left by a
+// go-mailer that stopped while sending, and the entry is tried again.
+const staleClaim = 30 * time.Minute
+
+// Open returns the outbox in dir, creating the directory if needed
+func Open(dir string) (*Outbox, error) {
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create outbox: %w", err)
+	}
+
+	return &Outbox{dir: dir}, nil
+}
+
+// Enqueue adds a message to the outbox, ready to be sent straight away
+func (o *Outbox) Enqueue(from string, to []string, subject string, raw []byte) (Entry, error) {
+	return o.add(from, to, subject, raw, time.Time{})
+}
+
+// Schedule adds a message to the outbox which is held until the given time
+func (o *Outbox) Schedule(from string, to []string, subject string, raw []byte, at time.Time) (Entry, error) {
+	return o.add(from, to, subject, raw, at)
+}
+
+// add writes a new entry, a zero sendAt means it is due straight away
+func (o *Outbox) add(from string, to []string, subject string, raw []byte, sendAt time.Time) (Entry, error) {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id, err := newID()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := time.Now()
+	e := Entry{
+		ID:          id,
+		From:        from,
+		To:          to,
+		Subject:     subject,
+		SendAt:      sendAt,
+		Created:     now,
+		NextAttempt: now,
+	}
+	if !sendAt.IsZero() {
+		e.NextAttempt = sendAt
+	}
+
+	// the message goes first, an entry without a message would be useless
+	if err := writeFile(o.path(id, ".eml"), raw); err != nil {
+		return Entry{}, err
+	}
+	if err := o.save(e); err != nil {
+		os.Remove(o.path(id, ".eml"))
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+// List returns every queued entry, oldest first
+func (o *Outbox) List() ([]Entry, error) {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.list()
+}
+
+func (o *Outbox) list() ([]Entry, error) {
+
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+
+		var (
+			e   Entry
+			err error
+		)
+		switch {
+		case strings.HasSuffix(name, ".json"):
+			e, err = o.load(strings.TrimSuffix(name, ".json"), ".json")
+		case strings.HasSuffix(name, claimedExt):
+			id := strings.TrimSuffix(name, claimedExt)
+			if info, ierr := f.Info(); ierr == nil && time.Since(info.ModTime()) > staleClaim {
+				o.release(id)
+				e, err = o.load(id, ".json")
+				break
+			}
+			e, err = o.load(id, claimedExt)
+			e.Sending = true
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	return entries, nil
+}
+
+// Message returns the raw message of a queued entry
+func (o *Outbox) Message(id string) ([]byte, error) {
+	return readFile(o.path(id, ".eml"))
+}
+
+// Remove takes an entry out of the outbox because it was cancelled. It
+// returns ErrSending if a flush has claimed it.
+func (o *Outbox) Remove(id string) error {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// the entry goes first so a half removed entry is never picked up
+	// again, once it's gone it can't be claimed either
+	err := os.Remove(o.path(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) && o.claimed(id) {
+		return ErrSending
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(o.path(id, ".eml")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// claimed reports whether a flush has claimed the entry
+func (o *Outbox) claimed(id string) bool {
+	_, err := os.Stat(o.path(id, claimedExt))
+	return err == nil
+}
+
+// Retry schedules an entry to be sent on the next flush
+func (o *Outbox) Retry(id string) error {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, err := o.load(id, ".json")
+	if errors.Is(err, os.ErrNotExist) && o.claimed(id) {
+		return ErrSending
+	}
+	if err != nil {
+		return err
+	}
+
+	e.NextAttempt, e.GaveUp = time.Now(), false
+	return o.save(e)
+}
+
+// Flush tries to send every entry that is due. Entries that were sent are
+// removed and entries that failed are rescheduled with a longer delay.
+// It returns how many entries were sent and how many failed.
+func (o *Outbox) Flush(send func(e Entry, raw []byte) error) (sent, failed int, err error) {
+
+	o.mu.Lock()
+	entries, err := o.list()
+	o.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.Sending || e.GaveUp || e.NextAttempt.After(now) || !o.claim(e.ID) {
+			continue
+		}
+
+		raw, err := o.Message(e.ID)
+		if err != nil {
+			o.release(e.ID)
+			continue
+		}
+
+		if err := send(e, raw); err != nil {
+			o.mu.Lock()
+			if o.failed(e.ID, claimedExt, err) != nil {
+				o.release(e.ID)
+			}
+			o.mu.Unlock()
+			failed++
+			continue
+		}
+
+		o.mu.Lock()
+		os.Remove(o.path(e.ID, claimedExt))
+		os.Remove(o.path(e.ID, ".eml"))
+		o.mu.Unlock()
+		sent++
+	}
+
+	return sent, failed, nil
+}
+
+// claim marks an entry as being sent by renaming its .json, it returns
+// false if it is already being sent or is gone
+func (o *Outbox) claim(id string) bool {
+
+	claimed := o.path(id, claimedExt)
+	if err := os.Rename(o.path(id, ".json"), claimed); err != nil {
+		return false
+	}
+
+	// the rename keeps the file's time, the claim's age starts now
+	now := time.Now()
+	os.Chtimes(claimed, now, now)
+	return true
+}
+
+// release gives up the claim on an entry, without it having been sent
+func (o *Outbox) release(id string) {
+	os.Rename(o.path(id, claimedExt), o.path(id, ".json"))
+}
+
+// Failed records a failed attempt at sending an entry and schedules the next one
+func (o *Outbox) Failed(id string, sendErr error) error {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.failed(id, ".json", sendErr)
+}
+
+// failed records the failed attempt in the entry's file with the given
+// extension. A claimed entry is updated in its claim file and only then
+// released, so no other flush can claim it before it is complete.
+func (o *Outbox) failed(id, ext string, sendErr error) error {
+
+	e, err := o.load(id, ext)
+	if err != nil {
+		return err
+	}
+
+	e.Attempts++
+	e.LastError = sendErr.Error()
+	e.ErrorKind, e.GaveUp = transport.Classify(sendErr)
+	e.NextAttempt = time.Now().Add(backoff(e.Attempts))
+	if err := o.write(e, ext); err != nil {
+		return err
+	}
+	if ext == claimedExt {
+		o.release(id)
+	}
+	return nil
+}
+
+// backoff returns how long to wait after the given number of failed
+// attempts. Up to half of it is taken off at random, so messages that
+// failed together, e.g. while we were offline, don't all go again at once.
+func backoff(attempts int) time.Duration {
+	delay := firstDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay - time.Duration(mathrand.Int63n(int64(delay/2)+1))
+}
+
+// path returns the path of one of an entry's files
+func (o *Outbox) path(id, ext string) string {
+	return filepath.Join(o.dir, id+ext)
+}
+
+// load reads an entry from disk, from its .json or its claimedExt file
+func (o *Outbox) load(id, ext string) (Entry, error) {
+
+	data, err := readFile(o.path(id, ext))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Entry{}, fmt.Errorf("outbox entry %s is corrupt: %w", id, err)
+	}
+
+	return e, nil
+}
+
+// save writes an entry to disk
+func (o *Outbox) save(e Entry) error {
+	return o.write(e, ".json")
+}
+
+// write writes an entry to its file with the given extension
+func (o *Outbox) write(e Entry, ext string) error {
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(o.path(e.ID, ext), data)
+}
+
+// readFile reads a file written by writeFile
+func readFile(path string) ([]byte, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return vault.Open(data)
+}
+
+// writeFile writes the file through a temporary file so it is never seen
+// half written, encrypted when encryption is turned on
+func writeFile(path string, data []byte) error {
+
+	data, err := vault.Seal(data)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// newID returns a new entry id, starting with the time so ids sort by age
+func newID() (string, error) {
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
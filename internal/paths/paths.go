@@ -0,0 +1,114 @@
+package paths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName is the directory go-mailer's files are kept in, in each of the places below
+const appName = "go-mailer"
+
+// the environment variables that put a directory somewhere else, whatever
+// the platform would have it be
+const (
+	ConfigEnv = "GO_MAILER_CONFIG_DIR"
+	DataEnv   = "GO_MAILER_DATA_DIR"
+	CacheEnv  = "GO_MAILER_CACHE_DIR"
+)
+
+// Config returns the directory of the config file, the templates and the
+// dictionaries: $XDG_CONFIG_HOME/go-mailer (~/.config/go-mailer) on Linux,
+// ~/Library/Application Support/go-mailer on macOS and %AppData%\go-mailer
+// on Windows
+func Config() (string, error) {
+	return dir(ConfigEnv, os.UserConfigDir)
+}
+
+// Data returns the directory of the mail, the outbox, the address book and
+// the logs: $XDG_DATA_HOME/go-mailer (~/.local/share/go-mailer) on Linux,
+// ~/Library/Application Support/go-mailer on macOS and
+// %LocalAppData%\go-mailer on Windows
+func Data() (string, error) {
+	return dir(DataEnv, userDataDir)
+}
+
+// Cache returns the directory of what can be looked up again if it's lost:
+// $XDG_CACHE_HOME/go-mailer (~/.cache/go-mailer) on Linux,
+// ~/Library/Caches/go-mailer on macOS and %LocalAppData%\go-mailer\cache
+// on Windows
+func Cache() (string, error) {
+	if runtime.GOOS == "windows" && os.Getenv(CacheEnv) == "" && Legacy() == "" {
+		// Windows has no place of its own for caches, they go with the data
+		data, err := Data()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(data, "cache"), nil
+	}
+	return dir(CacheEnv, os.UserCacheDir)
+}
+
+// Legacy returns ~/.go-mailer if it is there, where go-mailer kept all of
+// its files before it followed the platform's conventions. While it is
+// there it's used for everything, so nothing seems to go missing after an
+// update; moving its files to the new places and removing it switches over.
+func Legacy() string {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	legacy := filepath.Join(home, ".go-mailer")
+	if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+		return ""
+	}
+	return legacy
+}
+
+// dir returns the directory named by the environment variable, or else the
+// legacy one, or else go-mailer's directory in the platform's base
+func dir(env string, base func() (string, error)) (string, error) {
+
+	if d := os.Getenv(env); d != "" {
+		if !filepath.IsAbs(d) {
+			return "", errors.New(env + " has to be an absolute path")
+		}
+		return d, nil
+	}
+	if legacy := Legacy(); legacy != "" {
+		return legacy, nil
+	}
+
+	b, err := base()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b, appName), nil
+}
+
+// userDataDir is like os.UserConfigDir, for the data the user would miss
+// if it were lost but doesn't edit by hand
+func userDataDir() (string, error) {
+
+	switch runtime.GOOS {
+	case "windows":
+		if d := os.Getenv("LocalAppData"); d != "" {
+			return d, nil
+		}
+		return "", errors.New("%LocalAppData% is not defined")
+	case "darwin", "ios":
+		return os.UserConfigDir()
+	}
+
+	// see the XDG Base Directory Specification, a relative path is to be ignored
+	if d := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(d) {
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
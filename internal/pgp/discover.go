@@ -0,0 +1,294 @@
+package pgp
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/eai"
+)
+
+// ErrNotFound is returned when none of the places looked in has a key for the address
+var ErrNotFound = errors.New("no key found")
+
+// maxKeySize is the most we download of a key, a key with many signatures
+// can be big but nothing needs more than this
+const maxKeySize = 1 << 20
+
+// Key is an OpenPGP public key as gpg describes it
+type Key struct {
+	Fingerprint string
+	UserIDs     []string
+	Created     time.Time
+	Expires     time.Time // zero if it doesn't expire
+	Usable      bool      // it can encrypt, and isn't revoked or expired
+}
+
+// Found is a key found for an address, with where it came from
+type Found struct {
+	Address string
+	Source  string // "WKD" or the keyserver's host
+	Keys    []Key  // the keys for the address, usually one
+	data    []byte
+}
+
+// Discover looks for the address's key in each of the sources in turn, see
+// config.PGP.Discover, and returns the first usable keys found
+func Discover(ctx context.Context, addr string, sources []string) (Found, error) {
+
+	var errs []string
+	for _, source := range sources {
+		var (
+			data []byte
+			name string
+			err  error
+		)
+		if source == "wkd" {
+			data, err = fetchWKD(ctx, addr)
+			name = "WKD"
+		} else {
+			data, name, err = fetchKeyserver(ctx, source, addr)
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+
+		keys, err := Inspect(data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		var usable []Key
+		for _, k := range keys {
+			if k.Usable && k.hasAddress(addr) {
+				usable = append(usable, k)
+			}
+		}
+		if len(usable) > 0 {
+			return Found{Address: addr, Source: name, Keys: usable, data: data}, nil
+		}
+	}
+
+	// a server that couldn't be reached isn't the same as there being no key
+	if len(errs) > 0 {
+		return Found{}, errors.New(strings.Join(errs, "; "))
+	}
+	return Found{}, ErrNotFound
+}
+
+// hasAddress reports whether one of the key's user ids is the address
+func (k Key) hasAddress(addr string) bool {
+	for _, uid := range k.UserIDs {
+		if strings.Contains(strings.ToLower(uid), "<"+strings.ToLower(addr)+">") || strings.EqualFold(uid, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchWKD gets the key from the Web Key Directory of the address's domain,
+// see draft-koch-openpgp-webkey-service. The advanced method, on the
+// openpgpkey subdomain, is asked first and the direct one after it.
+func fetchWKD(ctx context.Context, addr string) ([]byte, error) {
+
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return nil, ErrNotFound
+	}
+	domain, err := eai.ToASCII(strings.ToLower(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(strings.ToLower(local)))
+	hash := zbase32(sum[:])
+	query := "?l=" + url.QueryEscape(local)
+
+	data, err := fetch(ctx, "https://openpgpkey."+domain+"/.well-known/openpgpkey/"+domain+"/hu/"+hash+query)
+	if err == nil {
+		return data, nil
+	}
+
+	// most domains don't have the subdomain, so the direct method is the
+	// one that answers, and its answer is the one that counts
+	return fetch(ctx, "https://"+domain+"/.well-known/openpgpkey/hu/"+hash+query)
+}
+
+// fetchKeyserver asks a keyserver for the address's key over HKP, the
+// protocol every keyserver speaks. hkps:// is HKP over HTTPS.
+func fetchKeyserver(ctx context.Context, server, addr string) ([]byte, string, error) {
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, server, err
+	}
+	switch u.Scheme {
+	case "hkps":
+		u.Scheme = "https"
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "11371")
+		}
+	}
+	u.Path = "/pks/lookup"
+	u.RawQuery = url.Values{"op": {"get"}, "options": {"mr"}, "search": {addr}}.Encode()
+
+	data, err := fetch(ctx, u.String())
+	return data, u.Hostname(), err
+}
+
+// fetch downloads the url, an answer of 404 is ErrNotFound
+func fetch(ctx context.Context, link string) ([]byte, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "go-mailer")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("server said %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxKeySize))
+}
+
+// zbase32 encodes the hash the way WKD names its files, see RFC 6189
+func zbase32(data []byte) string {
+
+	const alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+	var b strings.Builder
+	var buffer, bits uint
+	for _, c := range data {
+		buffer = buffer<<8 | uint(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(alphabet[buffer>>bits&31])
+		}
+	}
+	if bits > 0 {
+		b.WriteByte(alphabet[buffer<<(5-bits)&31])
+	}
+	return b.String()
+}
+
+// Inspect returns the keys in data, without importing them
+func Inspect(data []byte) ([]Key, error) {
+
+	out, _, err := run(data, "--with-colons", "--import-options", "show-only", "--import")
+	if err != nil {
+		return nil, err
+	}
+
+	// see doc/DETAILS in the GnuPG sources, like for HasPublicKey
+	var keys []Key
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			k := Key{Created: epoch(fields[5]), Expires: epoch(fields[6])}
+			k.Usable = len(fields) > 11 && strings.Contains(fields[11], "E") && !strings.ContainsAny(fields[1], "rei")
+			keys = append(keys, k)
+		case "fpr":
+			// the first fingerprint after pub is the key's, the others are its subkeys'
+			if n := len(keys); n > 0 && keys[n-1].Fingerprint == "" {
+				keys[n-1].Fingerprint = fields[9]
+			}
+		case "uid":
+			if n := len(keys); n > 0 && !strings.ContainsAny(fields[1], "re") {
+				keys[n-1].UserIDs = append(keys[n-1].UserIDs, unescape(fields[9]))
+			}
+		}
+	}
+	return keys, nil
+}
+
+// epoch reads the seconds since 1970 gpg writes dates as, empty is no date
+func epoch(s string) time.Time {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0)
+}
+
+// unescape undoes the \x3a escapes gpg writes the colons of a user id as
+func unescape(s string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if n, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Accept imports the keys found into the keyring and certifies them with a
+// local signature of the signer's key, which never leaves the keyring, so
+// gpg trusts them for encrypting from now on. Certifying needs the secret
+// key, and gpg-agent may ask for its passphrase.
+func Accept(f Found, signer string) error {
+
+	// only the user ids with the address are kept, so a keyserver's answer
+	// can't sneak other keys or names into the keyring
+	filter := "keep-uid=mbox = " + strings.ToLower(f.Address)
+	if _, _, err := run(f.data, "--import-filter", filter, "--import"); err != nil {
+		return err
+	}
+
+	var args []string
+	if signer != "" {
+		args = append(args, "--local-user", user(signer))
+	}
+	for _, k := range f.Keys {
+		if _, _, err := run(nil, append(args, "--quick-lsign-key", k.Fingerprint)...); err != nil {
+			return fmt.Errorf("imported the key, but could not certify it: %w", err)
+		}
+	}
+	return nil
+}
+
+// FormatFingerprint writes a fingerprint in groups of four, the way gpg
+// shows it, so it can be read out and compared
+func FormatFingerprint(fpr string) string {
+
+	var groups []string
+	for i := 0; i < len(fpr); i += 4 {
+		groups = append(groups, fpr[i:min(i+4, len(fpr))])
+	}
+	half := len(groups) / 2
+	return strings.Join(groups[:half], " ") + "  " + strings.Join(groups[half:], " ")
+}
@@ -0,0 +1,138 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// binary is the gpg command we run, it is looked up in the PATH. Going
+// through gpg means the keys come from the user's own GnuPG keyring and
+// gpg-agent takes care of passphrases.
+const binary = "gpg"
+
+// MicAlg is the hash we sign with, as named in the micalg parameter of a signed message
+const MicAlg = "pgp-sha256"
+
+// Available reports whether gpg is installed
+func Available() bool {
+	_, err := exec.LookPath(binary)
+	return err == nil
+}
+
+// run runs gpg with the input on stdin and returns what it wrote to stdout.
+// If gpg fails, the error holds the last thing it complained about.
+func run(input []byte, args ...string) ([]byte, string, error) {
+
+	// --batch keeps gpg from asking questions on the terminal we're drawing on
+	cmd := exec.Command(binary, append([]string{"--batch", "--no-tty", "--status-fd", "2"}, args...)...)
+	cmd.Stdin = bytes.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, stderr.String(), fmt.Errorf("gpg failed: %s", lastComplaint(stderr.String(), err))
+	}
+
+	return stdout.Bytes(), stderr.String(), nil
+}
+
+// lastComplaint returns the last line gpg wrote that isn't a status line
+func lastComplaint(stderr string, err error) string {
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "[GNUPG:]") {
+			return strings.TrimPrefix(line, "gpg: ")
+		}
+	}
+
+	return err.Error()
+}
+
+// user returns how we name a key to gpg, an address is matched exactly
+// against the key's user ids rather than as a substring
+func user(id string) string {
+	if strings.Contains(id, "@") && !strings.HasPrefix(id, "<") {
+		return "<" + id + ">"
+	}
+	return id
+}
+
+// HasPublicKey reports whether the keyring holds a usable encryption key for the address
+func HasPublicKey(addr string) bool {
+
+	out, _, err := run(nil, "--with-colons", "--list-keys", "--", user(addr))
+	if err != nil {
+		return false
+	}
+
+	// see doc/DETAILS in the GnuPG sources for the format, the second field
+	// is the validity and the twelfth the capabilities of the whole key
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 12 || fields[0] != "pub" {
+			continue
+		}
+		switch fields[1] {
+		case "i", "d", "r", "e":
+			// invalid, disabled, revoked or expired
+			continue
+		}
+		if strings.Contains(fields[11], "E") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MissingKeys returns the addresses we have no encryption key for
+func MissingKeys(addrs []string) []string {
+
+	var missing []string
+	for _, addr := range addrs {
+		if !HasPublicKey(addr) {
+			missing = append(missing, addr)
+		}
+	}
+
+	return missing
+}
+
+// Sign returns an ASCII armored detached signature of data made with the signer's key
+func Sign(signer string, data []byte) ([]byte, error) {
+	out, _, err := run(data, "--armor", "--detach-sign", "--digest-algo", "SHA256", "--local-user", user(signer))
+	return out, err
+}
+
+// Encrypt returns data encrypted for every recipient as an ASCII armored message,
+// signed with the signer's key as well when sign is true
+func Encrypt(recipients []string, signer string, sign bool, data []byte) ([]byte, error) {
+
+	args := []string{"--armor", "--encrypt"}
+	for _, r := range recipients {
+		args = append(args, "--recipient", user(r))
+	}
+	if sign {
+		args = append(args, "--sign", "--digest-algo", "SHA256", "--local-user", user(signer))
+	}
+
+	out, _, err := run(data, args...)
+	return out, err
+}
+
+// Decrypt returns the plain text of an encrypted message and whether it was signed too
+func Decrypt(data []byte) ([]byte, bool, error) {
+
+	out, status, err := run(data, "--decrypt")
+	if err != nil {
+		return nil, false, err
+	}
+
+	return out, strings.Contains(status, "[GNUPG:] NEWSIG") || strings.Contains(status, "[GNUPG:] GOODSIG"), nil
+}
@@ -0,0 +1,166 @@
+package pop3
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/config"
+)
+
+// Client is a POP3 connection which has already been logged in, see RFC 1939
+type Client struct {
+	tp *textproto.Conn
+}
+
+// Dial connects to the POP3 server and logs in with the configured credentials
+func Dial(cfg config.POP3) (*Client, error) {
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if cfg.Insecure {
+		conn, err = dialer.Dial("tcp", cfg.Addr())
+	} else {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Addr(), &tls.Config{ServerName: cfg.Host})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", cfg.Addr(), err)
+	}
+
+	c := &Client{tp: textproto.NewConn(conn)}
+
+	// the server greets us before we send anything
+	if _, err := c.response(); err != nil {
+		c.tp.Close()
+		return nil, err
+	}
+
+	if _, err := c.cmd("USER %s", cfg.Username); err != nil {
+		c.tp.Close()
+		return nil, fmt.Errorf("could not log in: %w", err)
+	}
+	if _, err := c.cmd("PASS %s", cfg.Password); err != nil {
+		c.tp.Close()
+		return nil, fmt.Errorf("could not log in: %w", err)
+	}
+
+	return c, nil
+}
+
+// response reads a single line status response and returns the text after +OK
+func (c *Client) response() (string, error) {
+
+	line, err := c.tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(line, "+OK") {
+		return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+	}
+
+	return "", fmt.Errorf("pop3: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+}
+
+// cmd sends a command and reads its status response
+func (c *Client) cmd(format string, args ...interface{}) (string, error) {
+
+	if err := c.tp.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+
+	return c.response()
+}
+
+// UIDL returns the unique id of every message keyed by message number
+func (c *Client) UIDL() (map[int]string, error) {
+
+	if _, err := c.cmd("UIDL"); err != nil {
+		return nil, err
+	}
+
+	lines, err := c.tp.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make(map[int]string, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("pop3: malformed UIDL line %q", line)
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("pop3: malformed UIDL line %q", line)
+		}
+		uids[n] = fields[1]
+	}
+
+	return uids, nil
+}
+
+// List returns the number of every message in the maildrop
+func (c *Client) List() ([]int, error) {
+
+	if _, err := c.cmd("LIST"); err != nil {
+		return nil, err
+	}
+
+	lines, err := c.tp.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	nums := make([]int, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("pop3: malformed LIST line %q", line)
+		}
+		nums = append(nums, n)
+	}
+
+	return nums, nil
+}
+
+// Retr downloads a whole message
+func (c *Client) Retr(n int) ([]byte, error) {
+
+	if _, err := c.cmd("RETR %d", n); err != nil {
+		return nil, err
+	}
+
+	// ReadDotBytes undoes the dot stuffing and converts line endings to \n
+	return c.tp.ReadDotBytes()
+}
+
+// Dele marks a message for deletion, it is removed once we Quit
+func (c *Client) Dele(n int) error {
+	_, err := c.cmd("DELE %d", n)
+	return err
+}
+
+// Quit ends the session, committing any deletions, and closes the connection
+func (c *Client) Quit() error {
+	_, err := c.cmd("QUIT")
+	c.tp.Close()
+	return err
+}
+
+// Close closes the connection without committing deletions
+func (c *Client) Close() error {
+	return c.tp.Close()
+}
@@ -0,0 +1,145 @@
+package pop3
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aidk/go-mailer/internal/config"
+	"github.com/aidk/go-mailer/internal/store"
+)
+
+// seenFile holds the UIDLs of messages already downloaded into a store
+const seenFile = ".pop3-uidl"
+
+// Fetch downloads every message we haven't downloaded before into the store
+// and returns how many there were. Unless the account is set to leave mail
+// on the server, downloaded messages are deleted from the server.
+func Fetch(cfg config.POP3, s *store.Store) (int, error) {
+
+	c, err := Dial(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	seenPath := filepath.Join(s.Dir(), seenFile)
+	seen, err := loadSeen(seenPath)
+	if err != nil {
+		c.Close()
+		return 0, err
+	}
+
+	// without UIDL we can't tell which messages we already have, which is
+	// only fine when we delete everything we download
+	uids, err := c.UIDL()
+	if err != nil && cfg.LeaveOnServer {
+		c.Close()
+		return 0, fmt.Errorf("server does not support UIDL, which is needed to leave mail on the server: %w", err)
+	}
+
+	var nums []int
+	if uids != nil {
+		for n := range uids {
+			nums = append(nums, n)
+		}
+	} else if nums, err = c.List(); err != nil {
+		c.Close()
+		return 0, err
+	}
+	sort.Ints(nums)
+
+	fetched := 0
+	kept := make(map[string]bool) // what we have of what is on the server
+
+	for _, n := range nums {
+		uid := uids[n]
+
+		if uid == "" || !seen[uid] {
+			raw, err := c.Retr(n)
+			if err != nil {
+				c.Close()
+				return fetched, err
+			}
+			if _, err := s.Folder(store.Inbox).Deliver(raw, ""); err != nil {
+				c.Close()
+				return fetched, err
+			}
+			fetched++
+
+			// it is written down straight away, so neither an error further
+			// on nor a QUIT that fails and takes the deletions back gets it
+			// downloaded again
+			if uid != "" {
+				seen[uid] = true
+				if err := saveSeen(seenPath, seen); err != nil {
+					c.Close()
+					return fetched, err
+				}
+			}
+		}
+		if uid != "" {
+			kept[uid] = true
+		}
+
+		if cfg.LeaveOnServer {
+			continue
+		}
+
+		if err := c.Dele(n); err != nil {
+			c.Close()
+			return fetched, err
+		}
+	}
+
+	// the messages being deleted stay in the set until the next time, when
+	// they're no longer on the server, in case QUIT fails and they are too
+	if err := saveSeen(seenPath, kept); err != nil {
+		c.Close()
+		return fetched, err
+	}
+
+	return fetched, c.Quit()
+}
+
+// loadSeen reads the set of UIDLs we've already downloaded
+func loadSeen(path string) (map[string]bool, error) {
+
+	seen := make(map[string]bool)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if uid := strings.TrimSpace(scanner.Text()); uid != "" {
+			seen[uid] = true
+		}
+	}
+
+	return seen, scanner.Err()
+}
+
+// saveSeen replaces the set of downloaded UIDLs, dropping any that are no longer on the server
+func saveSeen(path string, seen map[string]bool) error {
+
+	var b strings.Builder
+	for uid := range seen {
+		b.WriteString(uid + "\n")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,339 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aidk/go-mailer/internal/vault"
+)
+
+// the fields of a message that can be searched
+const (
+	FieldFrom    = "from"
+	FieldTo      = "to"
+	FieldSubject = "subject"
+	FieldBody    = "body"
+)
+
+// Doc is a message in the index. The message stays where it is, in Folder
+// under Key, the index only keeps what is needed to find and list it.
+type Doc struct {
+	Folder  string    `json:"folder"`
+	Key     string    `json:"key"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+
+	// Words holds the words of each field, each word once
+	Words map[string][]string `json:"words"`
+}
+
+// ID identifies the document, the same key could be in two folders
+func (d Doc) ID() string {
+	return d.Folder + "/" + d.Key
+}
+
+// Index finds messages by the words in them. It lives in a file next to the
+// mail it indexes, and only messages that aren't in it yet need to be read.
+type Index struct {
+	path string
+	docs map[string]*Doc
+
+	// postings has the documents each word is in, and in which of their fields
+	postings map[string]map[string][]string
+}
+
+// Open reads the index in the file at path, an index that doesn't exist yet is empty
+func Open(path string) (*Index, error) {
+
+	ix := &Index{path: path, docs: make(map[string]*Doc), postings: make(map[string]map[string][]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// it holds the words of sealed messages, so it is sealed too
+	if data, err = vault.Open(data); err != nil {
+		return ix, nil
+	}
+
+	var docs []*Doc
+	if err := json.Unmarshal(data, &docs); err != nil {
+		// the index only saves us reading the mail again, so a broken one is started over
+		return ix, nil
+	}
+	for _, d := range docs {
+		ix.add(d)
+	}
+
+	return ix, nil
+}
+
+// Has reports whether the message in the folder is in the index
+func (ix *Index) Has(folder, key string) bool {
+	_, ok := ix.docs[folder+"/"+key]
+	return ok
+}
+
+// Len returns how many messages are in the index
+func (ix *Index) Len() int {
+	return len(ix.docs)
+}
+
+// Add puts a message in the index, the text of each field is split into words
+func (ix *Index) Add(d Doc, body string) {
+
+	d.Words = map[string][]string{
+		FieldFrom:    Words(d.From),
+		FieldTo:      Words(d.To),
+		FieldSubject: Words(d.Subject),
+		FieldBody:    Words(body),
+	}
+	ix.add(&d)
+}
+
+// add puts the document in the postings of its words
+func (ix *Index) add(d *Doc) {
+
+	id := d.ID()
+	ix.remove(id)
+	ix.docs[id] = d
+
+	for field, words := range d.Words {
+		for _, w := range words {
+			if ix.postings[w] == nil {
+				ix.postings[w] = make(map[string][]string)
+			}
+			ix.postings[w][id] = append(ix.postings[w][id], field)
+		}
+	}
+}
+
+// remove takes the document with the id out of the index
+func (ix *Index) remove(id string) {
+
+	d, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for _, words := range d.Words {
+		for _, w := range words {
+			delete(ix.postings[w], id)
+			if len(ix.postings[w]) == 0 {
+				delete(ix.postings, w)
+			}
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// Keep takes the messages of the folder that aren't among the keys out of
+// the index, they have been removed since they were indexed
+func (ix *Index) Keep(folder string, keys []string) {
+
+	kept := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		kept[key] = true
+	}
+	for id, d := range ix.docs {
+		if d.Folder == folder && !kept[d.Key] {
+			ix.remove(id)
+		}
+	}
+}
+
+// Save writes the index to its file
+func (ix *Index) Save() error {
+
+	docs := make([]*Doc, 0, len(ix.docs))
+	for _, d := range ix.docs {
+		docs = append(docs, d)
+	}
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	if data, err = vault.Seal(data); err != nil {
+		return err
+	}
+
+	// we write it next to the old one first, so a crash can't leave half an index
+	tmp := ix.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ix.path)
+}
+
+// Query is a parsed search, see Parse
+type Query struct {
+	terms  []term
+	folder string
+	after  time.Time
+	before time.Time
+}
+
+// term is a word to look for, in one field or in any of them
+type term struct {
+	field  string
+	word   string
+	prefix bool // whether words that start with it match too
+}
+
+// Parse reads a search. Every word has to be in the message, in any field,
+// or in the field it is written after, as in subject:invoice. A word
+// ending in * matches every word that starts with it. after: and before:
+// take a day like 2024-03-01, after: takes in the day itself, and in: a
+// folder, such as in:sent.
+func Parse(s string) (Query, error) {
+
+	var q Query
+	for _, part := range strings.Fields(s) {
+		field, value, ok := strings.Cut(part, ":")
+		if !ok {
+			field, value = "", part
+		}
+		field = strings.ToLower(field)
+
+		switch field {
+		case "after", "before":
+			day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return Query{}, fmt.Errorf("%s: takes a day like 2024-03-01", field)
+			}
+			if field == "after" {
+				q.after = day
+			} else {
+				q.before = day
+			}
+			continue
+		case "in":
+			q.folder = value
+			continue
+		case "", FieldFrom, FieldTo, FieldSubject, FieldBody:
+		default:
+			// a colon that isn't after a field we know is part of what is looked for
+			field, value = "", part
+		}
+
+		prefix := strings.HasSuffix(value, "*")
+		words := Words(strings.TrimSuffix(value, "*"))
+		for i, w := range words {
+			// only the last word of something like ann@exa* is a prefix
+			q.terms = append(q.terms, term{field: field, word: w, prefix: prefix && i == len(words)-1})
+		}
+	}
+
+	return q, nil
+}
+
+// Empty reports whether the query has nothing to look for
+func (q Query) Empty() bool {
+	return len(q.terms) == 0 && q.folder == "" && q.after.IsZero() && q.before.IsZero()
+}
+
+// Search returns the messages that match the query, newest first
+func (ix *Index) Search(q Query) []Doc {
+
+	if q.Empty() {
+		return nil
+	}
+
+	// the documents every term so far matched, nil before the first one
+	var matches map[string]bool
+	for _, t := range q.terms {
+		next := make(map[string]bool)
+		for _, postings := range ix.postingsFor(t) {
+			for id, in := range postings {
+				if (matches == nil || matches[id]) && (t.field == "" || contains(in, t.field)) {
+					next[id] = true
+				}
+			}
+		}
+		matches = next
+	}
+
+	var found []Doc
+	for id, d := range ix.docs {
+		if matches != nil && !matches[id] {
+			continue
+		}
+		if q.folder != "" && !strings.EqualFold(d.Folder, q.folder) {
+			continue
+		}
+		// after: takes in the day itself, before: stops before it
+		if !q.after.IsZero() && d.Date.Before(q.after) {
+			continue
+		}
+		if !q.before.IsZero() && !d.Date.Before(q.before) {
+			continue
+		}
+		found = append(found, *d)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Date.After(found[j].Date)
+	})
+	return found
+}
+
+// postingsFor returns the postings of the words the term matches
+func (ix *Index) postingsFor(t term) []map[string][]string {
+
+	if !t.prefix {
+		if p, ok := ix.postings[t.word]; ok {
+			return []map[string][]string{p}
+		}
+		return nil
+	}
+
+	var all []map[string][]string
+	for w, p := range ix.postings {
+		if strings.HasPrefix(w, t.word) {
+			all = append(all, p)
+		}
+	}
+	return all
+}
+
+// Words splits text into lower case words, each returned once. Anything
+// that isn't a letter or a digit separates words, so an address is split
+// into its parts and ann@example.com is found by searching for ann.
+func Words(text string) []string {
+
+	seen := make(map[string]bool)
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// contains reports whether the field is among the fields
+func contains(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
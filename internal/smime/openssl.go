@@ -0,0 +1,105 @@
+package smime
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// binary is the openssl command we run, it is looked up in the PATH
+const binary = "openssl"
+
+// MicAlg is the hash we sign with, as named in the micalg parameter of a signed message
+const MicAlg = "sha-256"
+
+// passwordEnv is how the PKCS#12 password gets to openssl, so it doesn't
+// show up in the process list the way a command line argument would
+const passwordEnv = "GO_MAILER_PKCS12_PASSWORD"
+
+// Available reports whether openssl is installed
+func Available() bool {
+	_, err := exec.LookPath(binary)
+	return err == nil
+}
+
+// run runs openssl with the input on stdin and returns what it wrote to stdout.
+// If openssl fails, the error holds the first thing it complained about.
+func run(input []byte, password string, args ...string) ([]byte, error) {
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), passwordEnv+"="+password)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		complaint := strings.TrimSpace(strings.SplitN(strings.TrimSpace(stderr.String()), "\n", 2)[0])
+		if complaint == "" {
+			complaint = err.Error()
+		}
+		return nil, fmt.Errorf("openssl failed: %s", complaint)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// unpack reads the certificate and private key out of a PKCS#12 file, as PEM
+func unpack(p12, password string, args ...string) ([]byte, error) {
+
+	args = append([]string{"pkcs12", "-in", p12, "-nodes", "-passin", "env:" + passwordEnv}, args...)
+
+	out, err := run(nil, password, args...)
+	if err != nil {
+		// files exported by older tools use ciphers OpenSSL 3 only reads with -legacy
+		if legacy, lerr := run(nil, password, append(args, "-legacy")...); lerr == nil {
+			return legacy, nil
+		}
+		return nil, fmt.Errorf("could not read %s: %w", p12, err)
+	}
+
+	return out, nil
+}
+
+// Sign returns a detached DER signature of data, made with the certificate
+// and key in the PKCS#12 file. The certificates of the issuers are included
+// so the receiver can check the signature without having them already.
+func Sign(p12, password string, data []byte) ([]byte, error) {
+
+	signer, err := unpack(p12, password, "-clcerts")
+	if err != nil {
+		return nil, err
+	}
+	chain, err := unpack(p12, password, "-cacerts", "-nokeys")
+	if err != nil {
+		return nil, err
+	}
+
+	// openssl wants files, so the key spends a moment in a directory only we can read
+	dir, err := os.MkdirTemp("", "go-mailer-smime-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	signerFile := filepath.Join(dir, "signer.pem")
+	if err := os.WriteFile(signerFile, signer, 0600); err != nil {
+		return nil, err
+	}
+
+	// -binary keeps openssl from changing the line endings, the data already uses CRLF
+	args := []string{"smime", "-sign", "-binary", "-md", "sha256", "-outform", "DER", "-signer", signerFile, "-inkey", signerFile}
+	if bytes.Contains(chain, []byte("-----BEGIN CERTIFICATE-----")) {
+		chainFile := filepath.Join(dir, "chain.pem")
+		if err := os.WriteFile(chainFile, chain, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "-certfile", chainFile)
+	}
+
+	return run(data, password, args...)
+}
@@ -0,0 +1,311 @@
+package spamcheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Threshold is the score from which a message is likely to be taken for
+// spam, SpamAssassin's default
+const Threshold = 5.0
+
+// Rule is a test the message failed, and how much it adds to the score
+type Rule struct {
+	Name        string
+	Score       float64
+	Description string
+}
+
+// Report is what a check made of a message
+type Report struct {
+	Score     float64
+	Threshold float64
+	Rules     []Rule // the rules that fired, the ones that weigh most first
+}
+
+// Spam reports whether the message is likely to be taken for spam
+func (r Report) Spam() bool {
+	return r.Score >= r.Threshold
+}
+
+// Spamc has a local SpamAssassin score the message, through spamc(1)
+func Spamc(raw []byte) (Report, error) {
+
+	cmd := exec.Command("spamc", "--full")
+	cmd.Stdin = bytes.NewReader(raw)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// spamc exits with 1 when it thinks the message is spam, with --full
+	// that doesn't mean it failed, so we go by what it printed
+	err := cmd.Run()
+	report, ok := parseSpamc(stdout.String())
+	if !ok {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Report{}, fmt.Errorf("spamc failed: %s", msg)
+		}
+		if err != nil {
+			return Report{}, fmt.Errorf("spamc failed: %w", err)
+		}
+		return Report{}, fmt.Errorf("spamc gave no score, is spamd running?")
+	}
+	return report, nil
+}
+
+var (
+	// the first line spamc prints, e.g. 2.1/5.0
+	scoreLine = regexp.MustCompile(`^\s*(-?[0-9.]+)\s*/\s*(-?[0-9.]+)\s*$`)
+
+	// a rule in the table of the report, e.g.
+	//  1.5 SUBJ_ALL_CAPS          Subject is all capitals
+	ruleLine = regexp.MustCompile(`^\s*(-?[0-9]+\.[0-9]+)\s+([A-Z0-9_]+)\s+(.*)$`)
+)
+
+// parseSpamc reads the score and the rules out of what spamc --full printed
+func parseSpamc(out string) (Report, bool) {
+
+	sc := bufio.NewScanner(strings.NewReader(out))
+	if !sc.Scan() {
+		return Report{}, false
+	}
+	m := scoreLine.FindStringSubmatch(sc.Text())
+	if m == nil {
+		return Report{}, false
+	}
+	var r Report
+	r.Score, _ = strconv.ParseFloat(m[1], 64)
+	r.Threshold, _ = strconv.ParseFloat(m[2], 64)
+
+	// the table starts after the line of dashes under its heading
+	table := false
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "----"):
+			table = true
+		case !table || strings.TrimSpace(line) == "":
+		case ruleLine.MatchString(line):
+			m := ruleLine.FindStringSubmatch(line)
+			score, _ := strconv.ParseFloat(m[1], 64)
+			r.Rules = append(r.Rules, Rule{Name: m[2], Score: score, Description: strings.TrimSpace(m[3])})
+		case len(r.Rules) > 0:
+			// a long description goes on over the next lines
+			last := &r.Rules[len(r.Rules)-1]
+			last.Description += " " + strings.TrimSpace(line)
+		}
+	}
+
+	sortRules(r.Rules)
+	return r, true
+}
+
+// spammyPhrases are what spam says a lot more often than other mail does
+var spammyPhrases = []string{
+	"100% free",
+	"act now",
+	"buy now",
+	"cash bonus",
+	"click here",
+	"earn money",
+	"free money",
+	"guaranteed",
+	"limited time",
+	"no obligation",
+	"order now",
+	"risk-free",
+	"winner",
+}
+
+// shorteners are link shorteners, which hide where a link goes
+var shorteners = []string{"bit.ly/", "tinyurl.com/", "goo.gl/", "ow.ly/", "t.co/", "is.gd/"}
+
+// Heuristic scores the message with a few rules of our own, modelled on
+// SpamAssassin's, for when it isn't installed. The scores are rough, they
+// point at what to fix rather than predict what a filter will do.
+func Heuristic(raw []byte) (Report, error) {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Report{Threshold: Threshold}
+	fire := func(name string, score float64, description string) {
+		r.Rules = append(r.Rules, Rule{Name: name, Score: score, Description: description})
+		r.Score += score
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	switch {
+	case strings.TrimSpace(subject) == "":
+		fire("MISSING_SUBJECT", 1.8, "Subject is missing or empty")
+	case shouting(subject, 5):
+		fire("SUBJ_ALL_CAPS", 1.5, "Subject is all capitals")
+	}
+	if strings.Count(subject, "!") > 1 {
+		fire("SUBJ_EXCLAIM", 0.8, "Subject has more than one exclamation mark")
+	}
+	if msg.Header.Get("Date") == "" {
+		fire("MISSING_DATE", 1.4, "Missing Date header")
+	}
+	if msg.Header.Get("Message-Id") == "" {
+		fire("MISSING_MID", 0.5, "Missing Message-ID header")
+	}
+
+	var parts parts
+	if err := parts.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body); err != nil {
+		return Report{}, err
+	}
+
+	switch {
+	case parts.html && !parts.plain:
+		fire("MIME_HTML_ONLY", 1.1, "Message only has text/html MIME parts, add a plain text part")
+	case strings.TrimSpace(parts.text) == "" && parts.files == 0:
+		fire("EMPTY_MESSAGE", 2.3, "Message has no text and no attachments")
+	}
+
+	text := parts.text
+	if shouting(text, 50) {
+		fire("BODY_ALL_CAPS", 1.0, "Body is mostly in capitals")
+	}
+	if strings.Count(text, "!") >= 5 {
+		fire("BODY_EXCLAIM", 0.5, "Body has a lot of exclamation marks")
+	}
+
+	lower := strings.ToLower(text + " " + subject)
+	var found []string
+	for _, p := range spammyPhrases {
+		if strings.Contains(lower, p) {
+			found = append(found, strconv.Quote(p))
+		}
+	}
+	if len(found) > 0 {
+		fire("SPAMMY_PHRASES", min(0.5*float64(len(found)), 2.5), "Uses phrases common in spam: "+strings.Join(found, ", "))
+	}
+	for _, s := range shorteners {
+		if strings.Contains(lower, "://"+s) || strings.Contains(lower, "://www."+s) {
+			fire("URL_SHORTENER", 0.6, "Links through a URL shortener, "+strings.TrimSuffix(s, "/"))
+			break
+		}
+	}
+
+	sortRules(r.Rules)
+	return r, nil
+}
+
+// shouting reports whether the text is mostly in capitals, once it has at
+// least enough letters to tell
+func shouting(text string, least int) bool {
+
+	upper, letters := 0, 0
+	for _, c := range text {
+		if unicode.IsLetter(c) {
+			letters++
+			if unicode.IsUpper(c) {
+				upper++
+			}
+		}
+	}
+	return letters >= least && upper*10 >= letters*9
+}
+
+// parts is what the parts of the message hold
+type parts struct {
+	plain bool // whether there is a text/plain part
+	html  bool
+	text  string // the text of all the text parts
+	files int    // how many parts are attachments
+}
+
+// walk goes through a part, and the ones in it if it is multipart
+func (p *parts) walk(contentType, encoding string, body io.Reader) error {
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// a message without a Content-Type is plain text
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			if disposition == "attachment" {
+				p.files++
+				continue
+			}
+			if err := p.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch mediaType {
+	case "text/plain":
+		p.plain = true
+	case "text/html":
+		p.html = true
+	default:
+		p.files++
+		return nil
+	}
+
+	text, err := decode(encoding, body)
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/html" {
+		text = tags.ReplaceAllString(text, " ")
+	}
+	p.text += text + "\n"
+	return nil
+}
+
+// tags matches the tags of HTML, enough to leave the words for the rules
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// decode undoes the transfer encoding of a part
+func decode(encoding string, body io.Reader) (string, error) {
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// the decoder skips the line breaks itself
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+// sortRules puts the rules that weigh most first
+func sortRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Score > rules[j].Score
+	})
+}
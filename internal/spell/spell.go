@@ -0,0 +1,530 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// We read the dictionaries hunspell uses, which most systems and office
+// suites already have, e.g. /usr/share/hunspell/en_US.dic and en_US.aff.
+// The .dic file lists the stems of the words, each with flags saying which
+// affixes it takes, and the .aff file has the rules for those affixes. We
+// work out every form of every word when the dictionary is loaded, so
+// checking a word is just a lookup.
+
+// Dictionary is the words of a language, plus any the user added
+type Dictionary struct {
+	words map[string]bool
+	try   []rune      // the letters to try when suggesting, most common first
+	rep   [][2]string // common mistakes and what they should be, e.g. "f" for "ph"
+}
+
+// affix is one way of changing a stem, a prefix or a suffix
+type affix struct {
+	prefix    bool
+	cross     bool // whether it can be combined with an affix of the other kind
+	strip     string
+	add       string
+	condition []class
+	flags     []string // the affixes which can follow this one
+}
+
+// class matches a single letter of a condition, like . or [aeiou] or [^y]
+type class struct {
+	any     bool
+	negated bool
+	letters string
+}
+
+// affixFile is what we need from the .aff file
+type affixFile struct {
+	flagType  string
+	aliases   [][]string // flag sets numbered from 1, for dictionaries that use AF
+	affixes   map[string][]affix
+	cross     map[string]bool // the flags whose affixes can be combined with the other kind
+	needAffix string          // a stem with this flag isn't a word on its own
+	forbidden string          // a stem with this flag is never a word
+	try       []rune
+	rep       [][2]string
+}
+
+// Load reads a hunspell dictionary, dic is the .dic file and aff the .aff file
+func Load(dic, aff string) (*Dictionary, error) {
+
+	a, err := readAffixes(aff)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dictionary{words: make(map[string]bool), try: a.try, rep: a.rep}
+	if len(d.try) == 0 {
+		d.try = []rune("esianrtolcdugmphbyfvkwz'")
+	}
+
+	data, err := os.ReadFile(dic)
+	if err != nil {
+		return nil, err
+	}
+	text, err := decode(data, a.encoding(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dic, err)
+	}
+
+	forbidden := make(map[string]bool)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		// the first line is just how many words there are
+		if i == 0 || line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		stem, flags := splitEntry(line)
+		parsed := a.parseFlags(flags)
+		if has(parsed, a.forbidden) {
+			forbidden[stem] = true
+			continue
+		}
+		for _, form := range a.expand(stem, parsed) {
+			d.words[form] = true
+		}
+	}
+
+	for word := range forbidden {
+		delete(d.words, word)
+	}
+
+	return d, nil
+}
+
+// AddFile adds the words in a file, one on each line, like the ones the user
+// taught us. A file that doesn't exist yet has no words.
+func (d *Dictionary) AddFile(path string) error {
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if word := strings.TrimSpace(line); word != "" {
+			d.Add(word)
+		}
+	}
+
+	return nil
+}
+
+// Add teaches the dictionary a word
+func (d *Dictionary) Add(word string) {
+	d.words[normalize(word)] = true
+}
+
+// Correct reports whether the word is spelled right. A word in lower case in
+// the dictionary can also start with a capital or be all capitals, but a
+// name like Paris has to keep its capital.
+func (d *Dictionary) Correct(word string) bool {
+
+	word = normalize(word)
+	if d.words[word] {
+		return true
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case isTitle(word):
+		return d.words[lower]
+	case isUpper(word):
+		return d.words[lower] || d.words[title(lower)]
+	}
+
+	return false
+}
+
+// normalize turns typographic apostrophes into the plain ones dictionaries use
+func normalize(word string) string {
+	return strings.ReplaceAll(word, "’", "'")
+}
+
+// readAffixes reads the rules from the .aff file
+func readAffixes(path string) (*affixFile, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &affixFile{affixes: make(map[string][]affix), cross: make(map[string]bool)}
+	text, err := decode(data, a.encoding(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "FLAG":
+			a.flagType = fields[1]
+		case "NEEDAFFIX":
+			a.needAffix = fields[1]
+		case "FORBIDDENWORD":
+			a.forbidden = fields[1]
+		case "TRY":
+			// we suggest in lower case and put the capitals back after, so we only need the lower case letters
+			for _, r := range fields[1] {
+				if !unicode.IsUpper(r) {
+					a.try = append(a.try, r)
+				}
+			}
+		case "AF":
+			// the first AF line only says how many follow
+			if _, err := strconv.Atoi(fields[1]); err != nil || len(a.aliases) > 0 {
+				a.aliases = append(a.aliases, a.splitFlags(fields[1]))
+			} else {
+				a.aliases = append(a.aliases, nil)
+			}
+		case "REP":
+			if len(fields) >= 3 {
+				a.rep = append(a.rep, [2]string{strings.ReplaceAll(fields[1], "_", " "), strings.ReplaceAll(fields[2], "_", " ")})
+			}
+		case "PFX", "SFX":
+			// the header of a group is PFX flag Y count, each rule is PFX flag strip add condition
+			if len(fields) < 4 {
+				continue
+			}
+			if _, err := strconv.Atoi(fields[3]); err == nil && len(fields) == 4 && (fields[2] == "Y" || fields[2] == "N") {
+				a.cross[fields[1]] = fields[2] == "Y"
+				continue
+			}
+			a.addRule(fields)
+		}
+	}
+
+	return a, s.Err()
+}
+
+// addRule adds a PFX or SFX rule to the affixes with its flag
+func (a *affixFile) addRule(fields []string) {
+
+	flag := fields[1]
+	x := affix{prefix: fields[0] == "PFX", cross: a.cross[flag], strip: fields[2]}
+	if x.strip == "0" {
+		x.strip = ""
+	}
+
+	add, flags, _ := strings.Cut(fields[3], "/")
+	if add == "0" {
+		add = ""
+	}
+	x.add = add
+	x.flags = a.parseFlags(flags)
+
+	condition := "."
+	if len(fields) > 4 {
+		condition = fields[4]
+	}
+	x.condition = parseCondition(condition)
+
+	a.affixes[flag] = append(a.affixes[flag], x)
+}
+
+// expand returns every form the stem takes with its affixes
+func (a *affixFile) expand(stem string, flags []string) []string {
+
+	var forms []string
+	if !has(flags, a.needAffix) {
+		forms = append(forms, stem)
+	}
+
+	var prefixes, suffixes []affix
+	for _, flag := range flags {
+		for _, x := range a.affixes[flag] {
+			if x.prefix {
+				prefixes = append(prefixes, x)
+			} else {
+				suffixes = append(suffixes, x)
+			}
+		}
+	}
+
+	for _, sfx := range suffixes {
+		word, ok := sfx.apply(stem)
+		if !ok {
+			continue
+		}
+		if !has(sfx.flags, a.needAffix) {
+			forms = append(forms, word)
+		}
+
+		// a suffix can allow another one after it, e.g. in German
+		for _, flag := range sfx.flags {
+			for _, next := range a.affixes[flag] {
+				if next.prefix {
+					continue
+				}
+				if w, ok := next.apply(word); ok {
+					forms = append(forms, w)
+				}
+			}
+		}
+
+		for _, pfx := range prefixes {
+			if pfx.cross && sfx.cross {
+				if w, ok := pfx.apply(word); ok {
+					forms = append(forms, w)
+				}
+			}
+		}
+	}
+
+	for _, pfx := range prefixes {
+		if word, ok := pfx.apply(stem); ok && !has(pfx.flags, a.needAffix) {
+			forms = append(forms, word)
+		}
+	}
+
+	return forms
+}
+
+// apply adds the affix to the word, if its condition allows
+func (x affix) apply(word string) (string, bool) {
+
+	runes := []rune(word)
+	n := len(x.condition)
+	if len(runes) < n {
+		return "", false
+	}
+
+	if x.prefix {
+		if !matches(x.condition, runes[:n]) || !strings.HasPrefix(word, x.strip) {
+			return "", false
+		}
+		return x.add + word[len(x.strip):], true
+	}
+
+	if !matches(x.condition, runes[len(runes)-n:]) || !strings.HasSuffix(word, x.strip) {
+		return "", false
+	}
+	rest := word[:len(word)-len(x.strip)]
+	if rest == "" && x.add == "" {
+		return "", false
+	}
+
+	return rest + x.add, true
+}
+
+// matches reports whether each letter matches the class at the same place
+func matches(condition []class, runes []rune) bool {
+
+	for i, c := range condition {
+		if c.any {
+			continue
+		}
+		if strings.ContainsRune(c.letters, runes[i]) == c.negated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseCondition splits a condition like [^aeiou]y into the letters it matches
+func parseCondition(condition string) []class {
+
+	if condition == "." {
+		return nil
+	}
+
+	var classes []class
+	runes := []rune(condition)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '.':
+			classes = append(classes, class{any: true})
+		case '[':
+			c := class{}
+			i++
+			if i < len(runes) && runes[i] == '^' {
+				c.negated = true
+				i++
+			}
+			start := i
+			for i < len(runes) && runes[i] != ']' {
+				i++
+			}
+			c.letters = string(runes[start:i])
+			classes = append(classes, c)
+		default:
+			classes = append(classes, class{letters: string(runes[i])})
+		}
+	}
+
+	return classes
+}
+
+// splitEntry splits a line of the .dic file into the stem and its flags, the
+// stem can have an escaped slash in it and anything after a tab is ignored
+func splitEntry(line string) (string, string) {
+
+	if i := strings.IndexAny(line, "\t"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '/' && i > 0 {
+			stem := strings.ReplaceAll(line[:i], `\/`, "/")
+			return stem, line[i+1:]
+		}
+	}
+
+	// a word with morphological fields after it is separated by a space
+	if i := strings.Index(line, " "); i >= 0 {
+		line = line[:i]
+	}
+
+	return strings.ReplaceAll(line, `\/`, "/"), ""
+}
+
+// parseFlags turns the flags of a stem or an affix into a list, looking up
+// the set when the dictionary numbers its sets of flags with AF
+func (a *affixFile) parseFlags(flags string) []string {
+
+	if flags == "" {
+		return nil
+	}
+	if len(a.aliases) > 0 {
+		n, err := strconv.Atoi(flags)
+		if err == nil && n > 0 && n < len(a.aliases) {
+			return a.aliases[n]
+		}
+	}
+
+	return a.splitFlags(flags)
+}
+
+// splitFlags splits flags written the way the FLAG line says, one letter
+// each by default, two with long and comma separated numbers with num
+func (a *affixFile) splitFlags(flags string) []string {
+
+	var out []string
+	switch a.flagType {
+	case "long":
+		runes := []rune(flags)
+		for i := 0; i+1 < len(runes); i += 2 {
+			out = append(out, string(runes[i:i+2]))
+		}
+	case "num":
+		out = strings.Split(flags, ",")
+	default:
+		for _, r := range flags {
+			out = append(out, string(r))
+		}
+	}
+
+	return out
+}
+
+// encoding returns the character set the SET line of the .aff file names,
+// a .dic file is in the same one
+func (a *affixFile) encoding(data []byte) string {
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) == 2 && fields[0] == "SET" {
+			return fields[1]
+		}
+	}
+
+	return "ISO8859-1"
+}
+
+// decode turns the dictionary's text into UTF-8
+func decode(data []byte, charset string) (string, error) {
+
+	name := strings.ToLower(charset)
+	if name == "utf-8" || isASCII(data) {
+		return string(data), nil
+	}
+
+	// hunspell writes ISO8859-1 and microsoft-cp1251, the names we can look up are iso-8859-1 and windows-1251
+	if strings.HasPrefix(name, "iso8859") {
+		name = "iso-8859" + strings.TrimPrefix(name, "iso8859")
+	}
+	name = strings.Replace(name, "microsoft-cp", "windows-", 1)
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown character set %s", charset)
+	}
+
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// isASCII reports whether the text is plain ASCII, which reads the same in every character set
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// has reports whether the flag is in the list
+func has(flags []string, flag string) bool {
+
+	if flag == "" {
+		return false
+	}
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTitle reports whether the word starts with a capital and the rest is lower case
+func isTitle(word string) bool {
+	r, size := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r) && strings.ToLower(word[size:]) == word[size:]
+}
+
+// isUpper reports whether every letter of the word is a capital
+func isUpper(word string) bool {
+	return strings.ToUpper(word) == word && strings.ToLower(word) != word
+}
+
+// title gives a lower case word a capital first letter
+func title(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
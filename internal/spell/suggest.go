@@ -0,0 +1,138 @@
+package spell
+
+import (
+	"strings"
+)
+
+// Suggest returns up to n words the misspelled word might have been meant
+// to be, the likeliest first. We try the dictionary's list of common
+// mistakes, then every word one letter away, a letter missing, extra,
+// wrong or swapped with its neighbour, and then words two letters away.
+func (d *Dictionary) Suggest(word string, n int) []string {
+
+	word = normalize(word)
+	lower := strings.ToLower(word)
+
+	var out []string
+	seen := map[string]bool{lower: true}
+	add := func(candidate string) bool {
+		if seen[candidate] {
+			return false
+		}
+		seen[candidate] = true
+		if found, ok := d.known(candidate); ok {
+			out = append(out, matchCase(found, word))
+		}
+		return len(out) >= n
+	}
+
+	for _, rep := range d.rep {
+		for i := strings.Index(lower, rep[0]); i >= 0; {
+			if add(lower[:i] + rep[1] + lower[i+len(rep[0]):]) {
+				return out
+			}
+			next := strings.Index(lower[i+1:], rep[0])
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+
+	first := d.edits(lower)
+	for _, candidate := range first {
+		if add(candidate) {
+			return out
+		}
+	}
+
+	// two words run together are two words
+	runes := []rune(lower)
+	for i := 1; i < len(runes); i++ {
+		left, right := string(runes[:i]), string(runes[i:])
+		if d.Correct(left) && d.Correct(right) {
+			if add(left + " " + right) {
+				return out
+			}
+		}
+	}
+
+	// the words two letters away are many more, so we only go looking for
+	// them when there's nothing closer
+	if len(out) > 0 {
+		return out
+	}
+	for _, edit := range first {
+		for _, candidate := range d.edits(edit) {
+			if add(candidate) {
+				return out
+			}
+		}
+	}
+
+	return out
+}
+
+// known returns the form the dictionary knows the word in, e.g. with a capital for a name
+func (d *Dictionary) known(word string) (string, bool) {
+
+	if strings.Contains(word, " ") {
+		return word, true
+	}
+	if d.words[word] {
+		return word, true
+	}
+	if t := title(word); d.words[t] {
+		return t, true
+	}
+
+	return "", false
+}
+
+// edits returns every string one letter away from the word
+func (d *Dictionary) edits(word string) []string {
+
+	runes := []rune(word)
+	var out []string
+
+	// a letter swapped with the next one, the most common slip of all
+	for i := 0; i+1 < len(runes); i++ {
+		swapped := append([]rune{}, runes...)
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		out = append(out, string(swapped))
+	}
+	// a letter too many
+	for i := range runes {
+		out = append(out, string(runes[:i])+string(runes[i+1:]))
+	}
+	// a wrong letter
+	for i := range runes {
+		for _, r := range d.try {
+			if r != runes[i] {
+				out = append(out, string(runes[:i])+string(r)+string(runes[i+1:]))
+			}
+		}
+	}
+	// a letter missing
+	for i := 0; i <= len(runes); i++ {
+		for _, r := range d.try {
+			out = append(out, string(runes[:i])+string(r)+string(runes[i:]))
+		}
+	}
+
+	return out
+}
+
+// matchCase writes the suggestion the way the word was written, with a
+// capital at the start of a sentence or all in capitals
+func matchCase(suggestion, word string) string {
+
+	switch {
+	case isUpper(word) && len([]rune(word)) > 1:
+		return strings.ToUpper(suggestion)
+	case isTitle(word):
+		return title(suggestion)
+	}
+
+	return suggestion
+}
@@ -0,0 +1,107 @@
+package spell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Word is a word found in a text, Start and End are where it is, counted in runes
+type Word struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Misspelled returns the words in the text that aren't in the dictionary
+func (d *Dictionary) Misspelled(text string) []Word {
+
+	var bad []Word
+	for _, w := range Words(text) {
+		if !d.Correct(w.Text) {
+			bad = append(bad, w)
+		}
+	}
+
+	return bad
+}
+
+// Words returns the words in the text worth checking. Quoted lines of a
+// reply aren't ours to correct, and neither are addresses, links, numbers
+// or single letters.
+func Words(text string) []Word {
+
+	var words []Word
+
+	runes := []rune(text)
+	lineStart := true
+	quoted := false
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if r == '\n' {
+			lineStart, quoted = true, false
+			i++
+			continue
+		}
+		if lineStart && r == '>' {
+			quoted = true
+		}
+		if !unicode.IsSpace(r) {
+			lineStart = false
+		}
+		if unicode.IsSpace(r) {
+			i++
+			continue
+		}
+
+		// we look at everything up to the next space at once, so the
+		// parts of an address or a link aren't checked one by one
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		token := string(runes[i:end])
+		if !quoted && !skipToken(token) {
+			words = append(words, tokenWords(runes[i:end], i)...)
+		}
+		i = end
+	}
+
+	return words
+}
+
+// skipToken reports whether a run of text between spaces is something other than words
+func skipToken(token string) bool {
+	return strings.Contains(token, "@") || strings.Contains(token, "://") || strings.HasPrefix(token, "www.") ||
+		strings.IndexFunc(token, unicode.IsDigit) >= 0
+}
+
+// tokenWords splits a run of text between spaces into its words, an
+// apostrophe inside a word like don't is part of it
+func tokenWords(runes []rune, offset int) []Word {
+
+	var words []Word
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		letter := i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.Is(unicode.Mn, runes[i]))
+		inner := i < len(runes) && start >= 0 && isApostrophe(runes[i]) && i+1 < len(runes) && unicode.IsLetter(runes[i+1])
+
+		switch {
+		case letter || inner:
+			if start < 0 {
+				start = i
+			}
+		case start >= 0:
+			if i-start > 1 {
+				words = append(words, Word{Text: string(runes[start:i]), Start: offset + start, End: offset + i})
+			}
+			start = -1
+		}
+	}
+
+	return words
+}
+
+// isApostrophe reports whether the rune is a plain or a typographic apostrophe
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
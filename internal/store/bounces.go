@@ -0,0 +1,72 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bouncesFile is where the store keeps a line of JSON for every recipient a
+// delivery status notification said a sent message didn't reach
+const bouncesFile = ".bounces"
+
+// Bounce is a recipient a sent message couldn't be delivered to, as a
+// delivery status notification in the inbox reported it
+type Bounce struct {
+	ReportID   string    `json:"report_id"`   // the Message-ID of the report
+	OriginalID string    `json:"original_id"` // the Message-ID of the message that bounced
+	Recipient  string    `json:"recipient"`
+	Status     string    `json:"status"`               // the enhanced status code, e.g. 5.1.1
+	Diagnostic string    `json:"diagnostic,omitempty"` // what the remote server said
+	Received   time.Time `json:"received"`
+}
+
+// SaveBounces adds bounces to the ones the store knows about
+func (s *Store) SaveBounces(bounces []Bounce) error {
+
+	f, err := os.OpenFile(filepath.Join(s.dir, bouncesFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, b := range bounces {
+		line, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bounces returns every bounce the store knows about, oldest first
+func (s *Store) Bounces() ([]Bounce, error) {
+
+	f, err := os.Open(filepath.Join(s.dir, bouncesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bounces []Bounce
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var b Bounce
+		if err := json.Unmarshal(scanner.Bytes(), &b); err != nil {
+			// like the history, a broken line doesn't hide the others
+			continue
+		}
+		bounces = append(bounces, b)
+	}
+
+	return bounces, scanner.Err()
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/vault"
+)
+
+// followUpsFile is where the store keeps the sent messages we want to be
+// reminded of if nobody replies to them
+const followUpsFile = ".followups"
+
+// FollowUp is a sent message to follow up on if no reply to it arrives by Due
+type FollowUp struct {
+	MessageID string    `json:"message_id"` // what a reply has in its In-Reply-To or References
+	Key       string    `json:"key"`        // the message in the Sent folder
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	Due       time.Time `json:"due"`
+}
+
+// Overdue reports whether the reminder is due
+func (f FollowUp) Overdue(now time.Time) bool {
+	return !now.Before(f.Due)
+}
+
+// FollowUps returns the messages waiting for a reply, the one due first first
+func (s *Store) FollowUps() ([]FollowUp, error) {
+
+	data, err := os.ReadFile(filepath.Join(s.dir, followUpsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = vault.Open(data); err != nil {
+		return nil, err
+	}
+
+	var followUps []FollowUp
+	if err := json.Unmarshal(data, &followUps); err != nil {
+		return nil, err
+	}
+	return followUps, nil
+}
+
+// SetFollowUp adds a reminder, or changes the one the message already has
+func (s *Store) SetFollowUp(f FollowUp) error {
+
+	followUps, err := s.FollowUps()
+	if err != nil {
+		return err
+	}
+
+	kept := followUps[:0]
+	for _, old := range followUps {
+		if mailbox.NormalizeID(old.MessageID) == mailbox.NormalizeID(f.MessageID) {
+			continue
+		}
+		kept = append(kept, old)
+	}
+	return s.saveFollowUps(append(kept, f))
+}
+
+// RemoveFollowUps drops the reminders of the messages with the Message-IDs,
+// e.g. once they were replied to, and returns how many there were
+func (s *Store) RemoveFollowUps(ids ...string) (int, error) {
+
+	followUps, err := s.FollowUps()
+	if err != nil {
+		return 0, err
+	}
+
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[mailbox.NormalizeID(id)] = true
+	}
+
+	kept := followUps[:0]
+	for _, f := range followUps {
+		if !drop[mailbox.NormalizeID(f.MessageID)] {
+			kept = append(kept, f)
+		}
+	}
+
+	removed := len(followUps) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.saveFollowUps(kept)
+}
+
+// saveFollowUps replaces the reminders with the given ones
+func (s *Store) saveFollowUps(followUps []FollowUp) error {
+
+	sort.SliceStable(followUps, func(i, j int) bool {
+		return followUps[i].Due.Before(followUps[j].Due)
+	})
+
+	data, err := json.MarshalIndent(followUps, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// like the contacts, a new file is moved into place so a crash can't leave half of it
+	path := filepath.Join(s.dir, followUpsFile)
+	tmp := path + ".tmp"
+	if data, err = vault.Seal(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
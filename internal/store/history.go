@@ -0,0 +1,147 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/vault"
+)
+
+// historyFile is where the store keeps a line of JSON for every message sent
+const historyFile = ".sent-history"
+
+// SentRecord describes a message that was sent. The message itself is kept in
+// the Sent folder under Key, the record adds what only we know about it.
+type SentRecord struct {
+	Key     string    `json:"key"`
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Sent    time.Time `json:"sent"` // when the transport accepted the message
+
+	// MessageID is the message's Message-ID header, so a bounce can be
+	// matched with the message that bounced
+	MessageID string `json:"message_id,omitempty"`
+
+	// Transport is how the message went out, e.g. "smtp" or "jmap", and
+	// Result is what the server said when it accepted it
+	Transport string `json:"transport"`
+	Result    string `json:"result"`
+}
+
+// SaveSent keeps a copy of a sent message in the Sent folder and adds it to
+// the sent history. The record's key is filled in from the delivered message.
+func (s *Store) SaveSent(rec SentRecord, raw []byte) (SentRecord, error) {
+
+	key, err := s.Folder(Sent).DeliverSealed(raw, string(FlagSeen))
+	if err != nil {
+		return rec, err
+	}
+	rec.Key = key
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	if line, err = sealLine(line); err != nil {
+		return rec, err
+	}
+
+	// the history is only ever appended to, so one line is written at a time
+	f, err := os.OpenFile(filepath.Join(s.dir, historyFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return rec, err
+}
+
+// History returns the sent history, newest first. Records whose message was
+// removed from the Sent folder are left out.
+func (s *Store) History() ([]SentRecord, error) {
+
+	f, err := os.Open(filepath.Join(s.dir, historyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys, err := s.Folder(Sent).Keys()
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		kept[key] = true
+	}
+
+	var records []SentRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, err := openLine(scanner.Bytes())
+		if errors.Is(err, vault.ErrLocked) {
+			return nil, err
+		}
+		var rec SentRecord
+		if err != nil || json.Unmarshal(line, &rec) != nil {
+			// a line cut short by a crash shouldn't hide the rest of the history
+			continue
+		}
+		if !kept[rec.Key] {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// the file is oldest first, so we turn it around
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, nil
+}
+
+// sealLine encrypts a line of the history when encryption is turned on,
+// as base64 so the history stays one record per line
+func sealLine(line []byte) ([]byte, error) {
+
+	if !vault.Unlocked() {
+		return line, nil
+	}
+
+	sealed, err := vault.Seal(line)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openLine undoes sealLine, the lines written before encryption was turned
+// on are plain JSON
+func openLine(line []byte) ([]byte, error) {
+
+	if bytes.HasPrefix(line, []byte("{")) {
+		return line, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		// a line cut short by a crash, it is skipped like a broken JSON one
+		return line, nil
+	}
+	return vault.Open(sealed)
+}
@@ -0,0 +1,353 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/mailbox"
+	"github.com/aidk/go-mailer/internal/vault"
+)
+
+// Maildir is a single mail folder in the Maildir format, so other tools
+// like mutt and notmuch can read it. New mail is delivered into "new",
+// mail that has been looked at lives in "cur" with its flags in the file
+// name, and "tmp" is used while a message is being written.
+// See https://cr.yp.to/proto/maildir.html
+type Maildir string
+
+// the flags we care about, they are stored in the file name after ":2,"
+const (
+	FlagSeen    = 'S'
+	FlagDraft   = 'D'
+	FlagReplied = 'R'
+	FlagFlagged = 'F'
+	FlagTrashed = 'T'
+)
+
+// deliveries makes unique names for messages delivered in the same microsecond
+var deliveries int64
+
+// Init creates the tmp, new and cur directories if they don't exist
+func (d Maildir) Init() error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(string(d), sub), 0o700); err != nil {
+			return fmt.Errorf("could not create maildir: %w", err)
+		}
+	}
+	return nil
+}
+
+// Deliver writes a raw message into the folder and returns its key.
+// Messages without flags go into "new", flagged ones straight into "cur".
+// Like other maildir tools we store messages with plain \n line endings.
+func (d Maildir) Deliver(raw []byte, flags string) (string, error) {
+	return d.deliver(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), flags)
+}
+
+// DeliverSealed is like Deliver, but encrypts the message when encryption
+// is turned on. Only go-mailer can read it then, so it is for the messages
+// the user writes, like drafts and the copies of sent mail.
+func (d Maildir) DeliverSealed(raw []byte, flags string) (string, error) {
+
+	raw, err := vault.Seal(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")))
+	if err != nil {
+		return "", fmt.Errorf("could not encrypt message: %w", err)
+	}
+
+	return d.deliver(raw, flags)
+}
+
+// deliver writes a message that is ready to be stored into the folder
+func (d Maildir) deliver(raw []byte, flags string) (string, error) {
+
+	key := uniqueName()
+
+	// we write to tmp first so nobody ever sees half a message
+	tmp := filepath.Join(string(d), "tmp", key)
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return "", fmt.Errorf("could not save message: %w", err)
+	}
+
+	dest := filepath.Join(string(d), "new", key)
+	if flags != "" {
+		dest = filepath.Join(string(d), "cur", key+":2,"+sortFlags(flags))
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("could not save message: %w", err)
+	}
+
+	return key, nil
+}
+
+// uniqueName returns a file name following the maildir naming convention,
+// <seconds>.M<microseconds>P<pid>Q<counter>.<hostname>
+func uniqueName() string {
+
+	now := time.Now()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	// slashes and colons have special meaning in maildir names
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s",
+		now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddInt64(&deliveries, 1), host)
+}
+
+// sortFlags returns the flags in ASCII order without duplicates, as the spec requires
+func sortFlags(flags string) string {
+	seen := make(map[rune]bool)
+	var out []rune
+	for _, f := range flags {
+		if !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return string(out)
+}
+
+// entry is a message file found in new or cur
+type entry struct {
+	key   string
+	path  string
+	flags string
+	mod   time.Time
+}
+
+// entries returns every message in the folder, newest first
+func (d Maildir) entries() ([]entry, error) {
+
+	var found []entry
+
+	for _, sub := range []string{"new", "cur"} {
+		files, err := os.ReadDir(filepath.Join(string(d), sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			// dot files aren't messages
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+
+			key, flags := f.Name(), ""
+			if i := strings.Index(key, ":2,"); i >= 0 {
+				key, flags = key[:i], key[i+3:]
+			}
+
+			found = append(found, entry{
+				key:   key,
+				path:  filepath.Join(string(d), sub, f.Name()),
+				flags: flags,
+				mod:   info.ModTime(),
+			})
+		}
+	}
+
+	// file times can be coarse, so messages delivered together fall back to
+	// their names, which start with the delivery time
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].mod.Equal(found[j].mod) {
+			return found[i].mod.After(found[j].mod)
+		}
+		return found[i].key > found[j].key
+	})
+	return found, nil
+}
+
+// Keys returns the key of every message in the folder, newest first
+func (d Maildir) Keys() ([]string, error) {
+
+	entries, err := d.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+
+	return keys, nil
+}
+
+// find returns the entry for the given key
+func (d Maildir) find(key string) (entry, error) {
+
+	entries, err := d.entries()
+	if err != nil {
+		return entry{}, err
+	}
+
+	for _, e := range entries {
+		if e.key == key {
+			return e, nil
+		}
+	}
+
+	return entry{}, fmt.Errorf("message %s not found", key)
+}
+
+// Get returns the raw message with the given key, decrypted if it was sealed
+func (d Maildir) Get(key string) ([]byte, error) {
+
+	e, err := d.find(key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+	return vault.Open(raw)
+}
+
+// Remove deletes the message with the given key
+func (d Maildir) Remove(key string) error {
+
+	e, err := d.find(key)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(e.path)
+}
+
+// SetFlags replaces a message's flags, which also moves it from new into cur
+func (d Maildir) SetFlags(key, flags string) error {
+
+	e, err := d.find(key)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(string(d), "cur", key+":2,"+sortFlags(flags))
+	return os.Rename(e.path, dest)
+}
+
+// Flags returns a message's flags
+func (d Maildir) Flags(key string) (string, error) {
+
+	e, err := d.find(key)
+	if err != nil {
+		return "", err
+	}
+
+	return e.flags, nil
+}
+
+// MoveTo moves the message with the given key into another folder, keeping its flags
+func (d Maildir) MoveTo(key string, dest Maildir) error {
+
+	e, err := d.find(key)
+	if err != nil {
+		return err
+	}
+	if err := dest.Init(); err != nil {
+		return err
+	}
+
+	return os.Rename(e.path, filepath.Join(string(dest), filepath.Base(filepath.Dir(e.path)), filepath.Base(e.path)))
+}
+
+// Expunge removes the messages that are marked as trashed
+func (d Maildir) Expunge() error {
+
+	entries, err := d.entries()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if strings.ContainsRune(e.flags, FlagTrashed) {
+			if err := os.Remove(e.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Envelopes returns the envelopes of the newest messages, newest first, up to the given limit
+func (d Maildir) Envelopes(limit int) ([]mailbox.Envelope, error) {
+
+	entries, err := d.entries()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	envelopes := make([]mailbox.Envelope, 0, len(entries))
+	for _, e := range entries {
+		raw, err := os.ReadFile(e.path)
+		if err != nil {
+			// another program may have moved it while we were reading
+			continue
+		}
+		// a sealed message we can't open shows up as unreadable
+		raw, _ = vault.Open(raw)
+		env := envelope(e.key, raw)
+		env.Seen = strings.ContainsRune(e.flags, FlagSeen)
+		env.Flagged = strings.ContainsRune(e.flags, FlagFlagged)
+		env.Deleted = strings.ContainsRune(e.flags, FlagTrashed)
+		envelopes = append(envelopes, env)
+	}
+
+	return envelopes, nil
+}
+
+// envelope reads the headers of a raw message into an Envelope,
+// messages we can't parse still show up so they aren't silently lost
+func envelope(key string, raw []byte) mailbox.Envelope {
+
+	e := mailbox.Envelope{ID: key, Subject: "(unreadable message)"}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return e
+	}
+
+	dec := new(mime.WordDecoder)
+	if subject, err := dec.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		e.Subject = subject
+	}
+	e.Date, _ = msg.Header.Date()
+	e.MessageID = msg.Header.Get("Message-Id")
+	e.InReplyTo = msg.Header.Get("In-Reply-To")
+	e.References = mailbox.ParseReferences(msg.Header.Get("References"))
+
+	e.From = msg.Header.Get("From")
+	if from, err := mail.ParseAddress(e.From); err == nil {
+		e.From = from.Name
+		if e.From == "" {
+			e.From = from.Address
+		}
+	}
+
+	return e
+}
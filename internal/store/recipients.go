@@ -0,0 +1,177 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/vault"
+)
+
+// recipientsFile is where the store keeps every address a message was sent
+// to, with how often and when last, to suggest them as the To field is typed
+const recipientsFile = ".recipients"
+
+// Recipient is an address we have sent mail to
+type Recipient struct {
+	Address string    `json:"address"`
+	Name    string    `json:"name,omitempty"`
+	Count   int       `json:"count"` // how many messages went to it
+	Last    time.Time `json:"last"`  // when the last one did
+}
+
+// Score ranks the recipient for suggesting, by how often we've written to
+// them and how recently. Someone written to every day this week comes before
+// someone written to a lot last year.
+func (r Recipient) Score(now time.Time) float64 {
+
+	weight := 0.1
+	switch age := now.Sub(r.Last); {
+	case age < 4*24*time.Hour:
+		weight = 1
+	case age < 14*24*time.Hour:
+		weight = 0.7
+	case age < 31*24*time.Hour:
+		weight = 0.5
+	case age < 90*24*time.Hour:
+		weight = 0.3
+	}
+	return float64(r.Count) * weight
+}
+
+// Recipients returns everyone we've sent mail to, the best to suggest first.
+// Before any were remembered, they are worked out from the sent history.
+func (s *Store) Recipients() ([]Recipient, error) {
+
+	data, err := os.ReadFile(filepath.Join(s.dir, recipientsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s.historyRecipients()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = vault.Open(data); err != nil {
+		return nil, err
+	}
+
+	var recipients []Recipient
+	if err := json.Unmarshal(data, &recipients); err != nil {
+		return nil, err
+	}
+	sortRecipients(recipients, time.Now())
+	return recipients, nil
+}
+
+// AddRecipients remembers that a message was sent to the addresses
+func (s *Store) AddRecipients(to []string, when time.Time) error {
+
+	recipients, err := s.Recipients()
+	if err != nil {
+		return err
+	}
+	return s.saveRecipients(addRecipients(recipients, to, when))
+}
+
+// historyRecipients works out the recipients from every line of the sent
+// history, the messages removed from the Sent folder included
+func (s *Store) historyRecipients() ([]Recipient, error) {
+
+	f, err := os.Open(filepath.Join(s.dir, historyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recipients []Recipient
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, err := openLine(scanner.Bytes())
+		if errors.Is(err, vault.ErrLocked) {
+			return nil, err
+		}
+		var rec SentRecord
+		if err != nil || json.Unmarshal(line, &rec) != nil {
+			continue
+		}
+		recipients = addRecipients(recipients, rec.To, rec.Sent)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sortRecipients(recipients, time.Now())
+	return recipients, nil
+}
+
+// addRecipients counts a message sent to the addresses, which can have a name like "Ann <ann@example.com>"
+func addRecipients(recipients []Recipient, to []string, when time.Time) []Recipient {
+
+	index := make(map[string]int, len(recipients))
+	for i, r := range recipients {
+		index[strings.ToLower(r.Address)] = i
+	}
+
+	for _, addr := range to {
+		name := ""
+		if a, err := mail.ParseAddress(addr); err == nil {
+			name, addr = a.Name, a.Address
+		}
+		key := strings.ToLower(strings.TrimSpace(addr))
+		if key == "" {
+			continue
+		}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(recipients)
+			recipients = append(recipients, Recipient{Address: strings.TrimSpace(addr), Name: name, Count: 1, Last: when})
+			continue
+		}
+		r := &recipients[i]
+		r.Count++
+		if when.After(r.Last) {
+			r.Last = when
+		}
+		if name != "" {
+			r.Name = name
+		}
+	}
+	return recipients
+}
+
+// sortRecipients puts the best to suggest first
+func sortRecipients(recipients []Recipient, now time.Time) {
+	sort.SliceStable(recipients, func(i, j int) bool {
+		return recipients[i].Score(now) > recipients[j].Score(now)
+	})
+}
+
+// saveRecipients replaces the recipients with the given ones
+func (s *Store) saveRecipients(recipients []Recipient) error {
+
+	sortRecipients(recipients, time.Now())
+	data, err := json.MarshalIndent(recipients, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// like the follow-ups, a new file is moved into place so a crash can't leave half of it
+	path := filepath.Join(s.dir, recipientsFile)
+	tmp := path + ".tmp"
+	if data, err = vault.Seal(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the folders every store has
+const (
+	Inbox  = "INBOX"
+	Sent   = "Sent"
+	Drafts = "Drafts"
+)
+
+// Store keeps an account's mail on disk as a set of Maildir folders,
+// one directory per folder, e.g. INBOX/, Sent/ and Drafts/
+type Store struct {
+	dir string
+}
+
+// Open returns the store in dir, creating the standard folders if needed
+func Open(dir string) (*Store, error) {
+
+	s := &Store{dir: dir}
+
+	for _, name := range []string{Inbox, Sent, Drafts} {
+		if err := s.Folder(name).Init(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Dir returns the directory the store lives in
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Folder returns the maildir for the named folder
+func (s *Store) Folder(name string) Maildir {
+	return Maildir(filepath.Join(s.dir, name))
+}
+
+// Folders returns the names of the store's folders, in order
+func (s *Store) Folders() ([]string, error) {
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		// a directory is a folder when it is a maildir
+		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(s.dir, f.Name(), "cur")); err == nil && info.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// CreateFolder makes a new, empty folder
+func (s *Store) CreateFolder(name string) error {
+
+	if err := checkFolderName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+		return fmt.Errorf("there is already a folder called %s", name)
+	}
+
+	return s.Folder(name).Init()
+}
+
+// DeleteFolder removes a folder and every message in it. The standard
+// folders can't be deleted, go-mailer keeps its mail in them.
+func (s *Store) DeleteFolder(name string) error {
+
+	if err := checkFolderName(name); err != nil {
+		return err
+	}
+	for _, f := range []string{Inbox, Sent, Drafts} {
+		if name == f {
+			return fmt.Errorf("%s can't be deleted", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, name, "cur")); err != nil {
+		return fmt.Errorf("there is no folder called %s", name)
+	}
+
+	return os.RemoveAll(filepath.Join(s.dir, name))
+}
+
+// checkFolderName makes sure a folder name stays inside the store
+func checkFolderName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%q can't be a folder name", name)
+	}
+	return nil
+}
+
+// FolderName matches a folder name typed by the user, such as "sent",
+// to one of the standard folders, any other name is returned unchanged
+func FolderName(name string) string {
+	for _, f := range []string{Inbox, Sent, Drafts} {
+		if strings.EqualFold(name, f) {
+			return f
+		}
+	}
+	return name
+}
@@ -0,0 +1,165 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a message written once and filled in for each use. The file
+// starts with an optional "Subject:" line and an empty line, the rest is
+// the body. Both can use placeholders like {{.Name}}, see text/template.
+type Template struct {
+	Name    string
+	Vars    []string // the placeholders in the order they first appear
+	subject *template.Template
+	body    *template.Template
+}
+
+// Load reads every template in the directory, a missing directory has none
+func Load(dir string) ([]Template, error) {
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []Template
+	for _, e := range entries {
+		// editors leave hidden backup files lying around
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		t, err := Parse(name, string(data))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// Parse reads a template from its text
+func Parse(name, text string) (Template, error) {
+
+	t := Template{Name: name}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, "Subject:"); ok {
+		subject, body, _ := strings.Cut(rest, "\n")
+		text = strings.TrimPrefix(body, "\n")
+
+		var err error
+		if t.subject, err = parseText(name, strings.TrimSpace(subject)); err != nil {
+			return Template{}, err
+		}
+	}
+
+	var err error
+	if t.body, err = parseText(name, strings.TrimRight(text, "\n")); err != nil {
+		return Template{}, err
+	}
+
+	seen := make(map[string]bool)
+	for _, tmpl := range []*template.Template{t.subject, t.body} {
+		if tmpl != nil {
+			collect(tmpl.Tree.Root, seen, &t.Vars)
+		}
+	}
+
+	return t, nil
+}
+
+// parseText parses one half of a template. A placeholder without a value
+// is left empty rather than printing <no value>.
+func parseText(name, text string) (*template.Template, error) {
+
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// collect walks the parsed template and adds the name of every {{.Field}} it uses to vars
+func collect(node parse.Node, seen map[string]bool, vars *[]string) {
+
+	var pipes []*parse.PipeNode
+	var lists []*parse.ListNode
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		lists = append(lists, n)
+	case *parse.ActionNode:
+		pipes = append(pipes, n.Pipe)
+	case *parse.IfNode:
+		pipes, lists = append(pipes, n.Pipe), append(lists, n.List, n.ElseList)
+	case *parse.RangeNode:
+		pipes, lists = append(pipes, n.Pipe), append(lists, n.List, n.ElseList)
+	case *parse.WithNode:
+		pipes, lists = append(pipes, n.Pipe), append(lists, n.List, n.ElseList)
+	case *parse.FieldNode:
+		if name := n.Ident[0]; !seen[name] {
+			seen[name] = true
+			*vars = append(*vars, name)
+		}
+	}
+
+	for _, pipe := range pipes {
+		if pipe == nil {
+			continue
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				collect(arg, seen, vars)
+			}
+		}
+	}
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		for _, child := range list.Nodes {
+			collect(child, seen, vars)
+		}
+	}
+}
+
+// HasSubject reports whether the template sets the subject
+func (t Template) HasSubject() bool {
+	return t.subject != nil
+}
+
+// Execute fills in the placeholders and returns the subject and the body
+func (t Template) Execute(values map[string]string) (string, string, error) {
+
+	var subject, body bytes.Buffer
+
+	if t.subject != nil {
+		if err := t.subject.Execute(&subject, values); err != nil {
+			return "", "", fmt.Errorf("template %s: %w", t.Name, err)
+		}
+	}
+	if err := t.body.Execute(&body, values); err != nil {
+		return "", "", fmt.Errorf("template %s: %w", t.Name, err)
+	}
+
+	return subject.String(), body.String(), nil
+}
@@ -0,0 +1,238 @@
+package termimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// Protocol is how a terminal is told to show an image
+type Protocol int
+
+const (
+	None  Protocol = iota // the terminal can't show images
+	Kitty                 // the Kitty graphics protocol, also spoken by WezTerm and Ghostty
+	Sixel                 // DEC sixel graphics, spoken by xterm -ti vt340, foot, mlterm and others
+)
+
+// the size of a character cell in pixels, which is about what most terminals
+// use. Kitty scales the image to the cells itself, sixel images are sized with it.
+const (
+	cellWidth  = 10
+	cellHeight = 20
+)
+
+// Detect guesses the protocol the terminal speaks from the environment.
+// Terminals don't say whether they can show images, so it only knows the
+// ones that are known to and is None for everything else.
+func Detect() Protocol {
+
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty":
+		return Kitty
+	case program == "WezTerm" || program == "ghostty":
+		return Kitty
+	case strings.Contains(term, "sixel") || term == "foot" || strings.HasPrefix(term, "foot-") || term == "mlterm":
+		return Sixel
+	case program == "iTerm.app" || program == "mlterm":
+		return Sixel
+	}
+	return None
+}
+
+// Decode reads a PNG, JPEG or GIF image
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Size returns the number of cells the image takes up when it is fitted in
+// cols by rows cells, keeping its shape. Images that already fit aren't made bigger.
+func Size(img image.Image, cols, rows int) (int, int) {
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0, 0
+	}
+
+	maxW, maxH := max(cols, 1)*cellWidth, max(rows, 1)*cellHeight
+	if w > maxW {
+		h, w = h*maxW/w, maxW
+	}
+	if h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+
+	return max((w+cellWidth-1)/cellWidth, 1), max((h+cellHeight-1)/cellHeight, 1)
+}
+
+// Write draws the image at the cursor, fitted in cols by rows cells
+func Write(w io.Writer, img image.Image, p Protocol, cols, rows int) error {
+
+	cols, rows = Size(img, cols, rows)
+	switch p {
+	case Kitty:
+		return writeKitty(w, img, cols, rows)
+	case Sixel:
+		return writeSixel(w, scale(img, cols*cellWidth, rows*cellHeight))
+	}
+	return fmt.Errorf("the terminal can't show images")
+}
+
+// Clear takes the images that were drawn off the screen, only Kitty keeps
+// them apart from the text
+func Clear(w io.Writer, p Protocol) error {
+	if p != Kitty {
+		return nil
+	}
+	_, err := io.WriteString(w, "\x1b_Ga=d\x1b\\")
+	return err
+}
+
+// writeKitty sends the image as a PNG, in chunks of the size the protocol
+// takes, see https://sw.kovidgoyal.net/kitty/graphics-protocol/
+func writeKitty(w io.Writer, img image.Image, cols, rows int) error {
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	const chunk = 4096
+	for first := true; first || data != ""; first = false {
+		n := min(chunk, len(data))
+		part := data[:n]
+		data = data[n:]
+
+		more := 0
+		if data != "" {
+			more = 1
+		}
+
+		// only the first chunk says what the image is and where it goes
+		var err error
+		if first {
+			_, err = fmt.Fprintf(w, "\x1b_Ga=T,f=100,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, part)
+		} else {
+			_, err = fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scale resizes the image to fit in width by height pixels, by picking the
+// nearest pixel, which is good enough for a preview
+func scale(img image.Image, width, height int) image.Image {
+
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return img
+	}
+	w, h := b.Dx(), b.Dy()
+	if w > width {
+		h, w = max(h*width/w, 1), width
+	}
+	if h > height {
+		w, h = max(w*height/h, 1), height
+	}
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return out
+}
+
+// writeSixel draws the image six rows of pixels at a time, each character
+// says which of the six show a color, see
+// https://vt100.net/docs/vt3xx-gp/chapter14.html
+func writeSixel(w io.Writer, img image.Image) error {
+
+	// sixel images have a palette, so the colors are dithered down to 256 of them
+	b := img.Bounds()
+	p := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.WebSafe)
+	draw.FloydSteinberg.Draw(p, p.Bounds(), img, b.Min)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\x1bPq\"1;1;%d;%d", p.Rect.Dx(), p.Rect.Dy())
+	for i, c := range p.Palette {
+		r, g, bl, _ := color.RGBAModel.Convert(c).RGBA()
+		// sixel colors are percentages
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+	bits := make([]byte, width)
+	for top := 0; top < height; top += 6 {
+
+		// the colors in the band, each is drawn over the whole band in turn
+		used := make(map[uint8]bool)
+		for y := top; y < min(top+6, height); y++ {
+			for x := 0; x < width; x++ {
+				used[p.ColorIndexAt(x, y)] = true
+			}
+		}
+
+		for c := range used {
+			for x := 0; x < width; x++ {
+				bits[x] = 0
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if p.ColorIndexAt(x, top+dy) == c {
+						bits[x] |= 1 << dy
+					}
+				}
+			}
+			fmt.Fprintf(&out, "#%d", c)
+			writeRuns(&out, bits)
+			// $ goes back to the start of the band, for the next color
+			out.WriteString("$")
+		}
+		// - moves on to the next band
+		out.WriteString("-")
+	}
+	out.WriteString("\x1b\\")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// writeRuns writes a row of sixels, runs of the same one are written as !count
+func writeRuns(out *strings.Builder, bits []byte) {
+
+	for i := 0; i < len(bits); {
+		j := i
+		for j < len(bits) && bits[j] == bits[i] {
+			j++
+		}
+		ch := byte('?' + bits[i])
+		if n := j - i; n > 3 {
+			fmt.Fprintf(out, "!%d%c", n, ch)
+		} else {
+			out.WriteString(strings.Repeat(string(ch), n))
+		}
+		i = j
+	}
+}
@@ -0,0 +1,271 @@
+package tlspolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSA is a DANE record pinning the certificate of a server, see RFC 6698
+type TLSA struct {
+	Usage    uint8 // 2 pins a trust anchor, 3 the server's own certificate
+	Selector uint8 // 0 matches the whole certificate, 1 just its public key
+	Matching uint8 // 0 compares the data itself, 1 its SHA-256 and 2 its SHA-512
+	Data     []byte
+}
+
+// usable reports whether we can use the record. RFC 7672 says SMTP only
+// uses DANE-TA(2) and DANE-EE(3), the others rely on public CAs.
+func (t TLSA) usable() bool {
+	return (t.Usage == 2 || t.Usage == 3) && t.Selector <= 1 && t.Matching <= 2
+}
+
+// matches reports whether the certificate is the one the record pins
+func (t TLSA) matches(cert *x509.Certificate) bool {
+
+	data := cert.Raw
+	if t.Selector == 1 {
+		data = cert.RawSubjectPublicKeyInfo
+	}
+
+	switch t.Matching {
+	case 1:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case 2:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	}
+
+	return bytes.Equal(data, t.Data)
+}
+
+// verifyDANE checks the server's certificates against its TLSA records.
+// A matching DANE-EE record is enough on its own, the server's name doesn't
+// matter then. A DANE-TA record has to match a certificate the chain leads to.
+func verifyDANE(records []TLSA, state tls.ConnectionState, host string) error {
+
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("%s sent no certificate", host)
+	}
+
+	for _, r := range records {
+		if r.Usage == 3 && r.matches(certs[0]) {
+			return nil
+		}
+		if r.Usage != 2 {
+			continue
+		}
+		for _, anchor := range certs[1:] {
+			if !r.matches(anchor) {
+				continue
+			}
+			roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+			roots.AddCert(anchor)
+			for _, c := range certs[1:] {
+				intermediates.AddCert(c)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: intermediates})
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("the certificate of %s doesn't match its TLSA records", host)
+}
+
+// dnsTimeout is how long we wait for the resolver
+const dnsTimeout = 5 * time.Second
+
+// lookupTLSA asks the system resolver for the TLSA records of the name, and
+// whether it validated them with DNSSEC. Records that aren't validated can't
+// be trusted, an attacker who can change them could just as well remove them.
+// The standard library resolver doesn't tell us that, so we ask ourselves.
+func lookupTLSA(name string) ([]TLSA, bool, error) {
+
+	query, id := tlsaQuery(name)
+	server := resolver()
+
+	resp, err := exchange("udp", server, query)
+	// a truncated answer has to be asked for again over TCP
+	if err == nil && len(resp) > 3 && resp[2]&0x02 != 0 {
+		resp, err = exchange("tcp", server, query)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not look up %s: %w", name, err)
+	}
+
+	return parseTLSA(resp, id)
+}
+
+// resolver returns the first name server in /etc/resolv.conf
+func resolver() string {
+
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1:53"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+
+	return "127.0.0.1:53"
+}
+
+// tlsaQuery builds a DNS query for the TLSA records of the name, see RFC 1035.
+// It sets the AD bit and EDNS0's DO bit, so the resolver tells us whether
+// it validated the answer (RFC 6840 section 5.7).
+func tlsaQuery(name string) ([]byte, uint16) {
+
+	var id [2]byte
+	rand.Read(id[:])
+
+	var b bytes.Buffer
+	b.Write(id[:])
+	binary.Write(&b, binary.BigEndian, []uint16{
+		0x0120, // recursion desired and authentic data
+		1, 0, 0, 1,
+	})
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b.WriteByte(byte(len(label)))
+		b.WriteString(label)
+	}
+	b.WriteByte(0)
+	binary.Write(&b, binary.BigEndian, []uint16{52, 1}) // TLSA, IN
+
+	// the OPT record: root name, type 41, 4096 byte answers, the DO bit, no data
+	b.WriteByte(0)
+	binary.Write(&b, binary.BigEndian, []uint16{41, 4096, 0, 0x8000, 0})
+
+	return b.Bytes(), binary.BigEndian.Uint16(id[:])
+}
+
+// exchange sends the query to the server and returns its answer. Over TCP
+// messages are prefixed with their length.
+func exchange(network, server string, query []byte) ([]byte, error) {
+
+	conn, err := net.DialTimeout(network, server, dnsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, 4096)
+		n, err := conn.Read(resp)
+		return resp[:n], err
+	}
+
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, size)
+	_, err = io.ReadFull(conn, resp)
+	return resp, err
+}
+
+// parseTLSA reads the TLSA records out of the resolver's answer
+func parseTLSA(msg []byte, id uint16) ([]TLSA, bool, error) {
+
+	malformed := fmt.Errorf("malformed dns answer")
+
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		return nil, false, malformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	secure := flags&0x0020 != 0
+
+	switch rcode := flags & 0x000f; rcode {
+	case 0:
+	case 3:
+		// the name doesn't exist, so there are no records
+		return nil, secure, nil
+	default:
+		return nil, false, fmt.Errorf("dns lookup failed with rcode %d", rcode)
+	}
+
+	questions := binary.BigEndian.Uint16(msg[4:])
+	answers := binary.BigEndian.Uint16(msg[6:])
+
+	off := 12
+	for i := 0; i < int(questions); i++ {
+		if off = skipName(msg, off); off < 0 || off+4 > len(msg) {
+			return nil, false, malformed
+		}
+		off += 4
+	}
+
+	var records []TLSA
+	for i := 0; i < int(answers); i++ {
+		if off = skipName(msg, off); off < 0 || off+10 > len(msg) {
+			return nil, false, malformed
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, false, malformed
+		}
+
+		// the answer can also hold CNAMEs and signatures, we only want the TLSA records
+		if rtype == 52 && length >= 3 {
+			data := msg[off : off+length]
+			records = append(records, TLSA{
+				Usage:    data[0],
+				Selector: data[1],
+				Matching: data[2],
+				Data:     append([]byte(nil), data[3:]...),
+			})
+		}
+		off += length
+	}
+
+	return records, secure, nil
+}
+
+// skipName returns the offset just past the name at off, or -1 if it runs off the message
+func skipName(msg []byte, off int) int {
+
+	for off < len(msg) {
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1
+		case n&0xc0 == 0xc0:
+			// a pointer to a name earlier in the message ends the name
+			return off + 2
+		}
+		off += n + 1
+	}
+
+	return -1
+}
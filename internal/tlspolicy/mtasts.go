@@ -0,0 +1,235 @@
+package tlspolicy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAge caps how long we keep a policy, RFC 8461 allows a year at most
+const maxAge = 31557600 * time.Second
+
+// stsPolicy is a domain's MTA-STS policy, see RFC 8461
+type stsPolicy struct {
+	ID      string    `json:"id"`
+	Mode    string    `json:"mode"` // enforce, testing or none
+	MX      []string  `json:"mx"`   // the hosts allowed to receive the domain's mail
+	Expires time.Time `json:"expires"`
+}
+
+// covers reports whether the host is one of the policy's MX hosts. A
+// pattern like *.example.com matches exactly one more label.
+func (p stsPolicy) covers(host string) bool {
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range p.MX {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			label, found := strings.CutSuffix(host, suffix)
+			if found && label != "" && !strings.Contains(label, ".") {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stsCache keeps the policies we've fetched, so that an attacker who blocks
+// the lookup later on can't make us forget the domain wants TLS
+type stsCache map[string]stsPolicy
+
+// loadCache reads the cache file, a missing or broken one is an empty cache
+func loadCache(path string) stsCache {
+
+	cache := make(stsCache)
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+
+	return cache
+}
+
+// save writes the cache file, dropping the policies that have expired
+func (c stsCache) save(path string) error {
+
+	for domain, p := range c {
+		if time.Now().After(p.Expires) {
+			delete(c, domain)
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// lookupSTS returns the domain's policy and whether it has one. A policy
+// we fetched before is used while the domain advertises the same id, or
+// when the domain can't be reached at all.
+func lookupSTS(domain string, cache stsCache) (stsPolicy, bool, error) {
+
+	cached, ok := cache[domain]
+	if ok && time.Now().After(cached.Expires) {
+		ok = false
+	}
+
+	id, err := stsID(domain)
+	if err != nil {
+		if ok {
+			return cached, true, nil
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return stsPolicy{}, false, nil
+		}
+		return stsPolicy{}, false, fmt.Errorf("could not look up the MTA-STS record of %s: %w", domain, err)
+	}
+	if id == "" {
+		// no record, or one we don't understand, means no policy
+		if ok {
+			return cached, true, nil
+		}
+		return stsPolicy{}, false, nil
+	}
+	if ok && cached.ID == id {
+		return cached, true, nil
+	}
+
+	p, err := fetchSTS(domain)
+	if err != nil {
+		if ok {
+			return cached, true, nil
+		}
+		return stsPolicy{}, false, fmt.Errorf("could not fetch the MTA-STS policy of %s: %w", domain, err)
+	}
+
+	p.ID = id
+	cache[domain] = p
+	return p, true, nil
+}
+
+// stsID returns the id in the domain's _mta-sts TXT record, or "" if it has none
+func stsID(domain string) (string, error) {
+
+	txts, err := net.LookupTXT("_mta-sts." + domain)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []string
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, "v=STSv1") {
+			continue
+		}
+		for _, field := range strings.Split(txt, ";") {
+			if id, ok := strings.CutPrefix(strings.TrimSpace(field), "id="); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	// more than one record is as good as none, the RFC says
+	if len(ids) != 1 {
+		return "", nil
+	}
+
+	return ids[0], nil
+}
+
+// fetchSTS downloads the policy from https://mta-sts.<domain>/.well-known/mta-sts.txt
+func fetchSTS(domain string) (stsPolicy, error) {
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		// the policy has to come from the domain itself, so redirects aren't followed
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get("https://mta-sts." + domain + "/.well-known/mta-sts.txt")
+	if err != nil {
+		return stsPolicy{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return stsPolicy{}, fmt.Errorf("server said %s", resp.Status)
+	}
+
+	// policies are tiny, anything bigger than 64k isn't one
+	return parseSTS(io.LimitReader(resp.Body, 64*1024))
+}
+
+// parseSTS reads a policy file, which is made of "key: value" lines
+func parseSTS(r io.Reader) (stsPolicy, error) {
+
+	var (
+		p       stsPolicy
+		version string
+		age     = -1
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			p.Mode = value
+		case "mx":
+			p.MX = append(p.MX, value)
+		case "max_age":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				age = n
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stsPolicy{}, err
+	}
+
+	if version != "STSv1" {
+		return stsPolicy{}, fmt.Errorf("unknown policy version %q", version)
+	}
+	switch p.Mode {
+	case "enforce", "testing", "none":
+	default:
+		return stsPolicy{}, fmt.Errorf("unknown policy mode %q", p.Mode)
+	}
+	if age < 0 {
+		return stsPolicy{}, fmt.Errorf("policy has no max_age")
+	}
+	if p.Mode != "none" && len(p.MX) == 0 {
+		return stsPolicy{}, fmt.Errorf("policy lists no mx hosts")
+	}
+
+	p.Expires = time.Now().Add(min(time.Duration(age)*time.Second, maxAge))
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Policy is what the policies we found ask of a connection to an SMTP server
+type Policy struct {
+	host string
+	tlsa []TLSA   // the server's DNSSEC validated, usable TLSA records
+	sts  []string // the domains whose MTA-STS policies list the server as an MX
+}
+
+// Lookup finds the policies that apply to the SMTP server at host:port. Its
+// TLSA records apply to any connection, the MTA-STS policy of a recipient's
+// domain only when the server is one of the hosts that domain receives mail on.
+// When strict is false a failed lookup is the same as finding no policy, when
+// it is true the failure is returned and testing policies are enforced too.
+// MTA-STS policies are cached in the file at cachePath.
+func Lookup(host string, port int, domains []string, strict bool, cachePath string) (*Policy, error) {
+
+	p := &Policy{host: host}
+
+	// a server given by its IP address has no name to publish records under
+	var (
+		records []TLSA
+		secure  bool
+	)
+	if net.ParseIP(host) == nil {
+		var err error
+		records, secure, err = lookupTLSA(fmt.Sprintf("_%d._tcp.%s", port, host))
+		if err != nil && strict {
+			return nil, err
+		}
+	}
+	// RFC 7672 says records that weren't validated have to be ignored
+	if secure {
+		for _, r := range records {
+			if r.usable() {
+				p.tlsa = append(p.tlsa, r)
+			}
+		}
+	}
+
+	cache := loadCache(cachePath)
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+
+		policy, ok, err := lookupSTS(domain, cache)
+		if err != nil && strict {
+			return nil, err
+		}
+		if !ok || !policy.covers(host) {
+			continue
+		}
+		if policy.Mode == "enforce" || policy.Mode == "testing" && strict {
+			p.sts = append(p.sts, domain)
+		}
+	}
+	if err := cache.save(cachePath); err != nil && strict {
+		return nil, fmt.Errorf("could not save MTA-STS policies: %w", err)
+	}
+
+	return p, nil
+}
+
+// RequireTLS reports whether a policy says we mustn't send without TLS
+func (p *Policy) RequireTLS() bool {
+	return p != nil && (len(p.tlsa) > 0 || len(p.sts) > 0)
+}
+
+// String names the policies that apply, for error messages
+func (p *Policy) String() string {
+
+	var names []string
+	if len(p.tlsa) > 0 {
+		names = append(names, "the TLSA records of "+p.host)
+	}
+	for _, domain := range p.sts {
+		names = append(names, "the MTA-STS policy of "+domain)
+	}
+
+	return strings.Join(names, " and ")
+}
+
+// TLSConfig returns the TLS settings to connect with. TLSA records decide
+// which certificate the server may use, see RFC 7672 section 3.1, otherwise
+// it needs a certificate for its name from a CA we trust, as MTA-STS wants.
+func (p *Policy) TLSConfig() *tls.Config {
+
+	cfg := &tls.Config{ServerName: p.host}
+	if len(p.tlsa) > 0 {
+		// we check the certificate ourselves, against the records instead of the system's CAs
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyDANE(p.tlsa, state, p.host)
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,206 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic starts every sealed file, so files written before encryption was
+// turned on can still be read as they are
+var magic = []byte("go-mailer-sealed-1\n")
+
+// check is sealed into the key file, a passphrase that opens it is the right one
+var check = []byte("go-mailer")
+
+// the scrypt parameters for new key files, as recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrLocked is returned when a sealed file is read before the vault is unlocked
+var ErrLocked = errors.New("this is encrypted, go-mailer needs the passphrase to read it")
+
+// ErrPassphrase is returned by Unlock when the passphrase is wrong
+var ErrPassphrase = errors.New("wrong passphrase")
+
+// keyFile is what is kept on disk to derive the key from the passphrase
+// again, the key itself is never written anywhere
+type keyFile struct {
+	Salt  []byte `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Check []byte `json:"check"`
+}
+
+// the key of the unlocked vault, nil while it is locked
+var (
+	mu  sync.RWMutex
+	key *[32]byte
+)
+
+// Exists reports whether there is a key file at path
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Create writes a new key file for the passphrase at path and unlocks the vault with it
+func Create(path string, passphrase []byte) error {
+
+	kf := keyFile{Salt: make([]byte, 32), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(kf.Salt); err != nil {
+		return err
+	}
+
+	k, err := derive(passphrase, kf)
+	if err != nil {
+		return err
+	}
+	kf.Check, err = seal(k, check)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("could not write the key file: %w", err)
+	}
+
+	setKey(k)
+	return nil
+}
+
+// Unlock derives the key from the passphrase and the key file at path, from
+// then on Seal encrypts and Open decrypts
+func Unlock(path string, passphrase []byte) error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return fmt.Errorf("the key file %s is corrupt: %w", path, err)
+	}
+
+	k, err := derive(passphrase, kf)
+	if err != nil {
+		return err
+	}
+	if got, err := open(k, kf.Check); err != nil || !bytes.Equal(got, check) {
+		return ErrPassphrase
+	}
+
+	setKey(k)
+	return nil
+}
+
+// Unlocked reports whether the vault has been unlocked, i.e. whether Seal encrypts
+func Unlocked() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return key != nil
+}
+
+// Seal encrypts data with the vault's key. While the vault is locked, which
+// it stays unless encryption is turned on, data is returned as it is.
+func Seal(data []byte) ([]byte, error) {
+
+	mu.RLock()
+	k := key
+	mu.RUnlock()
+
+	if k == nil {
+		return data, nil
+	}
+	return seal(k, data)
+}
+
+// Open decrypts what Seal encrypted. Data that wasn't sealed is returned as it is.
+func Open(data []byte) ([]byte, error) {
+
+	if !IsSealed(data) {
+		return data, nil
+	}
+
+	mu.RLock()
+	k := key
+	mu.RUnlock()
+
+	if k == nil {
+		return nil, ErrLocked
+	}
+	return open(k, data)
+}
+
+// IsSealed reports whether data was encrypted by Seal
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// setKey unlocks the vault with k
+func setKey(k *[32]byte) {
+	mu.Lock()
+	key = k
+	mu.Unlock()
+}
+
+// derive returns the key for the passphrase with the key file's salt and parameters
+func derive(passphrase []byte, kf keyFile) (*[32]byte, error) {
+
+	b, err := scrypt.Key(passphrase, kf.Salt, kf.N, kf.R, kf.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var k [32]byte
+	copy(k[:], b)
+	return &k, nil
+}
+
+// seal returns magic, a random nonce and the data sealed with secretbox
+func seal(k *[32]byte, data []byte) ([]byte, error) {
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	out := append(append([]byte{}, magic...), nonce[:]...)
+	return secretbox.Seal(out, data, &nonce, k), nil
+}
+
+// open undoes seal
+func open(k *[32]byte, data []byte) ([]byte, error) {
+
+	data = bytes.TrimPrefix(data, magic)
+	if len(data) < 24 {
+		return nil, errors.New("the encrypted data is cut short")
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], data)
+	out, ok := secretbox.Open(nil, data[24:], &nonce, k)
+	if !ok {
+		return nil, errors.New("the encrypted data is corrupt or was sealed with another key")
+	}
+	return out, nil
+}
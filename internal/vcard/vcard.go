@@ -0,0 +1,248 @@
+package vcard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// We read vCard 2.1, 3.0 and 4.0, see RFC 6350 and RFC 2426. A file holds
+// any number of cards, each between BEGIN:VCARD and END:VCARD, and every
+// line of a card is a property like EMAIL;TYPE=work:ann@example.com.
+
+// Card is a contact read from a vCard file, with only what an address book needs
+type Card struct {
+	Name         string
+	Emails       []string // the preferred address goes first
+	Organization string
+}
+
+// property is one line of a card
+type property struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// Parse reads every card in r
+func Parse(r io.Reader) ([]Card, error) {
+
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		cards []Card
+		card  *Card
+		given string // the name from N, in case there is no FN
+		pref  bool   // whether the card's first address is the preferred one
+	)
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCARD"):
+			card, given, pref = &Card{}, "", false
+
+		case p.name == "END" && strings.EqualFold(p.value, "VCARD"):
+			if card == nil {
+				return nil, fmt.Errorf("END:VCARD without BEGIN:VCARD")
+			}
+			if card.Name == "" {
+				card.Name = given
+			}
+			cards = append(cards, *card)
+			card = nil
+
+		case card == nil:
+			// anything outside of a card isn't ours to read
+
+		case p.name == "FN":
+			card.Name = unescape(p.value)
+
+		case p.name == "N":
+			given = nameFromN(p.value)
+
+		case p.name == "ORG":
+			// the organization can be followed by its units, we only want the organization
+			card.Organization = unescape(splitValue(p.value)[0])
+
+		case p.name == "EMAIL":
+			addr := strings.TrimSpace(unescape(p.value))
+			if addr == "" {
+				continue
+			}
+			// a preferred address goes first, so it is the one we suggest
+			if p.preferred() && !pref {
+				card.Emails = append([]string{addr}, card.Emails...)
+				pref = true
+			} else {
+				card.Emails = append(card.Emails, addr)
+			}
+		}
+	}
+
+	if card != nil {
+		return nil, fmt.Errorf("the last card has no END:VCARD")
+	}
+
+	return cards, nil
+}
+
+// unfold reads the lines of the file, joining lines that were folded. A line
+// starting with a space or a tab continues the one before it, and in vCard
+// 2.1 a quoted-printable value ending in = continues on the next line.
+func unfold(r io.Reader) ([]string, error) {
+
+	var lines []string
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	continued := false
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if len(lines) == 0 {
+			// a file saved on Windows may well start with a byte order mark
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		switch {
+		case continued:
+			lines[len(lines)-1] += line
+		case len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+
+		last := lines[len(lines)-1]
+		continued = strings.HasSuffix(last, "=") && isQuotedPrintable(last)
+		if continued {
+			lines[len(lines)-1] = strings.TrimSuffix(last, "=")
+		}
+	}
+
+	return lines, s.Err()
+}
+
+// isQuotedPrintable reports whether a raw line has a quoted-printable value
+func isQuotedPrintable(line string) bool {
+	colon := strings.Index(line, ":")
+	return colon >= 0 && strings.Contains(strings.ToUpper(line[:colon]), "QUOTED-PRINTABLE")
+}
+
+// parseProperty splits a line into its name, parameters and value. A group
+// in front of the name, as in item1.EMAIL, is dropped.
+func parseProperty(line string) (property, error) {
+
+	// the value starts at the first colon that isn't inside a quoted parameter
+	colon, quoted := -1, false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("%q has no value", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	p := property{name: name, params: make(map[string][]string), value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			// vCard 2.1 allows a bare type, like EMAIL;PREF;INTERNET
+			key, value = "TYPE", param
+		}
+		key = strings.ToUpper(key)
+		for _, v := range strings.Split(value, ",") {
+			p.params[key] = append(p.params[key], strings.Trim(v, `"`))
+		}
+	}
+
+	if enc := p.params["ENCODING"]; len(enc) > 0 && strings.EqualFold(enc[0], "QUOTED-PRINTABLE") {
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(p.value)))
+		if err != nil {
+			return property{}, fmt.Errorf("%s has a broken quoted-printable value: %w", name, err)
+		}
+		p.value = string(bytes.TrimRight(decoded, "\r\n"))
+	}
+
+	return p, nil
+}
+
+// preferred reports whether the property is marked as the preferred one,
+// with TYPE=pref in vCard 3.0 or PREF=1 in 4.0
+func (p property) preferred() bool {
+
+	if len(p.params["PREF"]) > 0 {
+		return true
+	}
+	for _, t := range p.params["TYPE"] {
+		if strings.EqualFold(t, "pref") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nameFromN turns the structured name, family;given;additional;prefixes;suffixes into "given family"
+func nameFromN(value string) string {
+
+	parts := splitValue(value)
+	for len(parts) < 2 {
+		parts = append(parts, "")
+	}
+
+	return strings.TrimSpace(unescape(parts[1]) + " " + unescape(parts[0]))
+}
+
+// splitValue splits a structured value at the semicolons that aren't escaped
+func splitValue(value string) []string {
+
+	var (
+		parts []string
+		part  strings.Builder
+	)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			part.WriteByte(value[i])
+			part.WriteByte(value[i+1])
+			i++
+		case value[i] == ';':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(value[i])
+		}
+	}
+
+	return append(parts, part.String())
+}
+
+// unescape undoes the backslash escapes of a value
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\:`, ":", `\\`, `\`).Replace(value)
+}
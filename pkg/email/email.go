@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/eai"
+)
+
+// DeliveryReportHeader notes that a message asks for a delivery report. The
+// server never sees it, the transport takes it off just before sending and
+// asks for the report in the envelope instead.
+const DeliveryReportHeader = "X-Go-Mailer-Receipts"
+
+// Message is an email, ready to be rendered in RFC 5322 format and handed to
+// a transport. It needs a sender and someone to go to, the rest is optional.
+type Message struct {
+	From    *mail.Address
+	To      []*mail.Address
+	Subject string
+	Date    time.Time // when the message was written, now if it is zero
+	ID      string    // the Message-ID, with its angle brackets, see NewID
+	Headers []Header  // extra headers, see ValidateHeader
+
+	Text        string  // the plain text body
+	HTML        string  // an HTML version of the body, if there is one
+	Images      []Image // the images the HTML version shows
+	Calendar    []byte  // an invitation the body comes with as another version, see RFC 6047
+	Attachments []Attachment
+
+	Wrap     int    // the column the text is wrapped at as format=flowed, 0 for as it is
+	Encoding string // how the text parts are encoded, one of the Encoding constants, EncodingAuto if empty
+
+	ReadReceipt    bool // asks the recipients' mail clients to say when it was read (RFC 8098)
+	DeliveryReport bool // asks the server for a report once it's delivered, see DeliveryReportHeader
+}
+
+// NewID returns a new, globally unique Message-ID using the domain of the sender
+func NewID(sender string) string {
+
+	domain := "localhost"
+	if i := strings.LastIndex(sender, "@"); i >= 0 && i < len(sender)-1 {
+		domain = sender[i+1:]
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// Address returns the address as it goes in the headers. Its domain is
+// written in ASCII, so only a non-ASCII local part needs a server that
+// supports SMTPUTF8, see RFC 6532.
+func Address(a *mail.Address) *mail.Address {
+
+	if eai.NeedsSMTPUTF8(a.Address) {
+		return a
+	}
+	ascii, err := eai.Address(a.Address)
+	if err != nil {
+		return a
+	}
+
+	return &mail.Address{Name: a.Name, Address: ascii}
+}
+
+// Bytes renders the message in RFC 5322 format, ready to hand to a transport
+func (m Message) Bytes() []byte {
+
+	var b bytes.Buffer
+	m.WriteHeaders(&b)
+	m.WriteBody(&b, false)
+
+	return b.Bytes()
+}
+
+// WriteHeaders writes the headers of the message, all but the ones that go
+// with its body, see WriteBody. A message without an ID gets a new one.
+func (m Message) WriteHeaders(b *bytes.Buffer) {
+
+	to := make([]string, len(m.To))
+	for i, a := range m.To {
+		to[i] = Address(a).String()
+	}
+
+	// headers are separated by CRLF and end with an empty line
+	WriteHeader(b, "From", Address(m.From).String())
+	WriteHeader(b, "To", strings.Join(to, ", "))
+	WriteHeader(b, "Subject", m.Subject)
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	fmt.Fprintf(b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	id := m.ID
+	if id == "" {
+		id = NewID(m.From.Address)
+	}
+	WriteHeader(b, "Message-ID", id)
+	for _, h := range m.Headers {
+		WriteHeader(b, h.Name, h.Value)
+	}
+
+	// read receipts go back to the sender, a delivery report is asked for
+	// when the message is handed to the server, so we only note it for now
+	if m.ReadReceipt {
+		WriteHeader(b, "Disposition-Notification-To", Address(m.From).String())
+	}
+	if m.DeliveryReport {
+		fmt.Fprintf(b, "%s: delivery\r\n", DeliveryReportHeader)
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+}
+
+// WriteBody writes the Content-Type header, the empty line ending the
+// headers and the body. With safe set, every part is 7bit safe, so it gets
+// through any server unchanged, which a signature over the body needs.
+func (m Message) WriteBody(b *bytes.Buffer, safe bool) {
+	writeBody(b, m.Text, m.HTML, m.Images, m.Calendar, m.Attachments, m.Encoding, safe, m.Wrap)
+}
+
+// TakeDeliveryReport takes the DeliveryReportHeader off a rendered message,
+// and reports whether it asked for a delivery report
+func TakeDeliveryReport(raw []byte) ([]byte, bool) {
+
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end < 0 {
+		return raw, false
+	}
+
+	prefix := []byte(DeliveryReportHeader + ":")
+	for start := 0; start < end; {
+		next := bytes.Index(raw[start:], []byte("\r\n")) + start + 2
+		if len(raw) >= start+len(prefix) && bytes.EqualFold(raw[start:start+len(prefix)], prefix) {
+			// drafts keep the read receipt in it too, e.g. read+delivery
+			report := strings.Contains(strings.ToLower(string(raw[start+len(prefix):next-2])), "delivery")
+			out := append(append([]byte(nil), raw[:start]...), raw[next:]...)
+			return out, report
+		}
+		start = next
+	}
+
+	return raw, false
+}
+
+// AddBcc adds the recipients that aren't in the To or Cc headers of a
+// rendered message to a Bcc header, for the APIs that send to the
+// addresses in the headers rather than to a list of their own, and take
+// the Bcc header out before the message goes out
+func AddBcc(raw []byte, to []string) []byte {
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return raw
+	}
+
+	seen := make(map[string]bool)
+	for _, h := range []string{"To", "Cc", "Bcc"} {
+		list, _ := m.Header.AddressList(h)
+		for _, a := range list {
+			seen[strings.ToLower(a.Address)] = true
+		}
+	}
+
+	var bcc []string
+	for _, addr := range to {
+		if !seen[strings.ToLower(addr)] {
+			bcc = append(bcc, addr)
+		}
+	}
+	if len(bcc) == 0 {
+		return raw
+	}
+
+	return append([]byte("Bcc: "+strings.Join(bcc, ", ")+"\r\n"), raw...)
+}
@@ -0,0 +1,137 @@
+package email
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SignatureSeparator starts a signature, it ends in a space but is never a soft line break
+const SignatureSeparator = "-- "
+
+// Flow wraps the text as format=flowed, see RFC 3676. Long lines are broken
+// at spaces so no line is longer than width; the space left at the end of a
+// line says the next one belongs to the same paragraph, so the recipient's
+// client can put it back together at whatever width it likes.
+func Flow(text string, width int) string {
+
+	var out []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line == SignatureSeparator {
+			out = append(out, line)
+			continue
+		}
+
+		// quoted lines keep their > marks on every line they are wrapped into
+		depth := len(line) - len(strings.TrimLeft(line, ">"))
+		quote, content := line[:depth], line[depth:]
+		if depth > 0 {
+			content = strings.TrimPrefix(content, " ")
+		}
+
+		// a hard line break mustn't look like a soft one
+		content = strings.TrimRight(content, " ")
+
+		// the quote marks, the space after them and the space of a soft break all count
+		budget := width - depth - 1
+		if depth > 0 {
+			budget--
+		}
+		for _, piece := range wrap(content, budget) {
+			out = append(out, stuff(quote, piece))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// wrap breaks a line at spaces into pieces of at most width characters. Every
+// piece but the last ends with the space it was broken at. A word longer
+// than width gets a line of its own, we never break inside a word.
+func wrap(line string, width int) []string {
+
+	var (
+		pieces []string
+		piece  string
+	)
+	for i, word := range strings.Split(line, " ") {
+		switch {
+		case i == 0:
+			piece = word
+		case utf8.RuneCountInString(piece)+1+utf8.RuneCountInString(word) > width && piece != "":
+			pieces = append(pieces, piece+" ")
+			piece = word
+		default:
+			piece += " " + word
+		}
+	}
+
+	return append(pieces, piece)
+}
+
+// stuff puts the quote marks back in front of a piece and adds the space
+// RFC 3676 calls space-stuffing where it is needed, so a line starting with
+// a space, > or From isn't mistaken for something else
+func stuff(quote, piece string) string {
+
+	if quote != "" {
+		if piece == "" {
+			return quote
+		}
+		return quote + " " + piece
+	}
+
+	if strings.HasPrefix(piece, " ") || strings.HasPrefix(piece, ">") || strings.HasPrefix(piece, "From ") {
+		return " " + piece
+	}
+
+	return piece
+}
+
+// Unflow puts the paragraphs of a format=flowed text back together. With
+// delsp the space at the end of a soft line break was added by the sender
+// and isn't part of the text.
+func Unflow(text string, delsp bool) string {
+
+	var (
+		out       []string
+		paragraph string
+		depth     = -1 // the quote depth of the paragraph, -1 when there is none
+	)
+	end := func() {
+		if depth < 0 {
+			return
+		}
+		line := paragraph
+		if depth > 0 {
+			line = strings.Repeat(">", depth)
+			if paragraph != "" {
+				line += " " + paragraph
+			}
+		}
+		out = append(out, line)
+		paragraph, depth = "", -1
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		d := len(line) - len(strings.TrimLeft(line, ">"))
+		content := strings.TrimPrefix(line[d:], " ")
+
+		// a change of quote depth ends the paragraph, even after a soft break
+		if d != depth {
+			end()
+		}
+		depth = d
+
+		soft := strings.HasSuffix(content, " ") && content != SignatureSeparator
+		if soft && delsp {
+			content = strings.TrimSuffix(content, " ")
+		}
+		paragraph += content
+		if !soft {
+			end()
+		}
+	}
+	end()
+
+	return strings.Join(out, "\n")
+}
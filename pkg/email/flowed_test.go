@@ -0,0 +1,94 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFlow(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{"short line", "Hello there", 72, "Hello there"},
+		{"wrapped", "one two three four", 10, "one two \nthree \nfour"},
+		{"word longer than the width", "a verylongword b", 6, "a \nverylongword \nb"},
+		{"quoted", "> a b c", 6, "> a b \n> c"},
+		{"quoted twice", ">> one two", 8, ">> one \n>> two"},
+		{"trailing spaces", "end   ", 72, "end"},
+		{"stuffed From", "From here on", 72, " From here on"},
+		{"stuffed space", " indented", 72, "  indented"},
+		{"signature separator", "bye\n-- \nAnn", 72, "bye\n-- \nAnn"},
+		{"CRLF", "one\r\ntwo", 72, "one\ntwo"},
+		{"empty lines", "a\n\nb", 72, "a\n\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Flow(tt.text, tt.width); got != tt.want {
+				t.Errorf("Flow(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnflow(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		text  string
+		delsp bool
+		want  string
+	}{
+		{"soft break", "one two \nthree", false, "one two three"},
+		{"soft break with delsp", "abc \ndef", true, "abcdef"},
+		{"hard break", "one\ntwo", false, "one\ntwo"},
+		{"quoted", "> one \n> two\nreply", false, "> one two\nreply"},
+		{"quote depth change", "> one \n>> two", false, "> one \n>> two"},
+		{"unstuffed", " From here", false, "From here"},
+		{"signature separator", "bye\n-- \nAnn", false, "bye\n-- \nAnn"},
+		{"signature separator with delsp", "bye\n-- \nAnn", true, "bye\n-- \nAnn"},
+		{"CRLF", "one \r\ntwo", false, "one two"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unflow(tt.text, tt.delsp); got != tt.want {
+				t.Errorf("Unflow(%q, %v) = %q, want %q", tt.text, tt.delsp, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowRoundTrip(t *testing.T) {
+
+	texts := []string{
+		"A paragraph long enough to be wrapped over a few lines at the width we use here.",
+		"> A quoted paragraph that has to be wrapped too, its marks on every line.\n\nMy reply.",
+		">> Quoted twice, and long enough to take more than a line.\n> Quoted once.",
+		"From the start, a line that needs stuffing.\n indented",
+		"Grüße aus Köln, und ein Absatz mit Umlauten, der umbrochen werden muss.",
+		"Cheers\n-- \nAnn Example\nExample Inc.",
+		"",
+	}
+
+	for _, width := range []int{20, 40, 78} {
+		for _, text := range texts {
+			flowed := Flow(text, width)
+			for _, line := range strings.Split(flowed, "\n") {
+				if n := utf8.RuneCountInString(line); n > width && !strings.Contains(strings.TrimSpace(line), " ") {
+					continue // a single word longer than the width
+				} else if n > width {
+					t.Errorf("Flow(%q, %d) wrote %q, longer than %d", text, width, line, width)
+				}
+			}
+			if got := Unflow(flowed, false); got != text {
+				t.Errorf("Unflow(Flow(%q, %d)) = %q", text, width, got)
+			}
+		}
+	}
+}
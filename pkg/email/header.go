@@ -0,0 +1,167 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// Header is an extra header of a message, such as Reply-To or Organization
+type Header struct {
+	Name  string
+	Value string
+}
+
+// ValidateHeader checks a header before it is added to a message. Names are
+// printable ASCII without a colon, values can't break out of their line, so
+// nobody can sneak in extra headers or a body through them.
+func ValidateHeader(name, value string) error {
+
+	if name == "" {
+		return fmt.Errorf("header name can't be empty")
+	}
+	for _, c := range name {
+		if c < 33 || c > 126 || c == ':' {
+			return fmt.Errorf("header name %q may only contain printable characters and no colon", name)
+		}
+	}
+
+	for _, c := range value {
+		if c == '\r' || c == '\n' {
+			return fmt.Errorf("header value can't contain line breaks")
+		}
+		if c < 32 && c != '\t' || c == 127 {
+			return fmt.Errorf("header value can't contain control characters")
+		}
+	}
+
+	return nil
+}
+
+// maxLineLength is where we fold header lines, RFC 5322 asks for 78 characters
+const maxLineLength = 78
+
+// addressHeaders hold addresses, their display names are encoded but the addresses themselves can't be
+var addressHeaders = []string{"From", "To", "Cc", "Bcc", "Reply-To", "Sender"}
+
+// lineBreaks turns the line breaks in a header into spaces
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// WriteHeader writes a header line, encoding what isn't ASCII and folding
+// it at spaces so no line is longer than maxLineLength. Line breaks in the
+// name or the value become spaces, so a header can never end early and
+// start another one, or the body, whatever the caller checked.
+func WriteHeader(b *bytes.Buffer, name, value string) {
+	name, value = lineBreaks.Replace(name), lineBreaks.Replace(value)
+	b.WriteString(foldHeader(name, encodeHeader(name, value)))
+	b.WriteString("\r\n")
+}
+
+// encodeHeader encodes the non-ASCII parts of a header value as RFC 2047
+// encoded-words, so every client can show them
+func encodeHeader(name, value string) string {
+
+	// ASCII that looks like an encoded-word would be decoded, so it is encoded too
+	if isASCII(value) && !strings.Contains(value, "=?") {
+		return value
+	}
+
+	// net/mail encodes display names for us. A non-ASCII address is left
+	// as it is, it can only be sent with SMTPUTF8 which allows UTF-8 headers.
+	for _, h := range addressHeaders {
+		if !strings.EqualFold(name, h) {
+			continue
+		}
+		if addrs, err := mail.ParseAddressList(value); err == nil {
+			parts := make([]string, len(addrs))
+			for i, a := range addrs {
+				parts[i] = a.String()
+			}
+			return strings.Join(parts, ", ")
+		}
+	}
+
+	return encodeText(value)
+}
+
+// encodeText encodes the words of the text that aren't ASCII and leaves the
+// others readable. Neighbouring words are encoded together, the space
+// between two encoded-words disappears when they are decoded.
+func encodeText(text string) string {
+
+	var (
+		out []string
+		run []string
+	)
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		joined := strings.Join(run, " ")
+
+		// B is shorter for text that is mostly not ASCII, Q easier to read otherwise
+		encoding := mime.QEncoding
+		if nonASCII(joined)*3 > len(joined) {
+			encoding = mime.BEncoding
+		}
+		encoded := encoding.Encode("utf-8", joined)
+		if encoded == joined {
+			// Encode leaves ASCII as it is, even when it looks like an encoded-word
+			encoded = "=?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte(joined)) + "?="
+		}
+		out = append(out, encoded)
+		run = nil
+	}
+
+	for _, word := range strings.Split(text, " ") {
+		// a word that looks like an encoded-word has to be encoded too, or it would be decoded
+		if isASCII(word) && !strings.Contains(word, "=?") {
+			flush()
+			out = append(out, word)
+			continue
+		}
+		run = append(run, word)
+	}
+	flush()
+
+	return strings.Join(out, " ")
+}
+
+// isASCII reports whether the string only holds ASCII characters
+func isASCII(s string) bool {
+	return nonASCII(s) == 0
+}
+
+// nonASCII counts the bytes of the string that aren't ASCII
+func nonASCII(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			n++
+		}
+	}
+	return n
+}
+
+// foldHeader returns the header as one or more lines joined by CRLF. A word
+// longer than a line is left whole, which RFC 5322 allows up to 998 characters.
+func foldHeader(name, value string) string {
+
+	line := name + ":"
+	var lines []string
+
+	for _, word := range strings.Split(value, " ") {
+		// a line that only holds the name can't be folded yet
+		if len(line)+1+len(word) > maxLineLength && line != name+":" {
+			lines = append(lines, line)
+			line = ""
+		}
+		line += " " + word
+	}
+	lines = append(lines, line)
+
+	return strings.Join(lines, "\r\n")
+}
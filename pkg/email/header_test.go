@@ -0,0 +1,125 @@
+package email
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestValidateHeader(t *testing.T) {
+
+	tests := []struct {
+		name, header, value string
+		ok                  bool
+	}{
+		{"plain", "Organization", "Example Inc.", true},
+		{"tab in value", "X-Note", "a\tb", true},
+		{"utf-8 value", "Organization", "Café Müller", true},
+		{"empty name", "", "x", false},
+		{"colon in name", "X-Bad:Name", "x", false},
+		{"space in name", "X Bad", "x", false},
+		{"non-ascii name", "X-Grüße", "x", false},
+		{"CRLF in value", "X-Note", "a\r\nBcc: evil@example.com", false},
+		{"LF in value", "X-Note", "a\nb", false},
+		{"CR in value", "X-Note", "a\rb", false},
+		{"control character", "X-Note", "a\x07b", false},
+		{"DEL", "X-Note", "a\x7fb", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHeader(tt.header, tt.value)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateHeader(%q, %q) = %v, want ok %v", tt.header, tt.value, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWriteHeader(t *testing.T) {
+
+	long := strings.Repeat("word ", 30) + "end"
+	longWord := strings.Repeat("x", 100)
+
+	// a word, an encoded-word among them, is never broken, so a line
+	// holding one longer than a line may be longer
+	tooLong := func(line string) bool {
+		_, value, _ := strings.Cut(line, ":")
+		return len(line) > maxLineLength && len(strings.Fields(value)) > 1
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string // the value once unfolded and decoded
+		raw    string // what is written, when it matters exactly
+	}{
+		{name: "short", header: "Subject", value: "Hello there", want: "Hello there", raw: "Subject: Hello there\r\n"},
+		{name: "folded at 78", header: "Subject", value: long, want: long},
+		{name: "word longer than a line", header: "Subject", value: "see " + longWord + " here", want: "see " + longWord + " here"},
+		{name: "Q encoded", header: "Subject", value: "Meeting in Zürich", want: "Meeting in Zürich", raw: "Subject: Meeting in =?utf-8?q?Z=C3=BCrich?=\r\n"},
+		{name: "B encoded", header: "Subject", value: "Καλημέρα κόσμε", want: "Καλημέρα κόσμε"},
+		{name: "neighbouring words encoded together", header: "Subject", value: "Grüße aus Köln und Düsseldorf", want: "Grüße aus Köln und Düsseldorf"},
+		{name: "long encoded", header: "Subject", value: strings.Repeat("Grüße ", 20) + "!", want: strings.Repeat("Grüße ", 20) + "!"},
+		{name: "encoded-word lookalike", header: "Subject", value: "=?utf-8?q?hi?=", want: "=?utf-8?q?hi?="},
+		{name: "encoded-word lookalike among words", header: "Subject", value: "see =?utf-8?q?hi?= here", want: "see =?utf-8?q?hi?= here"},
+		{name: "display name", header: "From", value: "Zoë Adams <zoe@example.com>", want: "Zoë Adams <zoe@example.com>"},
+		{name: "CRLF in value", header: "Subject", value: "hi\r\nBcc: evil@example.com", want: "hi Bcc: evil@example.com"},
+		{name: "LF in value", header: "Subject", value: "hi\n\nbody", want: "hi  body"},
+		{name: "CR in value", header: "Subject", value: "hi\rBcc: evil@example.com", want: "hi Bcc: evil@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			WriteHeader(&b, tt.header, tt.value)
+			out := b.String()
+
+			if tt.raw != "" && out != tt.raw {
+				t.Errorf("wrote %q, want %q", out, tt.raw)
+			}
+			if !isASCII(out) {
+				t.Errorf("wrote %q, which isn't ASCII", out)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				if tooLong(line) {
+					t.Errorf("line %q is longer than %d", line, maxLineLength)
+				}
+			}
+
+			// whatever the value held, it is the only header written
+			msg, err := mail.ReadMessage(strings.NewReader(out + "\r\n"))
+			if err != nil {
+				t.Fatalf("could not read %q back: %v", out, err)
+			}
+			if len(msg.Header) != 1 {
+				t.Errorf("wrote %d headers, want 1: %q", len(msg.Header), out)
+			}
+
+			got, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get(tt.header))
+			if err != nil {
+				t.Fatalf("could not decode %q: %v", out, err)
+			}
+			if got != tt.want {
+				t.Errorf("decoded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHeaderName(t *testing.T) {
+
+	var b bytes.Buffer
+	WriteHeader(&b, "X-Note\r\nBcc", "evil@example.com")
+
+	msg, err := mail.ReadMessage(strings.NewReader(b.String() + "\r\n"))
+	if err == nil && msg.Header.Get("Bcc") != "" {
+		t.Errorf("a line break in the name started a Bcc header: %q", b.String())
+	}
+	if strings.Count(b.String(), "\r\n") != 1 {
+		t.Errorf("wrote %q, want a single line", b.String())
+	}
+}
@@ -0,0 +1,362 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// the content transfer encodings the text parts of a message can be sent in
+const (
+	EncodingAuto            = "auto"             // as it is when it can, else whichever of the two below is smaller
+	EncodingQuotedPrintable = "quoted-printable" // always quoted-printable, which keeps ASCII text readable
+	EncodingBase64          = "base64"           // always base64
+)
+
+// Attachment is a file carried along with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// FormatSize writes a number of bytes the way people read them, e.g. 12 KB or 3.4 MB
+func FormatSize(n int) string {
+	switch {
+	case n < 1<<20:
+		return fmt.Sprintf("%d KB", (n+1023)>>10)
+	case n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// Image is an image shown in the HTML version of a message. It goes along
+// as a related part, and the HTML points at it with a cid: URL.
+type Image struct {
+	Attachment
+	CID string // the part's Content-ID, without the angle brackets
+}
+
+// writeBody writes the Content-Type header, the empty line ending the headers
+// and the body. A message without attachments stays a single text/plain part,
+// otherwise the text goes first in a multipart/mixed message. The encoding
+// says how the text parts are encoded, see transferEncoding. With safe set,
+// they are 7bit safe, so they get through any server unchanged, which a
+// signature needs. A wrap above 0 sends the text as format=flowed,
+// wrapped at that column. With html set, the text comes with an HTML version
+// in a multipart/alternative part, and the images it shows with it. A
+// calendar is another version of the body, see RFC 6047.
+func writeBody(b *bytes.Buffer, text, html string, images []Image, calendar []byte, attachments []Attachment, encoding string, safe bool, wrap int) {
+
+	header, encoded := textPart(text, encoding, safe, wrap)
+	if html != "" || calendar != nil {
+		header, encoded = alternativePart(header, encoded, html, images, calendar, encoding, safe)
+	}
+
+	if len(attachments) == 0 {
+		fmt.Fprintf(b, "Content-Type: %s\r\n", header.Get("Content-Type"))
+		if cte := header.Get("Content-Transfer-Encoding"); cte != "" {
+			fmt.Fprintf(b, "Content-Transfer-Encoding: %s\r\n", cte)
+		}
+		b.WriteString("\r\n")
+		b.Write(encoded)
+		return
+	}
+
+	w := multipart.NewWriter(b)
+	fmt.Fprintf(b, "Content-Type: multipart/mixed; boundary=%q\r\n", w.Boundary())
+	b.WriteString("\r\n")
+
+	part, _ := w.CreatePart(header)
+	part.Write(encoded)
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		WriteBase64(part, a.Data)
+	}
+
+	w.Close()
+}
+
+// textPart returns the headers and the encoded body of the text part
+func textPart(text, encoding string, safe bool, wrap int) (textproto.MIMEHeader, []byte) {
+
+	header := textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}}
+	if wrap > 0 {
+		text = Flow(text, wrap)
+		header.Set("Content-Type", "text/plain; charset=UTF-8; format=flowed")
+	}
+
+	// the body must use CRLF line endings
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n", "\r\n") + "\r\n"
+
+	return encodePart(header, []byte(text), encoding, safe)
+}
+
+// encodePart encodes the body of a text part the way transferEncoding
+// picks, and sets the part's Content-Transfer-Encoding to say so
+func encodePart(header textproto.MIMEHeader, data []byte, encoding string, safe bool) (textproto.MIMEHeader, []byte) {
+
+	cte := transferEncoding(data, encoding, safe)
+	if cte == "7bit" {
+		// it's what a part without the header is, so we leave it out
+		return header, data
+	}
+	header.Set("Content-Transfer-Encoding", cte)
+
+	var b bytes.Buffer
+	switch cte {
+	case "quoted-printable":
+		w := quotedprintable.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+	case "base64":
+		WriteBase64(&b, data)
+	default:
+		return header, data
+	}
+
+	return header, b.Bytes()
+}
+
+// transferEncoding picks the content transfer encoding of a text part, see
+// RFC 2045. Text that is ASCII with lines no longer than RFC 5322 allows
+// goes as it is (7bit), and so does other text (8bit) unless it has to be
+// 7bit safe. Everything else is quoted-printable, unless so much of it
+// isn't ASCII, like Greek or Chinese, that base64 comes out smaller. The
+// encoding set in the config can ask for quoted-printable or base64 always.
+func transferEncoding(data []byte, encoding string, safe bool) string {
+
+	switch encoding {
+	case EncodingQuotedPrintable, EncodingBase64:
+		return encoding
+	}
+
+	var (
+		escaped int  // the bytes quoted-printable writes as three
+		line    int  // how long the current line is
+		long    bool // a line is longer than 998 characters
+		spaced  bool // a line ends in a space or a tab, which some servers strip
+		nul     bool // NUL isn't allowed in 7bit or 8bit text
+	)
+	for i, c := range data {
+		switch {
+		case c == '\n':
+			if i > 1 && (data[i-2] == ' ' || data[i-2] == '\t') {
+				spaced = true
+			}
+			line = 0
+			continue
+		case c == 0:
+			nul = true
+			escaped++
+		case c >= 0x80 || c == '=':
+			escaped++
+		}
+		if line++; line > 998+1 {
+			// the CR ending the line is counted too
+			long = true
+		}
+	}
+
+	switch {
+	case !long && !nul && !(safe && spaced) && isASCII(string(data)):
+		return "7bit"
+	case !long && !nul && !safe:
+		return "8bit"
+	case escaped*2 <= (len(data)+2)/3:
+		// each escaped byte adds two, base64 adds a third to everything
+		return "quoted-printable"
+	}
+	return "base64"
+}
+
+// To7bit re-encodes the 8bit parts of a message for a server that doesn't
+// offer 8BITMIME, which only takes 7bit. The text stays the same, only how
+// it is encoded changes, and a signed part is left alone as it has to be.
+func To7bit(raw []byte) ([]byte, error) {
+
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end < 0 || isASCII(string(raw[end:])) {
+		return raw, nil
+	}
+
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw[:end+4]))).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	cte, body, err := entity7bit(header, raw[end+4:])
+	if err != nil {
+		return nil, err
+	}
+
+	// the headers keep their order, only the encoding is written anew
+	var b bytes.Buffer
+	for _, line := range strings.SplitAfter(string(raw[:end+2]), "\r\n") {
+		if cte == "" || !strings.HasPrefix(strings.ToLower(line), "content-transfer-encoding:") {
+			b.WriteString(line)
+		}
+	}
+	if cte != "" {
+		fmt.Fprintf(&b, "Content-Transfer-Encoding: %s\r\n", cte)
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+
+	return b.Bytes(), nil
+}
+
+// entity7bit re-encodes the body of a MIME entity with the given headers,
+// and the parts in it, so it is 7bit. It returns the entity's new
+// Content-Transfer-Encoding, or "" when that stays as it is.
+func entity7bit(header textproto.MIMEHeader, body []byte) (string, []byte, error) {
+
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "multipart/signed" {
+		return "", body, nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.SetBoundary(params["boundary"]); err != nil {
+			return "", nil, err
+		}
+
+		r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", nil, err
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return "", nil, err
+			}
+
+			cte, data, err := entity7bit(part.Header, data)
+			if err != nil {
+				return "", nil, err
+			}
+			if cte != "" {
+				part.Header.Set("Content-Transfer-Encoding", cte)
+			}
+			pw, _ := w.CreatePart(part.Header)
+			pw.Write(data)
+		}
+
+		w.Close()
+		return "", b.Bytes(), nil
+	}
+
+	// quoted-printable and base64 are 7bit already
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "", "7bit", "8bit", "binary":
+		if isASCII(string(body)) {
+			return "", body, nil
+		}
+		encoded, data := encodePart(textproto.MIMEHeader{}, body, EncodingAuto, true)
+		return encoded.Get("Content-Transfer-Encoding"), data, nil
+	}
+
+	return "", body, nil
+}
+
+// alternativePart puts the text part and an HTML version of it together, the
+// text goes first as clients show the last version they understand
+func alternativePart(textHeader textproto.MIMEHeader, text []byte, html string, images []Image, calendar []byte, encoding string, safe bool) (textproto.MIMEHeader, []byte) {
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	part, _ := w.CreatePart(textHeader)
+	part.Write(text)
+
+	if html != "" {
+		htmlHeader, encoded := htmlPart(html, encoding, safe)
+		if len(images) > 0 {
+			htmlHeader, encoded = relatedPart(htmlHeader, encoded, images)
+		}
+		part, _ = w.CreatePart(htmlHeader)
+		part.Write(encoded)
+	}
+
+	// the calendar goes last, so clients that understand it show the invitation
+	if calendar != nil {
+		header, encoded := encodePart(textproto.MIMEHeader{"Content-Type": {"text/calendar; charset=UTF-8; method=REQUEST"}}, calendar, encoding, safe)
+		part, _ = w.CreatePart(header)
+		part.Write(encoded)
+	}
+
+	w.Close()
+
+	header := textproto.MIMEHeader{"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": w.Boundary()})}}
+	return header, b.Bytes()
+}
+
+// htmlPart returns the headers and the encoded body of the HTML part. HTML
+// lines can be longer than any server allows, transferEncoding sees to that.
+func htmlPart(html, encoding string, safe bool) (textproto.MIMEHeader, []byte) {
+
+	header := textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}}
+	return encodePart(header, []byte(strings.ReplaceAll(html, "\n", "\r\n")+"\r\n"), encoding, safe)
+}
+
+// relatedPart puts the HTML part and the images it shows together in a
+// multipart/related part, see RFC 2387. Each image is found by its Content-ID.
+func relatedPart(htmlHeader textproto.MIMEHeader, html []byte, images []Image) (textproto.MIMEHeader, []byte) {
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	part, _ := w.CreatePart(htmlHeader)
+	part.Write(html)
+
+	for _, image := range images {
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(image.ContentType, map[string]string{"name": image.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": image.Filename})},
+			"Content-ID":                {"<" + image.CID + ">"},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		WriteBase64(part, image.Data)
+	}
+
+	w.Close()
+
+	params := map[string]string{"type": "text/html", "boundary": w.Boundary()}
+	header := textproto.MIMEHeader{"Content-Type": {mime.FormatMediaType("multipart/related", params)}}
+	return header, b.Bytes()
+}
+
+// WriteBase64 encodes data in lines of 76 characters, as RFC 2045 asks
+func WriteBase64(w io.Writer, data []byte) {
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
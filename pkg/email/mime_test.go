@@ -0,0 +1,170 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestTransferEncoding(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		data     string
+		encoding string
+		safe     bool
+		want     string
+	}{
+		{"ascii", "hello\r\n", EncodingAuto, false, "7bit"},
+		{"ascii safe", "hello\r\n", EncodingAuto, true, "7bit"},
+		{"utf-8", "héllo\r\n", EncodingAuto, false, "8bit"},
+		{"mostly ascii safe", "Mostly English, with a word of German: Grüße.\r\n", EncodingAuto, true, "quoted-printable"},
+		{"mostly not ascii safe", "Καλημέρα κόσμε\r\n", EncodingAuto, true, "base64"},
+		{"line too long", strings.Repeat("a", 999) + "\r\n", EncodingAuto, false, "quoted-printable"},
+		{"longest line allowed", strings.Repeat("a", 998) + "\r\n", EncodingAuto, false, "7bit"},
+		{"NUL", "a\x00b\r\n", EncodingAuto, false, "quoted-printable"},
+		{"trailing space", "hi \r\n", EncodingAuto, false, "7bit"},
+		{"trailing space safe", "hi \r\n", EncodingAuto, true, "quoted-printable"},
+		{"trailing tab safe", "hi\t\r\n", EncodingAuto, true, "quoted-printable"},
+		{"quoted-printable asked for", "hello\r\n", EncodingQuotedPrintable, false, "quoted-printable"},
+		{"base64 asked for", "hello\r\n", EncodingBase64, false, "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transferEncoding([]byte(tt.data), tt.encoding, tt.safe); got != tt.want {
+				t.Errorf("transferEncoding(%q, %q, %v) = %q, want %q", tt.data, tt.encoding, tt.safe, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTo7bit(t *testing.T) {
+
+	signed := "Content-Type: multipart/signed; boundary=b; protocol=\"application/pgp-signature\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Grüße\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/pgp-signature\r\n" +
+		"\r\n" +
+		"sig\r\n" +
+		"--b--\r\n"
+
+	mixed := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Grüße aus Köln\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"Καλημέρα κόσμε\r\n" +
+		"--b--\r\n"
+
+	tests := []struct {
+		name string
+		raw  string
+		same bool // whether it is left as it is
+	}{
+		{"ascii", "Subject: hi\r\nContent-Type: text/plain\r\n\r\nhello\r\n", true},
+		{"8bit", "Subject: hi\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\nGrüße\r\n", false},
+		{"no encoding header", "Subject: hi\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\nGrüße\r\n", false},
+		{"quoted-printable already", "Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nGr=C3=BC=C3=9Fe\r\n", true},
+		{"multipart", mixed, false},
+		{"signed", signed, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := To7bit([]byte(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.same {
+				if string(out) != tt.raw {
+					t.Errorf("To7bit changed the message to %q", out)
+				}
+				return
+			}
+
+			if !isASCII(string(out)) {
+				t.Errorf("To7bit left 8 bits in %q", out)
+			}
+			if n := strings.Count(strings.ToLower(string(out)), "\r\ncontent-transfer-encoding:"); strings.HasPrefix(tt.raw, "Subject") && n != 1 {
+				t.Errorf("To7bit wrote %d Content-Transfer-Encoding headers, want 1: %q", n, out)
+			}
+			if got, want := text(t, out), text(t, []byte(tt.raw)); got != want {
+				t.Errorf("the text is %q after To7bit, want %q", got, want)
+			}
+		})
+	}
+}
+
+// text returns the decoded text of every part of the message, one after the other
+func text(t *testing.T, raw []byte) string {
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entityText(t, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), body)
+}
+
+func entityText(t *testing.T, contentType, cte string, body []byte) string {
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		switch strings.ToLower(cte) {
+		case "quoted-printable":
+			decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(decoded)
+		case "base64":
+			decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(decoded)
+		}
+		return string(body)
+	}
+
+	var b strings.Builder
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString(entityText(t, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), data))
+	}
+
+	return b.String()
+}
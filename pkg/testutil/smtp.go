@@ -0,0 +1,322 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a small SMTP server that takes every message it is sent and
+// keeps it, so tests and demos can send mail without a real server. It
+// doesn't offer TLS, nobody has to log in and it never refuses anyone.
+type Server struct {
+	Addr string // the host and port it listens on, on 127.0.0.1
+
+	ln         net.Listener
+	mu         sync.Mutex
+	conns      map[net.Conn]bool
+	messages   []Message
+	dir        string   // where messages are saved too, see SaveTo
+	extensions []string // what EHLO offers, see Offer
+}
+
+// Message is a message the server took
+type Message struct {
+	From    string   // the envelope sender
+	To      []string // the envelope recipients
+	Data    []byte   // the message as it was sent, with CRLF line endings
+	Path    string   // the file it was saved in, if it was
+	Chunked bool     // it came with BDAT rather than DATA
+}
+
+// defaultExtensions are what a new server offers
+var defaultExtensions = []string{"8BITMIME", "SMTPUTF8", "PIPELINING"}
+
+// NewServer starts a server on a port of its own
+func NewServer() (*Server, error) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Addr: ln.Addr().String(), ln: ln, conns: make(map[net.Conn]bool), extensions: defaultExtensions}
+	go s.serve()
+
+	return s, nil
+}
+
+// SaveTo writes every message the server takes from now on to a file of its own in dir
+func (s *Server) SaveTo(dir string) error {
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+
+	return nil
+}
+
+// Offer sets the extensions the server offers to the clients connecting
+// from now on, e.g. CHUNKING or SIZE 1000, in place of 8BITMIME, SMTPUTF8
+// and PIPELINING. Only CHUNKING changes what the server does, it always
+// takes 8 bits, pipelined commands and messages of any size.
+func (s *Server) Offer(extensions ...string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.extensions = extensions
+}
+
+// Messages returns the messages the server took, in the order they came
+func (s *Server) Messages() []Message {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and hangs up on everyone still connected
+func (s *Server) Close() error {
+
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+// serve takes connections until the server is closed
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// handle talks SMTP with one client. The replies go in the order the
+// commands came, so a client pipelining them reads them back as it should.
+func (s *Server) handle(conn net.Conn) {
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 localhost go-mailer test server")
+
+	var (
+		from    string
+		to      []string
+		started bool   // MAIL was sent, from can be empty for a bounce
+		chunks  []byte // what BDAT sent of the message so far
+	)
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			s.mu.Lock()
+			extensions := s.extensions
+			s.mu.Unlock()
+			lines := append([]string{"localhost"}, extensions...)
+			for i, line := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				c.PrintfLine("250%s%s", sep, line)
+			}
+		case "HELO":
+			c.PrintfLine("250 localhost")
+
+		case "MAIL":
+			addr, ok := path(arg, "FROM:")
+			if !ok {
+				c.PrintfLine("501 5.5.4 expected MAIL FROM:<address>")
+				continue
+			}
+			from, to, started, chunks = addr, nil, true, nil
+			c.PrintfLine("250 2.1.0 ok")
+
+		case "RCPT":
+			addr, ok := path(arg, "TO:")
+			switch {
+			case !started:
+				c.PrintfLine("503 5.5.1 MAIL first")
+			case !ok || addr == "":
+				c.PrintfLine("501 5.5.4 expected RCPT TO:<address>")
+			default:
+				to = append(to, addr)
+				c.PrintfLine("250 2.1.5 ok")
+			}
+
+		case "DATA":
+			if len(to) == 0 {
+				c.PrintfLine("503 5.5.1 no recipients yet")
+				continue
+			}
+			c.PrintfLine("354 end with a line holding a single dot")
+			data, err := readData(c)
+			if err != nil {
+				return
+			}
+			c.PrintfLine("250 2.0.0 ok: %s", s.keep(Message{From: from, To: to, Data: data}))
+			from, to, started = "", nil, false
+
+		case "BDAT":
+			size, last, ok := chunk(arg)
+			if !ok || !s.offers("CHUNKING") {
+				c.PrintfLine("501 5.5.4 expected BDAT <size> [LAST]")
+				return
+			}
+			// the chunk follows whatever we say, so it is read first
+			data := make([]byte, size)
+			if _, err := io.ReadFull(c.R, data); err != nil {
+				return
+			}
+			if len(to) == 0 {
+				c.PrintfLine("503 5.5.1 no recipients yet")
+				continue
+			}
+			chunks = append(chunks, data...)
+			if !last {
+				c.PrintfLine("250 2.0.0 %d bytes taken", size)
+				continue
+			}
+			c.PrintfLine("250 2.0.0 ok: %s", s.keep(Message{From: from, To: to, Data: chunks, Chunked: true}))
+			from, to, started, chunks = "", nil, false, nil
+
+		case "RSET":
+			from, to, started, chunks = "", nil, false, nil
+			c.PrintfLine("250 2.0.0 ok")
+		case "NOOP":
+			c.PrintfLine("250 2.0.0 ok")
+		case "QUIT":
+			c.PrintfLine("221 2.0.0 bye")
+			return
+		default:
+			c.PrintfLine("502 5.5.2 %s isn't something we do", verb)
+		}
+	}
+}
+
+// offers reports whether the server offers the extension
+func (s *Server) offers(extension string) bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.extensions {
+		if strings.EqualFold(e, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// keep adds the message to the ones the server took, and says where it went
+func (s *Server) keep(msg Message) string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the time keeps the files in order, the random part apart
+	if s.dir != "" {
+		if f, err := os.CreateTemp(s.dir, time.Now().Format("20060102-150405")+"-*.eml"); err == nil {
+			if _, err := f.Write(msg.Data); err == nil {
+				msg.Path = f.Name()
+			}
+			f.Close()
+		}
+	}
+	s.messages = append(s.messages, msg)
+
+	if msg.Path != "" {
+		return "captured as " + msg.Path
+	}
+	return fmt.Sprintf("captured as message %d", len(s.messages))
+}
+
+// readData reads the message that follows DATA, taking the dots that were
+// stuffed in front of lines back off. Unlike c.DotReader it keeps the CRLF
+// line endings, which a signed message needs.
+func readData(c *textproto.Conn) ([]byte, error) {
+
+	var data []byte
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "." {
+			return data, nil
+		}
+		data = append(data, strings.TrimPrefix(line, ".")+"\r\n"...)
+	}
+}
+
+// chunk reads the argument of BDAT, e.g. 1024 LAST
+func chunk(arg string) (int, bool, bool) {
+
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, false, false
+	}
+	size, err := strconv.Atoi(fields[0])
+	if err != nil || size < 0 {
+		return 0, false, false
+	}
+	if len(fields) == 2 && !strings.EqualFold(fields[1], "LAST") {
+		return 0, false, false
+	}
+
+	return size, len(fields) == 2, true
+}
+
+// path reads the address out of the argument of MAIL or RCPT, e.g.
+// FROM:<ann@example.com> BODY=8BITMIME, leaving the parameters off
+func path(arg, prefix string) (string, bool) {
+
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+
+	end := strings.Index(arg, ">")
+	if !strings.HasPrefix(arg, "<") || end < 0 {
+		return "", false
+	}
+
+	return arg[1:end], true
+}
@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+)
+
+// the kinds of error Classify tells apart
+const (
+	KindRejected  = "rejected"  // the server refused with a 5xx reply, or a 4xx status over HTTP, or a hook stopped it
+	KindTemporary = "temporary" // the server refused with a 4xx reply, or a 5xx or 429 status over HTTP, asking us to try later
+	KindDNS       = "dns"       // the server's name couldn't be looked up
+	KindTimeout   = "timeout"   // the server didn't answer in time
+	KindConnect   = "connect"   // the server couldn't be reached
+	KindTLS       = "tls"       // the server's certificate couldn't be verified
+	KindOther     = "failed"    // anything else, e.g. signing the message failed
+)
+
+// HTTPError is returned by the transports that send over HTTP, such as
+// the Gmail API, when the server answers with an error status
+type HTTPError struct {
+	Code int
+	Msg  string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Code, http.StatusText(e.Code), e.Msg)
+}
+
+// RefusedError is returned when the message was stopped before it got to
+// a server, e.g. by a pre-send hook. Like a 5xx reply, it is for good.
+type RefusedError struct {
+	By     string // what stopped it
+	Reason string
+}
+
+func (e *RefusedError) Error() string {
+	return fmt.Sprintf("%s stopped the message: %s", e.By, e.Reason)
+}
+
+// Classify tells what kind of error sending a message failed with, and
+// whether it is permanent, in which case trying again won't help until
+// something changes, such as the recipients or the settings
+func Classify(err error) (kind string, permanent bool) {
+
+	var (
+		reply   *textproto.Error
+		status  *HTTPError
+		refused *RefusedError
+		dns     *net.DNSError
+		netErr  net.Error
+		op      *net.OpError
+		cert    *tls.CertificateVerificationError
+		unknown x509.UnknownAuthorityError
+		host    x509.HostnameError
+		invalid x509.CertificateInvalidError
+	)
+	switch {
+	case err == nil:
+		return "", false
+	case errors.As(err, &reply):
+		if reply.Code >= 500 {
+			return KindRejected, true
+		}
+		return KindTemporary, false
+
+	case errors.As(err, &refused):
+		return KindRejected, true
+
+	// too many requests is the HTTP way of asking us to try later
+	case errors.As(err, &status):
+		if status.Code >= 500 || status.Code == http.StatusTooManyRequests {
+			return KindTemporary, false
+		}
+		return KindRejected, true
+
+	// a name that doesn't exist stays that way, unlike a resolver that can't be reached
+	case errors.As(err, &dns):
+		return KindDNS, dns.IsNotFound
+	case errors.As(err, &cert), errors.As(err, &unknown), errors.As(err, &host), errors.As(err, &invalid):
+		return KindTLS, true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return KindTimeout, false
+	case errors.As(err, &op):
+		return KindConnect, false
+	}
+
+	return KindOther, false
+}
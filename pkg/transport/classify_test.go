@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		err       error
+		kind      string
+		permanent bool
+	}{
+		{"nil", nil, "", false},
+		{"5xx reply", &textproto.Error{Code: 550, Msg: "no such user"}, KindRejected, true},
+		{"4xx reply", &textproto.Error{Code: 451, Msg: "try again later"}, KindTemporary, false},
+		{"wrapped reply", fmt.Errorf("could not send: %w", &textproto.Error{Code: 421, Msg: "closing"}), KindTemporary, false},
+		{"refused recipient", RecipientError{Addr: "ann@example.com", Err: &textproto.Error{Code: 550}}, KindRejected, true},
+		{"stopped by a hook", &RefusedError{By: "pre-send hook", Reason: "no"}, KindRejected, true},
+		{"HTTP 429", &HTTPError{Code: 429}, KindTemporary, false},
+		{"HTTP 503", &HTTPError{Code: 503}, KindTemporary, false},
+		{"HTTP 400", &HTTPError{Code: 400}, KindRejected, true},
+		{"name not found", &net.DNSError{Err: "no such host", Name: "smtp.example", IsNotFound: true}, KindDNS, true},
+		{"resolver unreachable", &net.DNSError{Err: "server misbehaving", Name: "smtp.example"}, KindDNS, false},
+		{"unknown authority", x509.UnknownAuthorityError{}, KindTLS, true},
+		{"wrong host", x509.HostnameError{Host: "smtp.example"}, KindTLS, true},
+		{"timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, KindTimeout, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, KindConnect, false},
+		{"anything else", errors.New("could not sign the message"), KindOther, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, permanent := Classify(tt.err)
+			if kind != tt.kind || permanent != tt.permanent {
+				t.Errorf("Classify(%v) = %q, %v, want %q, %v", tt.err, kind, permanent, tt.kind, tt.permanent)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// Pool keeps connections to an SMTP server open after a message has gone
+// out, so the next one doesn't have to connect and log in again. A mail
+// merge sends one message after another, that adds up. A nil pool keeps none.
+type Pool struct {
+	mu    sync.Mutex
+	size  int           // the most connections kept open
+	idle  time.Duration // how long a connection is kept without being used
+	conns []pooledConn
+}
+
+// pooledConn is a connection waiting in the pool for the next message
+type pooledConn struct {
+	c     *smtp.Client
+	since time.Time
+}
+
+// NewPool returns a pool keeping up to size connections open, each for as
+// long as idle without being used
+func NewPool(size int, idle time.Duration) *Pool {
+	return &Pool{size: size, idle: idle}
+}
+
+// get returns a connection that is still open, or nil when there is none
+// and a new one has to be made
+func (p *Pool) get() *smtp.Client {
+
+	if p == nil {
+		return nil
+	}
+
+	for {
+		p.mu.Lock()
+		if len(p.conns) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		// the connection used last is the one least likely to have been dropped
+		pc := p.conns[len(p.conns)-1]
+		p.conns = p.conns[:len(p.conns)-1]
+		p.mu.Unlock()
+
+		// the server may have hung up on us since, NOOP finds out without sending anything
+		if time.Since(pc.since) < p.idle && pc.c.Noop() == nil {
+			return pc.c
+		}
+		pc.c.Close()
+	}
+}
+
+// put gives a connection back for the next message. It reports false when
+// the pool is full, in which case the caller should close the connection.
+func (p *Pool) put(c *smtp.Client) bool {
+
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.conns) >= p.size {
+		return false
+	}
+	p.conns = append(p.conns, pooledConn{c: c, since: time.Now()})
+
+	// we hang up ourselves once the connection has been idle for too long,
+	// rather than leaving the server to do it
+	time.AfterFunc(p.idle, p.expire)
+
+	return true
+}
+
+// expire closes the connections that have been idle for too long
+func (p *Pool) expire() {
+
+	p.mu.Lock()
+	var stale []pooledConn
+	fresh := p.conns[:0]
+	for _, pc := range p.conns {
+		if time.Since(pc.since) >= p.idle {
+			stale = append(stale, pc)
+		} else {
+			fresh = append(fresh, pc)
+		}
+	}
+	p.conns = fresh
+	p.mu.Unlock()
+
+	for _, pc := range stale {
+		pc.c.Quit()
+	}
+}
+
+// Close says goodbye on every connection in the pool
+func (p *Pool) Close() {
+
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.c.Quit()
+	}
+}
@@ -0,0 +1,397 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aidk/go-mailer/internal/eai"
+	"github.com/aidk/go-mailer/pkg/email"
+)
+
+// SMTP sends mail through an SMTP submission server at Addr
+type SMTP struct {
+	Addr        string // the host and port of the server, e.g. smtp.example.com:587
+	ImplicitTLS bool   // TLS from the start, as port 465 expects, rather than STARTTLS
+	Insecure    bool   // lets the message go in plain text to a server without STARTTLS
+	Username    string // we log in with PLAIN when it is set
+	Password    string
+	ReturnPath  string // where bounces go, rather than to the sender
+
+	DKIM   Signer                                            // signs messages on the way out, if set
+	Policy func(host string, to []string) (TLSPolicy, error) // looks up the TLS policy for the server and the recipients, if set
+	Pool   *Pool                                             // connections kept open between messages, nil to connect for each one
+
+	// Connected is told how long connecting, switching to TLS and logging in took, if set
+	Connected func(time.Duration)
+
+	// Log gets the dialogue with the server at debug level, without the password or the messages, if set
+	Log *slog.Logger
+}
+
+func (t SMTP) Name() string {
+	return "smtp"
+}
+
+func (t SMTP) Send(from string, to []string, msg []byte) (string, error) {
+
+	msg, report := email.TakeDeliveryReport(msg)
+
+	// bounces go to the return path when there is one, rather than to the sender
+	if t.ReturnPath != "" {
+		addr, err := mail.ParseAddress(t.ReturnPath)
+		if err != nil {
+			return "", fmt.Errorf("invalid return path %q", t.ReturnPath)
+		}
+		from = addr.Address
+	}
+
+	// domains go out in ASCII, a local part that isn't needs SMTPUTF8
+	from, to, needUTF8, err := envelope(from, to)
+	if err != nil {
+		return "", err
+	}
+
+	host, _, err := net.SplitHostPort(t.Addr)
+	if err != nil {
+		return "", err
+	}
+
+	var policy TLSPolicy
+	if t.Policy != nil {
+		if policy, err = t.Policy(host, to); err != nil {
+			return "", err
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if policy != nil {
+		tlsConfig = policy.TLSConfig()
+	}
+
+	// a connection left open by the last message saves logging in again, but
+	// only without a TLS policy, which can change with the recipients
+	pool := t.Pool
+	if policy != nil {
+		pool = nil
+	}
+
+	c := pool.get()
+	if c == nil {
+		started := time.Now()
+		if c, err = t.dial(host, policy, tlsConfig); err != nil {
+			return "", err
+		}
+		if t.Connected != nil {
+			t.Connected(time.Since(started))
+		}
+	}
+
+	result, err := t.deliver(c, host, from, to, msg, report, needUTF8)
+	if err != nil {
+		// a refused message leaves the connection usable once it's reset
+		if pool == nil || c.Reset() != nil || !pool.put(c) {
+			c.Close()
+		}
+		return "", err
+	}
+
+	if pool.put(c) {
+		return result, nil
+	}
+	return result, c.Quit()
+}
+
+// dial connects to the server, switches to TLS and logs in
+func (t SMTP) dial(host string, policy TLSPolicy, tlsConfig *tls.Config) (*smtp.Client, error) {
+
+	// port 465 expects TLS straight away, everything else starts in plain text
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.ImplicitTLS {
+		conn, err = tls.Dial("tcp", t.Addr, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", t.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", t.Addr, err)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log := t.Log
+	if log != nil {
+		log = log.With("server", t.Addr)
+		log.Debug("connected", "tls", t.ImplicitTLS)
+		trace(c, log)
+	}
+
+	if !t.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return nil, err
+			}
+			if log != nil {
+				log.Debug("started TLS")
+				trace(c, log)
+			}
+		} else if policy != nil && policy.RequireTLS() {
+			// even when insecure is set, a policy saying otherwise means someone may be in the way
+			c.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS, but %s requires it", host, policy)
+		} else if !t.Insecure {
+			c.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS", host)
+		}
+	}
+
+	if t.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, host)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("could not log in: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// deliver sends one message over a connection that is ready for it
+func (t SMTP) deliver(c *smtp.Client, host, from string, to []string, msg []byte, report bool, needUTF8 string) (string, error) {
+
+	if ok, _ := c.Extension("SMTPUTF8"); needUTF8 != "" && !ok {
+		return "", fmt.Errorf("%s does not support SMTPUTF8, which is needed to send to or from %s", host, needUTF8)
+	}
+
+	// a server without 8BITMIME only takes 7bit, so text that went out as
+	// 8bit is encoded again. Raw 8 bits could get there mangled or not at all.
+	if ok, _ := c.Extension("8BITMIME"); !ok {
+		var err error
+		if msg, err = email.To7bit(msg); err != nil {
+			return "", err
+		}
+	}
+
+	// we sign last, just before sending, so the signature's timestamp is the
+	// time it went out, and it covers the message as the server gets it
+	if t.DKIM != nil {
+		signed, err := t.DKIM.Sign(msg)
+		if err != nil {
+			return "", err
+		}
+		msg = signed
+	}
+
+	// the server says how big a message it takes, we'd rather say so than
+	// have it turned away halfway through with a less helpful error
+	if ok, limit := c.Extension("SIZE"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(limit)); err == nil && n > 0 && len(msg) > n {
+			return "", fmt.Errorf("the message is %s, but %s only takes messages up to %s", email.FormatSize(len(msg)), host, email.FormatSize(n))
+		}
+	}
+
+	// a delivery report is asked for in the envelope, which only servers
+	// offering DSN understand, the others still get the message without it
+	dsn, _ := c.Extension("DSN")
+	if err := sendEnvelope(c, from, to, report && dsn); err != nil {
+		return "", err
+	}
+
+	// with CHUNKING the message goes as it is, DATA needs its lines dot stuffed
+	send := data
+	if ok, _ := c.Extension("CHUNKING"); ok {
+		send = bdat
+	}
+	result, err := send(c, msg)
+	if err != nil {
+		return "", err
+	}
+	if report && !dsn {
+		result += fmt.Sprintf(" (%s doesn't offer delivery reports, so none was asked for)", host)
+	}
+
+	return result, nil
+}
+
+// mailCommand returns the MAIL command starting the message. We write it
+// ourselves rather than use c.Mail, which can't take the DSN parameters or
+// be pipelined, with the same parameters c.Mail would have added.
+func mailCommand(c *smtp.Client, from string, report bool) string {
+
+	cmd := "MAIL FROM:<" + from + ">"
+	if report {
+		cmd += " RET=HDRS"
+	}
+	if ok, _ := c.Extension("8BITMIME"); ok {
+		cmd += " BODY=8BITMIME"
+	}
+	if ok, _ := c.Extension("SMTPUTF8"); ok {
+		cmd += " SMTPUTF8"
+	}
+
+	return cmd
+}
+
+// rcptCommand returns the RCPT command adding a recipient, asking for a
+// report on whether the message reached them or not when report is set
+func rcptCommand(rcpt string, report bool) string {
+
+	cmd := "RCPT TO:<" + rcpt + ">"
+	if report {
+		cmd += " NOTIFY=SUCCESS,FAILURE"
+	}
+
+	return cmd
+}
+
+// sendEnvelope tells the server who the message is from and who it goes
+// to. When the server offers PIPELINING the commands all go at once and
+// the replies are read afterwards, which saves a round trip per recipient.
+func sendEnvelope(c *smtp.Client, from string, to []string, report bool) error {
+
+	cmds := []string{mailCommand(c, from, report)}
+	for _, rcpt := range to {
+		cmds = append(cmds, rcptCommand(rcpt, report))
+	}
+	for _, cmd := range cmds {
+		if strings.ContainsAny(cmd, "\r\n") {
+			return fmt.Errorf("smtp: a command can't contain CR or LF")
+		}
+	}
+
+	// without pipelining we wait for the reply to each command before sending the next
+	batch := 1
+	if ok, _ := c.Extension("PIPELINING"); ok {
+		batch = len(cmds)
+	}
+
+	for start := 0; start < len(cmds); start += batch {
+		end := min(start+batch, len(cmds))
+
+		var ids []uint
+		for _, cmd := range cmds[start:end] {
+			id, err := c.Text.Cmd("%s", cmd)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		// every reply has to be read, even after a refusal, so the next one lines up with its command
+		var first error
+		for i, id := range ids {
+			expect := 25 // RCPT is answered with 250 or 251
+			if start+i == 0 {
+				expect = 250
+			}
+			c.Text.StartResponse(id)
+			_, _, err := c.Text.ReadResponse(expect)
+			c.Text.EndResponse(id)
+
+			if err != nil && first == nil {
+				first = err
+				if start+i > 0 {
+					first = RecipientError{Addr: to[start+i-1], Err: err}
+				}
+			}
+		}
+		if first != nil {
+			return first
+		}
+	}
+
+	return nil
+}
+
+// envelope returns the sender and recipients with their domains in ASCII,
+// and the first address that can only be sent with SMTPUTF8, if there is one
+func envelope(from string, to []string) (string, []string, string, error) {
+
+	var needUTF8 string
+	convert := func(addr string) (string, error) {
+		if needUTF8 == "" && eai.NeedsSMTPUTF8(addr) {
+			needUTF8 = addr
+		}
+		return eai.Address(addr)
+	}
+
+	from, err := convert(from)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	rcpts := make([]string, len(to))
+	for i, addr := range to {
+		if rcpts[i], err = convert(addr); err != nil {
+			return "", nil, "", err
+		}
+	}
+
+	return from, rcpts, needUTF8, nil
+}
+
+// data sends the message with the DATA command. We don't use c.Data because
+// it throws away the server's final reply, which usually holds the queue id.
+func data(c *smtp.Client, msg []byte) (string, error) {
+
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
+	if err != nil {
+		return "", err
+	}
+
+	w := c.Text.DotWriter()
+	if _, err := w.Write(msg); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	code, reply, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d %s", code, reply), nil
+}
+
+// bdat sends the message with the BDAT command from RFC 3030. It goes in a
+// single chunk, as it is, so there is one round trip and nothing to escape.
+func bdat(c *smtp.Client, msg []byte) (string, error) {
+
+	id := c.Text.Next()
+	c.Text.StartRequest(id)
+	fmt.Fprintf(c.Text.W, "BDAT %d LAST\r\n", len(msg))
+	c.Text.W.Write(msg)
+	err := c.Text.W.Flush()
+	c.Text.EndRequest(id)
+	if err != nil {
+		return "", err
+	}
+
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+
+	code, reply, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d %s", code, reply), nil
+}
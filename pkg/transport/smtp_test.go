@@ -0,0 +1,375 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aidk/go-mailer/internal/dkim"
+	"github.com/aidk/go-mailer/pkg/email"
+	"github.com/aidk/go-mailer/pkg/testutil"
+)
+
+func TestEnvelope(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		from     string
+		to       []string
+		wantFrom string
+		wantTo   []string
+		needUTF8 string
+	}{
+		{"ascii", "ann@example.com", []string{"bob@example.com"}, "ann@example.com", []string{"bob@example.com"}, ""},
+		{"non-ascii domain", "ann@bücher.example", []string{"bob@münchen.example"}, "ann@xn--bcher-kva.example", []string{"bob@xn--mnchen-3ya.example"}, ""},
+		{"non-ascii local part", "ann@example.com", []string{"bob@example.com", "jörg@example.com"}, "ann@example.com", []string{"bob@example.com", "jörg@example.com"}, "jörg@example.com"},
+		{"non-ascii sender", "zoë@example.com", []string{"bob@example.com"}, "zoë@example.com", []string{"bob@example.com"}, "zoë@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, needUTF8, err := envelope(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from != tt.wantFrom || !slices.Equal(to, tt.wantTo) || needUTF8 != tt.needUTF8 {
+				t.Errorf("envelope(%q, %q) = %q, %q, %q, want %q, %q, %q", tt.from, tt.to, from, to, needUTF8, tt.wantFrom, tt.wantTo, tt.needUTF8)
+			}
+		})
+	}
+}
+
+func TestRcptCommand(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		rcpt   string
+		report bool
+		want   string
+	}{
+		{"plain", "bob@example.com", false, "RCPT TO:<bob@example.com>"},
+		{"delivery report", "bob@example.com", true, "RCPT TO:<bob@example.com> NOTIFY=SUCCESS,FAILURE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rcptCommand(tt.rcpt, tt.report); got != tt.want {
+				t.Errorf("rcptCommand(%q, %v) = %q, want %q", tt.rcpt, tt.report, got, tt.want)
+			}
+		})
+	}
+}
+
+// newServer starts a test server offering the extensions
+func newServer(t *testing.T, extensions ...string) *testutil.Server {
+
+	s, err := testutil.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.Offer(extensions...)
+
+	return s
+}
+
+// testMessage renders a message with the text, which goes as 8bit when it isn't ASCII
+func testMessage(text string) []byte {
+	return email.Message{
+		From:    &mail.Address{Name: "Ann", Address: "ann@example.com"},
+		To:      []*mail.Address{{Address: "bob@example.com"}, {Address: "cy@example.com"}},
+		Subject: "Test",
+		Text:    text,
+	}.Bytes()
+}
+
+// sent returns the one message the server took
+func sent(t *testing.T, s *testutil.Server) testutil.Message {
+
+	msgs := s.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("the server took %d messages, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+func TestSendPipelining(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		extensions []string
+		pipelined  bool
+	}{
+		{"offered", []string{"8BITMIME", "PIPELINING"}, true},
+		{"not offered", []string{"8BITMIME"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.extensions...)
+
+			var log bytes.Buffer
+			tr := SMTP{Addr: s.Addr, Insecure: true, Log: slog.New(slog.NewTextHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+			if _, err := tr.Send("ann@example.com", []string{"bob@example.com", "cy@example.com"}, testMessage("Hello")); err != nil {
+				t.Fatal(err)
+			}
+			if got := sent(t, s).To; !slices.Equal(got, []string{"bob@example.com", "cy@example.com"}) {
+				t.Errorf("the server got the recipients %q", got)
+			}
+
+			// pipelined, every RCPT goes before the reply to MAIL is read
+			dialogue := log.String()
+			lastRcpt := strings.LastIndex(dialogue, `line="RCPT TO:`)
+			mailReply := strings.Index(dialogue, `line="250 2.1.0 ok"`)
+			if lastRcpt < 0 || mailReply < 0 {
+				t.Fatalf("the dialogue is missing the envelope:\n%s", dialogue)
+			}
+			if pipelined := lastRcpt < mailReply; pipelined != tt.pipelined {
+				t.Errorf("pipelined %v, want %v:\n%s", pipelined, tt.pipelined, dialogue)
+			}
+		})
+	}
+}
+
+func TestSendChunking(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		extensions []string
+		chunked    bool
+	}{
+		{"BDAT", []string{"8BITMIME", "CHUNKING"}, true},
+		{"DATA", []string{"8BITMIME"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.extensions...)
+
+			// a line starting with a dot has to come through either way
+			msg := testMessage("Hello\n.a line starting with a dot\n.\nend")
+			tr := SMTP{Addr: s.Addr, Insecure: true}
+			if _, err := tr.Send("ann@example.com", []string{"bob@example.com"}, msg); err != nil {
+				t.Fatal(err)
+			}
+
+			got := sent(t, s)
+			if got.Chunked != tt.chunked {
+				t.Errorf("sent with BDAT %v, want %v", got.Chunked, tt.chunked)
+			}
+			if !bytes.Equal(got.Data, msg) {
+				t.Errorf("the server got\n%q\nwant\n%q", got.Data, msg)
+			}
+		})
+	}
+}
+
+func TestSendSize(t *testing.T) {
+
+	msg := testMessage(strings.Repeat("Hello ", 100))
+
+	tests := []struct {
+		name  string
+		limit string
+		ok    bool
+	}{
+		{"within the limit", "SIZE 100000", true},
+		{"over the limit", "SIZE 500", false},
+		{"no limit", "SIZE", true},
+		{"zero", "SIZE 0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, "8BITMIME", tt.limit)
+
+			tr := SMTP{Addr: s.Addr, Insecure: true}
+			_, err := tr.Send("ann@example.com", []string{"bob@example.com"}, msg)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Send() = %v, want ok %v", err, tt.ok)
+			}
+			if err != nil && !strings.Contains(err.Error(), "only takes messages up to") {
+				t.Errorf("Send() = %v, want it to say how big a message the server takes", err)
+			}
+			if n := len(s.Messages()); tt.ok != (n == 1) {
+				t.Errorf("the server took %d messages", n)
+			}
+		})
+	}
+}
+
+func TestSendTo7bit(t *testing.T) {
+
+	const text = "Mostly English, with a word of German: Grüße."
+
+	tests := []struct {
+		name       string
+		extensions []string
+		cte        string
+	}{
+		{"8BITMIME", []string{"8BITMIME"}, "8bit"},
+		{"7bit only", nil, "quoted-printable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.extensions...)
+
+			tr := SMTP{Addr: s.Addr, Insecure: true}
+			if _, err := tr.Send("ann@example.com", []string{"bob@example.com"}, testMessage(text)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := mail.ReadMessage(bytes.NewReader(sent(t, s).Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cte := got.Header.Get("Content-Transfer-Encoding"); cte != tt.cte {
+				t.Errorf("Content-Transfer-Encoding %q, want %q", cte, tt.cte)
+			}
+
+			body := io.Reader(got.Body)
+			if tt.cte == "quoted-printable" {
+				body = quotedprintable.NewReader(body)
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != text+"\r\n" {
+				t.Errorf("the text is %q, want %q", decoded, text)
+			}
+		})
+	}
+}
+
+func TestSendDKIM(t *testing.T) {
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := dkim.New("example.com", "test", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		extensions []string
+	}{
+		{"8bit", []string{"8BITMIME"}},
+		// the signature has to cover the message as re-encoded for the server
+		{"re-encoded as 7bit", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.extensions...)
+
+			tr := SMTP{Addr: s.Addr, Insecure: true, DKIM: signer}
+			if _, err := tr.Send("ann@example.com", []string{"bob@example.com"}, testMessage("Grüße aus Köln")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := verifyDKIM(sent(t, s).Data, pub); err != "" {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// signatureTag finds the b= tag, and not bh=
+var signatureTag = regexp.MustCompile(`[;\s]b=`)
+
+// verifyDKIM checks the ed25519-sha256 signature in front of a message
+// signed with relaxed/relaxed canonicalization, and says what is wrong with it
+func verifyDKIM(msg []byte, pub ed25519.PublicKey) string {
+
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		return "the message has no body"
+	}
+	var fields []string
+	for _, line := range strings.Split(string(msg[:end]), "\r\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	if !strings.HasPrefix(fields[0], "DKIM-Signature:") {
+		return "the message doesn't start with a DKIM-Signature"
+	}
+
+	relaxed := func(field string) string {
+		name, value, _ := strings.Cut(field, ":")
+		return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+	}
+
+	tags := make(map[string]string)
+	_, value, _ := strings.Cut(fields[0], ":")
+	for _, tag := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+	}
+	if tags["a"] != "ed25519-sha256" || tags["c"] != "relaxed/relaxed" || tags["d"] != "example.com" || tags["s"] != "test" {
+		return "unexpected tags in " + fields[0]
+	}
+
+	// trailing empty lines don't count, and every line loses its trailing whitespace
+	lines := strings.Split(string(msg[end+4:]), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.Join(strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' }), " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	bodyHash := sha256.Sum256([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		return "the body hash doesn't match the body the server got"
+	}
+
+	// the signed headers are taken from the bottom up
+	var signed strings.Builder
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i > 0; i-- {
+			if n, _, _ := strings.Cut(fields[i], ":"); !used[i] && strings.EqualFold(strings.TrimSpace(n), name) {
+				used[i] = true
+				signed.WriteString(relaxed(fields[i]) + "\r\n")
+				break
+			}
+		}
+	}
+	// the signature covers its own header too, with b= empty
+	b := signatureTag.FindStringIndex(fields[0])
+	signed.WriteString(relaxed(fields[0][:b[1]]))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return "the signature isn't base64"
+	}
+	hash := sha256.Sum256([]byte(signed.String()))
+	if !ed25519.Verify(pub, hash[:], sig) {
+		return "the signature doesn't verify"
+	}
+
+	return ""
+}
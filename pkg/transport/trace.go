@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// trace logs the dialogue on the connection from now on, at debug level.
+// It goes between the client and its reader and writer, above TLS, so what
+// is logged is what was said rather than what went over the wire. The
+// client swaps them for new ones when it starts TLS, so it needs tracing
+// again after that.
+func trace(c *smtp.Client, log *slog.Logger) {
+	t := &tracer{log: log, r: c.Text.R, w: c.Text.W, closer: c.Text, body: -1}
+	c.Text = textproto.NewConn(t)
+}
+
+// tracer logs every line going through it. Passwords are left out, and so
+// are messages, which only get their size logged.
+type tracer struct {
+	log    *slog.Logger
+	r      io.Reader
+	w      *bufio.Writer
+	closer io.Closer
+
+	in, out []byte // the part of a line read or written so far
+
+	secret bool // the next line we write answers a 334 challenge from AUTH
+	data   bool // we sent DATA and wait to hear whether the message can follow
+	body   int  // the lines of the message written after DATA so far, -1 when it isn't being written
+	skip   int  // the bytes of a BDAT chunk still to be written
+}
+
+func (t *tracer) Read(p []byte) (int, error) {
+
+	n, err := t.r.Read(p)
+	t.in = append(t.in, p[:n]...)
+	for {
+		i := bytes.IndexByte(t.in, '\n')
+		if i < 0 {
+			break
+		}
+		t.received(strings.TrimRight(string(t.in[:i]), "\r"))
+		t.in = t.in[i+1:]
+	}
+
+	return n, err
+}
+
+func (t *tracer) Write(p []byte) (int, error) {
+
+	for rest := p; len(rest) > 0; {
+		// a BDAT chunk is the message as it is, with no lines to look at
+		if t.skip > 0 {
+			n := min(t.skip, len(rest))
+			t.skip -= n
+			rest = rest[n:]
+			continue
+		}
+
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			t.out = append(t.out, rest...)
+			break
+		}
+		t.out = append(t.out, rest[:i]...)
+		t.sent(strings.TrimRight(string(t.out), "\r"))
+		t.out = t.out[:0]
+		rest = rest[i+1:]
+	}
+
+	n, err := t.w.Write(p)
+	if err == nil {
+		err = t.w.Flush()
+	}
+	return n, err
+}
+
+func (t *tracer) Close() error {
+	return t.closer.Close()
+}
+
+// sent logs a line we wrote
+func (t *tracer) sent(line string) {
+
+	if t.body >= 0 {
+		if line != "." {
+			t.body++
+			return
+		}
+		t.log.Debug("sent", "line", fmt.Sprintf("(%d lines of message)", t.body))
+		t.body = -1
+	}
+
+	if t.secret {
+		t.secret = false
+		line = "(password left out)"
+	}
+
+	upper := strings.ToUpper(line)
+	switch {
+	// AUTH PLAIN has the password in it, only the mechanism is kept
+	case strings.HasPrefix(upper, "AUTH "):
+		if fields := strings.Fields(line); len(fields) > 2 {
+			line = fields[0] + " " + fields[1] + " (password left out)"
+		}
+	case upper == "DATA":
+		t.data = true
+	case strings.HasPrefix(upper, "BDAT "):
+		if fields := strings.Fields(line); len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil {
+				t.skip = n
+				line += fmt.Sprintf(" (%d bytes of message)", n)
+			}
+		}
+	}
+
+	t.log.Debug("sent", "line", line)
+}
+
+// received logs a line the server wrote
+func (t *tracer) received(line string) {
+
+	t.log.Debug("received", "line", line)
+
+	if strings.HasPrefix(line, "334 ") {
+		t.secret = true
+	}
+	if t.data {
+		t.data = false
+		if strings.HasPrefix(line, "354") {
+			t.body = 0
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Transport delivers a rendered message to its recipients. Send returns
+// what the server said when it accepted the message, so it can be kept in
+// the sent history.
+type Transport interface {
+	Name() string
+	Send(from string, to []string, msg []byte) (string, error)
+}
+
+// Signer signs a rendered message, e.g. with DKIM
+type Signer interface {
+	Sign(msg []byte) ([]byte, error)
+}
+
+// TLSPolicy is what a policy such as MTA-STS or DANE asks of the connection to a server
+type TLSPolicy interface {
+	RequireTLS() bool       // we mustn't send without TLS
+	TLSConfig() *tls.Config // the TLS settings to connect with
+	String() string         // names the policy, for error messages
+}
+
+// RecipientError is returned when the server refuses one of the recipients,
+// in which case the message isn't sent to any of them
+type RecipientError struct {
+	Addr string // the address as the server got it, with its domain in ASCII
+	Err  error
+}
+
+func (e RecipientError) Error() string {
+	return fmt.Sprintf("%s was refused: %v", e.Addr, e.Err)
+}
+
+func (e RecipientError) Unwrap() error {
+	return e.Err
+}